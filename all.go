@@ -0,0 +1,372 @@
+package sheriff
+
+import (
+	"math"
+	"reflect"
+	"sort"
+)
+
+// MarshalAll marshals data for each of the named option sets and returns the results by name, e.g. to render
+// the same object for different audiences. The results are the same as calling Marshal with every option set,
+// but data is only traversed once: the entries of maps are looked up once for all of them, and the primitive
+// values shared by several results are only boxed once. MarshalAll fails if marshalling fails for any of the
+// option sets.
+//
+// Every option set is marshalled by its own work list, the same way Marshal does; the work lists are only run
+// in lockstep. Structs, slices and maps which an option set reaches in another way than the others (e.g. maps
+// truncated by Options.MaxMapLen) are marshalled for it on its own. So are option sets with
+// Options.Instrumentation, so that the measured time only covers their own call, and option sets with an
+// Options.ErrorPolicy. A CollectedError of one of them fails MarshalAll as well. Option sets with
+// Options.Expand or Options.ReferenceObjects are marshalled on their own too, as the values of their reference
+// fields differ, and so are option sets with Options.DebugMetaKey, Options.CacheKeyer or
+// Options.PreserveMapKeyTypes.
+func MarshalAll(data interface{}, optionSets map[string]*Options) (map[string]interface{}, error) {
+	names := make([]string, 0, len(optionSets))
+	for name := range optionSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dest := make(map[string]interface{}, len(names))
+	w := &multiRun{}
+	defer w.release()
+	for _, name := range names {
+		options := optionSets[name]
+		if options.Instrumentation != nil || options.ErrorPolicy != FailFast || len(options.Expand) > 0 || options.ReferenceObjects || options.DebugMetaKey != "" || options.CacheKeyer != nil || options.PreserveMapKeyTypes {
+			result, err := Marshal(options, data)
+			if err != nil {
+				return nil, err
+			}
+			dest[name] = result
+			continue
+		}
+		w.names = append(w.names, name)
+		w.states = append(w.states, acquireMarshalState(options))
+	}
+	if len(w.states) == 0 {
+		return dest, nil
+	}
+
+	views := make([]int, len(w.states))
+	for i := range views {
+		views[i] = i
+	}
+	results := make([]interface{}, len(w.states))
+	w.shared = new(sharedBox)
+	for _, s := range w.states {
+		s.shared = w.shared
+	}
+	if err := w.root(reflect.ValueOf(data), views, results); err != nil {
+		return nil, err
+	}
+	for i, name := range w.names {
+		dest[name] = results[i]
+	}
+	return dest, nil
+}
+
+// multiRun runs the work lists of several option sets in lockstep, one marshalState per option set. The option
+// sets are called views and are identified by their index within states.
+//
+// Every view marshals the data using its own frames, like Marshal does. The views whose frames are for the same
+// struct, slice or map go through their elements together, so that the entries of maps are only looked up
+// once and the primitive values of an element are only boxed once, see sharedBox.
+type multiRun struct {
+	names  []string
+	states []*marshalState
+	shared *sharedBox
+	// levels are the scratch buffers of the structs, slices and maps being run, indexed by their depth.
+	levels []multiLevel
+	depth  int
+}
+
+// multiLevel holds the scratch buffers of a struct, slice or map run by multiRun.
+type multiLevel struct {
+	// group are the views running their frames for the value together.
+	group []int
+	// positions are the positions of the elements returned by next, i.e. the index of a struct field, slice
+	// element or map entry, indexed by view. It's -1 once the frame of the view is done.
+	positions []int
+	// children and traverse are the elements returned by next, indexed by view.
+	children []reflect.Value
+	traverse []bool
+	// sub are the views marshalling the current element which pushed a frame for it.
+	sub []int
+	// results are the results of the frames of sub, indexed by view.
+	results []interface{}
+	// keys and values are the entries of a map, shared by the frames of group.
+	keys   []reflect.Value
+	values []reflect.Value
+}
+
+func (w *multiRun) release() {
+	for _, s := range w.states {
+		s.release()
+	}
+}
+
+// enter returns the scratch buffers of the next level, which must be released by leave once it's done. As the
+// multiRun is gone once MarshalAll returns, the buffers aren't cleared.
+func (w *multiRun) enter() *multiLevel {
+	if w.depth == len(w.levels) {
+		n := len(w.states)
+		w.levels = append(w.levels, multiLevel{
+			group:     make([]int, 0, n),
+			positions: make([]int, n),
+			children:  make([]reflect.Value, n),
+			traverse:  make([]bool, n),
+			sub:       make([]int, 0, n),
+			results:   make([]interface{}, n),
+		})
+	}
+	l := &w.levels[w.depth]
+	w.depth++
+	return l
+}
+
+func (w *multiRun) leave() {
+	w.depth--
+}
+
+// top returns the topmost frame of view.
+func (w *multiRun) top(view int) *frame {
+	s := w.states[view]
+	return &s.frames[len(s.frames)-1]
+}
+
+// root marshals the data passed to MarshalAll for views like marshalRoot does and stores the result of each
+// view at its index within results.
+func (w *multiRun) root(v reflect.Value, views []int, results []interface{}) error {
+	l := w.enter()
+	defer w.leave()
+
+	sub := l.sub[:0]
+	for _, view := range views {
+		s := w.states[view]
+		var result interface{}
+		var pending bool
+		var err error
+		switch {
+		case isMarshalerRoot(s.options, v):
+			result, pending, err = s.visit(v, false)
+		case !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil():
+			// like marshal
+		default:
+			result, pending, err = s.beginMarshal(reflect.Indirect(v), reflect.Indirect(v).Type())
+		}
+		if err != nil {
+			return err
+		}
+		if pending {
+			sub = append(sub, view)
+			continue
+		}
+		results[view] = result
+	}
+	l.sub = sub
+	return w.run(sub, results)
+}
+
+// run runs the frames which views just pushed for the same element until they're done, and stores the result
+// of each view at its index within results. Views whose frames can't be run together with the first one's
+// run them on their own.
+func (w *multiRun) run(views []int, results []interface{}) error {
+	if len(views) == 0 {
+		return nil
+	}
+	l := w.enter()
+	defer w.leave()
+
+	first := w.top(views[0])
+	group := l.group[:0]
+	for _, view := range views {
+		s := w.states[view]
+		if f := w.top(view); !sameFrame(first, f) {
+			result, err := s.run(len(s.frames) - 1)
+			if err != nil {
+				return err
+			}
+			results[view] = result
+			continue
+		}
+		group = append(group, view)
+	}
+	l.group = group
+	if len(group) == 0 {
+		return nil
+	}
+
+	if first.kind == mapFrame {
+		// the frames go through the same entries instead of iterating over the map each
+		keys, values := l.keys[:0], l.values[:0]
+		iter := first.v.MapRange()
+		for iter.Next() {
+			keys = append(keys, iter.Key())
+			values = append(values, iter.Value())
+		}
+		l.keys, l.values = keys, values
+		for _, view := range group {
+			f := w.top(view)
+			f.keys = keys
+			f.values = values
+		}
+	}
+	for _, view := range group {
+		if err := w.next(l, view, results); err != nil {
+			return err
+		}
+	}
+
+	for {
+		// the views whose next element is the lowest one go on together
+		position := -1
+		for _, view := range group {
+			if p := l.positions[view]; p >= 0 && (position < 0 || p < position) {
+				position = p
+			}
+		}
+		if position < 0 {
+			return nil
+		}
+
+		w.shared.reset()
+		sub := l.sub[:0]
+		for _, view := range group {
+			if l.positions[view] != position {
+				continue
+			}
+			result, pending, err := w.states[view].visit(l.children[view], l.traverse[view])
+			if err != nil {
+				return err
+			}
+			if pending {
+				sub = append(sub, view)
+				continue
+			}
+			if err := w.assign(l, view, result, results); err != nil {
+				return err
+			}
+		}
+		l.sub = sub
+		if err := w.run(sub, l.results); err != nil {
+			return err
+		}
+		for _, view := range sub {
+			if err := w.assign(l, view, l.results[view], results); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sameFrame reports whether the frames f and g are for the same value, so that their elements can be run together.
+// Truncated maps aren't, as their entries depend on the options.
+func sameFrame(f, g *frame) bool {
+	if f.kind != g.kind || f.v.Type() != g.v.Type() {
+		return false
+	}
+	switch f.kind {
+	case sliceFrame:
+		return f.v.Pointer() == g.v.Pointer() && f.v.Len() == g.v.Len()
+	case mapFrame:
+		return f.v.Pointer() == g.v.Pointer() && f.keys == nil && g.keys == nil
+	}
+	return true
+}
+
+// assign stores the result of the current element of the topmost frame of view and moves on to the next one.
+func (w *multiRun) assign(l *multiLevel, view int, result interface{}, results []interface{}) error {
+	if err := w.states[view].assign(w.top(view), result); err != nil {
+		return err
+	}
+	return w.next(l, view, results)
+}
+
+// next sets up the next element of the topmost frame of view. If there is none left, the frame is finished and
+// its result is stored at the index of view within results.
+func (w *multiRun) next(l *multiLevel, view int, results []interface{}) error {
+	s := w.states[view]
+	f := w.top(view)
+	child, traverse, ok, err := s.next(f)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.positions[view] = -1
+		results[view], err = s.finish(f)
+		return err
+	}
+	l.children[view] = child
+	l.traverse[view] = traverse
+	if f.kind == sliceFrame {
+		l.positions[view] = f.index
+	} else {
+		// next has moved past the field or entry already
+		l.positions[view] = f.index - 1
+	}
+	return nil
+}
+
+// sharedBox holds the primitive value boxed for the element currently being marshalled by MarshalAll, so that
+// the other views reuse it instead of boxing the same value again. It also holds the typeInfo and the fields
+// of the last types looked up, which the views running together look up one after the other.
+type sharedBox struct {
+	v      reflect.Value
+	boxed  interface{}
+	t      reflect.Type
+	info   typeInfo
+	st     reflect.Type
+	fields []fieldInfo
+}
+
+// reset forgets the boxed value once MarshalAll moves on to the next element.
+func (b *sharedBox) reset() {
+	b.v = reflect.Value{}
+	b.boxed = nil
+}
+
+// box returns the primitive v as an interface{} like primitiveInterface does, reusing the boxed value if it's
+// the same one.
+func (b *sharedBox) box(v reflect.Value) interface{} {
+	if b.boxed != nil && b.v.Type() == v.Type() && samePrimitive(b.v, v) {
+		return b.boxed
+	}
+	b.v = v
+	b.boxed = primitiveInterface(v)
+	return b.boxed
+}
+
+// typeInfoOf returns typeInfoOf(t), reusing the last one looked up if it's for the same type.
+func (b *sharedBox) typeInfoOf(t reflect.Type) typeInfo {
+	if t != b.t {
+		b.t = t
+		b.info = typeInfoOf(t)
+	}
+	return b.info
+}
+
+// fieldInfosOf returns fieldInfosOf(t), reusing the last ones looked up if they're for the same struct type.
+func (b *sharedBox) fieldInfosOf(t reflect.Type) []fieldInfo {
+	if t != b.st {
+		b.st = t
+		b.fields = fieldInfosOf(t)
+	}
+	return b.fields
+}
+
+// samePrimitive reports whether the primitive values v and w of the same type are identical.
+func samePrimitive(v, w reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool() == w.Bool()
+	case reflect.String:
+		return v.String() == w.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == w.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == w.Uint()
+	case reflect.Float32, reflect.Float64:
+		return math.Float64bits(v.Float()) == math.Float64bits(w.Float())
+	}
+	return false
+}
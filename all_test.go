@@ -0,0 +1,174 @@
+package sheriff
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type AllAudit struct {
+	CreatedBy string `json:"created_by" groups:"admin"`
+	Note      string `json:"note,omitempty" groups:"staff,admin"`
+}
+
+type AllAddress struct {
+	City   string  `json:"city" groups:"public,staff,admin"`
+	Street string  `json:"street" groups:"staff,admin"`
+	Geo    *AllGeo `json:"geo,omitempty" groups:"admin"`
+}
+
+type AllGeo struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type AllModel struct {
+	AllAudit `groups:"admin"`
+
+	ID        int                    `json:"id"`
+	Name      string                 `json:"name" groups:"public,staff,admin"`
+	Email     string                 `json:"email,omitempty" groups:"staff,admin"`
+	Bio       string                 `json:"bio" groups:"public,admin" sheriff:"maxlen=8"`
+	Salary    int                    `json:"salary" groups:"admin"`
+	Tags      []string               `json:"tags" groups:"public,staff"`
+	Addresses []AllAddress           `json:"addresses" groups:"staff,admin"`
+	Primary   *AllAddress            `json:"primary" groups:"public,admin"`
+	Manager   *AllModel              `json:"manager,omitempty" groups:"staff,admin"`
+	Scores    map[int]float32        `json:"scores" groups:"admin"`
+	Attrs     map[string]interface{} `json:"attrs" groups:"public,staff,admin"`
+	Extra     interface{}            `json:"extra"`
+	Joined    time.Time              `json:"joined" groups:"public,admin"`
+	IP        net.IP                 `json:"ip" groups:"admin"`
+	Marshal   IsMarshaller           `json:"marshal"`
+	Traversed time.Time              `json:"traversed" groups:"admin" sheriff:"traverse"`
+	Untagged  string
+	Nothing   *AllAddress `json:"nothing"`
+	hidden    string
+}
+
+func allData() AllModel {
+	return AllModel{
+		AllAudit: AllAudit{CreatedBy: "root", Note: "imported"},
+		ID:       1,
+		Name:     "alice",
+		Email:    "alice@example.org",
+		Bio:      strings.Repeat("bio ", 20),
+		Salary:   100,
+		Tags:     []string{"a", "b", "c", "d"},
+		Addresses: []AllAddress{
+			{City: "Berlin", Street: "Main St", Geo: &AllGeo{Lat: 52.5, Lng: 13.4}},
+			{City: "Paris", Street: "Rue"},
+		},
+		Primary: &AllAddress{City: "Berlin", Street: "Main St"},
+		Manager: &AllModel{ID: 2, Name: "bob", Tags: []string{"x"}, Primary: &AllAddress{City: "Rome"}},
+		Scores:  map[int]float32{1: 0.5, 2: 1.5, 3: 2.5},
+		Attrs: map[string]interface{}{
+			"plan":    "pro",
+			"limits":  map[string]interface{}{"seats": 5, "secret": "x"},
+			"history": []interface{}{1, "two", AllGeo{Lat: 1}},
+			"empty":   map[string]int{},
+		},
+		Extra:     &AllGeo{Lat: 3},
+		Joined:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		IP:        net.IPv4(10, 0, 0, 1),
+		Marshal:   IsMarshaller{ShouldMarshal: "yes"},
+		Traversed: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Untagged:  "untagged",
+		hidden:    "hidden",
+	}
+}
+
+func allOptionSets() map[string]*Options {
+	return map[string]*Options{
+		"none":   {},
+		"public": {Groups: []string{"public"}, MaxSliceLen: 2, TruncateOverflow: true, OverflowKey: "…"},
+		"staff": {
+			Groups:           []string{"staff", "test"},
+			MapKeyFilter:     func(path string, key string) bool { return key != "secret" },
+			UntaggedKeyStyle: LowerFirstKeyStyle,
+			MaxRenderDepth:   2,
+		},
+		"admin": {
+			Groups:             []string{"admin"},
+			MaxStringLen:       4,
+			ExcludedAsNull:     true,
+			ErrOnDuplicateKeys: true,
+			MaxMapLen:          2,
+			TruncateOverflow:   true,
+			OverflowKey:        "…",
+		},
+		"everyone": {
+			Groups:             []string{"public", "staff", "admin", "test"},
+			OmitEmptyGroups:    []string{"none"},
+			TraverseMarshalers: true,
+			OmitEmptyNested:    true,
+		},
+		"depth": {Groups: []string{"public", "staff"}, MaxRenderDepth: 2, DepthOverflowField: "city"},
+	}
+}
+
+func TestMarshalAll(t *testing.T) {
+	for _, data := range []interface{}{
+		allData(),
+		&[]AllModel{allData(), {ID: 3}},
+		map[string]AllModel{"a": allData()},
+		nil,
+		(*AllModel)(nil),
+		42,
+		IsMarshaller{ShouldMarshal: "root"},
+		time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	} {
+		optionSets := allOptionSets()
+
+		all, err := MarshalAll(data, optionSets)
+		assert.NoError(t, err)
+		assert.Len(t, all, len(optionSets))
+		for name, options := range optionSets {
+			expected, err := Marshal(options, data)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, all[name], "%s of %T", name, data)
+		}
+	}
+}
+
+func TestMarshalAll_Callbacks(t *testing.T) {
+	var excluded []string
+	instrumentation := &recordingInstrumentation{}
+	optionSets := map[string]*Options{
+		"public": {
+			Groups:     []string{"public"},
+			OnExcluded: func(path string, field reflect.StructField, groups []string) { excluded = append(excluded, path) },
+		},
+		"admin": {Groups: []string{"admin"}, Instrumentation: instrumentation},
+	}
+
+	all, err := MarshalAll(allData(), optionSets)
+	assert.NoError(t, err)
+	assert.Contains(t, excluded, "addresses")
+	assert.Contains(t, excluded, "AllAudit.created_by")
+	// instrumented option sets are marshalled on their own
+	assert.Equal(t, reflect.TypeOf(AllModel{}), instrumentation.begun[0])
+	assert.Equal(t, 100, all["admin"].(map[string]interface{})["salary"])
+	assert.NotContains(t, all["public"], "salary")
+}
+
+func TestMarshalAll_Error(t *testing.T) {
+	data := map[string]interface{}{"values": make([]int, 5)}
+
+	_, err := MarshalAll(data, map[string]*Options{
+		"limited":   {MaxSliceLen: 2},
+		"unlimited": {},
+	})
+	assert.Equal(t, LengthError{Kind: reflect.Slice, Len: 5, Max: 2, Path: "values"}, err)
+
+	_, err = MarshalAll(DeferFailingModel{}, map[string]*Options{"a": {}, "b": {}})
+	assert.Equal(t, errDeferFailing, err)
+
+	all, err := MarshalAll(data, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+}
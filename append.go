@@ -0,0 +1,640 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// MarshalAppend appends the JSON encoding of data filtered by the given options to dst and returns the
+// extended buffer, like strconv.AppendInt does. The output is the same as json.Marshal of Marshal's result
+// (and therefore the same as the MarshalJSON method of Defer's result), including the sorted keys and the
+// HTML escaping of strings. If an error occurs, dst is returned with its original length.
+//
+// Structs, slices, string-keyed maps and primitives are encoded as they are visited, without building the
+// intermediate value returned by Marshal. Structs, slices and primitives are encoded without allocations if dst has
+// enough capacity, so reusing the returned buffer across calls makes the encoding allocation-free; maps allocate
+// for their entries. Every other value (e.g. types implementing json.Marshaler or Marshaller, and structs with
+// anonymous fields) is marshalled first and its result encoded, values left to encoding/json allocating as usual.
+// Types implementing encoding.TextAppender but not json.Marshaler are appended without going through
+// encoding/json. If one of the options only known to apply once values are marshalled is set (e.g.
+// Options.MaxSliceLen or Options.OmitEmptyNested), the whole document is marshalled first.
+func MarshalAppend(dst []byte, options *Options, data interface{}) ([]byte, error) {
+	s := acquireMarshalState(options)
+	defer s.release()
+	return s.marshalAppend(dst, data)
+}
+
+// marshalAppend is the implementation of MarshalAppend.
+func (s *marshalState) marshalAppend(dst []byte, data interface{}) ([]byte, error) {
+	v := reflect.ValueOf(data)
+	// the output written to a sink isn't kept
+	if s.sink == nil {
+		kind := cachedJSON
+		if s.canonical {
+			kind = cachedCanonicalJSON
+		}
+		if k, ok := s.outputCacheKey(v, kind); ok {
+			cache := s.options.outputCache()
+			if b, ok := cache.get(k); ok {
+				return append(dst, b.([]byte)...), nil
+			}
+			out, err := s.marshalAppendUncached(dst, v)
+			if err == nil {
+				cache.add(k, slices.Clone(out[len(dst):]))
+			}
+			return out, err
+		}
+	}
+	return s.marshalAppendUncached(dst, v)
+}
+
+// marshalAppendUncached is marshalAppend without Options.CacheKeyer.
+func (s *marshalState) marshalAppendUncached(dst []byte, v reflect.Value) ([]byte, error) {
+	if s.options.Instrumentation == nil {
+		return s.appendRoot(dst, v)
+	}
+	var out []byte
+	err := s.instrument(v, func() (err error) {
+		out, err = s.appendRoot(dst, v)
+		return err
+	})
+	if err != nil {
+		return dst, err
+	}
+	return out, nil
+}
+
+// appendRoot appends the JSON encoding of the data v, encoding it directly if appendsDirectly allows to.
+func (s *marshalState) appendRoot(dst []byte, v reflect.Value) ([]byte, error) {
+	if !s.appendsDirectly() {
+		intermediate, err := s.marshalRoot(v)
+		// the partial result is encoded if values failed to marshal with CollectAll
+		if _, ok := err.(*CollectedError); err != nil && !ok {
+			return dst, err
+		}
+		out, appendErr := s.appendJSON(dst, intermediate)
+		if appendErr != nil {
+			return dst, appendErr
+		}
+		return out, err
+	}
+
+	var out []byte
+	var err error
+	if isMarshalerRoot(s.options, v) {
+		out, err = s.appendValue(dst, v, false)
+	} else {
+		out, err = s.appendData(dst, v)
+	}
+	if err != nil {
+		return dst, err
+	}
+	return out, nil
+}
+
+// appendsDirectly reports whether the data can be encoded without building the intermediate value first.
+// Limiting the render depth may omit keys and limiting lengths may add keys, whether a value fails (and is
+// therefore omitted) with an ErrorPolicy, whether a nested object is empty with OmitEmptyNested, whether a value
+// is null with KeyTag "toml" and duplicate keys are only known once the values are marshalled. The debug metadata
+// is only added if the top level turns out to be an object, and cached results are intermediate ones.
+func (s *marshalState) appendsDirectly() bool {
+	options := s.options
+	return options.MaxRenderDepth == 0 && options.MaxSliceLen == 0 && options.MaxMapLen == 0 &&
+		options.ErrorPolicy == FailFast && !options.OmitEmptyNested && !options.omitsNil() &&
+		!options.ErrOnDuplicateKeys && options.DebugMetaKey == "" && options.CacheKeyer == nil && s.done == nil
+}
+
+// appendData is the direct counterpart of marshal.
+func (s *marshalState) appendData(dst []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(dst, "null"...), nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return append(dst, "null"...), nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return s.appendValue(dst, v, false)
+	}
+	return s.appendStruct(dst, v)
+}
+
+// appendValue is the direct counterpart of marshalValue. Structs, slices, string-keyed maps and primitives are
+// appended as they are visited, every other value (e.g. types implementing one of the marshaler interfaces) is
+// marshalled and its result appended using appendJSON.
+func (s *marshalState) appendValue(dst []byte, v reflect.Value, traverse bool) ([]byte, error) {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		// structs held by interfaces get their type field from visit
+		if e := reflect.Indirect(v.Elem()); s.options.TypeField != "" && e.Kind() == reflect.Struct {
+			return s.appendFallback(dst, v, traverse)
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return append(dst, "null"...), nil
+	}
+	if err := s.checkDepth(); err != nil {
+		return dst, err
+	}
+
+	info := typeInfoOf(v.Type())
+	if info.pointer == 0 && isPrimitiveKind(v.Kind()) && v.Type() != numberType {
+		return s.appendPrimitive(dst, v)
+	}
+	if info.pointer != 0 || info.sync != notSync || isRaw(v.Type()) {
+		return s.appendFallback(dst, v, traverse)
+	}
+
+	// other values held by pointers (e.g. *string) are left to visit, which handles them differently
+	e := v
+	if e.Kind() == reflect.Ptr {
+		e = e.Elem()
+	}
+	switch e.Kind() {
+	case reflect.Struct:
+		return s.appendStruct(dst, e)
+	case reflect.Slice:
+		if e.IsNil() {
+			return append(dst, "null"...), nil
+		}
+		dst = append(dst, '[')
+		for i := 0; i < e.Len(); i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			s.pushIndex(i)
+			var err error
+			dst, err = s.appendValue(dst, e.Index(i), traverse)
+			s.pop()
+			if err != nil {
+				return dst, err
+			}
+			if dst, err = s.flush(dst); err != nil {
+				return dst, err
+			}
+		}
+		return append(dst, ']'), nil
+	case reflect.Map:
+		if e.IsNil() {
+			return append(dst, "null"...), nil
+		}
+		if e.Type().Key().Kind() == reflect.String {
+			return s.appendMap(dst, e, traverse)
+		}
+	}
+	return s.appendFallback(dst, v, traverse)
+}
+
+// appendFallback appends the result of marshalValue for v.
+func (s *marshalState) appendFallback(dst []byte, v reflect.Value, traverse bool) ([]byte, error) {
+	intermediate, err := s.marshalValue(v, traverse)
+	if err != nil {
+		return dst, err
+	}
+	return s.appendJSON(dst, intermediate)
+}
+
+// appendPrimitive appends the bool, number or string v, whose type implements none of the interfaces looked for,
+// the same way appendJSON appends the result of visit.
+func (s *marshalState) appendPrimitive(dst []byte, v reflect.Value) ([]byte, error) {
+	options := s.options
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.AppendBool(dst, v.Bool()), nil
+	case reflect.String:
+		if s.maxStringLen > 0 {
+			return s.appendString(dst, truncateString(v.String(), s.maxStringLen)), nil
+		}
+		return s.appendString(dst, v.String()), nil
+	case reflect.Float32, reflect.Float64:
+		if options.FloatPrecision > 0 {
+			if n, ok := roundFloat(v.Float(), v.Type().Bits(), options.FloatPrecision); ok {
+				return s.appendJSON(dst, n)
+			}
+		}
+		if f := v.Float(); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return s.appendFloat(dst, f, v.Type().Bits()), nil
+		}
+		// encoding/json reports the unsupported value
+		return s.appendJSON(dst, v.Interface())
+	case reflect.Uintptr:
+		if !options.AllowUintptr {
+			return append(dst, "null"...), nil
+		}
+	}
+	if options.Int64AsString && isInt64(v.Type()) {
+		return s.appendString(dst, int64String(v)), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(dst, v.Int(), 10), nil
+	}
+	return strconv.AppendUint(dst, v.Uint(), 10), nil
+}
+
+// appendStruct appends the struct v with its fields sorted by their keys. Structs whose fields don't map to
+// keys one to one (i.e. with anonymous or inline fields, or implementing ComputedFields) are marshalled first.
+func (s *marshalState) appendStruct(dst []byte, v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	if hasEmbeddedField(t) || typeInfoOf(t).pointer&implComputedFields != 0 || structInfoOf(t).inline {
+		intermediate, err := s.marshal(v)
+		if err != nil {
+			return dst, err
+		}
+		return s.appendJSON(dst, intermediate)
+	}
+
+	// the fields of nested structs are stacked on top of the ones of v within the same buffer
+	start := len(s.appendFields)
+	defer func() {
+		// the pooled state mustn't keep the values alive
+		clear(s.appendFields[start:])
+		s.appendFields = s.appendFields[:start]
+	}()
+	for i := 0; ; {
+		s.appendFields = append(s.appendFields, structField{})
+		ok, err := s.nextField(t, v, &i, &s.appendFields[len(s.appendFields)-1])
+		if err != nil {
+			return dst, err
+		}
+		if !ok {
+			s.appendFields = s.appendFields[:len(s.appendFields)-1]
+			break
+		}
+	}
+	fields := s.appendFields[start:]
+	if s.canonical {
+		slices.SortStableFunc(fields, func(a, b structField) int { return compareUTF16(a.name, b.name) })
+	} else {
+		slices.SortStableFunc(fields, func(a, b structField) int { return strings.Compare(a.name, b.name) })
+	}
+
+	maxStringLen := s.maxStringLen
+	dst = append(dst, '{')
+	first := true
+	for i := start; i < start+len(fields); i++ {
+		// a later field with the same key replaces the earlier one, like in the result of Marshal
+		if i+1 < start+len(fields) && s.appendFields[i+1].name == s.appendFields[i].name {
+			continue
+		}
+		f := s.appendFields[i]
+		if !first {
+			dst = append(dst, ',')
+		}
+		first = false
+		dst = s.appendString(dst, f.name)
+		dst = append(dst, ':')
+		if f.excluded {
+			dst = append(dst, "null"...)
+			continue
+		}
+
+		s.maxStringLen = f.maxStringLen
+		s.pushStructField(&f, t)
+		var err error
+		dst, err = s.appendValue(dst, f.value, f.sheriffOpts.Contains("traverse"))
+		s.pop()
+		s.maxStringLen = maxStringLen
+		if err != nil {
+			return dst, err
+		}
+		if dst, err = s.flush(dst); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// mapEntry is an entry of a map being appended, see appendMap.
+type mapEntry struct {
+	key   string
+	value reflect.Value
+}
+
+// appendMap appends the non-nil map v with string keys, with its entries sorted by their keys.
+func (s *marshalState) appendMap(dst []byte, v reflect.Value, traverse bool) ([]byte, error) {
+	if v.Len() == 0 {
+		return append(dst, "{}"...), nil
+	}
+
+	// the entries of nested maps are stacked on top of the ones of v within the same buffer
+	start := len(s.appendEntries)
+	defer func() {
+		// the pooled state mustn't keep the values alive
+		clear(s.appendEntries[start:])
+		s.appendEntries = s.appendEntries[:start]
+	}()
+	// unlike v.MapKeys(), iterating using a single key value doesn't copy every key
+	key := reflect.New(v.Type().Key()).Elem()
+	iter := v.MapRange()
+	for iter.Next() {
+		key.SetIterKey(iter)
+		keyString := key.String()
+		if s.options.MapKeyFilter != nil && !s.options.MapKeyFilter(s.currentPath(), keyString) {
+			continue
+		}
+		if s.isKeyOmitted(keyString) {
+			continue
+		}
+		s.appendEntries = append(s.appendEntries, mapEntry{key: keyString, value: iter.Value()})
+	}
+	entries := s.appendEntries[start:]
+	if s.canonical {
+		slices.SortFunc(entries, func(a, b mapEntry) int { return compareUTF16(a.key, b.key) })
+	} else {
+		slices.SortFunc(entries, func(a, b mapEntry) int { return strings.Compare(a.key, b.key) })
+	}
+
+	dst = append(dst, '{')
+	for i := start; i < start+len(entries); i++ {
+		if i > start {
+			dst = append(dst, ',')
+		}
+		entry := s.appendEntries[i]
+		dst = s.appendString(dst, entry.key)
+		dst = append(dst, ':')
+		s.pushKey(entry.key)
+		var err error
+		dst, err = s.appendValue(dst, entry.value, traverse)
+		s.pop()
+		if err != nil {
+			return dst, err
+		}
+		if dst, err = s.flush(dst); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// appendJSON appends the JSON encoding of the intermediate value v to dst the same way encoding/json does,
+// or following the rules documented at MarshalCanonical if s.canonical is set.
+func (s *marshalState) appendJSON(dst []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case map[string]interface{}:
+		return s.appendObject(dst, v)
+	case map[interface{}]interface{}:
+		return dst, ErrPreservedMapKeys
+	case []interface{}:
+		dst = append(dst, '[')
+		for i, elem := range v {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			if dst, err = s.appendJSON(dst, elem); err != nil {
+				return dst, err
+			}
+			if dst, err = s.flush(dst); err != nil {
+				return dst, err
+			}
+		}
+		return append(dst, ']'), nil
+	case string:
+		return s.appendString(dst, v), nil
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(dst, v, 10), nil
+	case uint:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(dst, v, 10), nil
+	case float64:
+		if !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return s.appendFloat(dst, v, 64), nil
+		}
+	case json.Number:
+		if s.canonical {
+			return appendCanonicalNumber(dst, v)
+		}
+	}
+
+	// other primitives (e.g. int32 or named string types) are encoded by their kind, unless encoding/json
+	// would call one of their methods or treats them specially like json.Number
+	rv := reflect.ValueOf(v)
+	if isPrimitiveKind(rv.Kind()) && rv.Type() != numberType && typeInfoOf(rv.Type()).value&(implJSONMarshaler|implTextMarshaler) == 0 {
+		switch rv.Kind() {
+		case reflect.Bool:
+			return strconv.AppendBool(dst, rv.Bool()), nil
+		case reflect.String:
+			return s.appendString(dst, rv.String()), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.AppendInt(dst, rv.Int(), 10), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return strconv.AppendUint(dst, rv.Uint(), 10), nil
+		case reflect.Float32, reflect.Float64:
+			if f := rv.Float(); !math.IsInf(f, 0) && !math.IsNaN(f) {
+				return s.appendFloat(dst, f, rv.Type().Bits()), nil
+			}
+		}
+	}
+
+	// AppendText is preferred over MarshalText, as it writes into a reused buffer
+	if info := typeInfoOf(rv.Type()); info.value&implTextAppender != 0 && info.value&implJSONMarshaler == 0 && !(rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return s.appendText(dst, v.(textAppender))
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	if s.canonical {
+		return s.appendCanonicalJSON(dst, b)
+	}
+	return append(dst, b...), nil
+}
+
+// appendText appends the text appended by a as a JSON string.
+func (s *marshalState) appendText(dst []byte, a textAppender) ([]byte, error) {
+	text, err := a.AppendText(s.textBuf[:0])
+	if err != nil {
+		return dst, err
+	}
+	s.textBuf = text
+	if len(text) == 0 {
+		return append(dst, `""`...), nil
+	}
+	// text isn't modified while it's appended, so it doesn't have to be copied into a string
+	return s.appendString(dst, unsafe.String(&text[0], len(text))), nil
+}
+
+// appendObject appends the JSON object m with its keys sorted.
+func (s *marshalState) appendObject(dst []byte, m map[string]interface{}) ([]byte, error) {
+	// the keys of nested objects are stacked on top of the ones of m within the same buffer
+	start := len(s.jsonKeys)
+	for key := range m {
+		s.jsonKeys = append(s.jsonKeys, key)
+	}
+	defer func() {
+		// the pooled state mustn't keep the keys alive
+		clear(s.jsonKeys[start:])
+		s.jsonKeys = s.jsonKeys[:start]
+	}()
+	if s.canonical {
+		slices.SortFunc(s.jsonKeys[start:], compareUTF16)
+	} else {
+		slices.Sort(s.jsonKeys[start:])
+	}
+
+	dst = append(dst, '{')
+	for i := start; i < start+len(m); i++ {
+		if i > start {
+			dst = append(dst, ',')
+		}
+		key := s.jsonKeys[i]
+		dst = s.appendString(dst, key)
+		dst = append(dst, ':')
+		var err error
+		if dst, err = s.appendJSON(dst, m[key]); err != nil {
+			return dst, err
+		}
+		if dst, err = s.flush(dst); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, '}'), nil
+}
+
+// flushSize is the size from which on the encoded output is written to marshalState.sink.
+const flushSize = 4096
+
+// flush writes dst to s.sink if it's set and dst has grown to flushSize, and returns the emptied buffer.
+func (s *marshalState) flush(dst []byte) ([]byte, error) {
+	if s.sink == nil || len(dst) < flushSize {
+		return dst, nil
+	}
+	if _, err := s.sink.Write(dst); err != nil {
+		return dst, err
+	}
+	return dst[:0], nil
+}
+
+// appendFloat appends f like encoding/json does, except for negative zero being written as 0 if s.canonical is set.
+func (s *marshalState) appendFloat(dst []byte, f float64, bits int) []byte {
+	if s.canonical && f == 0 {
+		return append(dst, '0')
+	}
+	return appendFloat(dst, f, bits)
+}
+
+// appendFloat appends f like encoding/json does.
+func appendFloat(dst []byte, f float64, bits int) []byte {
+	// Copied from encode.go in the official json package
+
+	// Convert as if by ES6 number to string conversion.
+	// This matches most other JSON generators.
+	// See golang.org/issue/6384 and golang.org/issue/14135.
+	// Like fmt %g, but the exponent cutoffs are different
+	// and exponents themselves are not padded to two digits.
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+var numberType = reflect.TypeOf(json.Number(""))
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends the quoted string src like encoding/json does, or like appendCanonicalString does
+// if s.canonical is set.
+func (s *marshalState) appendString(dst []byte, src string) []byte {
+	if s.canonical {
+		return appendCanonicalString(dst, src)
+	}
+	return appendString(dst, src)
+}
+
+// appendString appends the quoted string src like encoding/json does, including the HTML escaping.
+func appendString(dst []byte, src string) []byte {
+	// Copied from encode.go in the official json package
+
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(src); {
+		if b := src[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, src[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				// This encodes bytes < 0x20 except for \b, \f, \n, \r and \t,
+				// as well as <, > and &.
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		n := len(src) - i
+		if n > utf8.UTFMax {
+			n = utf8.UTFMax
+		}
+		c, size := utf8.DecodeRuneInString(src[i : i+n])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, src[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 is LINE SEPARATOR.
+		// U+2029 is PARAGRAPH SEPARATOR.
+		// They are both technically valid characters in JSON strings,
+		// but don't work in JSONP, which has to be evaluated as JavaScript,
+		// and can lead to security holes there. It is valid JSON to
+		// escape them, so we do so unconditionally.
+		// See https://en.wikipedia.org/wiki/JSON#Safety.
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, src[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, src[start:]...)
+	dst = append(dst, '"')
+	return dst
+}
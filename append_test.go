@@ -0,0 +1,195 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type AppendStatus string
+
+type AppendModel struct {
+	Text     string                 `json:"text" groups:"api"`
+	Status   AppendStatus           `json:"status" groups:"api"`
+	Small    int8                   `json:"small" groups:"api"`
+	Float    float64                `json:"float" groups:"api"`
+	Float32  float32                `json:"float32" groups:"api"`
+	Floats   []float64              `json:"floats" groups:"api"`
+	Bytes    []byte                 `json:"bytes" groups:"api"`
+	Time     time.Time              `json:"time" groups:"api"`
+	Extra    map[string]interface{} `json:"extra" groups:"api"`
+	IntMap   map[int]string         `json:"int_map" groups:"api"`
+	Nested   *AppendModel           `json:"nested" groups:"api"`
+	Secret   string                 `json:"secret" groups:"admin"`
+	Untagged bool
+}
+
+type AppendTree struct {
+	Name     string        `json:"name" groups:"api"`
+	Status   AppendStatus  `json:"status,omitempty" groups:"api"`
+	Weight   float64       `json:"weight"`
+	Secret   string        `json:"secret" groups:"admin"`
+	Children []*AppendTree `json:"children" groups:"api"`
+}
+
+// AppendDuplicates has two fields with the key `name` with LowerAllKeyStyle.
+type AppendDuplicates struct {
+	Name  string
+	Other string `json:"name"`
+}
+
+func TestMarshalAppend(t *testing.T) {
+	hackCreationTime, err := time.Parse(time.RFC3339, "2017-01-20T18:11:00Z")
+	assert.NoError(t, err)
+
+	values := map[string]interface{}{
+		"model": AppendModel{
+			Text:    "<a href=\"x\">&</a>\n\t\b\f\x01    \xff ünïcode",
+			Status:  "active",
+			Small:   -3,
+			Float:   1e21,
+			Float32: 1e-7,
+			Floats:  []float64{0, 0.1, -1e-7, 123456789, 1e20},
+			Bytes:   []byte("bytes"),
+			Time:    hackCreationTime,
+			Extra:   map[string]interface{}{"b": 1, "a": []interface{}{"x", nil, true}, "c": json.Number("1.50")},
+			IntMap:  map[int]string{2: "two", 10: "ten"},
+			Nested:  &AppendModel{Text: "nested"},
+			Secret:  "secret",
+		},
+		"recursive": &TestRecursiveModel{SomeData: "SomeData", IsMarshaller: IsMarshaller{"test"}},
+		"parent inherit": UserInfo{
+			UserPrivateInfo: UserPrivateInfo{Age: "20"},
+			UserPublicInfo:  UserPublicInfo{ID: "F94", Email: "hello@hello.com"},
+		},
+		"inet":  TestInet{IPv4: net.ParseIP("0.0.0.0").To4(), IPv6: net.ParseIP("::").To16()},
+		"slice": []AModel{{true, false}, {false, true}},
+		"nil":   nil,
+		"int":   42,
+	}
+
+	for name, value := range values {
+		for _, groups := range [][]string{nil, {"api"}, {"test"}, {"private"}} {
+			options := &Options{Groups: groups}
+			expected, err := Defer(options, value).MarshalJSON()
+			assert.NoError(t, err)
+
+			actual, err := MarshalAppend(nil, options, value)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual), "%s %v", name, groups)
+		}
+	}
+}
+
+func TestMarshalAppend_Growth(t *testing.T) {
+	options := &Options{Groups: []string{"api"}}
+	value := AppendModel{Text: "text", Extra: map[string]interface{}{"key": "value"}}
+	expected, err := Defer(options, value).MarshalJSON()
+	assert.NoError(t, err)
+
+	// a buffer without enough capacity grows while keeping what's in it
+	small := make([]byte, 0, 4)
+	small = append(small, "[1,"...)
+	actual, err := MarshalAppend(small, options, value)
+	assert.NoError(t, err)
+	assert.Equal(t, "[1,"+string(expected), string(actual))
+	assert.Greater(t, cap(actual), 4)
+
+	// a reused buffer is appended to in place
+	buf := make([]byte, 0, 1024)
+	actual, err = MarshalAppend(buf, options, value)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+	assert.Equal(t, &buf[:1][0], &actual[0])
+
+	actual, err = MarshalAppend(actual, options, value)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected)+string(expected), string(actual))
+}
+
+func TestMarshalAppend_Error(t *testing.T) {
+	dst := []byte("prefix")
+
+	actual, err := MarshalAppend(dst, &Options{}, DeferFailingModel{})
+	assert.Equal(t, errDeferFailing, err)
+	assert.Equal(t, "prefix", string(actual))
+
+	actual, err = MarshalAppend(dst, &Options{Groups: []string{"api"}}, AppendModel{Float: math.NaN()})
+	_, expectedErr := json.Marshal(math.NaN())
+	assert.Equal(t, expectedErr.Error(), err.Error())
+	assert.Equal(t, "prefix", string(actual))
+}
+
+func TestMarshalAppend_NoAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops states at random with the race detector")
+	}
+	options := &Options{Groups: []string{"api"}}
+	for _, value := range []interface{}{
+		&FlatBenchmarkModel{AString: "str", AInt: 1123, ABool: true, BString: "str"},
+		&AppendTree{Name: "root", Weight: 1.5, Children: []*AppendTree{{Name: "leaf", Status: "active"}, nil}},
+		[]AModel{{true, false}, {false, true}},
+	} {
+		buf, err := MarshalAppend(nil, options, value)
+		assert.NoError(t, err)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			buf, _ = MarshalAppend(buf[:0], options, value)
+		})
+		assert.Equal(t, 0.0, allocs, "%T", value)
+	}
+}
+
+func TestMarshalAppend_Conformance(t *testing.T) {
+	hackCreationTime, err := time.Parse(time.RFC3339, "2017-01-20T18:11:00Z")
+	assert.NoError(t, err)
+	short, price := "a rather long text", 1.005
+
+	values := map[string]interface{}{
+		"model": AppendModel{
+			Text:    "text",
+			Status:  "active",
+			Floats:  []float64{1.5, 1e21, 0.25},
+			Time:    hackCreationTime,
+			Extra:   map[string]interface{}{"b": []int{1}, "a": &short, "c": json.Number("1.50")},
+			IntMap:  map[int]string{2: "two"},
+			Nested:  &AppendModel{Text: "nested", Extra: map[string]interface{}{}},
+			Secret:  "secret",
+			Float32: 2.5,
+		},
+		"pointers":   map[string]*float64{"price": &price, "nil": nil},
+		"interfaces": []interface{}{AModel{true, false}, &AModel{}, nil, "x", int64(1) << 60},
+		"duplicates": map[string]interface{}{"z": AppendDuplicates{Name: "first", Other: "second"}},
+		"array":      [2]AModel{{true, false}, {false, true}},
+		"unwrapper":  OptionalModel{Count: Some(1), Profiles: []Optional[OptionalProfile]{Some(OptionalProfile{Name: "alice"})}},
+		"embedded": UserInfo{
+			UserPrivateInfo: UserPrivateInfo{Age: "20"},
+			UserPublicInfo:  UserPublicInfo{ID: "F94", Email: "hello@hello.com"},
+		},
+	}
+	optionSets := []*Options{
+		{},
+		{Groups: []string{"api"}},
+		{Groups: []string{"admin"}, ExcludedAsNull: true},
+		{Groups: []string{"api"}, MaxStringLen: 4, Int64AsString: true, FloatPrecision: 2},
+		{Groups: []string{"api"}, OmitFields: []string{"nested.text", "extra.b"}, UntaggedKeyStyle: LowerAllKeyStyle},
+		{Groups: []string{"api"}, TypeField: "type", TimeLocation: time.FixedZone("X", 3600)},
+	}
+
+	for name, value := range values {
+		for i, options := range optionSets {
+			expectedMap, err := Marshal(options, value)
+			assert.NoError(t, err)
+			expected, err := json.Marshal(expectedMap)
+			assert.NoError(t, err)
+
+			actual, err := MarshalAppend(nil, options, value)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual), "%s %d", name, i)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package sheriff
+
+import "reflect"
+
+// Authorizer decides which fields with groups are visible, e.g. by asking a policy engine.
+//
+// Allow is called with Options.Subject, the struct type holding the field, the field itself and the groups
+// declared by its groups tag (or propagated from an anonymous field, or registered using RegisterFieldGroups),
+// which policies may use as labels. The groups are shared and must not be modified. Fields without groups are
+// visible to everyone and aren't passed to Allow.
+type Authorizer interface {
+	Allow(subject interface{}, resource reflect.Type, field reflect.StructField, declaredGroups []string) bool
+}
+
+// AuthorizerFunc is an adapter to allow the use of ordinary functions as Authorizer.
+type AuthorizerFunc func(subject interface{}, resource reflect.Type, field reflect.StructField, declaredGroups []string) bool
+
+// Allow calls fn(subject, resource, field, declaredGroups).
+func (fn AuthorizerFunc) Allow(subject interface{}, resource reflect.Type, field reflect.StructField, declaredGroups []string) bool {
+	return fn(subject, resource, field, declaredGroups)
+}
+
+// AuthorizerMode determines how Options.Authorizer is combined with the group check.
+type AuthorizerMode uint8
+
+const (
+	// AuthorizerReplacesGroups shows the fields allowed by the Authorizer, regardless of Options.Groups.
+	AuthorizerReplacesGroups AuthorizerMode = iota
+	// AuthorizerGrants shows the fields matching Options.Groups and additionally the ones allowed by the Authorizer.
+	AuthorizerGrants
+	// AuthorizerRestricts only shows the fields matching Options.Groups which the Authorizer allows too.
+	AuthorizerRestricts
+)
+
+// isVisible reports whether the field of the struct type t whose groups are groups passes the group check,
+// including Options.Authorizer.
+func (s *marshalState) isVisible(t reflect.Type, field reflect.StructField, groups []string) bool {
+	if groups == nil {
+		return true
+	}
+	authorizer := s.options.Authorizer
+	if authorizer == nil {
+		return s.matchesGroups(groups, s.groups)
+	}
+	switch s.options.AuthorizerMode {
+	case AuthorizerGrants:
+		return s.matchesGroups(groups, s.groups) || authorizer.Allow(s.options.Subject, t, field, groups)
+	case AuthorizerRestricts:
+		return s.matchesGroups(groups, s.groups) && authorizer.Allow(s.options.Subject, t, field, groups)
+	}
+	return authorizer.Allow(s.options.Subject, t, field, groups)
+}
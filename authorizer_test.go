@@ -0,0 +1,95 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type AuthorizerContact struct {
+	Phone string `json:"phone"`
+}
+
+type AuthorizerEmployee struct {
+	AuthorizerContact `groups:"hr"`
+	Name              string `json:"name"`
+	Email             string `json:"email" groups:"api"`
+	Salary            int    `json:"salary" groups:"hr,finance"`
+}
+
+// authorizerTeam authorizes fields whose declared groups include the one of the subject.
+var authorizerTeam = AuthorizerFunc(func(subject interface{}, resource reflect.Type, field reflect.StructField, declaredGroups []string) bool {
+	return contains(subject.(string), declaredGroups)
+})
+
+func TestMarshal_Authorizer(t *testing.T) {
+	v := AuthorizerEmployee{AuthorizerContact: AuthorizerContact{Phone: "555"}, Name: "alice", Email: "alice@example.org", Salary: 100}
+
+	tests := []struct {
+		name     string
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "replaces groups",
+			options:  &Options{Groups: []string{"api"}, Authorizer: authorizerTeam, Subject: "hr"},
+			expected: `{"name":"alice","phone":"555","salary":100}`,
+		},
+		{
+			name:     "grants",
+			options:  &Options{Groups: []string{"api"}, Authorizer: authorizerTeam, Subject: "finance", AuthorizerMode: AuthorizerGrants},
+			expected: `{"email":"alice@example.org","name":"alice","salary":100}`,
+		},
+		{
+			name:     "restricts",
+			options:  &Options{Groups: []string{"api", "hr"}, Authorizer: authorizerTeam, Subject: "finance", AuthorizerMode: AuthorizerRestricts},
+			expected: `{"name":"alice","salary":100}`,
+		},
+		{
+			name:     "excluded as null",
+			options:  &Options{Authorizer: authorizerTeam, Subject: "api", ExcludedAsNull: true},
+			expected: `{"email":"alice@example.org","name":"alice","phone":null,"salary":null}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Marshal(test.options, v)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(v, map[string]*Options{"a": test.options, "b": {Groups: []string{"api"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, m, all["a"])
+		})
+	}
+}
+
+func TestMarshal_AuthorizerArguments(t *testing.T) {
+	type call struct {
+		resource reflect.Type
+		field    string
+		groups   []string
+	}
+	var calls []call
+	options := &Options{
+		Subject: 42,
+		Authorizer: AuthorizerFunc(func(subject interface{}, resource reflect.Type, field reflect.StructField, declaredGroups []string) bool {
+			assert.Equal(t, 42, subject)
+			calls = append(calls, call{resource, field.Name, declaredGroups})
+			return false
+		}),
+	}
+
+	m, err := Marshal(options, AuthorizerEmployee{Name: "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "alice"}, m)
+	assert.Equal(t, []call{
+		{reflect.TypeOf(AuthorizerContact{}), "Phone", []string{"hr"}},
+		{reflect.TypeOf(AuthorizerEmployee{}), "Email", []string{"api"}},
+		{reflect.TypeOf(AuthorizerEmployee{}), "Salary", []string{"hr", "finance"}},
+	}, calls)
+}
@@ -1,6 +1,7 @@
 package sheriff
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 )
@@ -112,3 +113,288 @@ func BenchmarkModelsMarshaller_Marshal(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkModelsMarshaller_MarshalAppend(b *testing.B) {
+	s := testData()
+	o := &Options{}
+	var buf []byte
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		// the buffer only grows during the first iterations
+		buf, err = MarshalAppend(buf[:0], o, s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalAppend_FlatStruct(b *testing.B) {
+	s := FlatBenchmarkModel{AString: "str", AInt: 1123, ABool: true, BString: "str"}
+	o := &Options{Groups: []string{"api"}}
+	var buf []byte
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		buf, err = MarshalAppend(buf[:0], o, s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalJSON_FlatStruct(b *testing.B) {
+	s := FlatBenchmarkModel{AString: "str", AInt: 1123, ABool: true, BString: "str"}
+	o := &Options{Groups: []string{"api"}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Defer(o, s).MarshalJSON(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type FlatBenchmarkModel struct {
+	AString string `json:"a_string" groups:"api"`
+	AInt    int    `json:"a_int" groups:"api"`
+	ABool   bool   `json:"a_bool" groups:"admin"`
+	BString string `json:"b_string"`
+}
+
+// BenchmarkMarshal_FlatStruct marshals a struct without anonymous fields without pooling, so that every
+// allocation of the bookkeeping is counted.
+func BenchmarkMarshal_FlatStruct(b *testing.B) {
+	s := FlatBenchmarkModel{AString: "str", AInt: 1123, ABool: true, BString: "str"}
+	o := &Options{Groups: []string{"api"}, DisablePooling: true}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(o, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// WideBenchmarkModel has as many fields as the large models of typical APIs.
+type WideBenchmarkModel struct {
+	Field00 string  `json:"field_00"`
+	Field01 int     `json:"field_01"`
+	Field02 bool    `json:"field_02"`
+	Field03 float64 `json:"field_03"`
+	Field04 string  `json:"field_04"`
+	Field05 int     `json:"field_05"`
+	Field06 bool    `json:"field_06"`
+	Field07 float64 `json:"field_07"`
+	Field08 string  `json:"field_08"`
+	Field09 int     `json:"field_09"`
+	Field10 bool    `json:"field_10"`
+	Field11 float64 `json:"field_11"`
+	Field12 string  `json:"field_12"`
+	Field13 int     `json:"field_13"`
+	Field14 bool    `json:"field_14"`
+	Field15 float64 `json:"field_15"`
+	Field16 string  `json:"field_16"`
+	Field17 int     `json:"field_17"`
+	Field18 bool    `json:"field_18"`
+	Field19 float64 `json:"field_19"`
+	Field20 string  `json:"field_20"`
+	Field21 int     `json:"field_21"`
+	Field22 bool    `json:"field_22"`
+	Field23 float64 `json:"field_23"`
+	Field24 string  `json:"field_24"`
+	Field25 int     `json:"field_25"`
+	Field26 bool    `json:"field_26"`
+	Field27 float64 `json:"field_27"`
+	Field28 string  `json:"field_28"`
+	Field29 int     `json:"field_29"`
+	Field30 bool    `json:"field_30"`
+	Field31 float64 `json:"field_31"`
+	Field32 string  `json:"field_32"`
+	Field33 int     `json:"field_33"`
+	Field34 bool    `json:"field_34"`
+	Field35 float64 `json:"field_35"`
+	Field36 string  `json:"field_36"`
+	Field37 int     `json:"field_37"`
+	Field38 bool    `json:"field_38"`
+	Field39 float64 `json:"field_39"`
+}
+
+func BenchmarkMarshal_WideStruct(b *testing.B) {
+	s := []WideBenchmarkModel{{}, {}, {}, {}, {}, {}, {}, {}, {}, {}}
+	o := &Options{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(o, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshal_IntKeyedMap(b *testing.B) {
+	m := make(map[int64]SubModel, 50000)
+	for i := int64(0); i < 50000; i++ {
+		m[i*7919] = SubModel{AnotherString: "str", AnotherInt: 42}
+	}
+	o := &Options{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(o, m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TreeBenchmarkNode implements none of the interfaces marshalValue looks for.
+type TreeBenchmarkNode struct {
+	Name     string               `json:"name" groups:"api"`
+	Weight   int                  `json:"weight" groups:"api"`
+	Children []*TreeBenchmarkNode `json:"children" groups:"api"`
+}
+
+func treeData(depth, fanout int) *TreeBenchmarkNode {
+	node := &TreeBenchmarkNode{Name: "node", Weight: depth}
+	if depth == 0 {
+		return node
+	}
+	for i := 0; i < fanout; i++ {
+		node.Children = append(node.Children, treeData(depth-1, fanout))
+	}
+	return node
+}
+
+func BenchmarkMarshal_DeepTree(b *testing.B) {
+	tree := treeData(8, 3)
+	o := &Options{Groups: []string{"api"}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(o, tree); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshal_DeepChain(b *testing.B) {
+	chain := deepChain(5000)
+	o := &Options{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(o, chain); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type GroupsBenchmarkModel struct {
+	ID        int               `json:"id"`
+	Name      string            `json:"name" groups:"public,user,staff,admin"`
+	Email     string            `json:"email" groups:"user,staff,admin"`
+	Phone     string            `json:"phone" groups:"staff,admin"`
+	Salary    int               `json:"salary" groups:"admin"`
+	Active    bool              `json:"active" groups:"user,admin"`
+	Tags      []string          `json:"tags" groups:"public,staff"`
+	Labels    map[string]string `json:"labels" groups:"staff,admin,audit"`
+	Address   SubModel          `json:"address" groups:"user,admin"`
+	CreatedBy string            `json:"created_by" groups:"audit"`
+}
+
+func groupsBenchmarkData() []GroupsBenchmarkModel {
+	data := make([]GroupsBenchmarkModel, 10)
+	for i := range data {
+		data[i] = GroupsBenchmarkModel{
+			ID:        i,
+			Name:      "name",
+			Email:     "name@example.org",
+			Phone:     "555",
+			Salary:    1000,
+			Active:    true,
+			Tags:      []string{"a", "b", "c"},
+			Labels:    map[string]string{"a": "b", "c": "d"},
+			Address:   SubModel{AnotherString: "str", AnotherInt: 42},
+			CreatedBy: "root",
+		}
+	}
+	return data
+}
+
+func fiveGroupSets() map[string]*Options {
+	return map[string]*Options{
+		"public": {Groups: []string{"public"}},
+		"user":   {Groups: []string{"user"}},
+		"staff":  {Groups: []string{"staff"}},
+		"admin":  {Groups: []string{"admin"}},
+		"audit":  {Groups: []string{"audit"}},
+	}
+}
+
+// BenchmarkMarshal_FiveGroupSets calls Marshal once per group set, to be compared to BenchmarkMarshalAll_FiveGroupSets.
+func BenchmarkMarshal_FiveGroupSets(b *testing.B) {
+	s := groupsBenchmarkData()
+	optionSets := fiveGroupSets()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, o := range optionSets {
+			if _, err := Marshal(o, s); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkMarshalAll_FiveGroupSets(b *testing.B) {
+	s := groupsBenchmarkData()
+	optionSets := fiveGroupSets()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalAll(s, optionSets); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMarshalContext_SmallStruct checks a cancellable context, to be compared to BenchmarkMarshal_SmallStruct.
+func BenchmarkMarshalContext_SmallStruct(b *testing.B) {
+	s := testData()
+	o := &Options{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalContext(ctx, o, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshal_SmallStruct(b *testing.B) {
+	s := testData()
+	o := &Options{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(o, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
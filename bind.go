@@ -0,0 +1,34 @@
+package sheriff
+
+// BoundView is data marshalled with fixed options, see Bind. It implements json.Marshaler and
+// encoding.TextMarshaler, so it can be embedded into other structs, cached, or passed to any library accepting
+// them. The zero value encodes as null.
+type BoundView struct {
+	json []byte
+}
+
+// Bind marshals data with the given options upfront and returns the result as a BoundView, so that errors are
+// returned by Bind rather than when the view is encoded.
+//
+// Unlike Defer, the view is a snapshot: later changes to data or options aren't reflected by it.
+func Bind(options *Options, data interface{}) (BoundView, error) {
+	b, err := MarshalAppend(nil, options, data)
+	if err != nil {
+		return BoundView{}, err
+	}
+	return BoundView{json: b}, nil
+}
+
+// MarshalJSON returns the JSON encoding of the view. It's safe for concurrent use.
+func (v BoundView) MarshalJSON() ([]byte, error) {
+	if v.json == nil {
+		return []byte("null"), nil
+	}
+	// the caller owns the result, so the view mustn't be modified through it
+	return append([]byte(nil), v.json...), nil
+}
+
+// MarshalText returns the JSON encoding of the view, like MarshalJSON does.
+func (v BoundView) MarshalText() ([]byte, error) {
+	return v.MarshalJSON()
+}
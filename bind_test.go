@@ -0,0 +1,70 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type BindUser struct {
+	Name  string `json:"name" groups:"api"`
+	Email string `json:"email" groups:"admin"`
+}
+
+type BindResponse struct {
+	User  BoundView   `json:"user"`
+	Users []BoundView `json:"users,omitempty"`
+	Total int         `json:"total"`
+}
+
+func TestBind(t *testing.T) {
+	user := &BindUser{Name: "alice", Email: "alice@example.org"}
+	view, err := Bind(&Options{Groups: []string{"api"}}, user)
+	assert.NoError(t, err)
+
+	// the view is a snapshot
+	user.Name = "bob"
+
+	actual, err := json.Marshal(BindResponse{User: view, Total: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"user":{"name":"alice"},"total":1}`, string(actual))
+
+	text, err := view.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"alice"}`, string(text))
+
+	actual, err = json.Marshal(BindResponse{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"user":null,"total":0}`, string(actual))
+}
+
+func TestBind_Error(t *testing.T) {
+	view, err := Bind(&Options{}, DeferFailingModel{})
+	assert.True(t, errors.Is(err, errDeferFailing))
+	assert.Equal(t, BoundView{}, view)
+}
+
+func TestBind_Concurrent(t *testing.T) {
+	view, err := Bind(&Options{Groups: []string{"admin"}}, BindUser{Name: "alice", Email: "alice@example.org"})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b, err := json.Marshal(BindResponse{User: view, Users: []BoundView{view}})
+			if err == nil {
+				results[i] = string(b)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, result := range results {
+		assert.Equal(t, `{"user":{"email":"alice@example.org"},"users":[{"email":"alice@example.org"}],"total":0}`, result)
+	}
+}
@@ -0,0 +1,288 @@
+package sheriff
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOutputCacheSize is the number of entries of an OutputCache created without a size.
+const DefaultOutputCacheSize = 1024
+
+// DefaultOutputCache is the OutputCache used with Options.CacheKeyer if Options.OutputCache isn't set.
+var DefaultOutputCache = NewOutputCache(DefaultOutputCacheSize)
+
+// OutputCache holds the results of Marshal and MarshalAppend for the data identified by Options.CacheKeyer.
+// Once it's full, the least recently used entry is evicted. It's safe for concurrent use.
+//
+// The zero value is an empty cache of DefaultOutputCacheSize entries.
+type OutputCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[outputCacheKey]*list.Element
+	// order holds the *outputCacheEntry values, the most recently used first.
+	order list.List
+}
+
+// outputKind is the kind of result an OutputCache entry holds.
+type outputKind uint8
+
+const (
+	// cachedValue is the result of Marshal.
+	cachedValue outputKind = iota
+	// cachedJSON is the output of MarshalAppend.
+	cachedJSON
+	// cachedCanonicalJSON is the output of MarshalCanonical.
+	cachedCanonicalJSON
+)
+
+// outputCacheKey identifies an entry of an OutputCache.
+type outputCacheKey struct {
+	key string
+	// typ is the type of the data, without pointers, so that data of different types never shares a result.
+	typ reflect.Type
+	// groups is the fingerprint of the requested groups, see groupsFingerprint.
+	groups string
+	// options is the fingerprint of the other options, see optionsFingerprint.
+	options string
+	kind    outputKind
+}
+
+type outputCacheEntry struct {
+	key   outputCacheKey
+	value interface{}
+}
+
+// NewOutputCache returns an empty OutputCache holding at most size entries. It panics if size isn't positive.
+func NewOutputCache(size int) *OutputCache {
+	if size <= 0 {
+		panic(fmt.Sprintf("sheriff: NewOutputCache of non-positive size %d", size))
+	}
+	return &OutputCache{size: size}
+}
+
+// Invalidate removes the results for key, for all types and options, e.g. once the data it identifies changed.
+func (c *OutputCache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, elem := range c.entries {
+		if k.key == key {
+			c.order.Remove(elem)
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Purge removes all results.
+func (c *OutputCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.order.Init()
+}
+
+// Len returns the number of results in the cache.
+func (c *OutputCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// get returns the cached result for k and marks it as recently used.
+func (c *OutputCache) get(k outputCacheKey) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*outputCacheEntry).value, true
+}
+
+// add caches value for k, evicting the least recently used result if the cache is full.
+func (c *OutputCache) add(k outputCacheKey, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[k]; ok {
+		elem.Value.(*outputCacheEntry).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[outputCacheKey]*list.Element)
+	}
+	size := c.size
+	if size == 0 {
+		size = DefaultOutputCacheSize
+	}
+	if c.order.Len() >= size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*outputCacheEntry).key)
+	}
+	c.entries[k] = c.order.PushFront(&outputCacheEntry{key: k, value: value})
+}
+
+// outputCache returns the OutputCache used with CacheKeyer.
+func (o *Options) outputCache() *OutputCache {
+	if o.OutputCache != nil {
+		return o.OutputCache
+	}
+	return DefaultOutputCache
+}
+
+// outputCacheKey returns the key of the result of the given kind for the data v, ok is false if it isn't cached.
+func (s *marshalState) outputCacheKey(v reflect.Value, kind outputKind) (k outputCacheKey, ok bool) {
+	if s.options.CacheKeyer == nil || !v.IsValid() {
+		return outputCacheKey{}, false
+	}
+	key, ok := s.options.CacheKeyer(v.Interface())
+	if !ok {
+		return outputCacheKey{}, false
+	}
+	options, ok := optionsFingerprint(s.options)
+	if !ok {
+		return outputCacheKey{}, false
+	}
+	typ := v.Type()
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return outputCacheKey{key: key, typ: typ, groups: groupsFingerprint(s.groups), options: options, kind: kind}, true
+}
+
+// uncachedOptions are the options which don't affect the output, and Groups, which are part of the key on their own.
+var uncachedOptions = map[string]bool{
+	"Groups":          true,
+	"CacheKeyer":      true,
+	"OutputCache":     true,
+	"DisablePooling":  true,
+	"OnLineError":     true,
+	"OnExcluded":      true,
+	"OnDeprecated":    true,
+	"Instrumentation": true,
+}
+
+// optionsFingerprint returns a string identifying the values of the options affecting the output. ok is false if
+// one of them can't be told apart from other values, e.g. a function or a pointer, and the result mustn't be cached.
+func optionsFingerprint(o *Options) (fingerprint string, ok bool) {
+	var b strings.Builder
+	v := reflect.ValueOf(o).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if uncachedOptions[v.Type().Field(i).Name] {
+			continue
+		}
+		if !fingerprintValue(&b, v.Field(i)) {
+			return "", false
+		}
+		b.WriteByte(';')
+	}
+	return b.String(), true
+}
+
+// fingerprintValue writes a representation of v to b, ok is false if v can't be represented.
+func fingerprintValue(b *strings.Builder, v reflect.Value) (ok bool) {
+	switch v.Kind() {
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		b.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+	case reflect.Slice:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return true
+		}
+		b.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if !fingerprintValue(b, v.Index(i)) {
+				return false
+			}
+			b.WriteByte(',')
+		}
+		b.WriteByte(']')
+	case reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return true
+		}
+		b.WriteString(v.Elem().Type().String())
+		return fingerprintValue(b, v.Elem())
+	case reflect.Struct:
+		// stateless values like ExactGroups
+		b.WriteString("{")
+		for i := 0; i < v.NumField(); i++ {
+			if !fingerprintValue(b, v.Field(i)) {
+				return false
+			}
+			b.WriteByte(',')
+		}
+		b.WriteString("}")
+	case reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return true
+		}
+		if !v.CanInterface() {
+			return false
+		}
+		loc, ok := v.Interface().(*time.Location)
+		if !ok {
+			return false
+		}
+		b.WriteString(strconv.Quote(loc.String()))
+	case reflect.Func, reflect.Map, reflect.Chan:
+		if !v.IsNil() && !(v.Kind() == reflect.Map && v.Len() == 0) {
+			return false
+		}
+		b.WriteString("nil")
+	default:
+		return false
+	}
+	return true
+}
+
+// groupsFingerprint returns a string identifying the set of groups, regardless of their order and duplicates.
+func groupsFingerprint(groups []string) string {
+	sorted := slices.Clone(groups)
+	slices.Sort(sorted)
+	// NUL bytes don't occur in group names
+	return strings.Join(slices.Compact(sorted), "\x00")
+}
+
+// copyResult returns a copy of the result of Marshal v, in which the objects and arrays are copied recursively.
+// Other values are immutable, or left to encoding/json and therefore not expected to be modified.
+func copyResult(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = copyResult(value)
+		}
+		return c
+	case map[interface{}]interface{}:
+		c := make(map[interface{}]interface{}, len(v))
+		for key, value := range v {
+			c[key] = copyResult(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = copyResult(value)
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,254 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// CacheCounter counts how often it's marshalled.
+type CacheCounter struct {
+	calls *atomic.Int64
+}
+
+func (c CacheCounter) MarshalJSON() ([]byte, error) {
+	c.calls.Add(1)
+	return []byte(`"counted"`), nil
+}
+
+type CacheCountry struct {
+	Code    string       `json:"code"`
+	Name    string       `json:"name"`
+	Tax     float64      `json:"tax" groups:"admin"`
+	Regions []string     `json:"regions"`
+	Counter CacheCounter `json:"counter"`
+}
+
+func cacheCountryKeyer(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case CacheCountry:
+		return "country:" + v.Code, true
+	case *CacheCountry:
+		return "country:" + v.Code, true
+	}
+	return "", false
+}
+
+func TestMarshal_CacheKeyer(t *testing.T) {
+	country := CacheCountry{Code: "DE", Name: "Germany", Tax: 19, Regions: []string{"BY"}, Counter: CacheCounter{new(atomic.Int64)}}
+	cache := NewOutputCache(10)
+	options := &Options{CacheKeyer: cacheCountryKeyer, OutputCache: cache}
+
+	for i := 0; i < 3; i++ {
+		v, err := Marshal(options, &country)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"code": "DE", "name": "Germany", "regions": []interface{}{"BY"}, "counter": country.Counter}, v)
+	}
+	assert.Equal(t, 1, cache.Len())
+
+	// the returned results are copies
+	v, err := Marshal(options, country)
+	assert.NoError(t, err)
+	v.(map[string]interface{})["name"] = "changed"
+	v.(map[string]interface{})["regions"].([]interface{})[0] = "changed"
+	v, err = Marshal(options, country)
+	assert.NoError(t, err)
+	assert.Equal(t, "Germany", v.(map[string]interface{})["name"])
+	assert.Equal(t, []interface{}{"BY"}, v.(map[string]interface{})["regions"])
+
+	// the data isn't looked at once it's cached
+	country.Name = "stale"
+	v, err = Marshal(options, country)
+	assert.NoError(t, err)
+	assert.Equal(t, "Germany", v.(map[string]interface{})["name"])
+
+	// the groups are part of the key, regardless of their order
+	admin := &Options{CacheKeyer: cacheCountryKeyer, OutputCache: cache, Groups: []string{"admin", "user"}}
+	v, err = Marshal(admin, country)
+	assert.NoError(t, err)
+	assert.Equal(t, 19.0, v.(map[string]interface{})["tax"])
+	assert.Equal(t, "stale", v.(map[string]interface{})["name"])
+	v, err = Marshal(&Options{CacheKeyer: cacheCountryKeyer, OutputCache: cache, Groups: []string{"user", "admin", "user"}}, country)
+	assert.NoError(t, err)
+	assert.Equal(t, "stale", v.(map[string]interface{})["name"])
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Invalidate("country:DE")
+	assert.Equal(t, 0, cache.Len())
+	v, err = Marshal(options, country)
+	assert.NoError(t, err)
+	assert.Equal(t, "stale", v.(map[string]interface{})["name"])
+
+	// data without a key isn't cached
+	_, err = Marshal(options, []CacheCountry{country})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestMarshalAppend_CacheKeyer(t *testing.T) {
+	cache := NewOutputCache(10)
+	options := &Options{CacheKeyer: cacheCountryKeyer, OutputCache: cache}
+	var calls atomic.Int64
+	country := CacheCountry{Code: "FR", Name: "France", Counter: CacheCounter{&calls}}
+
+	b, err := MarshalAppend([]byte("x"), options, country)
+	assert.NoError(t, err)
+	assert.Equal(t, `x{"code":"FR","counter":"counted","name":"France","regions":null}`, string(b))
+	// the bytes are cached as well as the intermediate result they were encoded from
+	assert.Equal(t, 2, cache.Len())
+
+	country.Name = "stale"
+	b, err = MarshalAppend(b[:1], options, country)
+	assert.NoError(t, err)
+	assert.Equal(t, `x{"code":"FR","counter":"counted","name":"France","regions":null}`, string(b))
+	assert.Equal(t, int64(1), calls.Load())
+
+	b, err = MarshalCanonical(options, country)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"code":"FR","counter":"counted","name":"France","regions":null}`, string(b))
+	assert.Equal(t, 3, cache.Len())
+
+	cache.Purge()
+	b, err = MarshalAppend(nil, options, country)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"code":"FR","counter":"counted","name":"stale","regions":null}`, string(b))
+}
+
+type CacheLanguage struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type CacheSecret struct {
+	Code  string `json:"code"`
+	Token string `json:"token" mask:"last4"`
+}
+
+// codeKeyer keys data by its code only, regardless of its type.
+func codeKeyer(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case CacheCountry:
+		return v.Code, true
+	case CacheLanguage:
+		return v.Code, true
+	case CacheSecret:
+		return v.Code, true
+	}
+	return "", false
+}
+
+func TestMarshal_CacheKeyerCollisions(t *testing.T) {
+	cache := NewOutputCache(10)
+	options := &Options{CacheKeyer: codeKeyer, OutputCache: cache}
+
+	// data of different types doesn't share results
+	v, err := Marshal(options, CacheCountry{Code: "de", Name: "Germany", Counter: CacheCounter{new(atomic.Int64)}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Germany", v.(map[string]interface{})["name"])
+	v, err = Marshal(options, CacheLanguage{Code: "de", Name: "German"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"code": "de", "name": "German"}, v)
+	b, err := MarshalAppend(nil, options, CacheLanguage{Code: "de", Name: "German"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"code":"de","name":"German"}`, string(b))
+
+	// neither do option sets with different output
+	secret := CacheSecret{Code: "s", Token: "abcdefgh"}
+	v, err = Marshal(options, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdefgh", v.(map[string]interface{})["token"])
+	v, err = Marshal(&Options{CacheKeyer: codeKeyer, OutputCache: cache, EnableMasking: true}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "****efgh", v.(map[string]interface{})["token"])
+	b, err = MarshalAppend(nil, &Options{CacheKeyer: codeKeyer, OutputCache: cache, OmitFields: []string{"token"}}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"code":"s"}`, string(b))
+
+	// options which don't affect the output share results
+	n := cache.Len()
+	_, err = Marshal(&Options{CacheKeyer: codeKeyer, OutputCache: cache, OnExcluded: func(string, reflect.StructField, []string) {}}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, n, cache.Len())
+
+	// options which can't be compared disable the cache
+	_, err = Marshal(&Options{CacheKeyer: codeKeyer, OutputCache: cache, MapKeyFilter: func(string, string) bool { return true }}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, n, cache.Len())
+}
+
+func TestOutputCache_Eviction(t *testing.T) {
+	cache := NewOutputCache(2)
+	options := &Options{CacheKeyer: cacheCountryKeyer, OutputCache: cache}
+	counter := CacheCounter{new(atomic.Int64)}
+	marshal := func(code, name string) string {
+		v, err := Marshal(options, CacheCountry{Code: code, Name: name, Counter: counter})
+		assert.NoError(t, err)
+		return v.(map[string]interface{})["name"].(string)
+	}
+
+	marshal("DE", "Germany")
+	marshal("FR", "France")
+	// DE is used more recently than FR, which is therefore evicted
+	assert.Equal(t, "Germany", marshal("DE", "changed"))
+	marshal("IT", "Italy")
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, "Germany", marshal("DE", "changed"))
+	assert.Equal(t, "changed", marshal("FR", "changed"))
+
+	assert.PanicsWithValue(t, "sheriff: NewOutputCache of non-positive size 0", func() { NewOutputCache(0) })
+
+	// the zero value is usable
+	var zero OutputCache
+	v, err := Marshal(&Options{CacheKeyer: cacheCountryKeyer, OutputCache: &zero}, CacheCountry{Code: "DE", Counter: counter})
+	assert.NoError(t, err)
+	assert.Equal(t, "DE", v.(map[string]interface{})["code"])
+	assert.Equal(t, 1, zero.Len())
+}
+
+func TestOutputCache_Concurrent(t *testing.T) {
+	cache := NewOutputCache(4)
+	counter := CacheCounter{new(atomic.Int64)}
+	options := []*Options{
+		{CacheKeyer: cacheCountryKeyer, OutputCache: cache},
+		{CacheKeyer: cacheCountryKeyer, OutputCache: cache, Groups: []string{"admin"}},
+	}
+	countries := make([]CacheCountry, 8)
+	for i := range countries {
+		countries[i] = CacheCountry{Code: fmt.Sprint(i), Name: fmt.Sprint("country ", i), Tax: float64(i), Counter: counter}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				country := countries[(g+i)%len(countries)]
+				o := options[i%2]
+				if i%17 == 0 {
+					cache.Invalidate("country:" + country.Code)
+				}
+				v, err := Marshal(o, country)
+				if !assert.NoError(t, err) {
+					return
+				}
+				m := v.(map[string]interface{})
+				assert.Equal(t, country.Name, m["name"])
+				if o.Groups != nil {
+					assert.Equal(t, country.Tax, m["tax"])
+				} else {
+					assert.NotContains(t, m, "tax")
+				}
+				b, err := MarshalAppend(nil, o, country)
+				assert.NoError(t, err)
+				assert.Contains(t, string(b), `"name":"`+country.Name+`"`)
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, cache.Len(), 4)
+}
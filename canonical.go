@@ -0,0 +1,135 @@
+package sheriff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MarshalCanonical returns a canonical JSON encoding of data filtered by the given options, e.g. to sign or hash
+// the filtered view. Equal data results in the same bytes, no matter whether it's backed by structs or maps.
+//
+// The canonicalization follows the JSON Canonicalization Scheme (RFC 8785):
+//
+//   - There is no whitespace between tokens.
+//   - The keys of all objects are sorted by their UTF-16 code units, including the ones of objects returned
+//     by json.Marshaler implementations, whose output is decoded and encoded again.
+//   - Strings only escape '"', '\\' and control characters below U+0020. \b, \t, \n, \f and \r use their
+//     short forms, the other control characters \u00xx with lowercase hex digits. Everything else, including
+//     '<', '>', '&', U+2028 and U+2029, is written as is. Invalid UTF-8 is replaced by U+FFFD.
+//   - Floating point numbers are formatted like ECMAScript's Number.prototype.toString, i.e. the shortest
+//     representation without exponent for magnitudes between 1e-6 and 1e21 and with it otherwise
+//     (e.g. 1e+21, 1e-7). Negative zero is written as 0. float32 values use their own shortest representation.
+//
+// Unlike RFC 8785, integers are written exactly, even beyond ±2^53 where IEEE 754 doubles lose precision, and
+// json.Number values which are valid integers are kept. Other json.Number values are formatted as floats.
+func MarshalCanonical(options *Options, data interface{}) ([]byte, error) {
+	s := acquireMarshalState(options)
+	defer s.release()
+	s.canonical = true
+	return s.marshalAppend(nil, data)
+}
+
+// appendCanonicalJSON appends the JSON document b, which was encoded by encoding/json, canonically.
+func (s *marshalState) appendCanonicalJSON(dst []byte, b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return dst, err
+	}
+	return s.appendJSON(dst, decoded)
+}
+
+// appendCanonicalNumber appends the number n canonically.
+func appendCanonicalNumber(dst []byte, n json.Number) ([]byte, error) {
+	if !json.Valid([]byte(n)) {
+		return dst, fmt.Errorf("marshaller: invalid number literal %q", n)
+	}
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return strconv.AppendInt(dst, i, 10), nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return dst, fmt.Errorf("marshaller: number %s out of range", n)
+	}
+	if f == 0 {
+		return append(dst, '0'), nil
+	}
+	return appendFloat(dst, f, 64), nil
+}
+
+// appendCanonicalString appends the quoted string src as defined by RFC 8785.
+func appendCanonicalString(dst []byte, src string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(src); {
+		if b := src[i]; b < utf8.RuneSelf {
+			if b >= ' ' && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			dst = append(dst, src[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(src[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, src[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, src[start:]...)
+	return append(dst, '"')
+}
+
+// compareUTF16 compares a and b by their UTF-16 code units, as required by RFC 8785 for sorting keys. It only
+// differs from comparing the UTF-8 bytes if a rune beyond U+FFFF is compared to one between U+E000 and U+FFFF.
+func compareUTF16(a, b string) int {
+	for len(a) > 0 && len(b) > 0 {
+		ra, sizeA := utf8.DecodeRuneInString(a)
+		rb, sizeB := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			ua, ub := firstUTF16Unit(ra), firstUTF16Unit(rb)
+			if ua != ub {
+				return int(ua) - int(ub)
+			}
+			// both are beyond U+FFFF with the same high surrogate, so the low surrogates are in rune order
+			return int(ra) - int(rb)
+		}
+		a, b = a[sizeA:], b[sizeB:]
+	}
+	return len(a) - len(b)
+}
+
+// firstUTF16Unit returns the first UTF-16 code unit of r.
+func firstUTF16Unit(r rune) rune {
+	if r1, _ := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		return r1
+	}
+	return r
+}
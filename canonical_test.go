@@ -0,0 +1,104 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CanonicalAddress struct {
+	Street string `json:"street" groups:"api"`
+	City   string `json:"city" groups:"api"`
+}
+
+type CanonicalModel struct {
+	Name     string             `json:"name" groups:"api"`
+	Score    float64            `json:"score" groups:"api"`
+	Tags     []string           `json:"tags" groups:"api"`
+	Address  CanonicalAddress   `json:"address" groups:"api"`
+	Counts   map[string]int     `json:"counts" groups:"api"`
+	Unsorted UnsortedMarshaler  `json:"unsorted" groups:"api"`
+	Internal string             `json:"internal" groups:"admin"`
+	Children []CanonicalAddress `json:"children" groups:"api"`
+}
+
+// UnsortedMarshaler returns an object with unsorted keys, whitespace and HTML escapes.
+type UnsortedMarshaler struct{}
+
+func (UnsortedMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{ "z": 1.0, "a": "<tag>", "m": [ 1e2, -0 ] }`), nil
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	options := &Options{Groups: []string{"api"}}
+	model := CanonicalModel{
+		Name:     "<b>Zürich</b> & more",
+		Score:    1e21,
+		Tags:     []string{"b", "a"},
+		Address:  CanonicalAddress{Street: "Main\tStreet ", City: "Bern"},
+		Counts:   map[string]int{"z": 1, "a": 2, "m": 3, "b": 4, "y": 5},
+		Internal: "internal",
+		Children: []CanonicalAddress{{Street: "x", City: "y"}},
+	}
+	expected := `{"address":{"city":"Bern","street":"Main\tStreet` + " " + `"},"children":[{"city":"y","street":"x"}],` +
+		`"counts":{"a":2,"b":4,"m":3,"y":5,"z":1},"name":"<b>Zürich</b> & more","score":1e+21,"tags":["b","a"],` +
+		`"unsorted":{"a":"<tag>","m":[100,0],"z":1}}`
+
+	for i := 0; i < 100; i++ {
+		actual, err := MarshalCanonical(options, model)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(actual))
+	}
+
+	// the same data backed by maps results in the same bytes
+	mapBacked := map[string]interface{}{
+		"unsorted": UnsortedMarshaler{},
+		"tags":     []interface{}{"b", "a"},
+		"score":    1e21,
+		"name":     "<b>Zürich</b> & more",
+		"counts":   map[string]int{"y": 5, "b": 4, "m": 3, "a": 2, "z": 1},
+		"children": []map[string]string{{"street": "x", "city": "y"}},
+		"address":  map[string]interface{}{"street": "Main\tStreet ", "city": "Bern"},
+	}
+	for i := 0; i < 100; i++ {
+		actual, err := MarshalCanonical(options, mapBacked)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(actual))
+	}
+}
+
+func TestMarshalCanonical_Rules(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"control characters", "\x00\x1f\b\f\n\r\t\"\\\x7f", `"\u0000\u001f\b\f\n\r\t\"\\` + "\x7f" + `"`},
+		{"invalid utf-8", "a\xffb", "\"a\ufffdb\""},
+		{"negative zero", math.Copysign(0, -1), `0`},
+		{"small float", 1e-7, `1e-7`},
+		{"float", 123.456, `123.456`},
+		{"float32", float32(0.1), `0.1`},
+		{"large integer", int64(math.MaxInt64), `9223372036854775807`},
+		{"integer number", json.Number("-0"), `0`},
+		{"float number", json.Number("1.50E+2"), `150`},
+		{"utf-16 key order", map[string]int{"\ue000": 1, "\U0001F600": 2, "a": 3}, "{\"a\":3,\"\U0001F600\":2,\"\ue000\":1}"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := MarshalCanonical(&Options{}, map[string]interface{}{"v": test.value})
+			assert.NoError(t, err)
+			assert.Equal(t, `{"v":`+test.expected+`}`, string(actual))
+		})
+	}
+}
+
+func TestMarshalCanonical_Error(t *testing.T) {
+	_, err := MarshalCanonical(&Options{}, map[string]interface{}{"v": json.Number("1e999")})
+	assert.EqualError(t, err, "marshaller: number 1e999 out of range")
+
+	_, err = MarshalCanonical(&Options{}, DeferFailingModel{})
+	assert.Equal(t, errDeferFailing, err)
+}
@@ -0,0 +1,4 @@
+// Package cbortest checks that the results of sheriff.Marshal with Options.PreserveMapKeyTypes keep their map keys
+// through a CBOR encoder. It only holds tests and lives in its own module, so that sheriff itself doesn't depend on
+// a CBOR package.
+package cbortest
@@ -0,0 +1,16 @@
+module github.com/peoplecentrix/sheriff/cbortest
+
+go 1.21
+
+require (
+	github.com/fxamacker/cbor/v2 v2.9.4
+	github.com/peoplecentrix/sheriff v0.0.0-20261016174454-b08b1bfa4df7
+	github.com/stretchr/testify v1.4.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
@@ -0,0 +1,53 @@
+package cbortest
+
+import (
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/peoplecentrix/sheriff"
+	"github.com/stretchr/testify/assert"
+)
+
+type Reading struct {
+	Value  float64 `json:"value"`
+	Source string  `json:"source" groups:"internal"`
+}
+
+type Telemetry struct {
+	Device   string                   `json:"device"`
+	Readings map[int]Reading          `json:"readings"`
+	Labels   map[string]string        `json:"labels"`
+	Nested   map[int]map[int64]string `json:"nested"`
+}
+
+func telemetry() Telemetry {
+	return Telemetry{
+		Device:   "sensor",
+		Readings: map[int]Reading{1: {Value: 1.5, Source: "a"}, -2: {Value: 2}},
+		Labels:   map[string]string{"site": "berlin"},
+		Nested:   map[int]map[int64]string{3: {4: "x"}},
+	}
+}
+
+func TestMarshal_PreserveMapKeyTypes(t *testing.T) {
+	v, err := sheriff.Marshal(&sheriff.Options{PreserveMapKeyTypes: true}, telemetry())
+	assert.NoError(t, err)
+
+	// the integer keys round-trip through CBOR
+	b, err := cbor.Marshal(v)
+	assert.NoError(t, err)
+	var readings struct {
+		Readings map[int]map[string]float64 `cbor:"readings"`
+		Nested   map[int]map[int64]string   `cbor:"nested"`
+	}
+	assert.NoError(t, cbor.Unmarshal(b, &readings))
+	assert.Equal(t, map[int]map[string]float64{1: {"value": 1.5}, -2: {"value": 2}}, readings.Readings)
+	assert.Equal(t, map[int]map[int64]string{3: {4: "x"}}, readings.Nested)
+
+	// the keys converted to strings take more space
+	v, err = sheriff.Marshal(&sheriff.Options{}, telemetry())
+	assert.NoError(t, err)
+	b2, err := cbor.Marshal(v)
+	assert.NoError(t, err)
+	assert.Greater(t, len(b2), len(b))
+}
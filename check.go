@@ -0,0 +1,104 @@
+package sheriff
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Check reports every malformed tag of the given types and of all types reachable from their fields, e.g. the
+// elements of slices and maps, instead of discovering them one Marshal call at a time. It's meant to be called
+// once during initialization or in a test:
+//
+//	if err := sheriff.Check(reflect.TypeOf(User{}), reflect.TypeOf(Order{})); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// The returned error joins a TagError for each problem, or is nil if there is none. Problems include
+// tags which Marshal ignores unless configured otherwise, e.g. empty groups (see Options.StrictGroups),
+// groups which aren't registered (see MustRegisterGroups) and unknown masks (see Options.EnableMasking).
+// Types behind interfaces can't be reached and have to be passed themselves.
+func Check(types ...reflect.Type) error {
+	c := checker{seen: make(map[reflect.Type]bool)}
+	for _, t := range types {
+		c.check(t)
+	}
+	errs := make([]error, len(c.errs))
+	for i, err := range c.errs {
+		errs[i] = err
+	}
+	return errors.Join(errs...)
+}
+
+// checker walks the types passed to Check.
+type checker struct {
+	seen map[reflect.Type]bool
+	errs []TagError
+}
+
+// check collects the tag errors of t and of the types reachable from it.
+func (c *checker) check(t reflect.Type) {
+	for k := t.Kind(); k == reflect.Ptr || k == reflect.Slice || k == reflect.Array || k == reflect.Map; k = t.Kind() {
+		if k == reflect.Map {
+			c.check(t.Key())
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || c.seen[t] {
+		return
+	}
+	c.seen[t] = true
+
+	fields := fieldInfosOf(t)
+	for i := range fields {
+		info := &fields[i]
+		// unexported fields aren't marshalled, unless they're embedded
+		if !info.field.IsExported() && !info.field.Anonymous {
+			continue
+		}
+		c.errs = append(c.errs, info.tagErrors(t)...)
+		c.check(info.field.Type)
+	}
+}
+
+// tagErrors returns the problems of the tags of the field f of the struct type t, in the order of the tags.
+func (f *fieldInfo) tagErrors(t reflect.Type) []TagError {
+	var errs []TagError
+	add := func(tag string, err error) {
+		if err != nil {
+			errs = append(errs, TagError{Type: t, Field: f.field.Name, Tag: tag, Err: err})
+		}
+	}
+	add(tagName, f.groupsErr)
+	add(tagName, f.unknownGroupErr)
+	add("groups_if", f.groupsIfErr)
+	add("sheriff", f.maxLenErr)
+	add("sheriff", f.inlineErr)
+	add("pii", f.piiErr)
+	if f.mask != nil {
+		add("mask", f.mask.check(t, f.field))
+	}
+	add("precision", f.precisionErr)
+	return errs
+}
+
+// TagError is a malformed tag of a struct field, see Check.
+type TagError struct {
+	// Type is the struct type holding the field.
+	Type reflect.Type
+	// Field is the name of the Go field.
+	Field string
+	// Tag is the name of the malformed tag, e.g. "groups" or "precision".
+	Tag string
+	// Err describes the problem.
+	Err error
+}
+
+// Error returns the message of Err, which names the field and the struct already.
+func (e TagError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns Err.
+func (e TagError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,73 @@
+package sheriff
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CheckNested struct {
+	Amount float64 `json:"amount" precision:"-1"`
+	Parent *CheckNested
+}
+
+type CheckMistakes struct {
+	Name  string                   `json:"name" groups:"api,,admin"`
+	Bio   string                   `json:"bio" sheriff:"maxlen=ten"`
+	Age   int                      `json:"age" pii:"hash"`
+	Phone string                   `json:"phone" mask:"middle3"`
+	Count int                      `json:"count" mask:"last2" precision:"2"`
+	Extra string                   `json:"extra" sheriff:"inline"`
+	Items []map[string]CheckNested `json:"items"`
+	Fine  string                   `json:"fine" groups:"api" sheriff:"maxlen=10" pii:"hash"`
+	// unexported fields aren't marshalled, so their tags don't matter
+	internal string `precision:"2"`
+}
+
+func TestCheck(t *testing.T) {
+	typ := reflect.TypeOf(CheckMistakes{})
+	err := Check(typ, reflect.TypeOf(&CheckNested{}))
+	assert.EqualError(t, err, `marshaller: groups tag "api,,admin" of field Name of sheriff.CheckMistakes contains an empty group
+marshaller: invalid maxlen "ten" of field Bio of sheriff.CheckMistakes
+marshaller: pii tag of field Age of sheriff.CheckMistakes requires a string or []byte, not int
+marshaller: unknown mask "middle3" of field Phone of sheriff.CheckMistakes
+marshaller: mask tag of field Count of sheriff.CheckMistakes requires a string, not int
+marshaller: precision tag of field Count of sheriff.CheckMistakes requires a float, not int
+marshaller: inline field Extra of sheriff.CheckMistakes must be a map, not string
+marshaller: invalid precision "-1" of field Amount of sheriff.CheckNested`)
+
+	var tagErrs []TagError
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		tagErrs = append(tagErrs, err.(TagError))
+	}
+	assert.Len(t, tagErrs, 8)
+	assert.Equal(t, TagError{Type: typ, Field: "Name", Tag: "groups", Err: InvalidGroupsTagError{Type: typ, Field: "Name", Tag: "api,,admin"}}, tagErrs[0])
+	assert.Equal(t, "mask", tagErrs[4].Tag)
+	assert.Equal(t, "precision", tagErrs[5].Tag)
+	assert.Equal(t, reflect.TypeOf(CheckNested{}), tagErrs[7].Type)
+	assert.True(t, errors.As(err, new(InvalidGroupsTagError)))
+
+	assert.NoError(t, Check(reflect.TypeOf(AModel{}), reflect.TypeOf(map[string][]*TestGroupsModel{}), reflect.TypeOf(0)))
+	assert.NoError(t, Check())
+}
+
+type CheckRegistered struct {
+	Name  string `json:"name" groups:"api,adminn"`
+	Phone string `json:"phone" mask:"middle3"`
+}
+
+func TestCheck_RegisteredGroupsAndMasks(t *testing.T) {
+	defer ResetRegisteredGroups()
+	MustRegisterGroups("api")
+	RegisterMask("middle3", maskFull)
+	defer func() {
+		maskRegistry.Lock()
+		delete(maskRegistry.masks, "middle3")
+		maskRegistry.Unlock()
+	}()
+
+	err := Check(reflect.TypeOf(CheckRegistered{}))
+	assert.EqualError(t, err, `marshaller: group "adminn" of field Name of sheriff.CheckRegistered isn't registered`)
+}
@@ -0,0 +1,10 @@
+module github.com/peoplecentrix/sheriff/chirender
+
+go 1.21
+
+require (
+	github.com/go-chi/render v1.0.3
+	github.com/peoplecentrix/sheriff v0.0.0-20261016174454-b08b1bfa4df7
+)
+
+require github.com/ajg/form v1.5.1 // indirect
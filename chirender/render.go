@@ -0,0 +1,81 @@
+// Package chirender integrates sheriff with the render package of go-chi.
+//
+// The renderers returned by NewRenderer and NewRendererList filter their data in Render, the encoding is left to
+// render.Respond (e.g. render.JSON). Errors returned by sheriff.Marshal are returned by render.Render and
+// render.RenderList.
+package chirender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/go-chi/render"
+	"github.com/peoplecentrix/sheriff"
+)
+
+// groupsContextKey is the context key of the groups set by WithGroups.
+type groupsContextKey struct{}
+
+// WithGroups returns a copy of ctx carrying groups, e.g. set by an authentication middleware. Renderers
+// rendering a request with such a context use these groups instead of sheriff.Options.Groups.
+func WithGroups(ctx context.Context, groups []string) context.Context {
+	return context.WithValue(ctx, groupsContextKey{}, groups)
+}
+
+// GroupsFromContext returns the groups set by WithGroups and whether there are any.
+func GroupsFromContext(ctx context.Context) ([]string, bool) {
+	groups, ok := ctx.Value(groupsContextKey{}).([]string)
+	return groups, ok
+}
+
+// NewRenderer returns a render.Renderer which filters data using options when rendered.
+func NewRenderer(options *sheriff.Options, data interface{}) render.Renderer {
+	return &renderer{options: options, data: data}
+}
+
+// NewRendererList returns a renderer for every element of the slice or array data, to be passed to
+// render.RenderList. It panics if data is neither a slice nor an array.
+func NewRendererList(options *sheriff.Options, data interface{}) []render.Renderer {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		panic(fmt.Sprintf("sheriff: NewRendererList of non-slice type %T", data))
+	}
+	list := make([]render.Renderer, v.Len())
+	for i := range list {
+		list[i] = NewRenderer(options, v.Index(i).Interface())
+	}
+	return list
+}
+
+// renderer is the render.Renderer returned by NewRenderer.
+type renderer struct {
+	options *sheriff.Options
+	data    interface{}
+	// filtered is the result of sheriff.Marshal, set by Render.
+	filtered interface{}
+}
+
+// Render implements render.Renderer.
+func (rd *renderer) Render(w http.ResponseWriter, r *http.Request) error {
+	options := rd.options
+	if groups, ok := GroupsFromContext(r.Context()); ok {
+		o := *options
+		o.Groups = groups
+		options = &o
+	}
+
+	filtered, err := sheriff.Marshal(options, rd.data)
+	if err != nil {
+		return err
+	}
+	rd.filtered = filtered
+	return nil
+}
+
+// MarshalJSON encodes the data filtered by Render.
+func (rd *renderer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rd.filtered)
+}
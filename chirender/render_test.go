@@ -0,0 +1,91 @@
+package chirender_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-chi/render"
+	"github.com/peoplecentrix/sheriff"
+	"github.com/peoplecentrix/sheriff/chirender"
+)
+
+type User struct {
+	Username string `json:"username" groups:"api"`
+	Email    string `json:"email" groups:"personal"`
+}
+
+type Failing struct{}
+
+func (Failing) Marshal(options *sheriff.Options) (interface{}, error) {
+	return nil, errors.New("failed")
+}
+
+type Response struct {
+	Failing Failing `json:"failing"`
+}
+
+func serve(handler http.HandlerFunc, r *http.Request) {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	body, _ := io.ReadAll(w.Result().Body)
+	fmt.Printf("%d %s", w.Code, body)
+}
+
+func ExampleNewRenderer() {
+	user := User{Username: "alice", Email: "alice@example.org"}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := render.Render(w, r, chirender.NewRenderer(&sheriff.Options{Groups: []string{"api"}}, user)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/user", nil))
+	// Output:
+	// 200 {"username":"alice"}
+}
+
+func ExampleNewRendererList() {
+	users := []User{
+		{Username: "alice", Email: "alice@example.org"},
+		{Username: "bob", Email: "bob@example.org"},
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := render.RenderList(w, r, chirender.NewRendererList(&sheriff.Options{Groups: []string{"api"}}, users)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/users", nil))
+	// Output:
+	// 200 [{"username":"alice"},{"username":"bob"}]
+}
+
+func ExampleWithGroups() {
+	user := User{Username: "alice", Email: "alice@example.org"}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := render.Render(w, r, chirender.NewRenderer(&sheriff.Options{Groups: []string{"api"}}, user)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/me", nil)
+	r = r.WithContext(chirender.WithGroups(r.Context(), []string{"api", "personal"}))
+	serve(handler, r)
+	// Output:
+	// 200 {"email":"alice@example.org","username":"alice"}
+}
+
+func ExampleNewRenderer_error() {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := render.Render(w, r, chirender.NewRenderer(&sheriff.Options{}, Response{})); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	// Output:
+	// 500 failed
+}
@@ -0,0 +1,186 @@
+package sheriff
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Collision is a pair of Go fields which are marshalled to the same key of an object, see DetectCollisions.
+type Collision struct {
+	// Type is the struct type whose object holds the key.
+	Type reflect.Type
+	// Path is the dotted path of the struct from the prototype, empty if it's the top level. Elements of slices,
+	// arrays and maps are described by the `*` segment.
+	Path string
+	// Key is the output key both fields are marshalled to.
+	Key string
+	// Field and OtherField are the colliding fields, in the order of the struct.
+	Field, OtherField CollisionField
+	// Conditional reports whether the collision depends on the requested groups, i.e. whether one of the fields
+	// has groups (or a groups_if tag) and isn't visible to everyone.
+	Conditional bool
+}
+
+// CollisionField is a field taking part in a Collision.
+type CollisionField struct {
+	// Path is the Go name of the field, prefixed by the names of the embedded fields holding it,
+	// e.g. `Audit.CreatedBy`.
+	Path string
+	// Groups are the groups which may read the field, including the ones inherited from embedded fields, nil if
+	// it's visible to everyone.
+	Groups []string
+}
+
+// DetectCollisions reports every pair of fields of the struct type of prototype, and of all struct types
+// reachable from its fields, which are marshalled to the same key, e.g. because two embedded structs have fields
+// of the same name, or an embedded struct has a field named like one of the outer struct. Which of them ends up
+// in the output isn't obvious, so it's meant to be called in a test:
+//
+//	func TestCollisions(t *testing.T) {
+//		collisions, err := sheriff.DetectCollisions((*User)(nil))
+//		if err != nil || len(collisions) > 0 {
+//			t.Fatal(collisions, err)
+//		}
+//	}
+//
+// Only the type is looked at, prototype may be a nil pointer. Collisions are reported for any groups, the ones
+// which only occur for some groups are marked as Conditional. Fields which no group may read are left out.
+// Untagged fields are assumed to be keyed by their Go name, i.e. Options.UntaggedKeyStyle and Options.FieldNamer
+// aren't taken into account, and inline maps aren't looked at. Types behind interfaces can't be reached.
+//
+// The collisions are ordered by their struct's Path and by Key. An error is returned if a groups_if tag is
+// malformed.
+func DetectCollisions(prototype interface{}) ([]Collision, error) {
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		return nil, nil
+	}
+	d := collisionDetector{seen: make(map[reflect.Type]bool), onPath: make(map[reflect.Type]bool)}
+	if err := d.value(t, ""); err != nil {
+		return nil, err
+	}
+	return d.collisions, nil
+}
+
+// collisionDetector walks the type passed to DetectCollisions.
+type collisionDetector struct {
+	seen map[reflect.Type]bool
+	// onPath are the struct types whose fields are being flattened, which embedded pointers may refer to again.
+	onPath     map[reflect.Type]bool
+	collisions []Collision
+}
+
+// flatField is a field of a struct or of one of its embedded structs, which is marshalled to key.
+type flatField struct {
+	key string
+	typ reflect.Type
+	CollisionField
+	conditional bool
+}
+
+// value detects the collisions of the struct types reachable from type t at path.
+func (d *collisionDetector) value(t reflect.Type, path string) error {
+	for k := t.Kind(); k == reflect.Ptr || k == reflect.Slice || k == reflect.Array || k == reflect.Map; k = t.Kind() {
+		if k != reflect.Ptr {
+			path = joinPath(path, "*")
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || d.seen[t] {
+		return nil
+	}
+	d.seen[t] = true
+
+	var fields []flatField
+	if err := d.flatten(t, "", nil, &fields); err != nil {
+		return err
+	}
+	// every pair of fields with the same key collides
+	var collisions []Collision
+	for i, f := range fields {
+		for _, other := range fields[i+1:] {
+			if other.key == f.key {
+				collisions = append(collisions, Collision{
+					Type:        t,
+					Path:        path,
+					Key:         f.key,
+					Field:       f.CollisionField,
+					OtherField:  other.CollisionField,
+					Conditional: f.conditional || other.conditional,
+				})
+			}
+		}
+	}
+	slices.SortStableFunc(collisions, func(a, b Collision) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	d.collisions = append(d.collisions, collisions...)
+
+	for _, f := range fields {
+		if err := d.value(f.typ, joinPath(path, f.key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flatten appends the fields marshalled into the object of the struct type t to fields, the fields of embedded
+// structs included. prefix is prepended to the Go names, inherited are the groups of the anonymous field t is
+// held by, which apply to the fields without groups.
+func (d *collisionDetector) flatten(t reflect.Type, prefix string, inherited []string, fields *[]flatField) error {
+	if d.onPath[t] {
+		return nil
+	}
+	d.onPath[t] = true
+	defer delete(d.onPath, t)
+
+	infos := fieldInfosOf(t)
+	for i := range infos {
+		info := &infos[i]
+		field := info.field
+		key := info.jsonName
+		if key == "" {
+			key = field.Name
+		}
+		if key == "-" || !field.IsExported() || info.inline {
+			continue
+		}
+		if info.groupsIfErr != nil {
+			return info.groupsIfErr
+		}
+		groups := info.groups
+		if groups == nil {
+			groups = inherited
+		}
+		if info.embedded {
+			tt := field.Type
+			if tt.Kind() == reflect.Ptr {
+				tt = tt.Elem()
+			}
+			if err := d.flatten(tt, prefix+field.Name+".", groups, fields); err != nil {
+				return err
+			}
+			continue
+		}
+		// fields whose groups may only write them are never marshalled, unless their groups_if condition holds
+		if groups != nil && len(groups) == 0 && info.groupsIf == nil {
+			continue
+		}
+		*fields = append(*fields, flatField{
+			key:            key,
+			typ:            field.Type,
+			CollisionField: CollisionField{Path: prefix + field.Name, Groups: slices.Clone(groups)},
+			conditional:    groups != nil || info.groupsIf != nil,
+		})
+	}
+	return nil
+}
+
+// joinPath appends the segment to the dotted path.
+func joinPath(path, segment string) string {
+	if path == "" {
+		return segment
+	}
+	return path + "." + segment
+}
@@ -0,0 +1,99 @@
+package sheriff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CollisionsAudit struct {
+	ID        int    `json:"id"`
+	CreatedBy string `json:"created_by" groups:"admin"`
+	Secret    string `json:"secret" groups:"admin:w"`
+}
+
+type CollisionsOwner struct {
+	CreatedBy string `json:"created_by" groups:"owner"`
+	Name      string
+}
+
+type CollisionsItem struct {
+	*CollisionsOwner
+	Label string `json:"Name"`
+}
+
+type CollisionsModel struct {
+	CollisionsAudit
+	*CollisionsOwner `groups:"user"`
+	ID               string                    `json:"id"`
+	Secret           string                    `json:"secret"`
+	Items            []CollisionsItem          `json:"items"`
+	ByID             map[string]CollisionsPost `json:"by_id"`
+	Meta             map[string]string         `json:"meta" sheriff:"inline"`
+	Named            CollisionsOwner           `json:"named"`
+	Ignored          string                    `json:"-"`
+}
+
+type CollisionsDraft struct {
+	Content string `json:"body" groups_if:"Draft=true" groups:"editor:w"`
+	Draft   bool   `json:"draft"`
+}
+
+type CollisionsPost struct {
+	Body string `json:"body"`
+	CollisionsDraft
+}
+
+func TestDetectCollisions(t *testing.T) {
+	collisions, err := DetectCollisions((*CollisionsModel)(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, []Collision{
+		{
+			Type:        reflect.TypeOf(CollisionsModel{}),
+			Key:         "created_by",
+			Field:       CollisionField{Path: "CollisionsAudit.CreatedBy", Groups: []string{"admin"}},
+			OtherField:  CollisionField{Path: "CollisionsOwner.CreatedBy", Groups: []string{"owner"}},
+			Conditional: true,
+		},
+		{
+			Type:       reflect.TypeOf(CollisionsModel{}),
+			Key:        "id",
+			Field:      CollisionField{Path: "CollisionsAudit.ID"},
+			OtherField: CollisionField{Path: "ID"},
+		},
+		{
+			Type:       reflect.TypeOf(CollisionsItem{}),
+			Path:       "items.*",
+			Key:        "Name",
+			Field:      CollisionField{Path: "CollisionsOwner.Name"},
+			OtherField: CollisionField{Path: "Label"},
+		},
+		{
+			Type:        reflect.TypeOf(CollisionsPost{}),
+			Path:        "by_id.*",
+			Key:         "body",
+			Field:       CollisionField{Path: "Body"},
+			OtherField:  CollisionField{Path: "CollisionsDraft.Content", Groups: []string{}},
+			Conditional: true,
+		},
+	}, collisions)
+}
+
+type CollisionsLoop struct {
+	*CollisionsLoop
+	Next *CollisionsLoop `json:"next"`
+}
+
+func TestDetectCollisions_None(t *testing.T) {
+	collisions, err := DetectCollisions(CollisionsLoop{})
+	assert.NoError(t, err)
+	assert.Empty(t, collisions)
+
+	collisions, err = DetectCollisions(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, collisions)
+
+	_, err = DetectCollisions([]GroupsIfInvalidValue{})
+	assert.EqualError(t, err, `marshaller: invalid groups_if value "high" of field Body of sheriff.GroupsIfInvalidValue for int`)
+}
@@ -0,0 +1,37 @@
+package sheriff
+
+import "reflect"
+
+// ComputedFields is the interface models can implement to contribute derived values to their output which aren't
+// stored in any field, e.g. a full name built from the first and last name.
+//
+// SheriffComputed is called with the options of the Marshal call once the fields of the struct are done. The
+// returned keys are merged into the output of the struct, replacing keys written by its fields. The values
+// are marshalled like the ones of a map, so that structs among them are filtered by the groups as well.
+type ComputedFields interface {
+	SheriffComputed(options *Options) (map[string]interface{}, error)
+}
+
+// mergeComputedFields merges the computed fields of the struct frame f into its result.
+func (s *marshalState) mergeComputedFields(f *frame) error {
+	computed, _ := receiver(f.v, typeInfoOf(f.t), implComputedFields)
+	fields, err := computed.(ComputedFields).SheriffComputed(s.options)
+	if err != nil {
+		return err
+	}
+	// marshalling the values pushes frames, which may move f
+	dest := f.dest
+	for key, value := range fields {
+		s.pushKey(key)
+		result, err := s.marshalValue(reflect.ValueOf(value), false)
+		s.pop()
+		if err != nil {
+			if s.recoverFrom(err) {
+				continue
+			}
+			return err
+		}
+		dest[key] = result
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ComputedProfile struct {
+	Bio   string `json:"bio" groups:"api"`
+	Email string `json:"email" groups:"admin"`
+}
+
+type ComputedUser struct {
+	First string   `json:"first" groups:"api"`
+	Last  string   `json:"last" groups:"api"`
+	Roles []string `json:"-"`
+	Fail  bool     `json:"-"`
+}
+
+func (u ComputedUser) SheriffComputed(options *Options) (map[string]interface{}, error) {
+	if u.Fail {
+		return nil, errors.New("computing failed")
+	}
+	computed := map[string]interface{}{
+		"full_name": u.First + " " + u.Last,
+		"profile":   ComputedProfile{Bio: "bio of " + u.First, Email: strings.ToLower(u.First) + "@example.com"},
+	}
+	if slices.Contains(options.Groups, "admin") {
+		computed["permissions"] = strings.Join(u.Roles, ",")
+		// computed values replace the ones of fields
+		computed["last"] = strings.ToUpper(u.Last)
+	}
+	return computed, nil
+}
+
+type ComputedPointer struct {
+	ID int `json:"id" groups:"api"`
+}
+
+func (p *ComputedPointer) SheriffComputed(options *Options) (map[string]interface{}, error) {
+	return map[string]interface{}{"ref": "item-" + strconv.Itoa(p.ID)}, nil
+}
+
+type ComputedTeam struct {
+	Name    string            `json:"name" groups:"api"`
+	Members []ComputedUser    `json:"members" groups:"api"`
+	Lead    *ComputedUser     `json:"lead" groups:"api"`
+	Items   []ComputedPointer `json:"items" groups:"api"`
+}
+
+func computedTeam() ComputedTeam {
+	alice := ComputedUser{First: "Alice", Last: "Smith", Roles: []string{"read", "write"}}
+	return ComputedTeam{
+		Name:    "core",
+		Members: []ComputedUser{alice, {First: "Bob", Last: "Jones", Roles: []string{"read"}}},
+		Lead:    &alice,
+		Items:   []ComputedPointer{{ID: 1}},
+	}
+}
+
+func TestMarshal_ComputedFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []string
+		expected string
+	}{
+		{
+			name:   "api",
+			groups: []string{"api"},
+			expected: `{"items":[{"id":1,"ref":"item-1"}],` +
+				`"lead":{"first":"Alice","full_name":"Alice Smith","last":"Smith","profile":{"bio":"bio of Alice"}},` +
+				`"members":[{"first":"Alice","full_name":"Alice Smith","last":"Smith","profile":{"bio":"bio of Alice"}},` +
+				`{"first":"Bob","full_name":"Bob Jones","last":"Jones","profile":{"bio":"bio of Bob"}}],"name":"core"}`,
+		},
+		{
+			name:   "admin",
+			groups: []string{"api", "admin"},
+			expected: `{"items":[{"id":1,"ref":"item-1"}],` +
+				`"lead":{"first":"Alice","full_name":"Alice Smith","last":"SMITH","permissions":"read,write",` +
+				`"profile":{"bio":"bio of Alice","email":"alice@example.com"}},` +
+				`"members":[{"first":"Alice","full_name":"Alice Smith","last":"SMITH","permissions":"read,write",` +
+				`"profile":{"bio":"bio of Alice","email":"alice@example.com"}},` +
+				`{"first":"Bob","full_name":"Bob Jones","last":"JONES","permissions":"read",` +
+				`"profile":{"bio":"bio of Bob","email":"bob@example.com"}}],"name":"core"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := &Options{Groups: test.groups}
+			v, err := Marshal(o, computedTeam())
+			assert.NoError(t, err)
+			actual, err := json.Marshal(v)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(computedTeam(), map[string]*Options{"a": o, "b": {Groups: []string{"api"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, v, all["a"])
+		})
+	}
+}
+
+func TestMarshal_ComputedFieldsRoot(t *testing.T) {
+	o := &Options{Groups: []string{"api"}}
+	user := ComputedUser{First: "Alice", Last: "Smith"}
+	expected := map[string]interface{}{
+		"first":     "Alice",
+		"last":      "Smith",
+		"full_name": "Alice Smith",
+		"profile":   map[string]interface{}{"bio": "bio of Alice"},
+	}
+
+	v, err := Marshal(o, user)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, v)
+
+	v, err = Marshal(o, &user)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, v)
+
+	all, err := MarshalAll(user, map[string]*Options{"a": o})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, all["a"])
+}
+
+func TestMarshal_ComputedFieldsError(t *testing.T) {
+	team := ComputedTeam{Members: []ComputedUser{{First: "Alice"}, {First: "Bob", Fail: true}}}
+
+	_, err := Marshal(&Options{Groups: []string{"api"}}, team)
+	assert.EqualError(t, err, "computing failed")
+
+	v, err := Marshal(&Options{Groups: []string{"api"}, ErrorPolicy: SkipSilently}, team)
+	assert.NoError(t, err)
+	members := v.(map[string]interface{})["members"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"first": "Bob", "last": ""}, members[1])
+}
@@ -0,0 +1,107 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ConcurrencyModel struct {
+	UserInfo
+	*UserPublicInfo `groups:"admin"`
+	Recursive       TestRecursiveModel       `json:"recursive" groups:"public,admin"`
+	Marshaller      IsMarshaller             `json:"marshaller" groups:"admin"`
+	Items           []InterfaceableBeta      `json:"items" groups:"public"`
+	Lookup          map[string]AModel        `json:"lookup" groups:"admin"`
+	Deferred        interface{}              `json:"deferred" groups:"public"`
+	Nested          map[int]*TestGroupsModel `json:"nested" groups:"public"`
+}
+
+func concurrencyData() ConcurrencyModel {
+	groupsModel := &TestGroupsModel{
+		DefaultMarshal: "DefaultMarshal",
+		OnlyGroupTest:  "OnlyGroupTest",
+		SliceString:    []string{"test", "bla"},
+	}
+	return ConcurrencyModel{
+		UserInfo: UserInfo{
+			UserPrivateInfo: UserPrivateInfo{Age: "20"},
+			UserPublicInfo:  UserPublicInfo{ID: "F94", Email: "hello@hello.com"},
+		},
+		UserPublicInfo: &UserPublicInfo{ID: "F95"},
+		Recursive: TestRecursiveModel{
+			SomeData:     "SomeData",
+			GroupsData:   []*TestGroupsModel{groupsModel},
+			IsMarshaller: IsMarshaller{"test"},
+		},
+		Marshaller: IsMarshaller{"test"},
+		Items:      []InterfaceableBeta{{1, "secret"}, {2, "secret"}},
+		Lookup:     map[string]AModel{"a": {true, false}},
+		Deferred:   Defer(&Options{Groups: []string{"test"}}, groupsModel),
+		Nested:     map[int]*TestGroupsModel{1: groupsModel},
+	}
+}
+
+// TestMarshal_Concurrent hammers Marshal with shared Options from many goroutines.
+// Run with `go test -race` to detect data races.
+func TestMarshal_Concurrent(t *testing.T) {
+	data := concurrencyData()
+	optionSets := []*Options{
+		{Groups: []string{"public"}},
+		{Groups: []string{"admin"}},
+		{Groups: []string{"public", "private", "test"}},
+		{},
+	}
+
+	expected := make([]string, len(optionSets))
+	for i, o := range optionSets {
+		actualMap, err := Marshal(&Options{Groups: o.Groups}, data)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		expected[i] = string(actual)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 64; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				n := (g + i) % len(optionSets)
+				actualMap, err := Marshal(optionSets[n], data)
+				if !assert.NoError(t, err) {
+					return
+				}
+				actual, err := json.Marshal(actualMap)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, expected[n], string(actual))
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// TestJSON_Concurrent hammers the JSON helper and Defer from many goroutines.
+func TestJSON_Concurrent(t *testing.T) {
+	data := concurrencyData()
+	o := &Options{Groups: []string{"public"}}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				JSON(data, "root", "public,admin")
+				_, err := json.Marshal(Defer(o, data))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
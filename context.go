@@ -0,0 +1,74 @@
+package sheriff
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// contextCheckInterval is the number of struct fields, slice elements and map entries marshalled between
+// checking the context passed to MarshalContext, in addition to checking it before every struct.
+const contextCheckInterval = 128
+
+// ContextError is returned by MarshalContext if its context is done before marshalling finished.
+type ContextError struct {
+	// Path is the dotted path of the value which was about to be marshalled, empty if it's the top level.
+	Path string
+	// Err is the error of the context, i.e. context.Canceled or context.DeadlineExceeded.
+	Err error
+}
+
+func (e ContextError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("marshaller: %s", e.Err)
+	}
+	return fmt.Sprintf("marshaller: %s at %s", e.Err, e.Path)
+}
+
+// Unwrap returns the error of the context.
+func (e ContextError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalContext is like Marshal, but stops early with a ContextError once ctx is done, e.g. because the client
+// waiting for the response disconnected. ctx is checked before every struct and every 128 struct fields, slice
+// elements or map entries, so that checking it doesn't add up on large data. A ContextError isn't affected
+// by Options.ErrorPolicy.
+func MarshalContext(ctx context.Context, options *Options, data interface{}) (interface{}, error) {
+	s := acquireMarshalState(options)
+	defer s.release()
+	s.ctx = ctx
+	s.done = ctx.Done()
+	v := reflect.ValueOf(data)
+	if options.Instrumentation == nil {
+		return s.marshalRoot(v)
+	}
+
+	var dest interface{}
+	err := s.instrument(v, func() (err error) {
+		dest, err = s.marshalRoot(v)
+		return err
+	})
+	return dest, err
+}
+
+// checkContext returns a ContextError if the context passed to MarshalContext is done. It must only be called
+// if s.done is set.
+func (s *marshalState) checkContext() error {
+	select {
+	case <-s.done:
+		return ContextError{Path: s.currentPath(), Err: s.ctx.Err()}
+	default:
+		return nil
+	}
+}
+
+// tickContext calls checkContext every contextCheckInterval calls.
+func (s *marshalState) tickContext() error {
+	s.contextTicks++
+	if s.contextTicks < contextCheckInterval {
+		return nil
+	}
+	s.contextTicks = 0
+	return s.checkContext()
+}
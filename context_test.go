@@ -0,0 +1,85 @@
+package sheriff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ContextCountingValue counts how often it's marshalled and cancels the context once it's marshalled cancelAt times.
+type ContextCountingValue struct {
+	calls    *int
+	cancelAt int
+	cancel   context.CancelFunc
+}
+
+func (v ContextCountingValue) Marshal(options *Options) (interface{}, error) {
+	*v.calls++
+	if *v.calls == v.cancelAt {
+		v.cancel()
+	}
+	return *v.calls, nil
+}
+
+func TestMarshalContext(t *testing.T) {
+	values := make([]LinesModel, 1000)
+	actual, err := MarshalContext(context.Background(), &Options{Groups: []string{"user"}}, values)
+	assert.NoError(t, err)
+	assert.Len(t, actual, 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	actual, err = MarshalContext(ctx, &Options{Groups: []string{"user"}}, values[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": 0, "name": ""}}, actual)
+}
+
+func TestMarshalContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// structs are checked before marshalling them
+	_, err := MarshalContext(ctx, &Options{}, make([]LinesModel, 100000))
+	assert.Equal(t, ContextError{Path: "0", Err: context.Canceled}, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.EqualError(t, err, "marshaller: context canceled at 0")
+
+	_, err = MarshalContext(ctx, &Options{}, LinesModel{})
+	assert.Equal(t, ContextError{Err: context.Canceled}, err)
+
+	// other elements are checked periodically
+	_, err = MarshalContext(ctx, &Options{}, make([]int, 100000))
+	assert.Equal(t, ContextError{Path: "127", Err: context.Canceled}, err)
+
+	// the error isn't collected
+	_, err = MarshalContext(ctx, &Options{ErrorPolicy: CollectAll}, map[string]interface{}{"values": make([]LinesModel, 1)})
+	assert.Equal(t, ContextError{Path: "values.0", Err: context.Canceled}, err)
+}
+
+func TestMarshalContext_CancelledWhileMarshalling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	values := make([]ContextCountingValue, 10000)
+	for i := range values {
+		values[i] = ContextCountingValue{calls: &calls, cancelAt: 1000, cancel: cancel}
+	}
+
+	_, err := MarshalContext(ctx, &Options{}, values)
+	var contextErr ContextError
+	assert.True(t, errors.As(err, &contextErr))
+	assert.Equal(t, context.Canceled, contextErr.Err)
+	assert.LessOrEqual(t, calls, 1000+contextCheckInterval)
+}
+
+func TestMarshalContext_Deadline(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	_, err := MarshalContext(ctx, &Options{}, map[string]interface{}{"user": LinesModel{}})
+	assert.Equal(t, ContextError{Path: "user", Err: context.DeadlineExceeded}, err)
+}
@@ -0,0 +1,162 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// CoverageReport describes how the fields of struct types are protected by groups, see Coverage. It's meant to be
+// marshalled to JSON, e.g. for a security review.
+type CoverageReport struct {
+	// Types holds an entry for each struct type, sorted by Type.
+	Types []TypeCoverage `json:"types"`
+}
+
+// TypeCoverage describes the groups of the fields of a struct type. Fields are named by their Go name, the fields
+// of embedded structs are prefixed by the name of the embedded field, e.g. `Audit.CreatedBy`.
+type TypeCoverage struct {
+	// Type is the package path and name of the struct type, e.g. `example.com/models.User`.
+	Type string `json:"type"`
+	// Ungrouped are the fields without groups, which are visible to everyone.
+	Ungrouped []string `json:"ungrouped,omitempty"`
+	// Unregistered maps fields to their groups which aren't registered using MustRegisterGroups. It's empty as long
+	// as no groups are registered.
+	Unregistered map[string][]string `json:"unregistered,omitempty"`
+	// Groups are the groups of the fields, sorted, regardless of their access.
+	Groups []string `json:"groups,omitempty"`
+	// Unrequested are the Groups which none of the options passed to CoverageReport.Requested requests.
+	Unrequested []string `json:"unrequested,omitempty"`
+}
+
+// Coverage returns a report of the groups of the fields of the struct types of the prototypes and of all struct
+// types reachable from their fields, e.g. to find fields which lack a groups tag. Only the types are looked at,
+// prototypes may be nil pointers. Like with Check, types behind interfaces can't be reached and have to be passed
+// themselves.
+//
+// Groups are taken from the groups tags, or else from RegisterFieldGroups, and fields without groups inherit the
+// ones of the anonymous struct field holding them, like Marshal does. Fields which are never marshalled, i.e.
+// unexported fields and fields tagged `json:"-"`, aren't reported. Call CoverageReport.Requested to find the
+// groups which aren't requested by the Options in use.
+//
+// An error is returned if a prototype is nil or no struct type can be reached from it.
+func Coverage(prototypes ...interface{}) (*CoverageReport, error) {
+	c := coverageWalker{seen: make(map[reflect.Type]bool), onPath: make(map[reflect.Type]bool)}
+	for _, p := range prototypes {
+		t := reflect.TypeOf(p)
+		if t == nil || !c.walk(t) && !c.seen[structTypeOf(t)] {
+			return nil, fmt.Errorf("marshaller: Coverage of %v, which holds no struct type", t)
+		}
+	}
+	slices.SortFunc(c.types, func(a, b TypeCoverage) int {
+		return strings.Compare(a.Type, b.Type)
+	})
+	return &CoverageReport{Types: c.types}, nil
+}
+
+// Requested sets the Unrequested groups of every type to the ones which aren't requested by any of the given
+// options, considering their Groups and GroupMatcher. Options.Authorizer isn't consulted.
+func (r *CoverageReport) Requested(options ...*Options) {
+	states := make([]*marshalState, len(options))
+	for i, o := range options {
+		states[i] = acquireMarshalState(o)
+		defer states[i].release()
+	}
+	for i := range r.Types {
+		tc := &r.Types[i]
+		tc.Unrequested = nil
+		for _, group := range tc.Groups {
+			requested := false
+			for _, s := range states {
+				if s.matchesGroups([]string{group}, s.groups) {
+					requested = true
+					break
+				}
+			}
+			if !requested {
+				tc.Unrequested = append(tc.Unrequested, group)
+			}
+		}
+	}
+}
+
+// coverageWalker walks the types passed to Coverage.
+type coverageWalker struct {
+	seen map[reflect.Type]bool
+	// onPath are the struct types whose fields are being reported, which embedded pointers may refer to again.
+	onPath map[reflect.Type]bool
+	types  []TypeCoverage
+}
+
+// structTypeOf returns the type held by the pointers, slices, arrays and maps of type t.
+func structTypeOf(t reflect.Type) reflect.Type {
+	for k := t.Kind(); k == reflect.Ptr || k == reflect.Slice || k == reflect.Array || k == reflect.Map; k = t.Kind() {
+		t = t.Elem()
+	}
+	return t
+}
+
+// walk reports the struct type held by t and the ones reachable from it, and reports whether t holds a struct type
+// which hasn't been reported before.
+func (c *coverageWalker) walk(t reflect.Type) bool {
+	t = structTypeOf(t)
+	if t.Kind() != reflect.Struct || c.seen[t] {
+		return false
+	}
+	c.seen[t] = true
+
+	tc := TypeCoverage{Type: t.String()}
+	if t.Name() != "" && t.PkgPath() != "" {
+		tc.Type = t.PkgPath() + "." + t.Name()
+	}
+	declared := make(map[string]bool)
+	c.fields(t, "", nil, &tc, declared)
+	for group := range declared {
+		tc.Groups = append(tc.Groups, group)
+	}
+	slices.Sort(tc.Groups)
+	c.types = append(c.types, tc)
+	return true
+}
+
+// fields reports the fields of the struct type t to tc, prefixed by prefix. inherited are the groups of the
+// anonymous field t is held by, which apply to the fields without groups.
+func (c *coverageWalker) fields(t reflect.Type, prefix string, inherited []GroupAccess, tc *TypeCoverage, declared map[string]bool) {
+	if c.onPath[t] {
+		return
+	}
+	c.onPath[t] = true
+	defer delete(c.onPath, t)
+
+	fields := fieldInfosOf(t)
+	for i := range fields {
+		field := fields[i].field
+		if !field.IsExported() || fields[i].jsonName == "-" {
+			continue
+		}
+		name := prefix + field.Name
+		groups := FieldGroups(t, field)
+		for _, g := range groups {
+			declared[g.Group] = true
+			if !isGroupRegistered(g.Group) {
+				if tc.Unregistered == nil {
+					tc.Unregistered = make(map[string][]string)
+				}
+				tc.Unregistered[name] = append(tc.Unregistered[name], g.Group)
+			}
+		}
+		if groups == nil {
+			groups = inherited
+		}
+
+		if fields[i].embedded {
+			c.fields(structTypeOf(field.Type), name+".", groups, tc, declared)
+			continue
+		}
+		if groups == nil {
+			tc.Ungrouped = append(tc.Ungrouped, name)
+		}
+		c.walk(field.Type)
+	}
+}
@@ -0,0 +1,98 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CoverageAudit struct {
+	CreatedBy string `json:"created_by"`
+	Note      string `json:"note" groups:"user"`
+}
+
+type CoverageAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street" groups:"owner"`
+}
+
+type CoverageUser struct {
+	*CoverageAudit `groups:"admin"`
+	ID             int                         `json:"id"`
+	Email          string                      `json:"email" groups:"owner,admn"`
+	Password       string                      `json:"password" groups:"owner:w"`
+	Addresses      []CoverageAddress           `json:"addresses" groups:"owner"`
+	ByLabel        map[string]*CoverageAddress `json:"by_label" groups:"owner"`
+	Hidden         string                      `json:"-"`
+	internal       string
+}
+
+func TestCoverage(t *testing.T) {
+	report, err := Coverage((*CoverageUser)(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, &CoverageReport{Types: []TypeCoverage{
+		{
+			Type:      "github.com/peoplecentrix/sheriff.CoverageAddress",
+			Ungrouped: []string{"City"},
+			Groups:    []string{"owner"},
+		},
+		{
+			Type:      "github.com/peoplecentrix/sheriff.CoverageUser",
+			Ungrouped: []string{"ID"},
+			Groups:    []string{"admin", "admn", "owner", "user"},
+		},
+	}}, report)
+
+	MustRegisterGroups("admin", "owner", "user")
+	defer ResetRegisteredGroups()
+	report, err = Coverage(CoverageUser{}, []CoverageAddress{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"Email": {"admn"}}, report.Types[1].Unregistered)
+
+	report.Requested(&Options{Groups: []string{"owner"}}, &Options{Groups: []string{"ad*"}, GroupMatcher: GlobGroups})
+	assert.Nil(t, report.Types[0].Unrequested)
+	assert.Equal(t, []string{"user"}, report.Types[1].Unrequested)
+
+	b, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"types":[
+		{"type":"github.com/peoplecentrix/sheriff.CoverageAddress","ungrouped":["City"],"groups":["owner"]},
+		{"type":"github.com/peoplecentrix/sheriff.CoverageUser","ungrouped":["ID"],"unregistered":{"Email":["admn"]},
+			"groups":["admin","admn","owner","user"],"unrequested":["user"]}
+	]}`, string(b))
+}
+
+type CoverageEmbedded struct {
+	CoverageAudit
+	*CoverageLoop
+	Name string `json:"name" groups:"public"`
+}
+
+type CoverageLoop struct {
+	*CoverageLoop
+	Level int `json:"level"`
+}
+
+func TestCoverage_Embedded(t *testing.T) {
+	report, err := Coverage(CoverageEmbedded{})
+	assert.NoError(t, err)
+	assert.Equal(t, []TypeCoverage{{
+		Type:      "github.com/peoplecentrix/sheriff.CoverageEmbedded",
+		Ungrouped: []string{"CoverageAudit.CreatedBy", "CoverageLoop.Level"},
+		Groups:    []string{"public", "user"},
+	}}, report.Types)
+}
+
+func TestCoverage_Errors(t *testing.T) {
+	_, err := Coverage(nil)
+	assert.EqualError(t, err, "marshaller: Coverage of <nil>, which holds no struct type")
+
+	_, err = Coverage(map[string]int{})
+	assert.EqualError(t, err, "marshaller: Coverage of map[string]int, which holds no struct type")
+
+	// types may be passed several times
+	report, err := Coverage(CoverageAddress{}, &CoverageAddress{})
+	assert.NoError(t, err)
+	assert.Len(t, report.Types, 1)
+}
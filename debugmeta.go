@@ -0,0 +1,35 @@
+package sheriff
+
+import "reflect"
+
+// withDebugMeta returns result, the top-level result of marshalling v, with the metadata of
+// Options.DebugMetaKey added if it's an object.
+//
+// The object is copied, as it may be owned by the caller, e.g. if it was returned by a Marshaller.
+func (s *marshalState) withDebugMeta(v reflect.Value, result interface{}) (interface{}, error) {
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return result, nil
+	}
+	key := s.options.DebugMetaKey
+	if _, ok := m[key]; ok {
+		return nil, ExtraKeyError{Type: reflect.Indirect(v).Type(), Key: key}
+	}
+	dest := make(map[string]interface{}, len(m)+1)
+	for k, value := range m {
+		dest[k] = value
+	}
+
+	meta := map[string]interface{}{
+		// the groups are copied, as the result mustn't share the options' slice
+		"groups": append([]string{}, s.groups...),
+	}
+	if len(s.options.OmitFields) > 0 {
+		meta["omit_fields"] = append([]string(nil), s.options.OmitFields...)
+	}
+	if len(s.options.OnlyFields) > 0 {
+		meta["only_fields"] = append([]string(nil), s.options.OnlyFields...)
+	}
+	dest[key] = meta
+	return dest, nil
+}
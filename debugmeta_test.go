@@ -0,0 +1,80 @@
+package sheriff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type DebugMetaModel struct {
+	Name   string            `json:"name" groups:"api"`
+	Email  string            `json:"email" groups:"admin"`
+	Nested DebugMetaNested   `json:"nested" groups:"api"`
+	Items  []DebugMetaNested `json:"items" groups:"api"`
+}
+
+type DebugMetaNested struct {
+	Value string `json:"value" groups:"api"`
+}
+
+type DebugMetaCollision struct {
+	Meta string `json:"_sheriff"`
+}
+
+type DebugMetaMarshaller map[string]interface{}
+
+func (m DebugMetaMarshaller) Marshal(options *Options) (interface{}, error) {
+	return map[string]interface{}(m), nil
+}
+
+func TestMarshal_DebugMetaKey(t *testing.T) {
+	v := DebugMetaModel{Name: "alice", Email: "alice@example.org", Nested: DebugMetaNested{Value: "v"}, Items: []DebugMetaNested{{Value: "i"}}}
+
+	// it's off by default
+	actual, err := Marshal(&Options{Groups: []string{"api"}}, v)
+	assert.NoError(t, err)
+	assert.NotContains(t, actual, "_sheriff")
+
+	options := &Options{Groups: []string{"api", " admin"}, DebugMetaKey: "_sheriff", OmitFields: []string{"email"}}
+	actual, err = Marshal(options, v)
+	assert.NoError(t, err)
+	// it's only added at the top level
+	assert.Equal(t, map[string]interface{}{
+		"name":   "alice",
+		"nested": map[string]interface{}{"value": "v"},
+		"items":  []interface{}{map[string]interface{}{"value": "i"}},
+		"_sheriff": map[string]interface{}{
+			"groups":      []string{"api", "admin"},
+			"omit_fields": []string{"email"},
+		},
+	}, actual)
+
+	all, err := MarshalAll(v, map[string]*Options{"a": options, "b": {Groups: []string{"api"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, actual, all["a"])
+	assert.NotContains(t, all["b"], "_sheriff")
+
+	actual, err = Marshal(&Options{Groups: []string{"api"}, DebugMetaKey: "_sheriff", OnlyFields: []string{"name"}}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "alice", "_sheriff": map[string]interface{}{"groups": []string{"api"}, "only_fields": []string{"name"}}}, actual)
+
+	b, err := MarshalAppend(nil, &Options{Groups: []string{"api"}, DebugMetaKey: "_sheriff"}, []DebugMetaNested{{Value: "i"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"value":"i"}]`, string(b))
+}
+
+func TestMarshal_DebugMetaKeyCollision(t *testing.T) {
+	_, err := Marshal(&Options{DebugMetaKey: "_sheriff"}, &DebugMetaCollision{})
+	assert.Equal(t, ExtraKeyError{Type: reflect.TypeOf(DebugMetaCollision{}), Key: "_sheriff"}, err)
+
+	_, err = MarshalWith(&Options{DebugMetaKey: "_sheriff"}, DebugMetaModel{}, map[string]interface{}{"_sheriff": 1})
+	assert.Equal(t, ExtraKeyError{Type: reflect.TypeOf(DebugMetaModel{}), Key: "_sheriff"}, err)
+
+	// the map returned by a Marshaller isn't modified
+	m := DebugMetaMarshaller{"a": 1}
+	actual, err := Marshal(&Options{DebugMetaKey: "_sheriff"}, m)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": 1, "_sheriff": map[string]interface{}{"groups": []string{}}}, actual)
+	assert.Equal(t, DebugMetaMarshaller{"a": 1}, m)
+}
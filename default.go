@@ -0,0 +1,33 @@
+package sheriff
+
+import "sync/atomic"
+
+// defaultOptions holds the options set using SetDefault, nil if none are set.
+var defaultOptions atomic.Pointer[Options]
+
+// SetDefault sets the options used by MarshalDefault and by JSON if no groups are passed.
+// A copy of options is stored, so modifying them afterwards has no effect. SetDefault(nil) restores
+// the empty Options.
+//
+// SetDefault is safe to be called concurrently with marshalling, e.g. to reload the configuration.
+func SetDefault(options *Options) {
+	if options == nil {
+		defaultOptions.Store(nil)
+		return
+	}
+	o := *options
+	defaultOptions.Store(&o)
+}
+
+// MarshalDefault marshals data using the options set by SetDefault.
+func MarshalDefault(data interface{}) (interface{}, error) {
+	return Marshal(getDefault(), data)
+}
+
+// getDefault returns the options set by SetDefault, or empty Options if none are set.
+func getDefault() *Options {
+	if options := defaultOptions.Load(); options != nil {
+		return options
+	}
+	return &Options{}
+}
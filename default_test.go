@@ -0,0 +1,67 @@
+package sheriff
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalDefault(t *testing.T) {
+	defer SetDefault(nil)
+
+	v := &TestGroupsModel{OnlyGroupTest: "OnlyGroupTest", OnlyGroupTestOther: "OnlyGroupTestOther"}
+
+	actual, err := MarshalDefault(v)
+	assert.NoError(t, err)
+	assert.NotContains(t, actual, "only_group_test")
+
+	options := &Options{Groups: []string{"test"}}
+	SetDefault(options)
+	// modifying the options afterwards doesn't affect the default
+	options.Groups = []string{"test-other"}
+
+	actual, err = MarshalDefault(v)
+	assert.NoError(t, err)
+	assert.Contains(t, actual, "only_group_test")
+	assert.NotContains(t, actual, "only_group_test_other")
+
+	// JSON uses the default if no groups are passed
+	assert.Contains(t, JSON(v, "", ""), "only_group_test")
+	assert.Contains(t, JSON(v, "", "test-other"), "only_group_test_other")
+
+	SetDefault(nil)
+	actual, err = MarshalDefault(v)
+	assert.NoError(t, err)
+	assert.NotContains(t, actual, "only_group_test")
+}
+
+func TestSetDefault_Concurrent(t *testing.T) {
+	defer SetDefault(nil)
+
+	v := &TestGroupsModel{OnlyGroupTest: "OnlyGroupTest"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if (i+j)%2 == 0 {
+					SetDefault(&Options{Groups: []string{"test"}})
+				} else {
+					SetDefault(nil)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := MarshalDefault(v)
+				assert.NoError(t, err)
+				JSON(v, "data", "")
+			}
+		}()
+	}
+	wg.Wait()
+}
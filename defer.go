@@ -0,0 +1,28 @@
+package sheriff
+
+import "encoding/json"
+
+// Defer returns a json.Marshaler which postpones marshalling data with the given options until
+// it is actually being encoded.
+//
+// This allows embedding sheriff-filtered values into other structs (e.g. a response envelope) or
+// passing them to libraries accepting a json.Marshaler without building the filtered map upfront.
+// Errors returned by Marshal are returned from MarshalJSON and therefore propagated by encoding/json.
+func Defer(options *Options, data interface{}) json.Marshaler {
+	return deferred{options: options, data: data}
+}
+
+// deferred is the json.Marshaler returned by Defer.
+type deferred struct {
+	options *Options
+	data    interface{}
+}
+
+// MarshalJSON runs Marshal on the wrapped data and encodes the result using encoding/json.
+func (d deferred) MarshalJSON() ([]byte, error) {
+	v, err := Marshal(d.options, d.data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
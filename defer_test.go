@@ -0,0 +1,58 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type DeferResponse struct {
+	Data interface{} `json:"data"`
+}
+
+func TestDefer(t *testing.T) {
+	testModel := &TestGroupsModel{
+		DefaultMarshal: "DefaultMarshal",
+		OnlyGroupTest:  "OnlyGroupTest",
+		OmitEmpty:      "OmitEmpty",
+	}
+
+	actual, err := json.Marshal(DeferResponse{
+		Data: Defer(&Options{Groups: []string{"test"}}, testModel),
+	})
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(map[string]interface{}{
+		"data": map[string]interface{}{
+			"default_marshal":      "DefaultMarshal",
+			"only_group_test":      "OnlyGroupTest",
+			"omit_empty":           "OmitEmpty",
+			"group_test_and_other": "",
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual))
+}
+
+type DeferFailingMarshaller struct{}
+
+var errDeferFailing = errors.New("failing marshaller")
+
+func (DeferFailingMarshaller) Marshal(options *Options) (interface{}, error) {
+	return nil, errDeferFailing
+}
+
+type DeferFailingModel struct {
+	Failing DeferFailingMarshaller `json:"failing"`
+}
+
+func TestDefer_Error(t *testing.T) {
+	_, err := json.Marshal(DeferResponse{
+		Data: Defer(&Options{}, DeferFailingModel{}),
+	})
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, errDeferFailing))
+}
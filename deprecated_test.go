@@ -0,0 +1,99 @@
+package sheriff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type DeprecatedAddress struct {
+	Street string `json:"street"`
+	Zip    string `json:"zip,omitempty" deprecated:"use postal_code"`
+	Postal string `json:"postal_code"`
+}
+
+type DeprecatedUser struct {
+	FullName  string              `json:"full_name"`
+	Name      string              `json:"name" deprecated:"use full_name"`
+	Email     string              `json:"email" groups:"admin" deprecated:"use contact.email"`
+	Nickname  string              `json:"nickname,omitempty" deprecated:""`
+	Address   DeprecatedAddress   `json:"address"`
+	Addresses []DeprecatedAddress `json:"addresses"`
+}
+
+func deprecatedUser() DeprecatedUser {
+	return DeprecatedUser{
+		FullName: "Alice Smith",
+		Name:     "Alice",
+		Email:    "alice@example.com",
+		Address:  DeprecatedAddress{Street: "Main St", Zip: "12345", Postal: "12345"},
+		Addresses: []DeprecatedAddress{
+			{Street: "Side St", Zip: "54321", Postal: "54321"},
+			{Street: "Back St", Postal: "99999"},
+		},
+	}
+}
+
+func TestMarshal_OnDeprecated(t *testing.T) {
+	calls := make(map[string]int)
+	notes := make(map[string]string)
+	options := &Options{
+		OnDeprecated: func(path string, note string) {
+			calls[path]++
+			notes[path] = note
+		},
+	}
+
+	v, err := Marshal(options, deprecatedUser())
+	assert.NoError(t, err)
+	// deprecated fields are still emitted
+	assert.Equal(t, "Alice", v.(map[string]interface{})["name"])
+	assert.Equal(t, "12345", v.(map[string]interface{})["address"].(map[string]interface{})["zip"])
+
+	// fields excluded by the group check or omitempty aren't reported
+	assert.Equal(t, map[string]int{"name": 1, "address.zip": 1, "addresses.0.zip": 1}, calls)
+	assert.Equal(t, map[string]string{"name": "use full_name", "address.zip": "use postal_code", "addresses.0.zip": "use postal_code"}, notes)
+
+	calls = make(map[string]int)
+	options.Groups = []string{"admin"}
+	_, err = Marshal(options, deprecatedUser())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"name": 1, "email": 1, "address.zip": 1, "addresses.0.zip": 1}, calls)
+
+	// the streaming encoder reports the same fields
+	calls = make(map[string]int)
+	_, err = MarshalAppend(nil, options, deprecatedUser())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"name": 1, "email": 1, "address.zip": 1, "addresses.0.zip": 1}, calls)
+}
+
+func TestMarshal_OmitDeprecated(t *testing.T) {
+	called := 0
+	options := &Options{
+		Groups:         []string{"admin"},
+		OmitDeprecated: true,
+		ExcludedAsNull: true,
+		OnDeprecated:   func(path string, note string) { called++ },
+	}
+	v, err := Marshal(options, deprecatedUser())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"full_name": "Alice Smith",
+		"address":   map[string]interface{}{"street": "Main St", "postal_code": "12345"},
+		"addresses": []interface{}{
+			map[string]interface{}{"street": "Side St", "postal_code": "54321"},
+			map[string]interface{}{"street": "Back St", "postal_code": "99999"},
+		},
+	}, v)
+	assert.Equal(t, 0, called)
+
+	// deprecated fields aren't null with ExcludedAsNull either
+	options.Groups = nil
+	v, err = Marshal(options, deprecatedUser())
+	assert.NoError(t, err)
+	assert.NotContains(t, v, "email")
+
+	keys, err := Keys(&Options{OmitDeprecated: true}, DeprecatedAddress{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"postal_code", "street"}, keys)
+}
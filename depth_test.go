@@ -0,0 +1,91 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type DepthBase struct {
+	ID int `json:"id"`
+}
+
+type DepthCountry struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type DepthCity struct {
+	DepthBase
+	Name    string       `json:"name"`
+	Country DepthCountry `json:"country"`
+}
+
+type DepthUser struct {
+	ID        int          `json:"id"`
+	Name      string       `json:"name"`
+	City      DepthCity    `json:"city"`
+	Cities    []DepthCity  `json:"cities"`
+	CityPtr   *DepthCity   `json:"city_ptr"`
+	Country   DepthCountry `json:"country"`
+	Following []DepthBase  `json:"following"`
+}
+
+func TestMarshal_MaxRenderDepth(t *testing.T) {
+	city := DepthCity{DepthBase: DepthBase{ID: 2}, Name: "Zurich", Country: DepthCountry{Code: "CH", Name: "Switzerland"}}
+	v := DepthUser{
+		ID:        1,
+		Name:      "alice",
+		City:      city,
+		Cities:    []DepthCity{city},
+		CityPtr:   &city,
+		Country:   city.Country,
+		Following: []DepthBase{{ID: 3}},
+	}
+
+	tests := []struct {
+		name     string
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "unlimited",
+			options:  &Options{},
+			expected: `{"cities":[{"country":{"code":"CH","name":"Switzerland"},"id":2,"name":"Zurich"}],"city":{"country":{"code":"CH","name":"Switzerland"},"id":2,"name":"Zurich"},"city_ptr":{"country":{"code":"CH","name":"Switzerland"},"id":2,"name":"Zurich"},"country":{"code":"CH","name":"Switzerland"},"following":[{"id":3}],"id":1,"name":"alice"}`,
+		},
+		{
+			name:     "depth 1",
+			options:  &Options{MaxRenderDepth: 1},
+			expected: `{"cities":[null],"city":null,"city_ptr":null,"country":null,"following":[null],"id":1,"name":"alice"}`,
+		},
+		{
+			name:     "depth 1 omitted",
+			options:  &Options{MaxRenderDepth: 1, OmitDepthOverflow: true},
+			expected: `{"cities":[null],"following":[null],"id":1,"name":"alice"}`,
+		},
+		{
+			name:     "depth 1 id",
+			options:  &Options{MaxRenderDepth: 1, DepthOverflowField: "id"},
+			expected: `{"cities":[{"id":2}],"city":{"id":2},"city_ptr":{"id":2},"country":null,"following":[{"id":3}],"id":1,"name":"alice"}`,
+		},
+		{
+			name:     "depth 2 id",
+			options:  &Options{MaxRenderDepth: 2, DepthOverflowField: "id"},
+			expected: `{"cities":[{"id":2}],"city":{"country":null,"id":2,"name":"Zurich"},"city_ptr":{"country":null,"id":2,"name":"Zurich"},"country":{"code":"CH","name":"Switzerland"},"following":[{"id":3}],"id":1,"name":"alice"}`,
+		},
+		{
+			name:     "depth 3 id",
+			options:  &Options{MaxRenderDepth: 3, DepthOverflowField: "id"},
+			expected: `{"cities":[{"country":null,"id":2,"name":"Zurich"}],"city":{"country":{"code":"CH","name":"Switzerland"},"id":2,"name":"Zurich"},"city_ptr":{"country":{"code":"CH","name":"Switzerland"},"id":2,"name":"Zurich"},"country":{"code":"CH","name":"Switzerland"},"following":[{"id":3}],"id":1,"name":"alice"}`,
+		},
+	}
+
+	for _, test := range tests {
+		actualMap, err := Marshal(test.options, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, string(actual), test.name)
+	}
+}
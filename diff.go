@@ -0,0 +1,108 @@
+package sheriff
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// DiffResult describes the differences between two views of the same value as returned by Diff.
+//
+// All fields contain dotted paths as used in error messages, e.g. `address.city` or `items.0.name`.
+// A path referring to an object or slice covers the whole subtree.
+type DiffResult struct {
+	// OnlyA contains the paths which are only present in the view of the first options.
+	OnlyA []string `json:"only_a"`
+	// OnlyB contains the paths which are only present in the view of the second options.
+	OnlyB []string `json:"only_b"`
+	// Changed contains the paths which are present in both views but with different values.
+	Changed []string `json:"changed"`
+}
+
+// Empty reports whether both views are equal.
+func (d *DiffResult) Empty() bool {
+	return len(d.OnlyA) == 0 && len(d.OnlyB) == 0 && len(d.Changed) == 0
+}
+
+// Diff marshals data with both optionsA and optionsB and reports which paths are only visible in one of the
+// views and which are visible in both but hold different values (e.g. because a field is masked).
+//
+// Objects are compared key by key, slices index by index. Leaf values are compared after the same
+// conversion Fields applies, e.g. a time.Time is compared by its textual representation.
+// The paths within each list of the result are sorted.
+func Diff(optionsA, optionsB *Options, data interface{}) (*DiffResult, error) {
+	a, err := diffView(optionsA, data)
+	if err != nil {
+		return nil, err
+	}
+	b, err := diffView(optionsB, data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DiffResult{
+		OnlyA:   []string{},
+		OnlyB:   []string{},
+		Changed: []string{},
+	}
+	result.diff("", a, b)
+	sort.Strings(result.OnlyA)
+	sort.Strings(result.OnlyB)
+	sort.Strings(result.Changed)
+	return result, nil
+}
+
+func diffView(options *Options, data interface{}) (interface{}, error) {
+	intermediate, err := Marshal(options, data)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeField(intermediate)
+}
+
+func diffPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func (d *DiffResult) diff(path string, a, b interface{}) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			for key, value := range a {
+				other, ok := b[key]
+				if !ok {
+					d.OnlyA = append(d.OnlyA, diffPath(path, key))
+					continue
+				}
+				d.diff(diffPath(path, key), value, other)
+			}
+			for key := range b {
+				if _, ok := a[key]; !ok {
+					d.OnlyB = append(d.OnlyB, diffPath(path, key))
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			for i := 0; i < len(a) || i < len(b); i++ {
+				switch {
+				case i >= len(b):
+					d.OnlyA = append(d.OnlyA, diffPath(path, strconv.Itoa(i)))
+				case i >= len(a):
+					d.OnlyB = append(d.OnlyB, diffPath(path, strconv.Itoa(i)))
+				default:
+					d.diff(diffPath(path, strconv.Itoa(i)), a[i], b[i])
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		d.Changed = append(d.Changed, path)
+	}
+}
@@ -0,0 +1,83 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type DiffMasked string
+
+func (m DiffMasked) Marshal(options *Options) (interface{}, error) {
+	if contains("admin", options.Groups) {
+		return string(m), nil
+	}
+	return "***", nil
+}
+
+type DiffItem struct {
+	Name  string `json:"name" groups:"user,admin"`
+	Price int    `json:"price" groups:"admin"`
+}
+
+type DiffAddress struct {
+	City   string `json:"city" groups:"user,admin"`
+	Street string `json:"street" groups:"admin"`
+}
+
+type DiffModel struct {
+	Name    string              `json:"name" groups:"user,admin"`
+	Salary  int                 `json:"salary" groups:"admin"`
+	Email   DiffMasked          `json:"email" groups:"user,admin"`
+	Address DiffAddress         `json:"address" groups:"user,admin"`
+	Items   []DiffItem          `json:"items" groups:"user,admin"`
+	Notes   []string            `json:"notes" groups:"user,admin"`
+	Lookup  map[string]DiffItem `json:"lookup" groups:"user,admin"`
+	Audit   string              `json:"audit" groups:"user"`
+}
+
+func TestDiff(t *testing.T) {
+	v := DiffModel{
+		Name:    "alice",
+		Salary:  100,
+		Email:   "alice@example.org",
+		Address: DiffAddress{City: "Zurich", Street: "Bahnhofstrasse"},
+		Items:   []DiffItem{{Name: "a", Price: 1}, {Name: "b", Price: 2}},
+		Notes:   []string{"note"},
+		Lookup:  map[string]DiffItem{"x": {Name: "x", Price: 3}},
+	}
+
+	result, err := Diff(&Options{Groups: []string{"admin"}}, &Options{Groups: []string{"user"}}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, &DiffResult{
+		OnlyA:   []string{"address.street", "items.0.price", "items.1.price", "lookup.x.price", "salary"},
+		OnlyB:   []string{"audit"},
+		Changed: []string{"email"},
+	}, result)
+	assert.False(t, result.Empty())
+
+	actual, err := json.Marshal(result)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"only_a":["address.street","items.0.price","items.1.price","lookup.x.price","salary"],"only_b":["audit"],"changed":["email"]}`, string(actual))
+}
+
+func TestDiff_Equal(t *testing.T) {
+	result, err := Diff(&Options{Groups: []string{"user"}}, &Options{Groups: []string{"user"}}, DiffModel{Name: "alice"})
+	assert.NoError(t, err)
+	assert.True(t, result.Empty())
+
+	actual, err := json.Marshal(result)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"only_a":[],"only_b":[],"changed":[]}`, string(actual))
+}
+
+func TestDiff_Slices(t *testing.T) {
+	result := &DiffResult{}
+	result.diff("", []interface{}{"a", "b", "c"}, []interface{}{"a", "x"})
+	assert.Equal(t, &DiffResult{OnlyA: []string{"2"}, Changed: []string{"1"}}, result)
+
+	result = &DiffResult{}
+	result.diff("", map[string]interface{}{"tags": []interface{}{}}, map[string]interface{}{"tags": []interface{}{"a"}})
+	assert.Equal(t, &DiffResult{OnlyB: []string{"tags.0"}}, result)
+}
@@ -0,0 +1,216 @@
+package sheriff
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MarshalEnv marshals data like Marshal does and flattens the result into environment variable style names and
+// values, e.g. `APP_DATABASE_HOST=db`, to dump effective configuration.
+//
+// The names are the keys of the nested objects converted to upper snake case (`maxConns` and `max_conns` both
+// become `MAX_CONNS`) and joined by underscores, prefixed by prefix, which is converted the same way. Strings are
+// kept, bools and integers are formatted with strconv, floats like in the JSON output (`1500000` rather than
+// `1.5e+06`), and types implementing encoding.TextMarshaler or encoding.TextAppender use it, e.g. time.Time is
+// formatted as RFC 3339. Other types are converted using their JSON representation. Nil values and empty objects
+// don't result in any variables.
+//
+// Slices are joined with Options.EnvSliceSeparator, as long as their elements can be represented as strings.
+// Without it, or for values which can't be represented as a single string, an error is returned. An
+// EnvCollisionError is returned if two values end up with the same name. A prefix is needed if data isn't
+// marshalled to an object.
+func MarshalEnv(options *Options, data interface{}, prefix string) (map[string]string, error) {
+	intermediate, err := Marshal(options, data)
+	if err != nil {
+		return nil, err
+	}
+
+	e := envExporter{
+		dest:  make(map[string]string),
+		paths: make(map[string]string),
+		sep:   options.EnvSliceSeparator,
+	}
+	name := envName(prefix)
+	if _, ok := intermediate.(map[string]interface{}); !ok && name == "" {
+		return nil, fmt.Errorf("marshaller: MarshalEnv of %T, which isn't marshalled to an object, without prefix", data)
+	}
+	if err := e.export(name, "", intermediate); err != nil {
+		return nil, err
+	}
+	return e.dest, nil
+}
+
+// EnvCollisionError is returned by MarshalEnv if two values end up with the same name, e.g. the keys `maxConns`
+// and `max_conns` of the same object.
+type EnvCollisionError struct {
+	// Name is the name both values end up with.
+	Name string
+	// Path and OtherPath are the dotted paths of the keys of the values, sorted.
+	Path, OtherPath string
+}
+
+func (e EnvCollisionError) Error() string {
+	return fmt.Sprintf("marshaller: %s and %s are both exported as %s", e.Path, e.OtherPath, e.Name)
+}
+
+// envExporter holds the state of a single MarshalEnv call.
+type envExporter struct {
+	dest map[string]string
+	// paths holds the dotted path of the value of every name in dest, see EnvCollisionError.
+	paths map[string]string
+	sep   string
+}
+
+// export adds the variables of v, which is at the dotted path and exported as name.
+func (e *envExporter) export(name, path string, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		// sorted, so that the same error is returned every time
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if err := e.export(joinEnvName(name, envName(key)), joinPath(path, key), v[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if e.sep == "" {
+			return fmt.Errorf("marshaller: %s is an array, which is only exported if Options.EnvSliceSeparator is set", name)
+		}
+		elems := make([]string, len(v))
+		for i, elem := range v {
+			s, ok, err := envValue(elem)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("marshaller: element %d of %s can't be exported as a single string", i, name)
+			}
+			elems[i] = s
+		}
+		return e.set(name, path, strings.Join(elems, e.sep))
+	}
+
+	s, ok, err := envValue(v)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// the JSON representation is an object or array
+		var decoded interface{}
+		if err := decodeJSON(v, &decoded); err != nil {
+			return err
+		}
+		return e.export(name, path, decoded)
+	}
+	return e.set(name, path, s)
+}
+
+// set adds the variable name for the value at the dotted path.
+func (e *envExporter) set(name, path, value string) error {
+	if other, ok := e.paths[name]; ok {
+		paths := []string{other, path}
+		slices.Sort(paths)
+		return EnvCollisionError{Name: name, Path: paths[0], OtherPath: paths[1]}
+	}
+	e.dest[name] = value
+	e.paths[name] = path
+	return nil
+}
+
+// envValue returns the string representation of v, ok is false if it's an object or array.
+func envValue(v interface{}) (s string, ok bool, err error) {
+	switch v := v.(type) {
+	case nil:
+		return "", true, nil
+	case map[string]interface{}, []interface{}:
+		return "", false, nil
+	case encoding.TextMarshaler, textAppender:
+		b, err := marshalText(v)
+		return string(b), err == nil, err
+	case json.Number:
+		return v.String(), true, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return string(appendFloat(nil, rv.Float(), rv.Type().Bits())), true, nil
+	}
+
+	// anything else (e.g. types implementing json.Marshaler or byte slices) is converted using its JSON representation
+	var decoded interface{}
+	if err := decodeJSON(v, &decoded); err != nil {
+		return "", false, err
+	}
+	if _, ok := decoded.(map[string]interface{}); ok {
+		return "", false, nil
+	}
+	if _, ok := decoded.([]interface{}); ok {
+		return "", false, nil
+	}
+	return envValue(decoded)
+}
+
+// decodeJSON decodes the JSON representation of v into decoded, keeping numbers as json.Number.
+func decodeJSON(v interface{}, decoded *interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(decoded)
+}
+
+// envName converts key to upper snake case, e.g. `maxConns`, `max-conns` and `MaxConns` to `MAX_CONNS`, and
+// `HTTPServer` to `HTTP_SERVER`. Characters other than letters and digits are replaced by underscores.
+func envName(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			// a word starts after a lower-case letter or digit, or at the last letter of an acronym
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// joinEnvName appends the converted key to the name.
+func joinEnvName(name, key string) string {
+	if name == "" {
+		return key
+	}
+	return name + "_" + key
+}
@@ -0,0 +1,118 @@
+package sheriff
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type EnvDatabase struct {
+	Host     string   `json:"host"`
+	MaxConns int      `json:"maxConns"`
+	Password string   `json:"password" groups:"admin"`
+	Replicas []string `json:"replicas,omitempty"`
+}
+
+type EnvConfig struct {
+	Name       string                 `json:"name"`
+	Debug      bool                   `json:"debug"`
+	Ratio      float64                `json:"ratio"`
+	Started    time.Time              `json:"started"`
+	Stopped    *time.Time             `json:"stopped"`
+	IP         net.IP                 `json:"ip"`
+	Database   EnvDatabase            `json:"database"`
+	HTTPServer map[string]interface{} `json:"HTTPServer"`
+	Empty      struct{}               `json:"empty"`
+}
+
+func TestMarshalEnv(t *testing.T) {
+	config := EnvConfig{
+		Name:       "api",
+		Debug:      true,
+		Ratio:      0.25,
+		Started:    time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC),
+		IP:         net.IPv4(10, 0, 0, 1),
+		Database:   EnvDatabase{Host: "db", MaxConns: 10, Password: "secret"},
+		HTTPServer: map[string]interface{}{"read-timeout": "5s", "port": uint16(8080)},
+	}
+
+	env, err := MarshalEnv(&Options{}, config, "app")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"APP_NAME":                     "api",
+		"APP_DEBUG":                    "true",
+		"APP_RATIO":                    "0.25",
+		"APP_STARTED":                  "2024-05-01T08:30:00Z",
+		"APP_IP":                       "10.0.0.1",
+		"APP_DATABASE_HOST":            "db",
+		"APP_DATABASE_MAX_CONNS":       "10",
+		"APP_HTTP_SERVER_READ_TIMEOUT": "5s",
+		"APP_HTTP_SERVER_PORT":         "8080",
+	}, env)
+
+	env, err = MarshalEnv(&Options{Groups: []string{"admin"}}, config.Database, "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"HOST": "db", "MAX_CONNS": "10", "PASSWORD": "secret"}, env)
+}
+
+func TestMarshalEnv_Floats(t *testing.T) {
+	env, err := MarshalEnv(&Options{}, map[string]interface{}{"price": 1500000.0, "rate": 0.0000001, "small": float32(0.25)}, "app")
+	assert.NoError(t, err)
+
+	// floats are formatted like in the JSON output
+	assert.Equal(t, map[string]string{"APP_PRICE": "1500000", "APP_RATE": "1e-7", "APP_SMALL": "0.25"}, env)
+}
+
+func TestMarshalEnv_Slices(t *testing.T) {
+	db := EnvDatabase{Host: "db", Replicas: []string{"r1", "r2"}}
+	_, err := MarshalEnv(&Options{}, db, "db")
+	assert.EqualError(t, err, "marshaller: DB_REPLICAS is an array, which is only exported if Options.EnvSliceSeparator is set")
+
+	env, err := MarshalEnv(&Options{EnvSliceSeparator: ","}, db, "db")
+	assert.NoError(t, err)
+	assert.Equal(t, "r1,r2", env["DB_REPLICAS"])
+
+	_, err = MarshalEnv(&Options{EnvSliceSeparator: ","}, map[string]interface{}{"dbs": []EnvDatabase{db}}, "")
+	assert.EqualError(t, err, "marshaller: element 0 of DBS can't be exported as a single string")
+}
+
+func TestMarshalEnv_Collisions(t *testing.T) {
+	_, err := MarshalEnv(&Options{}, map[string]interface{}{"max_conns": 1, "maxConns": 2}, "db")
+	assert.Equal(t, EnvCollisionError{Name: "DB_MAX_CONNS", Path: "maxConns", OtherPath: "max_conns"}, err)
+	assert.EqualError(t, err, "marshaller: maxConns and max_conns are both exported as DB_MAX_CONNS")
+
+	_, err = MarshalEnv(&Options{}, map[string]interface{}{"database": EnvDatabase{Host: "db"}, "Database_Host": "other"}, "")
+	assert.Equal(t, EnvCollisionError{Name: "DATABASE_HOST", Path: "Database_Host", OtherPath: "database.host"}, err)
+}
+
+func TestMarshalEnv_Errors(t *testing.T) {
+	_, err := MarshalEnv(&Options{}, "value", "")
+	assert.EqualError(t, err, "marshaller: MarshalEnv of string, which isn't marshalled to an object, without prefix")
+
+	env, err := MarshalEnv(&Options{}, "value", "value")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"VALUE": "value"}, env)
+
+	_, err = MarshalEnv(&Options{}, map[string]interface{}{"raw": func() {}}, "")
+	assert.Error(t, err)
+}
+
+func TestEnvName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"name":        "NAME",
+		"maxConns":    "MAX_CONNS",
+		"MaxConns":    "MAX_CONNS",
+		"max-conns":   "MAX_CONNS",
+		"HTTPServer":  "HTTP_SERVER",
+		"ID":          "ID",
+		"user2FA":     "USER2_FA",
+		"café":        "CAFÉ",
+		"a.b":         "A_B",
+		"":            "",
+		"already_SET": "ALREADY_SET",
+	} {
+		assert.Equal(t, expected, envName(key), key)
+	}
+}
@@ -0,0 +1,80 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// metaKey is the key Envelope adds the metadata under.
+const metaKey = "meta"
+
+// Envelope marshals data and wraps it as `{root: data, "meta": meta}`, the envelope commonly used by JSON APIs.
+// meta is filtered with the same options; if it's nil, the "meta" key is left out. Unlike JSON, errors are
+// returned instead of panicking.
+//
+// If root is empty, data isn't wrapped (same as JSON) and meta is added to its result instead, which has to
+// be an object, otherwise a MarshalInvalidTypeError is returned. If data already has a "meta" key, an
+// ExtraKeyError is returned, unless Options.ExtraOverwrites is set. A root of "meta" can't be combined with
+// metadata.
+func Envelope(options *Options, root string, data interface{}, meta map[string]interface{}) (map[string]interface{}, error) {
+	s := acquireMarshalState(options)
+	defer s.release()
+	v := reflect.ValueOf(data)
+	if options.Instrumentation == nil {
+		return s.envelope(v, root, meta)
+	}
+
+	var dest map[string]interface{}
+	err := s.instrument(v, func() (err error) {
+		dest, err = s.envelope(v, root, meta)
+		return err
+	})
+	return dest, err
+}
+
+// envelope is the implementation of Envelope.
+func (s *marshalState) envelope(v reflect.Value, root string, meta map[string]interface{}) (map[string]interface{}, error) {
+	if root == metaKey && meta != nil {
+		return nil, fmt.Errorf("marshaller: root key %q collides with the metadata", root)
+	}
+	result, err := s.marshalRoot(v)
+	// the values which failed to marshal with CollectAll are collected again below
+	if _, ok := err.(*CollectedError); err != nil && !ok {
+		return nil, err
+	}
+
+	var dest map[string]interface{}
+	if root == "" {
+		var ok bool
+		if dest, ok = result.(map[string]interface{}); !ok {
+			kind := v.Kind()
+			if e := reflect.Indirect(v); e.IsValid() {
+				kind = e.Kind()
+			}
+			var value interface{}
+			if v.IsValid() {
+				value = v.Interface()
+			}
+			return nil, MarshalInvalidTypeError{Kind: kind, Value: value}
+		}
+	} else {
+		dest = map[string]interface{}{root: result}
+	}
+	if meta == nil {
+		return dest, s.collectedError()
+	}
+
+	if _, ok := dest[metaKey]; ok && !s.options.ExtraOverwrites {
+		return nil, ExtraKeyError{Type: reflect.Indirect(v).Type(), Key: metaKey}
+	}
+	s.pushKey(metaKey)
+	marshalled, err := s.marshalValue(reflect.ValueOf(meta), false)
+	s.pop()
+	if err != nil && !s.recoverFrom(err) {
+		return nil, err
+	}
+	if err == nil {
+		dest[metaKey] = marshalled
+	}
+	return dest, s.collectedError()
+}
@@ -0,0 +1,70 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type EnvelopeUser struct {
+	Name  string `json:"name" groups:"api"`
+	Email string `json:"email" groups:"admin"`
+}
+
+type EnvelopeMeta struct {
+	Total int `json:"total"`
+}
+
+func TestEnvelope(t *testing.T) {
+	users := []EnvelopeUser{{Name: "alice", Email: "alice@example.org"}, {Name: "bob", Email: "bob@example.org"}}
+	meta := map[string]interface{}{"page": 1, "stats": EnvelopeMeta{Total: 2}, "owner": users[0]}
+
+	m, err := Envelope(&Options{Groups: []string{"api"}}, "users", users, meta)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"meta":{"owner":{"name":"alice"},"page":1,"stats":{"total":2}},"users":[{"name":"alice"},{"name":"bob"}]}`, string(actual))
+
+	m, err = Envelope(&Options{Groups: []string{"api"}}, "user", &users[1], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"user": map[string]interface{}{"name": "bob"}}, m)
+
+	_, err = Envelope(&Options{}, "meta", users, meta)
+	assert.EqualError(t, err, `marshaller: root key "meta" collides with the metadata`)
+}
+
+func TestEnvelope_NoRoot(t *testing.T) {
+	m, err := Envelope(&Options{Groups: []string{"api"}}, "", EnvelopeUser{Name: "alice"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "alice"}, m)
+
+	m, err = Envelope(&Options{Groups: []string{"api"}}, "", EnvelopeUser{Name: "alice"}, map[string]interface{}{"page": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "alice", "meta": map[string]interface{}{"page": 1}}, m)
+
+	data := map[string]interface{}{"meta": "taken"}
+	_, err = Envelope(&Options{}, "", data, map[string]interface{}{"page": 1})
+	assert.Equal(t, ExtraKeyError{Type: reflect.TypeOf(data), Key: "meta"}, err)
+
+	m, err = Envelope(&Options{ExtraOverwrites: true}, "", data, map[string]interface{}{"page": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"meta": map[string]interface{}{"page": 1}}, m)
+
+	_, err = Envelope(&Options{}, "", []string{"a"}, nil)
+	assert.Equal(t, MarshalInvalidTypeError{Kind: reflect.Slice, Value: []string{"a"}}, err)
+
+	_, err = Envelope(&Options{}, "", nil, nil)
+	assert.Equal(t, MarshalInvalidTypeError{Kind: reflect.Invalid}, err)
+}
+
+func TestEnvelope_ErrorPolicy(t *testing.T) {
+	meta := map[string]interface{}{"bad": MarshalWithFailing{}, "good": 1}
+	_, err := Envelope(&Options{}, "data", 1, meta)
+	assert.EqualError(t, err, "failing")
+
+	m, err := Envelope(&Options{ErrorPolicy: SkipSilently}, "data", 1, meta)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"data": 1, "meta": map[string]interface{}{"good": 1}}, m)
+}
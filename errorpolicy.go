@@ -0,0 +1,94 @@
+package sheriff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorPolicy determines what happens if a value within the marshalled data fails to marshal, e.g. because
+// a Marshaller returns an error or a map key isn't supported.
+type ErrorPolicy int
+
+const (
+	// FailFast stops marshalling at the first error and returns it. It's the default.
+	FailFast ErrorPolicy = iota
+	// CollectAll marshals everything else and returns the partial result together with a *CollectedError
+	// listing every failed value. Failed slice elements are replaced by null, failed struct fields and map
+	// entries are omitted.
+	CollectAll
+	// SkipSilently handles failed values like CollectAll does, but doesn't return any error for them.
+	SkipSilently
+)
+
+// FieldError is a value which failed to marshal, see CollectAll.
+type FieldError struct {
+	// Path is the dotted path of the value, e.g. `users.2.address`.
+	Path string
+	// Err is the error the value failed with.
+	Err error
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("marshaller: %s: %s", e.Path, e.Err)
+}
+
+// Unwrap returns the error the value failed with.
+func (e FieldError) Unwrap() error {
+	return e.Err
+}
+
+// CollectedError is returned together with the partial result if values failed to marshal with CollectAll.
+// Like an error returned by errors.Join, its message lists the errors on separate lines and errors.Is and
+// errors.As consider each of them.
+type CollectedError struct {
+	// Errors are the failed values in the order they were marshalled in.
+	Errors []FieldError
+}
+
+func (e *CollectedError) Error() string {
+	var b strings.Builder
+	for i, err := range e.Errors {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the FieldErrors.
+func (e *CollectedError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// recoverFrom reports whether marshalling goes on after the value at the current path failed with err,
+// which is collected if Options.ErrorPolicy is CollectAll. A ContextError is never recovered from.
+func (s *marshalState) recoverFrom(err error) bool {
+	if _, ok := err.(ContextError); ok {
+		return false
+	}
+	// unknown groups of the options would fail every field
+	if e, ok := err.(UnknownGroupError); ok && e.Type == nil {
+		return false
+	}
+	switch s.options.ErrorPolicy {
+	case CollectAll:
+		s.errs = append(s.errs, FieldError{Path: s.currentPath(), Err: err})
+		return true
+	case SkipSilently:
+		return true
+	}
+	return false
+}
+
+// collectedError returns the errors collected by recoverFrom, nil if there are none.
+func (s *marshalState) collectedError() error {
+	if len(s.errs) == 0 {
+		return nil
+	}
+	return &CollectedError{Errors: s.errs}
+}
@@ -0,0 +1,126 @@
+package sheriff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errPolicyFailing = errors.New("failing")
+
+type ErrorPolicyValue struct {
+	Fail bool
+}
+
+func (v ErrorPolicyValue) Marshal(options *Options) (interface{}, error) {
+	if v.Fail {
+		return nil, errPolicyFailing
+	}
+	return "ok", nil
+}
+
+type ErrorPolicyKey int
+
+func (k ErrorPolicyKey) MarshalText() ([]byte, error) {
+	if k < 0 {
+		return nil, errPolicyFailing
+	}
+	return []byte(fmt.Sprintf("key%d", k)), nil
+}
+
+type ErrorPolicyItem struct {
+	ID    int              `json:"id" groups:"api"`
+	Value ErrorPolicyValue `json:"value" groups:"api"`
+}
+
+// errorPolicyData returns a slice whose elements 2 and 7 fail.
+func errorPolicyData() []ErrorPolicyItem {
+	items := make([]ErrorPolicyItem, 10)
+	for i := range items {
+		items[i] = ErrorPolicyItem{ID: i, Value: ErrorPolicyValue{Fail: i == 2 || i == 7}}
+	}
+	return items
+}
+
+// errorPolicyExpected returns the partial result of errorPolicyData.
+func errorPolicyExpected() []interface{} {
+	expected := make([]interface{}, 10)
+	for i := range expected {
+		item := map[string]interface{}{"id": i}
+		if i != 2 && i != 7 {
+			item["value"] = "ok"
+		}
+		expected[i] = item
+	}
+	return expected
+}
+
+func TestErrorPolicy_FailFast(t *testing.T) {
+	actual, err := Marshal(&Options{Groups: []string{"api"}}, errorPolicyData())
+	assert.Equal(t, errPolicyFailing, err)
+	assert.Nil(t, actual)
+}
+
+func TestErrorPolicy_CollectAll(t *testing.T) {
+	actual, err := Marshal(&Options{Groups: []string{"api"}, ErrorPolicy: CollectAll}, errorPolicyData())
+	assert.Equal(t, errorPolicyExpected(), actual)
+
+	var collected *CollectedError
+	assert.True(t, errors.As(err, &collected))
+	assert.Equal(t, []FieldError{
+		{Path: "2.value", Err: errPolicyFailing},
+		{Path: "7.value", Err: errPolicyFailing},
+	}, collected.Errors)
+	assert.True(t, errors.Is(err, errPolicyFailing))
+	assert.EqualError(t, err, "marshaller: 2.value: failing\nmarshaller: 7.value: failing")
+
+	// the partial result is encoded as well
+	b, err := MarshalAppend(nil, &Options{Groups: []string{"api"}, ErrorPolicy: CollectAll}, errorPolicyData()[:3])
+	assert.Equal(t, `[{"id":0,"value":"ok"},{"id":1,"value":"ok"},{"id":2}]`, string(b))
+	assert.True(t, errors.As(err, &collected))
+	assert.Len(t, collected.Errors, 1)
+}
+
+func TestErrorPolicy_SkipSilently(t *testing.T) {
+	actual, err := Marshal(&Options{Groups: []string{"api"}, ErrorPolicy: SkipSilently}, errorPolicyData())
+	assert.NoError(t, err)
+	assert.Equal(t, errorPolicyExpected(), actual)
+}
+
+func TestErrorPolicy_Elements(t *testing.T) {
+	data := map[string]interface{}{
+		// failed slice elements keep their position
+		"values": []ErrorPolicyValue{{}, {Fail: true}, {}},
+		// failed map entries are omitted
+		"byKey":  map[string]ErrorPolicyValue{"a": {}, "b": {Fail: true}},
+		"keys":   map[ErrorPolicyKey]int{1: 1, -1: 2},
+		"nested": []interface{}{make([]int, 5), []int{1}},
+	}
+	options := &Options{ErrorPolicy: CollectAll, MaxSliceLen: 3}
+
+	actual, err := Marshal(options, data)
+	assert.Equal(t, map[string]interface{}{
+		"values": []interface{}{"ok", nil, "ok"},
+		"byKey":  map[string]interface{}{"a": "ok"},
+		"keys":   map[string]interface{}{"key1": 1},
+		"nested": []interface{}{nil, []interface{}{1}},
+	}, actual)
+
+	var collected *CollectedError
+	assert.True(t, errors.As(err, &collected))
+	paths := make([]string, len(collected.Errors))
+	for i, fieldErr := range collected.Errors {
+		paths[i] = fieldErr.Path
+	}
+	assert.ElementsMatch(t, []string{"values.1", "byKey.b", "keys", "nested.0"}, paths)
+	var lengthErr LengthError
+	assert.True(t, errors.As(err, &lengthErr))
+	assert.Equal(t, LengthError{Kind: reflect.Slice, Len: 5, Max: 3, Path: "nested.0"}, lengthErr)
+
+	// the marshalled value itself can't be skipped
+	_, err = Marshal(options, make([]int, 5))
+	assert.Equal(t, LengthError{Kind: reflect.Slice, Len: 5, Max: 3}, err)
+}
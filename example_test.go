@@ -0,0 +1,84 @@
+package sheriff_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/peoplecentrix/sheriff"
+)
+
+type ExampleUser struct {
+	Username string `json:"username" groups:"api"`
+	Email    string `json:"email" groups:"personal"`
+}
+
+type ExampleAccount struct {
+	Plan    string `json:"plan" groups:"api"`
+	Balance int    `json:"balance" groups:"billing"`
+}
+
+type ExampleResponse struct {
+	User    json.Marshaler `json:"user"`
+	Account json.Marshaler `json:"account"`
+}
+
+func ExampleDefer() {
+	user := ExampleUser{Username: "alice", Email: "alice@example.org"}
+	account := ExampleAccount{Plan: "pro", Balance: 42}
+
+	response := ExampleResponse{
+		User:    sheriff.Defer(&sheriff.Options{Groups: []string{"api", "personal"}}, user),
+		Account: sheriff.Defer(&sheriff.Options{Groups: []string{"api"}}, account),
+	}
+
+	output, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Println(string(output))
+	// Output:
+	// {
+	//   "user": {
+	//     "email": "alice@example.org",
+	//     "username": "alice"
+	//   },
+	//   "account": {
+	//     "plan": "pro"
+	//   }
+	// }
+}
+
+// roleAuthorizer grants each role the fields of the listed groups.
+type roleAuthorizer map[string][]string
+
+func (a roleAuthorizer) Allow(subject interface{}, resource reflect.Type, field reflect.StructField, declaredGroups []string) bool {
+	for _, granted := range a[subject.(string)] {
+		for _, declared := range declaredGroups {
+			if granted == declared {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func ExampleAuthorizer() {
+	authorizer := roleAuthorizer{
+		"support": {"api"},
+		"owner":   {"api", "personal"},
+	}
+	user := ExampleUser{Username: "alice", Email: "alice@example.org"}
+
+	for _, role := range []string{"support", "owner"} {
+		output, err := sheriff.MarshalAppend(nil, &sheriff.Options{Authorizer: authorizer, Subject: role}, user)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Println(role, string(output))
+	}
+	// Output:
+	// support {"username":"alice"}
+	// owner {"email":"alice@example.org","username":"alice"}
+}
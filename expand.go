@@ -0,0 +1,115 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// isExpanded reports whether the field with the output key name within the current struct is to be rendered
+// fully instead of as a reference, see Options.Expand.
+func (s *marshalState) isExpanded(name string) bool {
+	if len(s.options.Expand) == 0 {
+		return false
+	}
+	path := s.fieldPath(name)
+	for _, expand := range s.options.Expand {
+		if strings.HasPrefix(expand, path) && (len(expand) == len(path) || expand[len(path)] == '.') {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldPath returns the dotted path of the field with the output key name within the current struct, which
+// consists of the keys of the fields leading to it, leaving out slice indexes and map keys.
+func (s *marshalState) fieldPath(name string) string {
+	var b strings.Builder
+	for _, segment := range s.path {
+		if segment.parent != nil && !segment.embedded {
+			b.WriteString(segment.name)
+			b.WriteByte('.')
+		}
+	}
+	b.WriteString(name)
+	return b.String()
+}
+
+// reference returns the reference to v rendered instead of a struct field tagged with `sheriff:"ref=key"`:
+// structs are replaced by their field with the output key key (or an object holding only that field, see
+// Options.ReferenceObjects), slices, arrays and maps by their elements' references.
+func (s *marshalState) reference(v reflect.Value, key string) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return s.reference(v.Elem(), key)
+	case reflect.Struct:
+		i, ok := referenceField(v.Type(), key)
+		if !ok {
+			return nil, fmt.Errorf("marshaller: %s has no field %s to reference it by (at %s)", v.Type(), key, s.currentPath())
+		}
+		id := v.Field(i).Interface()
+		if s.options.ReferenceObjects {
+			return map[string]interface{}{key: id}, nil
+		}
+		return id, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		refs := make([]interface{}, v.Len())
+		for i := range refs {
+			s.pushIndex(i)
+			ref, err := s.reference(v.Index(i), key)
+			s.pop()
+			if err != nil {
+				return nil, err
+			}
+			refs[i] = ref
+		}
+		return refs, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if err := s.checkMapKey(v.Type()); err != nil {
+			return nil, err
+		}
+		refs := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			keyString, err := s.mapKeyString(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			s.pushKey(keyString)
+			ref, err := s.reference(iter.Value(), key)
+			s.pop()
+			if err != nil {
+				return nil, err
+			}
+			refs[keyString] = ref
+		}
+		return refs, nil
+	}
+	return v.Interface(), nil
+}
+
+// referenceField returns the index of the exported field of the struct type t whose json name (or Go name, if
+// it has none) is key.
+func referenceField(t reflect.Type, key string) (int, bool) {
+	for i, f := range fieldInfosOf(t) {
+		name := f.jsonName
+		if name == "" {
+			name = f.field.Name
+		}
+		if name == key && f.field.IsExported() {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,125 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ExpandCustomer struct {
+	ID    string `json:"id" groups:"api"`
+	Name  string `json:"name" groups:"api"`
+	Email string `json:"email" groups:"admin"`
+}
+
+type ExpandProduct struct {
+	ID   int    `json:"id" groups:"api"`
+	Name string `json:"name" groups:"api"`
+}
+
+type ExpandLine struct {
+	Quantity int            `json:"quantity" groups:"api"`
+	Product  *ExpandProduct `json:"product" groups:"api" sheriff:"ref=id"`
+}
+
+type ExpandInvoice struct {
+	Number   string          `json:"number" groups:"api"`
+	Customer ExpandCustomer  `json:"customer" groups:"api" sheriff:"ref=id"`
+	Lines    []ExpandLine    `json:"lines" groups:"api"`
+	Related  []ExpandProduct `json:"related" groups:"api" sheriff:"ref=id"`
+}
+
+type ExpandOrder struct {
+	ID      int            `json:"id" groups:"api"`
+	Invoice *ExpandInvoice `json:"invoice" groups:"api" sheriff:"ref=number"`
+}
+
+func expandOrder() ExpandOrder {
+	return ExpandOrder{
+		ID: 1,
+		Invoice: &ExpandInvoice{
+			Number:   "INV-1",
+			Customer: ExpandCustomer{ID: "cus_1", Name: "Alice", Email: "alice@example.com"},
+			Lines: []ExpandLine{
+				{Quantity: 2, Product: &ExpandProduct{ID: 10, Name: "Pen"}},
+				{Quantity: 1},
+			},
+			Related: []ExpandProduct{{ID: 11, Name: "Ink"}},
+		},
+	}
+}
+
+func TestMarshal_Expand(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     interface{}
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "references by default",
+			data:     *expandOrder().Invoice,
+			options:  &Options{Groups: []string{"api"}},
+			expected: `{"customer":"cus_1","lines":[{"product":10,"quantity":2},{"product":null,"quantity":1}],"number":"INV-1","related":[11]}`,
+		},
+		{
+			name:    "expanded",
+			data:    *expandOrder().Invoice,
+			options: &Options{Groups: []string{"api"}, Expand: []string{"customer", "lines.product"}},
+			expected: `{"customer":{"id":"cus_1","name":"Alice"},"lines":[{"product":{"id":10,"name":"Pen"},"quantity":2},` +
+				`{"product":null,"quantity":1}],"number":"INV-1","related":[11]}`,
+		},
+		{
+			name:     "expanded slice",
+			data:     *expandOrder().Invoice,
+			options:  &Options{Groups: []string{"api", "admin"}, Expand: []string{"related"}},
+			expected: `{"customer":"cus_1","lines":[{"product":10,"quantity":2},{"product":null,"quantity":1}],"number":"INV-1","related":[{"id":11,"name":"Ink"}]}`,
+		},
+		{
+			name:     "nested reference",
+			data:     expandOrder(),
+			options:  &Options{Groups: []string{"api"}, Expand: []string{"customer"}},
+			expected: `{"id":1,"invoice":"INV-1"}`,
+		},
+		{
+			name:    "nested expansion",
+			data:    expandOrder(),
+			options: &Options{Groups: []string{"api", "admin"}, Expand: []string{"invoice.customer"}},
+			expected: `{"id":1,"invoice":{"customer":{"email":"alice@example.com","id":"cus_1","name":"Alice"},` +
+				`"lines":[{"product":10,"quantity":2},{"product":null,"quantity":1}],"number":"INV-1","related":[11]}}`,
+		},
+		{
+			name:    "reference objects",
+			data:    expandOrder(),
+			options: &Options{Groups: []string{"api"}, Expand: []string{"invoice"}, ReferenceObjects: true},
+			expected: `{"id":1,"invoice":{"customer":{"id":"cus_1"},"lines":[{"product":{"id":10},"quantity":2},` +
+				`{"product":null,"quantity":1}],"number":"INV-1","related":[{"id":11}]}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := Marshal(test.options, test.data)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(v)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(test.data, map[string]*Options{"a": test.options, "b": {Groups: []string{"api"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, v, all["a"])
+		})
+	}
+}
+
+type ExpandMissing struct {
+	Customer ExpandCustomer `json:"customer" sheriff:"ref=uuid"`
+}
+
+func TestMarshal_ExpandMissingField(t *testing.T) {
+	_, err := Marshal(&Options{}, ExpandMissing{})
+	assert.EqualError(t, err, "marshaller: sheriff.ExpandCustomer has no field uuid to reference it by (at customer)")
+
+	_, err = Marshal(&Options{Expand: []string{"customer"}}, ExpandMissing{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,96 @@
+package sheriff
+
+import "strings"
+
+// rootPrefix marks entries of Options.OmitFields and Options.OnlyFields which are matched from the top level only.
+const rootPrefix = "$."
+
+// keyPattern is a parsed entry of Options.OmitFields or Options.OnlyFields.
+type keyPattern struct {
+	keys   []string
+	rooted bool
+}
+
+// parseKeyPatterns parses the entries of Options.OmitFields or Options.OnlyFields.
+func parseKeyPatterns(entries []string) []keyPattern {
+	if len(entries) == 0 {
+		return nil
+	}
+	patterns := make([]keyPattern, len(entries))
+	for i, entry := range entries {
+		rooted := strings.HasPrefix(entry, rootPrefix)
+		if rooted {
+			entry = entry[len(rootPrefix):]
+		}
+		patterns[i] = keyPattern{keys: strings.Split(entry, "."), rooted: rooted}
+	}
+	return patterns
+}
+
+// omits reports whether the pattern drops the key whose path is keys, i.e. whether the path ends with the pattern,
+// or equals it if it's rooted.
+func (p keyPattern) omits(keys []string) bool {
+	start := len(keys) - len(p.keys)
+	if start < 0 || p.rooted && start != 0 {
+		return false
+	}
+	return equalKeys(keys[start:], p.keys)
+}
+
+// keeps reports whether the pattern keeps the key whose path is keys: the path contains the pattern (i.e. the key
+// is the matched one or within it), or ends with the beginning of it (i.e. the key leads to the matched one).
+// Rooted patterns only match from the beginning of the path.
+func (p keyPattern) keeps(keys []string) bool {
+	for start := range keys {
+		if p.rooted && start > 0 {
+			break
+		}
+		n := min(len(keys)-start, len(p.keys))
+		if equalKeys(keys[start:start+n], p.keys[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalKeys(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isKeyOmitted reports whether the key name of the struct or map currently being marshalled is dropped by
+// Options.OmitFields or Options.OnlyFields.
+func (s *marshalState) isKeyOmitted(name string) bool {
+	if s.omitPatterns == nil && s.onlyPatterns == nil {
+		return false
+	}
+
+	// the path of keys leading to the key, without slice indexes and embedded structs
+	keys := s.keyPath[:0]
+	for _, segment := range s.path {
+		if segment.index < 0 && !segment.embedded {
+			keys = append(keys, segment.name)
+		}
+	}
+	keys = append(keys, name)
+	s.keyPath = keys
+
+	for _, p := range s.omitPatterns {
+		if p.omits(keys) {
+			return true
+		}
+	}
+	if s.onlyPatterns == nil {
+		return false
+	}
+	for _, p := range s.onlyPatterns {
+		if p.keeps(keys) {
+			return false
+		}
+	}
+	return true
+}
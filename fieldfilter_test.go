@@ -0,0 +1,109 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type FieldFilterAccount struct {
+	ID           int    `json:"id"`
+	PasswordHash string `json:"password_hash"`
+}
+
+type FieldFilterAudit struct {
+	Actor   string            `json:"actor"`
+	Details map[string]string `json:"details"`
+}
+
+type FieldFilterUser struct {
+	FieldFilterAccount
+	Name    string               `json:"name"`
+	Friends []FieldFilterAccount `json:"friends"`
+	Audit   FieldFilterAudit     `json:"audit"`
+	Secret  string               `json:"secret" groups:"admin"`
+}
+
+func fieldFilterUser() FieldFilterUser {
+	return FieldFilterUser{
+		FieldFilterAccount: FieldFilterAccount{ID: 1, PasswordHash: "h1"},
+		Name:               "Alice",
+		Friends:            []FieldFilterAccount{{ID: 2, PasswordHash: "h2"}},
+		Audit: FieldFilterAudit{
+			Actor:   "Bob",
+			Details: map[string]string{"password_hash": "h3", "reason": "reset"},
+		},
+		Secret: "s",
+	}
+}
+
+func TestMarshal_FieldFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  *Options
+		expected string
+	}{
+		{
+			name:    "omitted at every depth",
+			options: &Options{OmitFields: []string{"password_hash"}},
+			expected: `{"audit":{"actor":"Bob","details":{"reason":"reset"}},"friends":[{"id":2}],"id":1,` +
+				`"name":"Alice"}`,
+		},
+		{
+			name:    "omitted path",
+			options: &Options{OmitFields: []string{"friends.password_hash", "audit.details"}},
+			expected: `{"audit":{"actor":"Bob"},"friends":[{"id":2}],"id":1,"name":"Alice",` +
+				`"password_hash":"h1"}`,
+		},
+		{
+			name:    "omitted rooted path",
+			options: &Options{OmitFields: []string{"$.password_hash", "$.details"}},
+			expected: `{"audit":{"actor":"Bob","details":{"password_hash":"h3","reason":"reset"}},` +
+				`"friends":[{"id":2,"password_hash":"h2"}],"id":1,"name":"Alice"}`,
+		},
+		{
+			name:     "after groups",
+			options:  &Options{Groups: []string{"api"}, OmitFields: []string{"name"}},
+			expected: `{"audit":{"actor":"Bob","details":{"password_hash":"h3","reason":"reset"}},"friends":[{"id":2,"password_hash":"h2"}],"id":1,"password_hash":"h1"}`,
+		},
+		{
+			name:     "only",
+			options:  &Options{OnlyFields: []string{"id", "name", "secret"}, Groups: []string{"api"}},
+			expected: `{"id":1,"name":"Alice"}`,
+		},
+		{
+			name:     "only path",
+			options:  &Options{OnlyFields: []string{"audit.details.reason", "friends"}},
+			expected: `{"audit":{"details":{"reason":"reset"}},"friends":[{"id":2,"password_hash":"h2"}]}`,
+		},
+		{
+			name:     "only unrooted path",
+			options:  &Options{OnlyFields: []string{"id", "actor"}},
+			expected: `{"id":1}`,
+		},
+		{
+			name:     "only rooted path",
+			options:  &Options{OnlyFields: []string{"$.audit", "$.actor"}},
+			expected: `{"audit":{"actor":"Bob","details":{"password_hash":"h3","reason":"reset"}}}`,
+		},
+		{
+			name:     "omit wins",
+			options:  &Options{OnlyFields: []string{"audit"}, OmitFields: []string{"password_hash"}},
+			expected: `{"audit":{"actor":"Bob","details":{"reason":"reset"}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := Marshal(test.options, fieldFilterUser())
+			assert.NoError(t, err)
+			actual, err := json.Marshal(v)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(fieldFilterUser(), map[string]*Options{"a": test.options, "b": {}})
+			assert.NoError(t, err)
+			assert.Equal(t, v, all["a"])
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package sheriff
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Fields marshals data like Marshal does and returns a map which is safe to be passed to structured loggers,
+// e.g. `logrus.WithFields(logrus.Fields(fields))` or `zap.Any("user", fields)`.
+//
+// Unlike Marshal, the returned tree is guaranteed to only contain the following types:
+// nil, string, bool, int64, uint64, float64, map[string]interface{} and []interface{}.
+// Named types are converted to their underlying primitive, types implementing encoding.TextMarshaler or
+// encoding.TextAppender (e.g. time.Time or net.IP) are converted to strings, types implementing json.Marshaler are converted
+// using their JSON representation and types implementing fmt.Stringer using String.
+//
+// data has to be a struct or a map, otherwise a MarshalInvalidTypeError is returned.
+func Fields(options *Options, data interface{}) (map[string]interface{}, error) {
+	intermediate, err := Marshal(options, data)
+	if err != nil {
+		return nil, err
+	}
+	if intermediate == nil {
+		return nil, nil
+	}
+	m, ok := intermediate.(map[string]interface{})
+	if !ok {
+		v := reflect.ValueOf(data)
+		return nil, MarshalInvalidTypeError{Kind: v.Kind(), Value: data}
+	}
+
+	fields, err := normalizeField(m)
+	if err != nil {
+		return nil, err
+	}
+	return fields.(map[string]interface{}), nil
+}
+
+// normalizeField converts a value returned by Marshal into one of the types guaranteed by Fields.
+func normalizeField(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, string, bool, int64, uint64, float64:
+		return v, nil
+	case map[string]interface{}:
+		dest := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			n, err := normalizeField(value)
+			if err != nil {
+				return nil, err
+			}
+			dest[key] = n
+		}
+		return dest, nil
+	case []interface{}:
+		dest := make([]interface{}, len(v))
+		for i, value := range v {
+			n, err := normalizeField(value)
+			if err != nil {
+				return nil, err
+			}
+			dest[i] = n
+		}
+		return dest, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case json.Marshaler:
+		return normalizeJSONField(v)
+	case encoding.TextMarshaler, textAppender:
+		b, err := marshalText(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+	}
+	return normalizeJSONField(v)
+}
+
+// normalizeJSONField converts v using its JSON representation.
+func normalizeJSONField(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return normalizeField(decoded)
+}
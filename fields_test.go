@@ -0,0 +1,108 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type FieldsStatus string
+
+type FieldsJSON struct {
+	Value int
+}
+
+func (f FieldsJSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"value": f.Value, "ratio": 0.5})
+}
+
+type FieldsModel struct {
+	Name      string            `json:"name" groups:"public"`
+	Secret    string            `json:"secret" groups:"private"`
+	Status    FieldsStatus      `json:"status" groups:"public"`
+	Count     int               `json:"count" groups:"public"`
+	Small     uint8             `json:"small" groups:"public"`
+	Ratio     float32           `json:"ratio" groups:"public"`
+	CreatedAt time.Time         `json:"created_at" groups:"public"`
+	Duration  time.Duration     `json:"duration" groups:"public"`
+	IP        net.IP            `json:"ip" groups:"public"`
+	Custom    FieldsJSON        `json:"custom" groups:"public"`
+	Address   *FlatAddress      `json:"address" groups:"public"`
+	Tags      []FieldsStatus    `json:"tags" groups:"public"`
+	Lookup    map[int]AModel    `json:"lookup" groups:"public"`
+	Array     [2]int            `json:"array" groups:"public"`
+	Nil       map[string]string `json:"nil" groups:"public"`
+}
+
+// assertFieldTypes asserts that v only consists of the types Fields guarantees.
+func assertFieldTypes(t *testing.T, path string, v interface{}) {
+	switch v := v.(type) {
+	case nil, string, bool, int64, uint64, float64:
+	case map[string]interface{}:
+		for key, value := range v {
+			assertFieldTypes(t, path+"."+key, value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			assertFieldTypes(t, path+"[]", value)
+		}
+	default:
+		t.Errorf("unexpected type %T at %s", v, path)
+	}
+}
+
+func TestFields(t *testing.T) {
+	createdAt, err := time.Parse(time.RFC3339, "2017-01-20T18:11:00Z")
+	assert.NoError(t, err)
+
+	v := FieldsModel{
+		Name:      "alice",
+		Secret:    "secret",
+		Status:    "active",
+		Count:     3,
+		Small:     4,
+		Ratio:     0.25,
+		CreatedAt: createdAt,
+		Duration:  time.Second,
+		IP:        net.ParseIP("127.0.0.1").To4(),
+		Custom:    FieldsJSON{Value: 5},
+		Address:   &FlatAddress{City: "Zurich"},
+		Tags:      []FieldsStatus{"a"},
+		Lookup:    map[int]AModel{1: {AllGroups: true}},
+		Array:     [2]int{1, 2},
+	}
+
+	fields, err := Fields(&Options{Groups: []string{"public", "test"}}, v)
+	assert.NoError(t, err)
+
+	assertFieldTypes(t, "", fields)
+	assert.Equal(t, map[string]interface{}{
+		"name":       "alice",
+		"status":     "active",
+		"count":      int64(3),
+		"small":      uint64(4),
+		"ratio":      float64(0.25),
+		"created_at": "2017-01-20T18:11:00Z",
+		"duration":   "1s",
+		"ip":         "127.0.0.1",
+		"custom":     map[string]interface{}{"value": int64(5), "ratio": float64(0.5)},
+		"address":    map[string]interface{}{"city": "Zurich"},
+		"tags":       []interface{}{"a"},
+		"lookup":     map[string]interface{}{"1": map[string]interface{}{"something": true}},
+		"array":      []interface{}{int64(1), int64(2)},
+		"nil":        nil,
+	}, fields)
+}
+
+func TestFields_InvalidType(t *testing.T) {
+	_, err := Fields(&Options{}, []string{"a"})
+	assert.Equal(t, MarshalInvalidTypeError{Kind: reflect.Slice, Value: []string{"a"}}, err)
+
+	fields, err := Fields(&Options{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, fields)
+}
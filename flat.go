@@ -0,0 +1,100 @@
+package sheriff
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// defaultFlatSeparator is used by MarshalFlat if Options.FlatSeparator is empty.
+const defaultFlatSeparator = "."
+
+// MarshalFlat marshals data like Marshal does, but flattens the result into a single level map.
+//
+// Nested objects are flattened into keys joined with Options.FlatSeparator (e.g. `address.city`) and slices
+// into indexed keys (e.g. `tags.0`, `tags.1`). Separators and backslashes within keys are escaped with a
+// backslash, so that e.g. the map key `a.b` becomes `a\.b`. Values which aren't primitives (e.g. time.Time)
+// are converted using their JSON representation; JSON numbers are returned as json.Number.
+// Empty objects and slices don't contribute any keys.
+func MarshalFlat(options *Options, data interface{}) (map[string]interface{}, error) {
+	intermediate, err := Marshal(options, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sep := options.FlatSeparator
+	if sep == "" {
+		sep = defaultFlatSeparator
+	}
+	f := flattener{
+		dest:    make(map[string]interface{}),
+		sep:     sep,
+		escaper: strings.NewReplacer(`\`, `\\`, sep, `\`+sep),
+	}
+	if err := f.flatten("", intermediate); err != nil {
+		return nil, err
+	}
+	return f.dest, nil
+}
+
+// flattener holds the state of a single MarshalFlat call.
+type flattener struct {
+	dest    map[string]interface{}
+	sep     string
+	escaper *strings.Replacer
+}
+
+func (f *flattener) join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + f.sep + key
+}
+
+func (f *flattener) flatten(prefix string, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if err := f.flatten(f.join(prefix, f.escaper.Replace(key)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		for i, value := range v {
+			if err := f.flatten(f.join(prefix, strconv.Itoa(i)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil, json.Number:
+		f.dest[prefix] = v
+		return nil
+	}
+
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Marshaler); !ok {
+			f.dest[prefix] = v
+			return nil
+		}
+	}
+
+	// anything else (e.g. time.Time, net.IP or arrays) is flattened using its JSON representation
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return err
+	}
+	return f.flatten(prefix, decoded)
+}
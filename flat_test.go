@@ -0,0 +1,73 @@
+package sheriff
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type FlatAddress struct {
+	City   string `json:"city" groups:"public"`
+	Street string `json:"street" groups:"private"`
+}
+
+type FlatModel struct {
+	Name       string            `json:"name" groups:"public"`
+	Address    FlatAddress       `json:"address" groups:"public"`
+	Tags       []string          `json:"tags" groups:"public"`
+	Attributes map[string]string `json:"attributes" groups:"public"`
+	Marshaller IsMarshaller      `json:"marshaller" groups:"public"`
+	CreatedAt  time.Time         `json:"created_at" groups:"public"`
+	IP         net.IP            `json:"ip" groups:"public"`
+	Empty      []string          `json:"empty" groups:"public"`
+	Nil        *FlatAddress      `json:"nil" groups:"public"`
+}
+
+func TestMarshalFlat(t *testing.T) {
+	createdAt, err := time.Parse(time.RFC3339, "2017-01-20T18:11:00Z")
+	assert.NoError(t, err)
+
+	v := FlatModel{
+		Name:       "alice",
+		Address:    FlatAddress{City: "Zurich", Street: "Main"},
+		Tags:       []string{"a", "b"},
+		Attributes: map[string]string{"dotted.key": "x", `back\slash`: "y"},
+		Marshaller: IsMarshaller{"test"},
+		CreatedAt:  createdAt,
+		IP:         net.ParseIP("127.0.0.1").To4(),
+		Empty:      []string{},
+	}
+
+	actual, err := MarshalFlat(&Options{Groups: []string{"public", "test"}}, v)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"name":                      "alice",
+		"address.city":              "Zurich",
+		"tags.0":                    "a",
+		"tags.1":                    "b",
+		`attributes.dotted\.key`:    "x",
+		`attributes.back\\slash`:    "y",
+		"marshaller.should_marshal": "test",
+		"created_at":                "2017-01-20T18:11:00Z",
+		"ip":                        "127.0.0.1",
+		"nil":                       nil,
+	}, actual)
+}
+
+func TestMarshalFlat_Separator(t *testing.T) {
+	v := FlatModel{
+		Address:    FlatAddress{City: "Zurich"},
+		Attributes: map[string]string{"a/b": "x"},
+	}
+
+	actual, err := MarshalFlat(&Options{Groups: []string{"public"}, FlatSeparator: "/"}, v)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Zurich", actual["address/city"])
+	assert.Equal(t, "x", actual[`attributes/a\/b`])
+	_, ok := actual["marshaller/should_marshal"]
+	assert.False(t, ok)
+}
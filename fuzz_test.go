@@ -0,0 +1,234 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/netip"
+	"testing"
+)
+
+type FuzzEmbedded struct {
+	Embedded string `json:"embedded" groups:"a"`
+}
+
+type fuzzUnexported struct {
+	Hidden string
+}
+
+type fuzzUnexportedPtr struct {
+	HiddenPtr string
+}
+
+type FuzzID string
+
+type FuzzNode struct {
+	*FuzzEmbedded
+	fuzzUnexported
+	*fuzzUnexportedPtr
+	*FuzzID
+
+	Name     string                `json:"name,omitempty" groups:"a"`
+	Next     *FuzzNode             `json:"next" groups:"a,b"`
+	Any      interface{}           `json:"any,omitempty"`
+	Items    []interface{}         `json:"items" groups:"b"`
+	Nested   [][]*FuzzNode         `json:"nested"`
+	Lookup   map[string]*FuzzNode  `json:"lookup,omitempty" groups:"a"`
+	Opt      Optional[interface{}] `json:"opt,omitempty"`
+	Stringer fmt.Stringer          `json:"stringer"`
+	Short    string                `json:"short" sheriff:"maxlen=2"`
+}
+
+// fuzzBuilder builds values and options from the input of the fuzzer. Every byte selects what to build next,
+// running out of input results in zero values.
+type fuzzBuilder struct {
+	data []byte
+}
+
+func (b *fuzzBuilder) next() byte {
+	if len(b.data) == 0 {
+		return 0
+	}
+	c := b.data[0]
+	b.data = b.data[1:]
+	return c
+}
+
+func (b *fuzzBuilder) string() string {
+	n := int(b.next() % 8)
+	if n > len(b.data) {
+		n = len(b.data)
+	}
+	s := string(b.data[:n])
+	b.data = b.data[n:]
+	return s
+}
+
+func (b *fuzzBuilder) options() *Options {
+	flags := b.next()
+	options := &Options{
+		Groups:             [][]string{nil, {"a"}, {"b"}, {"a", "b"}}[flags%4],
+		OmitEmptyNested:    flags&4 != 0,
+		TraverseMarshalers: flags&8 != 0,
+		ExcludedAsNull:     flags&16 != 0,
+		UseValuer:          flags&32 != 0,
+		TruncateOverflow:   flags&64 != 0,
+	}
+	if flags&128 != 0 {
+		limits := b.next()
+		options.MaxRenderDepth = int(limits % 4)
+		options.MaxSliceLen = int(limits / 4 % 4)
+		options.MaxMapLen = int(limits / 16 % 4)
+		options.MaxStringLen = int(limits / 64)
+		options.OverflowKey = "_more"
+		options.DepthOverflowField = [2]string{"", "name"}[limits%2]
+		options.OmitDepthOverflow = limits%3 == 0
+	}
+	return options
+}
+
+func (b *fuzzBuilder) value(depth int) interface{} {
+	if depth > 8 {
+		return nil
+	}
+	switch b.next() % 24 {
+	case 0:
+		return nil
+	case 1:
+		return (*FuzzNode)(nil)
+	case 2:
+		return (*IsMarshaller)(nil)
+	case 3:
+		return (*Optional[int])(nil)
+	case 4:
+		return b.string()
+	case 5:
+		return int(b.next()) - 128
+	case 6:
+		return b.node(depth)
+	case 7:
+		return []interface{}{b.value(depth + 1), b.value(depth + 1), b.value(depth + 1)}
+	case 8:
+		return map[string]interface{}{b.string(): b.value(depth + 1), b.string(): b.value(depth + 1)}
+	case 9:
+		return map[int8]interface{}{int8(b.next()): b.value(depth + 1)}
+	case 10:
+		return map[float64]interface{}{math.NaN(): b.value(depth + 1)}
+	case 11:
+		return map[*netip.Addr]interface{}{nil: b.value(depth + 1)}
+	case 12:
+		return map[interface{}]string{b.string(): b.string(), int(b.next()): b.string()}
+	case 13:
+		return [][]interface{}{{b.value(depth + 1)}, nil, {}}
+	case 14:
+		return Some(b.value(depth + 1))
+	case 15:
+		if node := b.node(depth); node != nil {
+			return *node
+		}
+		return FuzzNode{}
+	case 16:
+		return IsMarshaller{ShouldMarshal: b.string()}
+	case 17:
+		return make(chan int)
+	case 18:
+		v := b.value(depth + 1)
+		return &v
+	case 19:
+		return Optional[*FuzzNode]{}
+	case 20:
+		return (*netip.Addr)(nil)
+	case 21:
+		return []*FuzzNode{b.node(depth), nil}
+	case 22:
+		return map[string]Optional[interface{}]{b.string(): Some(b.value(depth + 1))}
+	default:
+		return (fmt.Stringer)(nil)
+	}
+}
+
+func (b *fuzzBuilder) node(depth int) *FuzzNode {
+	flags := b.next()
+	if flags == 0 {
+		return nil
+	}
+	node := &FuzzNode{
+		Name:  b.string(),
+		Short: b.string(),
+	}
+	if flags&1 != 0 {
+		node.FuzzEmbedded = &FuzzEmbedded{Embedded: b.string()}
+	}
+	if flags&2 != 0 {
+		node.fuzzUnexportedPtr = &fuzzUnexportedPtr{HiddenPtr: b.string()}
+	}
+	if flags&4 != 0 && depth < 8 {
+		node.Next = b.node(depth + 1)
+	}
+	if flags&8 != 0 {
+		node.Any = b.value(depth + 1)
+		node.Items = []interface{}{b.value(depth + 1), nil}
+	}
+	if flags&16 != 0 {
+		node.Nested = [][]*FuzzNode{{nil, b.node(depth + 1)}, nil}
+		node.Lookup = map[string]*FuzzNode{"nil": nil, "node": b.node(depth + 1)}
+	}
+	if flags&32 != 0 {
+		node.Opt = Some(b.value(depth + 1))
+	}
+	if flags&64 != 0 {
+		var addr *netip.Addr
+		node.Stringer = addr
+	}
+	if flags&128 != 0 {
+		id := FuzzID(b.string())
+		node.FuzzID = &id
+	}
+	return node
+}
+
+// FuzzMarshal asserts that Marshal either succeeds or returns an error, but never panics, and that MarshalAppend
+// appends the same as json.Marshal of Marshal's result.
+func FuzzMarshal(f *testing.F) {
+	seeds := [][]byte{
+		{},
+		{0, 1},
+		{0, 2},
+		{3, 3},
+		{255, 255, 6, 255, 1, 'a', 1, 'b'},
+		{1, 7, 2, 3, 1},
+		{2, 8, 1, 'k', 11, 1, 'l', 20},
+		{0, 10, 6},
+		{0, 11, 2},
+		{0, 12, 1},
+		{0, 14, 2},
+		{0, 22, 1, 'k', 3},
+		{0, 21, 255, 2, 'n', 'n', 2, 's', 's'},
+		{128 | 1, 255, 15, 255},
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b := &fuzzBuilder{data: data}
+		options := b.options()
+		v := b.value(0)
+
+		intermediate, err := Marshal(options, v)
+		if err != nil {
+			return
+		}
+		expected, err := json.Marshal(intermediate)
+		if err != nil {
+			return
+		}
+		actual, err := MarshalAppend(nil, options, v)
+		if err != nil {
+			t.Fatalf("MarshalAppend failed: %v", err)
+		}
+		if string(actual) != string(expected) {
+			t.Fatalf("MarshalAppend appended %s instead of %s", actual, expected)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+module github.com/peoplecentrix/sheriff/gateway
+
+go 1.25.0
+
+require (
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.29.0
+	github.com/peoplecentrix/sheriff v0.0.0-20261016174454-b08b1bfa4df7
+	github.com/stretchr/testify v1.4.0
+	google.golang.org/grpc v1.80.0
+	google.golang.org/protobuf v1.36.11
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.49.0 // indirect
+	golang.org/x/sys v0.40.0 // indirect
+	golang.org/x/text v0.36.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20260414002931-afd174a4e478 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260414002931-afd174a4e478 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
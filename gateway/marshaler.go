@@ -0,0 +1,140 @@
+// Package gateway provides a grpc-gateway runtime.Marshaler filtering responses using sheriff.
+//
+// runtime.Marshaler has no access to the request, so the groups are attached to a response by
+// Marshaler.RewriteResponse, which is to be registered using runtime.WithForwardResponseRewriter:
+//
+//	m := &gateway.Marshaler{MetadataKey: "x-scopes"}
+//	mux := runtime.NewServeMux(
+//		runtime.WithMarshalerOption(runtime.MIMEWildcard, m),
+//		runtime.WithForwardResponseRewriter(m.RewriteResponse),
+//	)
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/peoplecentrix/sheriff"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// groupsContextKey is the context key of the groups set by WithGroups.
+type groupsContextKey struct{}
+
+// WithGroups returns a copy of ctx carrying the groups responses are filtered by.
+func WithGroups(ctx context.Context, groups []string) context.Context {
+	return context.WithValue(ctx, groupsContextKey{}, groups)
+}
+
+// GroupsFromContext returns the groups set by WithGroups and whether there are any.
+func GroupsFromContext(ctx context.Context) ([]string, bool) {
+	groups, ok := ctx.Value(groupsContextKey{}).([]string)
+	return groups, ok
+}
+
+// Handler returns a middleware for the gateway mux which sets the groups returned by groups for every request,
+// e.g. derived from the scopes of the caller.
+func Handler(next http.Handler, groups func(r *http.Request) []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithGroups(r.Context(), groups(r))))
+	})
+}
+
+// Marshaler is a runtime.Marshaler which marshals responses rewritten by RewriteResponse using sheriff.
+//
+// The fields of generated messages are filtered like any other struct and encoded using encoding/json, i.e. the
+// keys are taken from their json tags instead of the protojson names. Their internal fields are unexported and
+// therefore skipped. Everything else, including error responses and decoding requests, is left to the embedded
+// runtime.JSONPb.
+type Marshaler struct {
+	runtime.JSONPb
+
+	// Options are used to marshal the responses. Their groups are replaced by the groups of the request.
+	// If nil, empty options are used.
+	Options *sheriff.Options
+	// MetadataKey is the metadata key holding the comma-separated groups if the context has none set by WithGroups,
+	// e.g. the forwarded header of the request. If empty, only WithGroups is used.
+	MetadataKey string
+}
+
+// response is a response rewritten by RewriteResponse.
+type response struct {
+	groups []string
+	data   interface{}
+}
+
+// RewriteResponse attaches the groups of the request to resp, see runtime.WithForwardResponseRewriter.
+// Responses of requests without groups are returned as is.
+func (m *Marshaler) RewriteResponse(ctx context.Context, resp proto.Message) (any, error) {
+	groups, ok := m.groups(ctx)
+	if !ok {
+		return resp, nil
+	}
+	// the runtime only honors the response_body option of the HttpRule for messages which aren't rewritten
+	var data interface{} = resp
+	if rb, ok := resp.(interface{ XXX_ResponseBody() interface{} }); ok {
+		data = rb.XXX_ResponseBody()
+	}
+	return response{groups: groups, data: data}, nil
+}
+
+func (m *Marshaler) groups(ctx context.Context) ([]string, bool) {
+	if groups, ok := GroupsFromContext(ctx); ok {
+		return groups, true
+	}
+	if m.MetadataKey == "" {
+		return nil, false
+	}
+	// the gateway forwards the request headers as outgoing metadata
+	md, _ := metadata.FromOutgoingContext(ctx)
+	values := md.Get(m.MetadataKey)
+	if len(values) == 0 {
+		values = metadata.ValueFromIncomingContext(ctx, m.MetadataKey)
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+	var groups []string
+	for _, value := range values {
+		groups = append(groups, strings.Split(value, ",")...)
+	}
+	return groups, true
+}
+
+// Marshal implements runtime.Marshaler.
+func (m *Marshaler) Marshal(v interface{}) ([]byte, error) {
+	resp, ok := v.(response)
+	if !ok {
+		return m.JSONPb.Marshal(v)
+	}
+	if isNil(resp.data) {
+		return []byte("null"), nil
+	}
+
+	options := sheriff.Options{}
+	if m.Options != nil {
+		options = *m.Options
+	}
+	options.Groups = resp.groups
+	// generated messages implement fmt.Stringer, which would leave them to encoding/json unfiltered
+	options.TraverseMarshalers = true
+
+	filtered, err := sheriff.Marshal(&options, resp.data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(filtered)
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// User stands in for a generated message, including its internal fields.
+type User struct {
+	state         struct{}
+	sizeCache     int32
+	unknownFields []byte
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty" groups:"public"`
+	Email string `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty" groups:"personal"`
+}
+
+func (x *User) Reset()                             {}
+func (x *User) String() string                     { return "name:" + x.Name }
+func (x *User) ProtoMessage()                      {}
+func (x *User) ProtoReflect() protoreflect.Message { return nil }
+
+// GetUserResponse stands in for a generated response with nested messages.
+type GetUserResponse struct {
+	state         struct{}
+	sizeCache     int32
+	unknownFields []byte
+
+	User    *User   `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Friends []*User `protobuf:"bytes,2,rep,name=friends,proto3" json:"friends,omitempty" groups:"personal"`
+}
+
+func (x *GetUserResponse) Reset()                             {}
+func (x *GetUserResponse) String() string                     { return "user:" + x.User.String() }
+func (x *GetUserResponse) ProtoMessage()                      {}
+func (x *GetUserResponse) ProtoReflect() protoreflect.Message { return nil }
+
+func userResponse() *GetUserResponse {
+	return &GetUserResponse{
+		User:    &User{Name: "alice", Email: "alice@example.org"},
+		Friends: []*User{{Name: "bob", Email: "bob@example.org"}},
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	tests := map[string]struct {
+		ctx      context.Context
+		expected string
+	}{
+		"context": {
+			ctx:      WithGroups(context.Background(), []string{"public"}),
+			expected: `{"user":{"name":"alice"}}`,
+		},
+		"outgoing metadata": {
+			ctx:      metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-scopes", "public,personal")),
+			expected: `{"friends":[{"email":"bob@example.org","name":"bob"}],"user":{"email":"alice@example.org","name":"alice"}}`,
+		},
+		"incoming metadata": {
+			ctx:      metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-scopes", "public")),
+			expected: `{"user":{"name":"alice"}}`,
+		},
+	}
+
+	m := &Marshaler{MetadataKey: "x-scopes"}
+	for name, test := range tests {
+		rewritten, err := m.RewriteResponse(test.ctx, userResponse())
+		assert.NoError(t, err)
+
+		actual, err := m.Marshal(rewritten)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, string(actual), name)
+	}
+}
+
+func TestMarshaler_WithoutGroups(t *testing.T) {
+	m := &Marshaler{}
+	resp := userResponse()
+
+	rewritten, err := m.RewriteResponse(metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-scopes", "public")), resp)
+	assert.NoError(t, err)
+	assert.Same(t, resp, rewritten)
+
+	actual, err := m.Marshal(map[string]string{"name": "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"alice"}`, string(actual))
+}
+
+func TestMarshaler_Nil(t *testing.T) {
+	m := &Marshaler{}
+	ctx := WithGroups(context.Background(), []string{"public"})
+
+	rewritten, err := m.RewriteResponse(ctx, (*GetUserResponse)(nil))
+	assert.NoError(t, err)
+	actual, err := m.Marshal(rewritten)
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(actual))
+
+	rewritten, err = m.RewriteResponse(ctx, &GetUserResponse{})
+	assert.NoError(t, err)
+	actual, err = m.Marshal(rewritten)
+	assert.NoError(t, err)
+	assert.Equal(t, `{}`, string(actual))
+}
+
+func TestMarshaler_ServeMux(t *testing.T) {
+	m := &Marshaler{}
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, m),
+		runtime.WithForwardResponseRewriter(m.RewriteResponse),
+	)
+	err := mux.HandlePath(http.MethodGet, "/user", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		runtime.ForwardResponseMessage(r.Context(), mux, outbound, w, r, userResponse())
+	})
+	assert.NoError(t, err)
+
+	handler := Handler(mux, func(r *http.Request) []string {
+		return []string{r.URL.Query().Get("scope")}
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user?scope=public", nil))
+
+	body, err := io.ReadAll(w.Result().Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"user":{"name":"alice"}}`, string(body))
+}
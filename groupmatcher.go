@@ -0,0 +1,71 @@
+package sheriff
+
+import (
+	"path"
+	"strings"
+)
+
+// GroupMatcher determines whether a requested group (one of Options.Groups) matches a group of a field's tag.
+//
+// Match is called with the requested group and the tagged one, both with surrounding spaces trimmed and without
+// the access suffix of the tag (e.g. `admin` for `admin:rw`).
+type GroupMatcher interface {
+	Match(requested, tagged string) bool
+}
+
+// GroupMatcherFunc is an adapter to allow the use of ordinary functions as GroupMatcher.
+type GroupMatcherFunc func(requested, tagged string) bool
+
+// Match calls fn(requested, tagged).
+func (fn GroupMatcherFunc) Match(requested, tagged string) bool {
+	return fn(requested, tagged)
+}
+
+var (
+	// ExactGroups matches groups which are equal. It's the default.
+	ExactGroups GroupMatcher = exactGroups{}
+	// CaseInsensitiveGroups matches groups which are equal under Unicode case-folding, e.g. `Read:Billing`
+	// and `read:billing`.
+	CaseInsensitiveGroups GroupMatcher = caseInsensitiveGroups{}
+	// GlobGroups treats the requested groups as patterns as defined by path.Match, e.g. `admin:*` matches
+	// `admin:users` and `admin:billing`. The groups of tags are taken literally: a tag `admin:*` is only
+	// matched by requested groups matching the string `admin:*` itself, not by `admin:users`. Malformed
+	// patterns match nothing, see Options.Validate.
+	GlobGroups GroupMatcher = globGroups{}
+)
+
+type exactGroups struct{}
+
+func (exactGroups) Match(requested, tagged string) bool {
+	return requested == tagged
+}
+
+type caseInsensitiveGroups struct{}
+
+func (caseInsensitiveGroups) Match(requested, tagged string) bool {
+	return strings.EqualFold(requested, tagged)
+}
+
+type globGroups struct{}
+
+func (globGroups) Match(requested, tagged string) bool {
+	matched, _ := path.Match(requested, tagged)
+	return matched
+}
+
+// matchesGroups reports whether one of the requested groups matches one of the tagged groups
+// using Options.GroupMatcher.
+func (s *marshalState) matchesGroups(tagged []string, requested []string) bool {
+	matcher := s.options.GroupMatcher
+	if matcher == nil {
+		return listContains(tagged, requested)
+	}
+	for _, t := range tagged {
+		for _, r := range requested {
+			if matcher.Match(r, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type GroupMatcherBilling struct {
+	Plan string `json:"plan"`
+}
+
+type GroupMatcherModel struct {
+	GroupMatcherBilling `groups:"read:billing"`
+	Name                string `json:"name" groups:"read:profile"`
+	Users               int    `json:"users" groups:"admin:users"`
+	Invoices            int    `json:"invoices" groups:"admin:billing"`
+	Wildcard            string `json:"wildcard" groups:"admin:*"`
+	Note                string `json:"note,omitempty" groups:"Read:Profile"`
+}
+
+func TestMarshal_GroupMatcher(t *testing.T) {
+	v := GroupMatcherModel{
+		GroupMatcherBilling: GroupMatcherBilling{Plan: "pro"},
+		Name:                "alice",
+		Users:               3,
+		Invoices:            7,
+		Wildcard:            "wildcard",
+	}
+
+	tests := []struct {
+		name     string
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "exact",
+			options:  &Options{Groups: []string{"Read:Billing", "read:profile"}},
+			expected: `{"name":"alice"}`,
+		},
+		{
+			name:     "case-insensitive",
+			options:  &Options{Groups: []string{"Read:Billing", "READ:PROFILE"}, GroupMatcher: CaseInsensitiveGroups},
+			expected: `{"name":"alice","plan":"pro"}`,
+		},
+		{
+			name:     "case-insensitive omitempty groups",
+			options:  &Options{Groups: []string{"read:profile"}, OmitEmptyGroups: []string{"READ:PROFILE"}, GroupMatcher: CaseInsensitiveGroups},
+			expected: `{"name":"alice"}`,
+		},
+		{
+			name:     "glob in request",
+			options:  &Options{Groups: []string{"admin:*"}, GroupMatcher: GlobGroups},
+			expected: `{"invoices":7,"users":3,"wildcard":"wildcard"}`,
+		},
+		{
+			name:     "glob in request propagated",
+			options:  &Options{Groups: []string{"read:*"}, GroupMatcher: GlobGroups},
+			expected: `{"name":"alice","plan":"pro"}`,
+		},
+		{
+			name:     "glob in tag",
+			options:  &Options{Groups: []string{"admin:users"}, GroupMatcher: GlobGroups},
+			expected: `{"users":3}`,
+		},
+		{
+			name:     "malformed pattern",
+			options:  &Options{Groups: []string{"admin:[users"}, GroupMatcher: GlobGroups},
+			expected: `{}`,
+		},
+		{
+			name: "func",
+			options: &Options{Groups: []string{"admin"}, GroupMatcher: GroupMatcherFunc(func(requested, tagged string) bool {
+				return strings.HasPrefix(tagged, requested+":")
+			})},
+			expected: `{"invoices":7,"users":3,"wildcard":"wildcard"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Marshal(test.options, v)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(v, map[string]*Options{"a": test.options, "b": {Groups: []string{"read:profile"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, m, all["a"])
+		})
+	}
+}
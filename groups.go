@@ -0,0 +1,62 @@
+package sheriff
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Access describes what a group may do with a field.
+type Access uint8
+
+const (
+	// AccessRead allows a group to read a field, i.e. the field is marshalled for that group.
+	AccessRead Access = 1 << iota
+	// AccessWrite allows a group to write a field, which is up to the input side to enforce.
+	AccessWrite
+	// AccessReadWrite allows a group to read and write a field. It's the default if no access is specified.
+	AccessReadWrite = AccessRead | AccessWrite
+)
+
+// GroupAccess is a single entry of a groups tag, e.g. `admin:rw`.
+type GroupAccess struct {
+	Group  string
+	Access Access
+}
+
+// FieldGroups returns the groups of the field of the struct type t together with their access, as parsed from
+// its groups tag, or else from the groups registered using RegisterFieldGroups. It returns nil if the field
+// has no groups, which means it's visible to everyone.
+//
+// Each group in a tag may be suffixed with `:r` (read only), `:w` (write only) or `:rw` (read and write, the default),
+// e.g. `groups:"public:r,admin"`. Marshal only considers the groups which may read a field. Other suffixes
+// are considered part of the group name.
+func FieldGroups(t reflect.Type, field reflect.StructField) []GroupAccess {
+	entries, _ := fieldGroupEntries(t, field, false)
+	if entries == nil {
+		return nil
+	}
+	groups := make([]GroupAccess, len(entries))
+	for i, entry := range entries {
+		groups[i] = parseGroupAccess(entry)
+	}
+	return groups
+}
+
+// parseGroupAccess parses a single normalized entry of a groups tag.
+func parseGroupAccess(entry string) GroupAccess {
+	if i := strings.LastIndexByte(entry, ':'); i >= 0 {
+		var access Access
+		switch entry[i+1:] {
+		case "r":
+			access = AccessRead
+		case "w":
+			access = AccessWrite
+		case "rw":
+			access = AccessReadWrite
+		}
+		if access != 0 {
+			return GroupAccess{Group: strings.TrimSpace(entry[:i]), Access: access}
+		}
+	}
+	return GroupAccess{Group: entry, Access: AccessReadWrite}
+}
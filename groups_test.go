@@ -0,0 +1,65 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type DirectionalInfo struct {
+	Age int `json:"age"`
+}
+
+type DirectionalModel struct {
+	DirectionalInfo `groups:"admin:w"`
+	Name            string `json:"name" groups:"public:r,admin:rw"`
+	Email           string `json:"email" groups:"public:w,admin"`
+	Password        string `json:"password" groups:"public:w,admin:w"`
+	Scope           string `json:"scope" groups:"scope:read"`
+	Plain           string `json:"plain" groups:"public"`
+}
+
+func TestMarshal_DirectionalGroups(t *testing.T) {
+	v := DirectionalModel{
+		DirectionalInfo: DirectionalInfo{Age: 20},
+		Name:            "alice",
+		Email:           "alice@example.org",
+		Password:        "s3cr3t",
+		Scope:           "scope",
+		Plain:           "plain",
+	}
+
+	tests := map[string]string{
+		"public":     `{"name":"alice","plain":"plain"}`,
+		"admin":      `{"email":"alice@example.org","name":"alice"}`,
+		"scope:read": `{"scope":"scope"}`,
+	}
+	for group, expected := range tests {
+		actualMap, err := Marshal(&Options{Groups: []string{group}}, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(actual), group)
+	}
+}
+
+func TestFieldGroups(t *testing.T) {
+	typ := reflect.TypeOf(DirectionalModel{})
+	field := func(name string) reflect.StructField {
+		f, ok := typ.FieldByName(name)
+		assert.True(t, ok)
+		return f
+	}
+
+	assert.Equal(t, []GroupAccess{{"admin", AccessWrite}}, FieldGroups(typ, field("DirectionalInfo")))
+	assert.Equal(t, []GroupAccess{{"public", AccessRead}, {"admin", AccessReadWrite}}, FieldGroups(typ, field("Name")))
+	assert.Equal(t, []GroupAccess{{"public", AccessWrite}, {"admin", AccessReadWrite}}, FieldGroups(typ, field("Email")))
+	assert.Equal(t, []GroupAccess{{"scope:read", AccessReadWrite}}, FieldGroups(typ, field("Scope")))
+	assert.Equal(t, []GroupAccess{{"public", AccessReadWrite}}, FieldGroups(typ, field("Plain")))
+	assert.Nil(t, FieldGroups(reflect.TypeOf(DirectionalInfo{}), reflect.TypeOf(DirectionalInfo{}).Field(0)))
+
+	// registered groups are parsed the same way
+	assert.Equal(t, []GroupAccess{{"admin", AccessReadWrite}}, FieldGroups(reflect.TypeOf(RegistryBaseModel{}), reflect.TypeOf(RegistryBaseModel{}).Field(2)))
+}
@@ -0,0 +1,83 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// groupsCondition is the parsed groups_if tag of a field, e.g. `groups_if:"Visibility=public"`. It shows the
+// field regardless of its groups if the sibling field holds the given value.
+type groupsCondition struct {
+	// index is the index sequence of the sibling field, which may be promoted from an anonymous field.
+	index []int
+	// kind is the kind of the sibling field, after dereferencing pointers.
+	kind reflect.Kind
+	// value is the value compared to, parsed according to kind: a string, bool, int64 or uint64.
+	value interface{}
+}
+
+// parseGroupsIfTag parses the groups_if tag of the field of the struct type t, which is nil if there is none.
+func parseGroupsIfTag(t reflect.Type, field reflect.StructField) (*groupsCondition, error) {
+	tag, ok := field.Tag.Lookup("groups_if")
+	if !ok {
+		return nil, nil
+	}
+	name, value, ok := strings.Cut(tag, "=")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("marshaller: invalid groups_if %q of field %s of %s, expected Field=value", tag, field.Name, t)
+	}
+	sibling, ok := t.FieldByName(name)
+	if !ok {
+		return nil, fmt.Errorf("marshaller: groups_if tag of field %s of %s refers to the unknown field %s", field.Name, t, name)
+	}
+
+	ft := sibling.Type
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	c := &groupsCondition{index: sibling.Index, kind: ft.Kind()}
+	var err error
+	switch ft.Kind() {
+	case reflect.String:
+		c.value = value
+	case reflect.Bool:
+		c.value, err = strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c.value, err = strconv.ParseInt(value, 10, ft.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		c.value, err = strconv.ParseUint(value, 10, ft.Bits())
+	default:
+		return nil, fmt.Errorf("marshaller: groups_if tag of field %s of %s compares field %s of type %s, which isn't a string, bool or integer", field.Name, t, name, sibling.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("marshaller: invalid groups_if value %q of field %s of %s for %s", value, field.Name, t, sibling.Type)
+	}
+	return c, nil
+}
+
+// matches reports whether the sibling field of the struct value v holds the value of c. Nil pointers, including
+// the ones of anonymous fields the sibling is promoted from, never match.
+func (c *groupsCondition) matches(v reflect.Value) bool {
+	sibling, err := v.FieldByIndexErr(c.index)
+	if err != nil {
+		return false
+	}
+	for sibling.Kind() == reflect.Ptr {
+		if sibling.IsNil() {
+			return false
+		}
+		sibling = sibling.Elem()
+	}
+	switch c.kind {
+	case reflect.String:
+		return sibling.String() == c.value
+	case reflect.Bool:
+		return sibling.Bool() == c.value
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return sibling.Int() == c.value
+	default:
+		return sibling.Uint() == c.value
+	}
+}
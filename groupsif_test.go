@@ -0,0 +1,124 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type GroupsIfPost struct {
+	ID         int    `json:"id"`
+	Visibility string `json:"visibility"`
+	Body       string `json:"body" groups:"moderator" groups_if:"Visibility=public"`
+}
+
+type GroupsIfFeed struct {
+	Posts []GroupsIfPost `json:"posts"`
+}
+
+func TestMarshal_GroupsIf(t *testing.T) {
+	feed := GroupsIfFeed{Posts: []GroupsIfPost{
+		{ID: 1, Visibility: "public", Body: "hello"},
+		{ID: 2, Visibility: "private", Body: "secret"},
+		{ID: 3, Visibility: "public", Body: "world"},
+	}}
+
+	tests := []struct {
+		name     string
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "anonymous",
+			options:  &Options{},
+			expected: `{"posts":[{"body":"hello","id":1,"visibility":"public"},{"id":2,"visibility":"private"},{"body":"world","id":3,"visibility":"public"}]}`,
+		},
+		{
+			name:     "other group",
+			options:  &Options{Groups: []string{"user"}},
+			expected: `{"posts":[{"body":"hello","id":1,"visibility":"public"},{"id":2,"visibility":"private"},{"body":"world","id":3,"visibility":"public"}]}`,
+		},
+		{
+			name:     "moderator",
+			options:  &Options{Groups: []string{"moderator"}},
+			expected: `{"posts":[{"body":"hello","id":1,"visibility":"public"},{"body":"secret","id":2,"visibility":"private"},{"body":"world","id":3,"visibility":"public"}]}`,
+		},
+		{
+			name:     "excluded as null",
+			options:  &Options{ExcludedAsNull: true},
+			expected: `{"posts":[{"body":"hello","id":1,"visibility":"public"},{"body":null,"id":2,"visibility":"private"},{"body":"world","id":3,"visibility":"public"}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := Marshal(test.options, feed)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(v)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(feed, map[string]*Options{"a": test.options, "b": {Groups: []string{"moderator"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, v, all["a"])
+		})
+	}
+}
+
+type GroupsIfOwner struct {
+	Shared *bool `json:"shared"`
+}
+
+type GroupsIfKinds struct {
+	*GroupsIfOwner
+	Level  int8   `json:"level"`
+	Rank   uint   `json:"rank"`
+	ByBool string `json:"by_bool" groups:"admin" groups_if:"Shared=true"`
+	ByInt  string `json:"by_int" groups:"admin" groups_if:"Level=-1"`
+	ByUint string `json:"by_uint" groups:"admin" groups_if:"Rank=7"`
+}
+
+func TestMarshal_GroupsIfKinds(t *testing.T) {
+	shared := true
+	values := []GroupsIfKinds{
+		{GroupsIfOwner: &GroupsIfOwner{Shared: &shared}, Level: -1, Rank: 7, ByBool: "b", ByInt: "i", ByUint: "u"},
+		// the promoted field and the pointer are nil
+		{Level: 1, ByBool: "b", ByInt: "i", ByUint: "u"},
+		{GroupsIfOwner: &GroupsIfOwner{}, ByBool: "b"},
+	}
+
+	actual, err := MarshalAppend(nil, &Options{}, values)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"by_bool":"b","by_int":"i","by_uint":"u","level":-1,"rank":7,"shared":true},{"level":1,"rank":0},{"level":0,"rank":0,"shared":null}]`, string(actual))
+}
+
+type GroupsIfMistakes struct {
+	Flag    float64 `json:"flag"`
+	Unknown string  `json:"unknown" groups:"admin" groups_if:"Visibility=public"`
+	Syntax  string  `json:"syntax" groups:"admin" groups_if:"Flag"`
+	Kind    string  `json:"kind" groups:"admin" groups_if:"Flag=1"`
+}
+
+type GroupsIfInvalidValue struct {
+	Level int    `json:"level"`
+	Body  string `json:"body" groups:"admin" groups_if:"Level=high"`
+}
+
+func TestMarshal_GroupsIfErrors(t *testing.T) {
+	_, err := Marshal(&Options{}, GroupsIfInvalidValue{})
+	assert.EqualError(t, err, `marshaller: invalid groups_if value "high" of field Body of sheriff.GroupsIfInvalidValue for int`)
+
+	// the field is skipped if the error is recovered from
+	v, err := Marshal(&Options{ErrorPolicy: SkipSilently}, GroupsIfInvalidValue{Level: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"level": 1}, v)
+
+	typ := reflect.TypeOf(GroupsIfMistakes{})
+	err = Check(typ)
+	assert.EqualError(t, err, `marshaller: groups_if tag of field Unknown of sheriff.GroupsIfMistakes refers to the unknown field Visibility
+marshaller: invalid groups_if "Flag" of field Syntax of sheriff.GroupsIfMistakes, expected Field=value
+marshaller: groups_if tag of field Kind of sheriff.GroupsIfMistakes compares field Flag of type float64, which isn't a string, bool or integer`)
+	assert.True(t, errors.As(err, new(TagError)))
+}
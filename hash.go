@@ -0,0 +1,34 @@
+package sheriff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+)
+
+// Hash writes the canonical encoding of data filtered by the given options (see MarshalCanonical) to h and
+// returns the resulting digest as a hex string, e.g. to be used as an ETag. If h is nil, SHA-256 is used.
+// h isn't reset, so anything written to it before is part of the digest.
+//
+// The encoding is written in chunks, so the whole document is never held in memory at once. As it only
+// contains what the options allow to see, callers with different groups get different digests for the same
+// data. The digest changes whenever the filtered data or the group tags deciding about it change.
+func Hash(options *Options, data interface{}, h hash.Hash) (string, error) {
+	if h == nil {
+		h = sha256.New()
+	}
+
+	s := acquireMarshalState(options)
+	defer s.release()
+	s.canonical = true
+	s.sink = h
+
+	rest, err := s.marshalAppend(make([]byte, 0, flushSize), data)
+	if err != nil {
+		return "", err
+	}
+	if _, err := h.Write(rest); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,68 @@
+package sheriff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type HashModel struct {
+	ID     int    `json:"id" groups:"user,admin"`
+	Name   string `json:"name" groups:"user,admin"`
+	Salary int    `json:"salary" groups:"admin"`
+}
+
+func TestHash(t *testing.T) {
+	value := HashModel{ID: 1, Name: "alice", Salary: 100}
+
+	user, err := Hash(&Options{Groups: []string{"user"}}, value, nil)
+	assert.NoError(t, err)
+	admin, err := Hash(&Options{Groups: []string{"admin"}}, value, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, user, admin)
+
+	// equal values result in equal digests, no matter how they're backed
+	equal, err := Hash(&Options{Groups: []string{"user"}}, &HashModel{ID: 1, Name: "alice", Salary: 200}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, user, equal)
+	mapBacked, err := Hash(&Options{Groups: []string{"user"}}, map[string]interface{}{"name": "alice", "id": 1}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, user, mapBacked)
+
+	changed, err := Hash(&Options{Groups: []string{"user"}}, HashModel{ID: 1, Name: "bob"}, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, user, changed)
+
+	sum := sha256.Sum256([]byte(`{"id":1,"name":"alice"}`))
+	assert.Equal(t, hex.EncodeToString(sum[:]), user)
+}
+
+func TestHash_Streamed(t *testing.T) {
+	// large enough to be written to the hash in several chunks
+	values := make([]HashModel, 1000)
+	for i := range values {
+		values[i] = HashModel{ID: i, Name: strings.Repeat("x", i%50), Salary: i}
+	}
+	options := &Options{Groups: []string{"admin"}}
+
+	canonical, err := MarshalCanonical(options, values)
+	assert.NoError(t, err)
+	assert.Greater(t, len(canonical), 4*flushSize)
+
+	h := fnv.New64a()
+	_, _ = h.Write(canonical)
+	expected := hex.EncodeToString(h.Sum(nil))
+
+	actual, err := Hash(options, values, fnv.New64a())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestHash_Error(t *testing.T) {
+	_, err := Hash(&Options{}, DeferFailingModel{}, nil)
+	assert.Equal(t, errDeferFailing, err)
+}
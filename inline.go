@@ -0,0 +1,38 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// parseInlineTag parses the inline option of the sheriff tag of the field of the struct type t. It returns whether
+// the field is inlined and an error if it isn't a map.
+func parseInlineTag(t reflect.Type, field reflect.StructField, opts tagOptions) (bool, error) {
+	if !opts.Contains("inline") {
+		return false, nil
+	}
+	ft := field.Type
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	if ft.Kind() != reflect.Map {
+		return false, fmt.Errorf("marshaller: inline field %s of %s must be a map, not %s", field.Name, t, field.Type)
+	}
+	return true, nil
+}
+
+// mergeInline merges the entries of the inline maps of the struct frame f into its result once all of its fields
+// are done. Keys of declared fields (and of earlier inline maps) are kept, unless Options.InlineMapsWin is set.
+func (s *marshalState) mergeInline(f *frame) {
+	for _, m := range f.inline {
+		for key, value := range m {
+			if _, ok := f.dest[key]; ok && !s.options.InlineMapsWin {
+				continue
+			}
+			f.dest[key] = value
+		}
+	}
+	// the pooled frames mustn't keep the maps alive
+	clear(f.inline)
+	f.inline = f.inline[:0]
+}
@@ -0,0 +1,79 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type InlineProduct struct {
+	ID       int                    `json:"id" groups:"api"`
+	Name     string                 `json:"name" groups:"api"`
+	Extra    map[string]interface{} `json:"extra" groups:"api" sheriff:"inline"`
+	Internal *map[string]string     `json:"internal" groups:"admin" sheriff:"inline"`
+}
+
+func TestMarshal_Inline(t *testing.T) {
+	internal := map[string]string{"cost": "3", "name": "internal name"}
+	v := InlineProduct{
+		ID:       1,
+		Name:     "Pen",
+		Extra:    map[string]interface{}{"color": "red", "id": 2, "nested": InlineProduct{ID: 3, Extra: map[string]interface{}{"size": "L"}}},
+		Internal: &internal,
+	}
+
+	tests := []struct {
+		name     string
+		data     InlineProduct
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "declared fields win",
+			data:     v,
+			options:  &Options{Groups: []string{"api"}},
+			expected: `{"color":"red","id":1,"name":"Pen","nested":{"id":3,"name":"","size":"L"}}`,
+		},
+		{
+			name:     "inline maps win",
+			data:     v,
+			options:  &Options{Groups: []string{"api", "admin"}, InlineMapsWin: true},
+			expected: `{"color":"red","cost":"3","id":2,"name":"internal name","nested":{"id":3,"name":"","size":"L"}}`,
+		},
+		{
+			name:     "excluded as null",
+			data:     v,
+			options:  &Options{Groups: []string{"api"}, ExcludedAsNull: true},
+			expected: `{"color":"red","id":1,"name":"Pen","nested":{"id":3,"name":"","size":"L"}}`,
+		},
+		{
+			name:     "nil maps",
+			data:     InlineProduct{ID: 1},
+			options:  &Options{Groups: []string{"api", "admin"}},
+			expected: `{"id":1,"name":""}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Marshal(test.options, test.data)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(test.data, map[string]*Options{"a": test.options, "b": {Groups: []string{"api"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, m, all["a"])
+		})
+	}
+}
+
+type InlineInvalid struct {
+	Extra []string `json:"extra" sheriff:"inline"`
+}
+
+func TestMarshal_InlineInvalid(t *testing.T) {
+	_, err := Marshal(&Options{}, InlineInvalid{})
+	assert.EqualError(t, err, "marshaller: inline field Extra of sheriff.InlineInvalid must be a map, not []string")
+}
@@ -0,0 +1,55 @@
+package sheriff
+
+import (
+	"reflect"
+	"time"
+)
+
+// Instrumentation receives notifications about Marshal calls, e.g. to export metrics on the amount of
+// marshalled fields or the time spent marshalling.
+//
+// Both methods are called synchronously from the goroutine calling Marshal, so they should return quickly.
+// As Options may be shared, an implementation has to be safe for concurrent use.
+type Instrumentation interface {
+	// Begin is called before data of the type t is marshalled. t is nil if data is nil.
+	Begin(t reflect.Type)
+	// End is called after marshalling finished, including when it failed.
+	End(stats Stats)
+}
+
+// Stats describes a single Marshal call.
+type Stats struct {
+	// Type is the type of the marshalled data, nil if data was nil.
+	Type reflect.Type
+	// EmittedFields is the number of struct fields which passed the group check. Anonymous struct fields,
+	// whose children are brought to the top, aren't counted themselves.
+	EmittedFields int
+	// ExcludedFields is the number of struct fields which failed the group check. Fields within an excluded
+	// field are not visited and therefore not counted.
+	ExcludedFields int
+	// MaxDepth is the deepest nesting level of structs, slices and maps which has been reached.
+	MaxDepth int
+	// Elapsed is the time spent marshalling.
+	Elapsed time.Duration
+	// Err is the error marshalling failed with, if any.
+	Err error
+}
+
+// instrument calls marshal and notifies Options.Instrumentation about it.
+func (s *marshalState) instrument(v reflect.Value, marshal func() error) error {
+	var t reflect.Type
+	if v.IsValid() {
+		t = v.Type()
+	}
+	instrumentation := s.options.Instrumentation
+	instrumentation.Begin(t)
+
+	s.stats = &Stats{Type: t}
+	start := time.Now()
+	err := marshal()
+	s.stats.Elapsed = time.Since(start)
+	s.stats.Err = err
+	instrumentation.End(*s.stats)
+	s.stats = nil
+	return err
+}
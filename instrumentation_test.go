@@ -0,0 +1,71 @@
+package sheriff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingInstrumentation struct {
+	begun []reflect.Type
+	ended []Stats
+}
+
+func (r *recordingInstrumentation) Begin(t reflect.Type) {
+	r.begun = append(r.begun, t)
+}
+
+func (r *recordingInstrumentation) End(stats Stats) {
+	r.ended = append(r.ended, stats)
+}
+
+type InstrumentationItem struct {
+	Name  string `json:"name" groups:"public"`
+	Price int    `json:"price" groups:"private"`
+}
+
+type InstrumentationModel struct {
+	UserInfo
+	Name  string                `json:"name" groups:"public"`
+	Items []InstrumentationItem `json:"items" groups:"public"`
+	Item  InstrumentationItem   `json:"item" groups:"private"`
+}
+
+func TestMarshal_Instrumentation(t *testing.T) {
+	instrumentation := &recordingInstrumentation{}
+	options := &Options{Groups: []string{"public"}, Instrumentation: instrumentation}
+
+	v := &InstrumentationModel{Items: []InstrumentationItem{{Name: "a"}, {Name: "b"}}}
+	_, err := Marshal(options, v)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []reflect.Type{reflect.TypeOf(v)}, instrumentation.begun)
+	assert.Len(t, instrumentation.ended, 1)
+	stats := instrumentation.ended[0]
+	assert.True(t, stats.Elapsed >= 0)
+	stats.Elapsed = 0
+	assert.Equal(t, Stats{
+		Type: reflect.TypeOf(v),
+		// ID, name, items, items.0.name, items.1.name
+		EmittedFields: 5,
+		// Age, Email, items.0.price, items.1.price, item
+		ExcludedFields: 5,
+		// items.0.name
+		MaxDepth: 3,
+	}, stats)
+}
+
+func TestMarshal_InstrumentationError(t *testing.T) {
+	instrumentation := &recordingInstrumentation{}
+	options := &Options{Instrumentation: instrumentation}
+
+	_, err := Marshal(options, DeferFailingModel{})
+	assert.Equal(t, errDeferFailing, err)
+	assert.Len(t, instrumentation.ended, 1)
+	assert.Equal(t, errDeferFailing, instrumentation.ended[0].Err)
+
+	_, err = Marshal(options, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []reflect.Type{reflect.TypeOf(DeferFailingModel{}), nil}, instrumentation.begun)
+}
@@ -0,0 +1,24 @@
+package sheriff
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// isInt64 reports whether t is an integer type of 64 bits other than uintptr, see Options.Int64AsString.
+func isInt64(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return t.Bits() == 64
+	}
+	return false
+}
+
+// int64String returns the decimal representation of the integer v.
+func int64String(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	}
+	return strconv.FormatUint(v.Uint(), 10)
+}
@@ -0,0 +1,74 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Int64AsStringID int64
+
+type Int64AsStringMarshaler int64
+
+func (i Int64AsStringMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(i), 10)), nil
+}
+
+type Int64AsStringModel struct {
+	ID        int64                  `json:"id"`
+	Owner     uint64                 `json:"owner"`
+	Count     int                    `json:"count"`
+	Small     int32                  `json:"small"`
+	Named     Int64AsStringID        `json:"named"`
+	Marshaler Int64AsStringMarshaler `json:"marshaler"`
+	Parent    *int64                 `json:"parent"`
+	Empty     int64                  `json:"empty,omitempty"`
+	Zero      int64                  `json:"zero"`
+	Tags      []uint64               `json:"tags"`
+	Scores    map[string]int64       `json:"scores"`
+	Extra     interface{}            `json:"extra"`
+}
+
+func TestMarshal_Int64AsString(t *testing.T) {
+	parent := int64(math.MinInt64)
+	v := Int64AsStringModel{
+		ID:        math.MaxInt64,
+		Owner:     math.MaxUint64,
+		Count:     42,
+		Small:     7,
+		Named:     1 << 60,
+		Marshaler: 1 << 60,
+		Parent:    &parent,
+		Tags:      []uint64{1, 1 << 63},
+		Scores:    map[string]int64{"a": 1 << 53},
+		Extra:     []interface{}{int64(3), 1.5},
+	}
+	options := &Options{Int64AsString: true}
+
+	m, err := Marshal(options, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"count":"42","extra":["3",1.5],"id":"9223372036854775807","marshaler":1152921504606846976,"named":"1152921504606846976","owner":"18446744073709551615","parent":"-9223372036854775808","scores":{"a":"9007199254740992"},"small":7,"tags":["1","9223372036854775808"],"zero":"0"}`, string(actual))
+
+	// the strings round-trip exactly, unlike numbers decoded as float64
+	var decoded struct {
+		ID    int64  `json:"id,string"`
+		Owner uint64 `json:"owner,string"`
+	}
+	assert.NoError(t, json.Unmarshal(actual, &decoded))
+	assert.Equal(t, int64(math.MaxInt64), decoded.ID)
+	assert.Equal(t, uint64(math.MaxUint64), decoded.Owner)
+
+	all, err := MarshalAll(v, map[string]*Options{"a": options, "b": {}})
+	assert.NoError(t, err)
+	assert.Equal(t, m, all["a"])
+	assert.Equal(t, int64(math.MaxInt64), all["b"].(map[string]interface{})["id"])
+
+	b, err := MarshalAppend(nil, options, math.MaxInt64)
+	assert.NoError(t, err)
+	assert.Equal(t, `"9223372036854775807"`, string(b))
+}
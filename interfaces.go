@@ -0,0 +1,79 @@
+package sheriff
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+)
+
+// InterfaceKind is one of the interfaces whose implementations sheriff leaves to their own marshalling instead
+// of filtering them, see Options.InterfacePreference.
+type InterfaceKind uint8
+
+const (
+	// InterfaceJSONMarshaler is json.Marshaler. Implementations are kept as they are, so that encoders
+	// calling MarshalJSON (like encoding/json) use it.
+	InterfaceJSONMarshaler InterfaceKind = iota + 1
+	// InterfaceTextMarshaler is encoding.TextMarshaler, or encoding.TextAppender for types which only implement
+	// the latter. Implementations are replaced by the string returned by MarshalText (or appended by AppendText).
+	InterfaceTextMarshaler
+	// InterfaceStringer is fmt.Stringer. Implementations are replaced by the string returned by String.
+	InterfaceStringer
+)
+
+// flag returns the typeInterfaces flag of k.
+func (k InterfaceKind) flag() typeInterfaces {
+	switch k {
+	case InterfaceJSONMarshaler:
+		return implJSONMarshaler
+	case InterfaceTextMarshaler:
+		return implTextMarshaler | implTextAppender
+	case InterfaceStringer:
+		return implStringer
+	}
+	return 0
+}
+
+// marshalerInterfaces returns the interfaces whose implementations are left to their own marshalling.
+func (o *Options) marshalerInterfaces() typeInterfaces {
+	if o.InterfacePreference == nil {
+		return implMarshalerMethod
+	}
+	var interfaces typeInterfaces
+	for _, kind := range o.InterfacePreference {
+		interfaces |= kind.flag()
+	}
+	return interfaces
+}
+
+// marshalText returns the text of v, which implements encoding.TextMarshaler or encoding.TextAppender. Like
+// encoding/json, MarshalText is preferred if v implements both.
+func marshalText(v interface{}) ([]byte, error) {
+	if m, ok := v.(encoding.TextMarshaler); ok {
+		return m.MarshalText()
+	}
+	return v.(textAppender).AppendText(nil)
+}
+
+// preferredMarshaler marshals v, which implements one of the interfaces of Options.InterfacePreference,
+// using the first of them.
+func (s *marshalState) preferredMarshaler(v reflect.Value, info typeInfo) (interface{}, error) {
+	for _, kind := range s.options.InterfacePreference {
+		m, ok := receiver(v, info, kind.flag())
+		if !ok {
+			continue
+		}
+		switch kind {
+		case InterfaceTextMarshaler:
+			text, err := marshalText(m)
+			if err != nil {
+				return nil, err
+			}
+			return string(text), nil
+		case InterfaceStringer:
+			return m.(fmt.Stringer).String(), nil
+		}
+		return m, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,155 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type InterfaceValue struct {
+	Code string `json:"code" groups:"api"`
+}
+
+func (v InterfaceValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal("json:" + v.Code)
+}
+
+func (v InterfaceValue) MarshalText() ([]byte, error) {
+	if v.Code == "" {
+		return nil, errors.New("empty code")
+	}
+	return []byte("text:" + v.Code), nil
+}
+
+func (v InterfaceValue) String() string {
+	return "string:" + v.Code
+}
+
+type InterfacePointerValue struct {
+	Code string `json:"code" groups:"api"`
+}
+
+func (v *InterfacePointerValue) MarshalText() ([]byte, error) {
+	return []byte("text:" + v.Code), nil
+}
+
+func (v *InterfacePointerValue) String() string {
+	return "string:" + v.Code
+}
+
+type InterfaceModel struct {
+	Value   InterfaceValue            `json:"value" groups:"api"`
+	Pointer InterfacePointerValue     `json:"pointer" groups:"api"`
+	List    []InterfaceValue          `json:"list" groups:"api"`
+	Map     map[string]InterfaceValue `json:"map" groups:"api"`
+}
+
+func interfaceModel() InterfaceModel {
+	return InterfaceModel{
+		Value:   InterfaceValue{Code: "a"},
+		Pointer: InterfacePointerValue{Code: "b"},
+		List:    []InterfaceValue{{Code: "c"}},
+		Map:     map[string]InterfaceValue{"d": {Code: "d"}},
+	}
+}
+
+func TestMarshal_InterfacePreference(t *testing.T) {
+	tests := []struct {
+		name       string
+		preference []InterfaceKind
+		want       string
+	}{
+		{
+			name: "default",
+			want: `{"list":["json:c"],"map":{"d":"json:d"},"pointer":"text:b","value":"json:a"}`,
+		},
+		{
+			name:       "text first",
+			preference: []InterfaceKind{InterfaceTextMarshaler, InterfaceJSONMarshaler, InterfaceStringer},
+			want:       `{"list":["text:c"],"map":{"d":"text:d"},"pointer":"text:b","value":"text:a"}`,
+		},
+		{
+			name:       "stringer first",
+			preference: []InterfaceKind{InterfaceStringer, InterfaceTextMarshaler, InterfaceJSONMarshaler},
+			want:       `{"list":["string:c"],"map":{"d":"string:d"},"pointer":"string:b","value":"string:a"}`,
+		},
+		{
+			name:       "json first",
+			preference: []InterfaceKind{InterfaceJSONMarshaler, InterfaceStringer},
+			want:       `{"list":["json:c"],"map":{"d":"json:d"},"pointer":"string:b","value":"json:a"}`,
+		},
+		{
+			name:       "stringer only",
+			preference: []InterfaceKind{InterfaceStringer},
+			want:       `{"list":["string:c"],"map":{"d":"string:d"},"pointer":"string:b","value":"string:a"}`,
+		},
+		{
+			name:       "none",
+			preference: []InterfaceKind{},
+			want:       `{"list":[{"code":"c"}],"map":{"d":{"code":"d"}},"pointer":{"code":"b"},"value":{"code":"a"}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := &Options{Groups: []string{"api"}, InterfacePreference: test.preference}
+
+			v, err := Marshal(o, interfaceModel())
+			assert.NoError(t, err)
+			actual, err := json.Marshal(v)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(actual))
+
+			appended, err := MarshalAppend(nil, o, interfaceModel())
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(appended))
+		})
+	}
+}
+
+func TestMarshalAll_InterfacePreference(t *testing.T) {
+	optionSets := map[string]*Options{
+		"default": {Groups: []string{"api"}},
+		"text":    {Groups: []string{"api"}, InterfacePreference: []InterfaceKind{InterfaceTextMarshaler}},
+		"none":    {Groups: []string{"api"}, InterfacePreference: []InterfaceKind{}},
+	}
+	results, err := MarshalAll(interfaceModel(), optionSets)
+	assert.NoError(t, err)
+	for name, options := range optionSets {
+		expected, err := Marshal(options, interfaceModel())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, results[name], name)
+	}
+}
+
+func TestMarshal_InterfacePreferenceRoot(t *testing.T) {
+	// structs passed to Marshal directly are filtered, whichever interfaces they implement
+	o := &Options{InterfacePreference: []InterfaceKind{InterfaceStringer}}
+	v, err := Marshal(o, InterfaceValue{Code: "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, v)
+
+	v, err = Marshal(o, []InterfaceValue{{Code: "a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"string:a"}, v)
+
+	o = &Options{Groups: []string{"api"}, InterfacePreference: []InterfaceKind{}}
+	v, err = Marshal(o, InterfaceValue{Code: "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"code": "a"}, v)
+}
+
+func TestMarshal_InterfacePreferenceError(t *testing.T) {
+	o := &Options{Groups: []string{"api"}, InterfacePreference: []InterfaceKind{InterfaceTextMarshaler}}
+	_, err := Marshal(o, InterfaceModel{})
+	assert.EqualError(t, err, "empty code")
+
+	o.ErrorPolicy = CollectAll
+	v, err := Marshal(o, InterfaceModel{List: []InterfaceValue{{Code: "a"}, {}}})
+	collected, ok := err.(*CollectedError)
+	if assert.True(t, ok) {
+		assert.Len(t, collected.Errors, 2)
+	}
+	assert.Equal(t, []interface{}{"text:a", nil}, v.(map[string]interface{})["list"])
+}
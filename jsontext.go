@@ -0,0 +1,279 @@
+//go:build goexperiment.jsonv2 && go1.27
+
+package sheriff
+
+import (
+	"encoding/json"
+	"encoding/json/jsontext"
+	"reflect"
+	"sort"
+)
+
+// MarshalEncoder writes data filtered by the given options directly to the passed jsontext.Encoder.
+//
+// Struct fields, nested structs, slices and string-keyed maps are emitted token by token while applying the
+// groups, without building the intermediate map returned by Marshal. Every other value (including structs
+// with embedded fields and types implementing one of the marshaler interfaces) falls back to Marshal and is
+// encoded using encoding/json. If one of Options.MaxRenderDepth, Options.MaxSliceLen, Options.MaxMapLen or
+// Options.DebugMetaKey is set, or Options.KeyTag is "toml", the whole document falls back to Marshal.
+// The resulting document is equivalent to json.Marshal of Marshal's result.
+//
+// MarshalEncoder is only available when building with GOEXPERIMENT=jsonv2.
+func MarshalEncoder(enc *jsontext.Encoder, options *Options, data interface{}) error {
+	s := acquireMarshalState(options)
+	defer s.release()
+	v := reflect.ValueOf(data)
+	if options.Instrumentation == nil {
+		return s.encodeRoot(enc, v)
+	}
+	return s.instrument(v, func() error {
+		return s.encodeRoot(enc, v)
+	})
+}
+
+// encodeRoot is the streaming counterpart of marshalRoot.
+func (s *marshalState) encodeRoot(enc *jsontext.Encoder, v reflect.Value) error {
+	// limiting the render depth may omit keys and limiting lengths may add keys, and whether a value fails
+	// (and is therefore omitted) with an ErrorPolicy, which is only known once the value is marshalled. The debug
+	// metadata is only added if the top level turns out to be an object, and cached results are intermediate ones.
+	// Whether a key is omitted because its value is null (see KeyTag) is also only known once it's marshalled.
+	if s.options.MaxRenderDepth > 0 || s.options.MaxSliceLen > 0 || s.options.MaxMapLen > 0 || s.options.ErrorPolicy != FailFast || s.options.DebugMetaKey != "" || s.options.CacheKeyer != nil || s.options.omitsNil() {
+		intermediate, err := s.marshalRoot(v)
+		if _, ok := err.(*CollectedError); err != nil && !ok {
+			return err
+		}
+		if encodeErr := s.encodeIntermediate(enc, intermediate); encodeErr != nil {
+			return encodeErr
+		}
+		return err
+	}
+	if isMarshalerRoot(s.options, v) {
+		return s.encodeValue(enc, v, false)
+	}
+	return s.encodeData(enc, v)
+}
+
+// encodeData is the streaming counterpart of Marshal.
+func (s *marshalState) encodeData(enc *jsontext.Encoder, v reflect.Value) error {
+	if !v.IsValid() {
+		return enc.WriteToken(jsontext.Null)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return enc.WriteToken(jsontext.Null)
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return s.encodeValue(enc, v, false)
+	}
+	if hasEmbeddedField(v.Type()) || typeInfoOf(v.Type()).pointer&implComputedFields != 0 || structInfoOf(v.Type()).inline {
+		intermediate, err := s.marshal(v)
+		if err != nil {
+			return err
+		}
+		return s.encodeIntermediate(enc, intermediate)
+	}
+
+	var owners map[string]string
+	if s.options.ErrOnDuplicateKeys {
+		owners = make(map[string]string)
+	}
+
+	if err := enc.WriteToken(jsontext.BeginObject); err != nil {
+		return err
+	}
+	err := s.eachField(v.Type(), v, func(f structField) error {
+		if f.excluded {
+			if err := s.claimKey(owners, v.Type(), f.name, f.field.Name); err != nil {
+				return err
+			}
+			if err := enc.WriteToken(jsontext.String(f.name)); err != nil {
+				return err
+			}
+			return enc.WriteToken(jsontext.Null)
+		}
+
+		traverse := f.sheriffOpts.Contains("traverse")
+		if s.options.OmitEmptyNested && (f.value.Kind() == reflect.Struct || f.value.Kind() == reflect.Map) {
+			// whether the key is omitted is only known once the value is marshalled
+			s.pushField(f.name, v.Type())
+			intermediate, err := s.marshalValue(f.value, traverse)
+			s.pop()
+			if err != nil {
+				return err
+			}
+			if m, ok := intermediate.(map[string]interface{}); ok && len(m) == 0 {
+				return nil
+			}
+			if err := s.claimKey(owners, v.Type(), f.name, f.field.Name); err != nil {
+				return err
+			}
+			if err := enc.WriteToken(jsontext.String(f.name)); err != nil {
+				return err
+			}
+			return s.encodeIntermediate(enc, intermediate)
+		}
+
+		if err := s.claimKey(owners, v.Type(), f.name, f.field.Name); err != nil {
+			return err
+		}
+		if err := enc.WriteToken(jsontext.String(f.name)); err != nil {
+			return err
+		}
+		s.pushField(f.name, v.Type())
+		err := s.encodeValue(enc, f.value, traverse)
+		s.pop()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return enc.WriteToken(jsontext.EndObject)
+}
+
+// encodeValue is the streaming counterpart of marshalValue.
+func (s *marshalState) encodeValue(enc *jsontext.Encoder, v reflect.Value, traverse bool) error {
+	if !v.IsValid() || !v.CanInterface() {
+		return enc.WriteToken(jsontext.Null)
+	}
+	if v.Kind() == reflect.Interface {
+		// structs held by interfaces get their type field from visit
+		if e := reflect.Indirect(v.Elem()); s.options.TypeField != "" && e.Kind() == reflect.Struct {
+			return s.encodeFallback(enc, v, traverse)
+		}
+		return s.encodeValue(enc, v.Elem(), traverse)
+	}
+	if err := s.checkDepth(); err != nil {
+		return err
+	}
+
+	info := typeInfoOf(v.Type())
+	if info.pointer&implUnwrapper != 0 || info.value&implMarshaller != 0 || isRaw(v.Type()) {
+		return s.encodeFallback(enc, v, traverse)
+	}
+	if info.pointer&s.marshalerInterfaces != 0 {
+		if !(traverse || s.options.TraverseMarshalers) || !isTraversable(v) {
+			return s.encodeFallback(enc, v, traverse)
+		}
+	}
+	if s.options.UseValuer && info.pointer&implValuer != 0 {
+		return s.encodeFallback(enc, v, traverse)
+	}
+	if s.options.UseBinaryMarshaler && info.pointer&implBinaryMarshaler != 0 {
+		return s.encodeFallback(enc, v, traverse)
+	}
+	if info.sync != notSync {
+		return s.encodeFallback(enc, v, traverse)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return enc.WriteToken(jsontext.Null)
+		}
+		return s.encodeValue(enc, v.Elem(), traverse)
+	case reflect.Struct:
+		return s.encodeData(enc, v)
+	case reflect.Slice:
+		if v.IsNil() {
+			return enc.WriteToken(jsontext.Null)
+		}
+		if err := enc.WriteToken(jsontext.BeginArray); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			s.pushIndex(i)
+			err := s.encodeValue(enc, v.Index(i), traverse)
+			s.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return enc.WriteToken(jsontext.EndArray)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return s.encodeFallback(enc, v, traverse)
+		}
+		if v.IsNil() {
+			return enc.WriteToken(jsontext.Null)
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		if err := enc.WriteToken(jsontext.BeginObject); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if s.options.MapKeyFilter != nil && !s.options.MapKeyFilter(s.currentPath(), key.String()) {
+				continue
+			}
+			if s.isKeyOmitted(key.String()) {
+				continue
+			}
+			if err := enc.WriteToken(jsontext.String(key.String())); err != nil {
+				return err
+			}
+			s.pushKey(key.String())
+			err := s.encodeValue(enc, v.MapIndex(key), traverse)
+			s.pop()
+			if err != nil {
+				return err
+			}
+		}
+		return enc.WriteToken(jsontext.EndObject)
+	}
+	return s.encodeFallback(enc, v, traverse)
+}
+
+// encodeFallback marshals v the same way marshalValue does and writes the result using encoding/json.
+func (s *marshalState) encodeFallback(enc *jsontext.Encoder, v reflect.Value, traverse bool) error {
+	intermediate, err := s.marshalValue(v, traverse)
+	if err != nil {
+		return err
+	}
+	return s.encodeIntermediate(enc, intermediate)
+}
+
+// encodeIntermediate writes an already marshalled value using encoding/json.
+func (s *marshalState) encodeIntermediate(enc *jsontext.Encoder, intermediate interface{}) error {
+	if s.options.PreserveMapKeyTypes && hasKeyedMap(intermediate) {
+		return ErrPreservedMapKeys
+	}
+	b, err := json.Marshal(intermediate)
+	if err != nil {
+		return err
+	}
+	return enc.WriteValue(b)
+}
+
+// hasKeyedMap reports whether the marshalled value holds a map whose keys are preserved, see
+// Options.PreserveMapKeyTypes.
+func hasKeyedMap(intermediate interface{}) bool {
+	switch v := intermediate.(type) {
+	case map[interface{}]interface{}:
+		return true
+	case map[string]interface{}:
+		for _, elem := range v {
+			if hasKeyedMap(elem) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, elem := range v {
+			if hasKeyedMap(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasEmbeddedField reports whether the struct type t has an anonymous field.
+func hasEmbeddedField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Anonymous {
+			return true
+		}
+	}
+	return false
+}
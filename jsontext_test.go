@@ -0,0 +1,459 @@
+//go:build goexperiment.jsonv2 && go1.27
+
+package sheriff
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"encoding/json/jsontext"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalEncoder_Conformance(t *testing.T) {
+	hackCreationTime, err := time.Parse(time.RFC3339, "2017-01-20T18:11:00Z")
+	assert.NoError(t, err)
+
+	groupsModel := &TestGroupsModel{
+		DefaultMarshal:     "DefaultMarshal",
+		NeverMarshal:       "NeverMarshal",
+		OnlyGroupTest:      "OnlyGroupTest",
+		OnlyGroupTestOther: "OnlyGroupTestOther",
+		GroupTestAndOther:  "GroupTestAndOther",
+		OmitEmpty:          "OmitEmpty",
+		OmitEmptyGroupTest: "OmitEmptyGroupTest",
+		SliceString:        []string{"test", "bla"},
+		MapStringStruct:    map[string]AModel{"firstModel": {true, true}},
+	}
+
+	values := map[string]interface{}{
+		"groups": groupsModel,
+		"recursive": &TestRecursiveModel{
+			SomeData:     "SomeData",
+			GroupsData:   []*TestGroupsModel{groupsModel},
+			IsMarshaller: IsMarshaller{"test"},
+		},
+		"parent inherit": UserInfo{
+			UserPrivateInfo: UserPrivateInfo{Age: "20"},
+			UserPublicInfo:  UserPublicInfo{ID: "F94", Email: "hello@hello.com"},
+		},
+		"time":  TimeHackTest{ATime: hackCreationTime},
+		"inet":  TestInet{IPv4: net.ParseIP("0.0.0.0").To4(), IPv6: net.ParseIP("::").To16()},
+		"empty": EmptyMapTest{AMap: map[string]string{}},
+		"interfaceable": InterfacerAlpha{
+			Plaintext: "I am plaintext",
+			Secret:    "I am a secret",
+			Nested:    InterfaceableBeta{100, "Still a secret"},
+			Interfaceable: ArrayOfInterfaceable{
+				InterfaceableBeta{200, "Still a secret good"},
+				InterfaceableCharlie{300, "Still a secret excellent"},
+			},
+		},
+		"nested anon": TopLevel{NestedAnon{Foo: 3, Bar: 4}, NestedNamed{Name: "KooKoo"}},
+		"nil map":     MapAliasContainer{},
+		"slice":       []AModel{{true, false}, {false, true}},
+		"int map":     map[int]AModel{1: {true, true}},
+		"nil":         nil,
+		"netip":       netip.MustParsePrefix("10.0.0.0/8"),
+		"nullable":    NullableModel{Int: NullInt{sql.NullInt64{Int64: 1, Valid: true}}, IntMap: map[string]NullInt{"a": {}}},
+		"unwrapper":   OptionalModel{Count: Some(1), Profiles: []Optional[OptionalProfile]{Some(OptionalProfile{Name: "alice"})}},
+		"traverse": TraverseModel{
+			Profile:   TraverseProfile{Name: "alice", Secret: "s3cr3t"},
+			Traversed: TraverseProfile{Name: "alice", Secret: "s3cr3t"},
+			Pointers:  []*TraverseProfile{{Name: "bob", Secret: "s3cr3t"}},
+		},
+	}
+	groupSets := [][]string{nil, {"test"}, {"test-other"}, {"public"}, {"safe"}, {"verbose"}}
+
+	for name, value := range values {
+		for _, groups := range groupSets {
+			for _, omitEmptyNested := range []bool{false, true} {
+				expectedMap, err := Marshal(&Options{Groups: groups, OmitEmptyNested: omitEmptyNested}, value)
+				assert.NoError(t, err)
+				expected, err := json.Marshal(expectedMap)
+				assert.NoError(t, err)
+
+				var buf bytes.Buffer
+				err = MarshalEncoder(jsontext.NewEncoder(&buf), &Options{Groups: groups, OmitEmptyNested: omitEmptyNested}, value)
+				assert.NoError(t, err, name)
+
+				assert.JSONEq(t, string(expected), buf.String(), "%s %v", name, groups)
+			}
+		}
+	}
+
+	// with the keys of the toml tag, null values are omitted
+	config := keyTagConfig()
+	tomlValues := []interface{}{config, config.Labels, KeyTagService{Name: "api", Labels: config.Labels}}
+	for _, value := range tomlValues {
+		for _, groups := range groupSets {
+			options := &Options{Groups: groups, KeyTag: "toml", ExcludedAsNull: true}
+			expectedMap, err := Marshal(options, value)
+			assert.NoError(t, err)
+			expected, err := json.Marshal(expectedMap)
+			assert.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(expected), buf.String(), "%T %v", value, groups)
+			assert.NotContains(t, buf.String(), "null")
+		}
+	}
+}
+
+// KeyTagService has no embedded fields, so it isn't left to Marshal as a whole.
+type KeyTagService struct {
+	Name     string             `toml:"name"`
+	Database *KeyTagDatabase    `toml:"database"`
+	Labels   map[string]*string `toml:"labels"`
+	Owner    interface{}        `toml:"owner"`
+}
+
+type JSONTextFailing struct {
+	Failing DeferFailingMarshaller `json:"failing"`
+}
+
+func TestMarshalEncoder_Error(t *testing.T) {
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), &Options{}, JSONTextFailing{})
+	assert.Equal(t, errDeferFailing, err)
+}
+
+func TestMarshalEncoder_ErrorPolicy(t *testing.T) {
+	options := &Options{Groups: []string{"api"}, ErrorPolicy: CollectAll}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, errorPolicyData()[1:3])
+	assert.JSONEq(t, `[{"id":1,"value":"ok"},{"id":2}]`, buf.String())
+	assert.Equal(t, &CollectedError{Errors: []FieldError{{Path: "1.value", Err: errPolicyFailing}}}, err)
+}
+
+func TestMarshalEncoder_ExcludedAsNull(t *testing.T) {
+	options := &Options{Groups: []string{"public"}, ExcludedAsNull: true}
+	value := ExcludedAsNullModel{Name: "alice", Salary: 100}
+
+	expectedMap, err := Marshal(options, value)
+	assert.NoError(t, err)
+	expected, err := json.Marshal(expectedMap)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+}
+
+func TestMarshalEncoder_UseBinaryMarshaler(t *testing.T) {
+	options := &Options{UseBinaryMarshaler: true}
+	value := BinaryModel{Value: BinaryValue{1, 2}, Map: map[string]BinaryPointer{"a": {5}}}
+
+	expectedMap, err := Marshal(options, value)
+	assert.NoError(t, err)
+	expected, err := json.Marshal(expectedMap)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+}
+
+func TestMarshalEncoder_InterfacePreference(t *testing.T) {
+	options := &Options{Groups: []string{"api"}, InterfacePreference: []InterfaceKind{InterfaceStringer}}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, interfaceModel())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"list":["string:c"],"map":{"d":"string:d"},"pointer":"string:b","value":"string:a"}`, buf.String())
+}
+
+func TestMarshalEncoder_TimePositions(t *testing.T) {
+	value := timePositionsModel(time.Date(2017, 1, 20, 18, 11, 0, 0, time.UTC))
+	for _, options := range []*Options{{Groups: []string{"api"}}, {Groups: []string{"api"}, TraverseMarshalers: true}} {
+		expectedMap, err := Marshal(options, value)
+		assert.NoError(t, err)
+		expected, err := json.Marshal(expectedMap)
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(expected), buf.String())
+	}
+}
+
+func TestMarshalEncoder_Uintptr(t *testing.T) {
+	for _, options := range []*Options{{Groups: []string{"api"}}, {Groups: []string{"api"}, AllowUintptr: true}} {
+		expectedMap, err := Marshal(options, uintptrModel())
+		assert.NoError(t, err)
+		expected, err := json.Marshal(expectedMap)
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = MarshalEncoder(jsontext.NewEncoder(&buf), options, uintptrModel())
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(expected), buf.String())
+	}
+}
+
+func TestMarshalEncoder_Sync(t *testing.T) {
+	options := &Options{Groups: []string{"api"}}
+	value := newSyncModel()
+
+	expectedMap, err := Marshal(options, value)
+	assert.NoError(t, err)
+	expected, err := json.Marshal(expectedMap)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+}
+
+func TestMarshalEncoder_ComputedFields(t *testing.T) {
+	options := &Options{Groups: []string{"api", "admin"}}
+	for _, value := range []interface{}{computedTeam(), ComputedUser{First: "Alice", Last: "Smith"}} {
+		expectedMap, err := Marshal(options, value)
+		assert.NoError(t, err)
+		expected, err := json.Marshal(expectedMap)
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(expected), buf.String())
+	}
+}
+
+func TestMarshalEncoder_Expand(t *testing.T) {
+	for _, options := range []*Options{
+		{Groups: []string{"api"}},
+		{Groups: []string{"api"}, Expand: []string{"invoice.customer", "invoice.lines.product"}},
+	} {
+		expectedMap, err := Marshal(options, expandOrder())
+		assert.NoError(t, err)
+		expected, err := json.Marshal(expectedMap)
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = MarshalEncoder(jsontext.NewEncoder(&buf), options, expandOrder())
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(expected), buf.String())
+	}
+}
+
+func TestMarshalEncoder_TypeField(t *testing.T) {
+	options := &Options{Groups: []string{"safe"}, TypeField: "_type"}
+	value := TypeFieldModel{
+		Single: &InterfaceableBeta{1, "secret"},
+		Nested: InterfaceableBeta{2, "secret"},
+		List:   ArrayOfInterfaceable{InterfaceableCharlie{3, "secret"}},
+	}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"single":{"_type":"InterfaceableBeta","integer":1},"nested":{"integer":2},`+
+		`"list":[{"_type":"InterfaceableCharlie","integer":3}],"map":null,"ptrs":null}`, buf.String())
+}
+
+func TestMarshalEncoder_FieldFilter(t *testing.T) {
+	options := &Options{OmitFields: []string{"password_hash"}, OnlyFields: []string{"id", "audit", "friends"}}
+	value := fieldFilterUser()
+
+	expectedMap, err := Marshal(options, value)
+	assert.NoError(t, err)
+	expected, err := json.Marshal(expectedMap)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+}
+
+func TestMarshalEncoder_GroupMatcher(t *testing.T) {
+	options := &Options{Groups: []string{"admin:*", "READ:*"}, GroupMatcher: GlobGroups}
+	value := GroupMatcherModel{GroupMatcherBilling: GroupMatcherBilling{Plan: "pro"}, Name: "alice", Users: 3}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"invoices":0,"users":3,"wildcard":""}`, buf.String())
+}
+
+func TestMarshalEncoder_Authorizer(t *testing.T) {
+	options := &Options{Authorizer: authorizerTeam, Subject: "hr"}
+	value := AuthorizerEmployee{AuthorizerContact: AuthorizerContact{Phone: "555"}, Name: "alice", Salary: 100}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"alice","phone":"555","salary":100}`, buf.String())
+}
+
+func TestMarshalEncoder_PII(t *testing.T) {
+	options := &Options{Groups: []string{"analytics"}, PIIHasher: hmacHasher("k")}
+	value := PIIContact{ID: 1, Email: "alice@example.org"}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"email":"29beb0c8","id":1,"token":"8bb990c4"}`, buf.String())
+}
+
+func TestMarshalEncoder_Mask(t *testing.T) {
+	options := &Options{EnableMasking: true}
+	value := MaskCustomer{Name: "Jürgen", Card: "4111 1111 1111 1234", Country: "ch"}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"card":"***************1234","country":"CH","email":null,"name":"J****n","note":"","phone":""}`, buf.String())
+}
+
+func TestMarshalEncoder_TimeLocation(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	options := &Options{TimeLocation: newYork}
+	summer := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	value := TimeLocationModel{Created: summer, Updated: &summer, History: []time.Time{summer}}
+
+	expectedMap, err := Marshal(options, value)
+	assert.NoError(t, err)
+	expected, err := json.Marshal(expectedMap)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+	assert.Contains(t, buf.String(), `"created":"2024-07-01T08:00:00-04:00"`)
+}
+
+func TestMarshalEncoder_Precision(t *testing.T) {
+	options := &Options{FloatPrecision: 3}
+	value := PrecisionPrice{Amount: 19.899999999999999, Discount: 0.004, Ratio: 0.123456, History: []float64{1.005}}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount":19.90,"extra":null,"history":[1.005],"rate":null,"ratio":0.123}`, buf.String())
+	assert.Contains(t, buf.String(), `"amount":19.90`)
+}
+
+func TestMarshalEncoder_Raw(t *testing.T) {
+	options := &Options{Groups: []string{"api"}, TraverseMarshalers: true}
+	inner := RawInner{Public: "p", Secret: "s"}
+	value := RawModel{Field: Raw{Value: inner}, Slice: []interface{}{Raw{Value: inner}, inner}}
+
+	expectedMap, err := Marshal(options, value)
+	assert.NoError(t, err)
+	expected, err := json.Marshal(expectedMap)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+}
+
+func TestMarshalEncoder_Inline(t *testing.T) {
+	options := &Options{Groups: []string{"api"}}
+	value := InlineProduct{ID: 1, Name: "Pen", Extra: map[string]interface{}{"color": "red", "id": 2}}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"color":"red","id":1,"name":"Pen"}`, buf.String())
+}
+
+func TestMarshalEncoder_Int64AsString(t *testing.T) {
+	options := &Options{Int64AsString: true}
+	value := Int64AsStringModel{ID: 1 << 62, Tags: []uint64{1}, Scores: map[string]int64{"a": -1}}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"count":"0","extra":null,"id":"4611686018427387904","marshaler":0,"named":"0","owner":"0","parent":null,"scores":{"a":"-1"},"small":0,"tags":["1"],"zero":"0"}`, buf.String())
+}
+
+func TestMarshalEncoder_TextAppender(t *testing.T) {
+	options := &Options{Groups: []string{"api"}}
+	value := AppenderModel{Version: AppenderVersion{Major: 1, Minor: 2}, ByVersion: map[AppenderVersion]int{{Minor: 9}: 3}}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"by_version":{"0.9":3},"previous":null,"version":"1.2"}`, buf.String())
+}
+
+func TestMarshalEncoder_DebugMetaKey(t *testing.T) {
+	options := &Options{Groups: []string{"api"}, DebugMetaKey: "_sheriff"}
+	value := DebugMetaModel{Name: "alice", Email: "alice@example.org"}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"_sheriff":{"groups":["api"]},"items":null,"name":"alice","nested":{"value":""}}`, buf.String())
+}
+
+func TestMarshalEncoder_GroupsIf(t *testing.T) {
+	value := GroupsIfFeed{Posts: []GroupsIfPost{{ID: 1, Visibility: "public", Body: "hello"}, {ID: 2, Body: "secret"}}}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), &Options{}, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"posts":[{"body":"hello","id":1,"visibility":"public"},{"id":2,"visibility":""}]}`, buf.String())
+}
+
+func TestMarshalEncoder_PreserveMapKeyTypes(t *testing.T) {
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), &Options{PreserveMapKeyTypes: true}, mapKeysTelemetry())
+	assert.Equal(t, ErrPreservedMapKeys, err)
+}
+
+func TestMarshalEncoder_OnDeprecated(t *testing.T) {
+	var paths []string
+	options := &Options{OnDeprecated: func(path string, note string) { paths = append(paths, path) }}
+
+	var buf bytes.Buffer
+	assert.NoError(t, MarshalEncoder(jsontext.NewEncoder(&buf), options, deprecatedUser()))
+	assert.Equal(t, []string{"name", "address.zip", "addresses.0.zip"}, paths)
+}
+
+func TestMarshalEncoder_MaxRenderDepth(t *testing.T) {
+	options := &Options{MaxRenderDepth: 1, OmitDepthOverflow: true}
+	value := DepthUser{ID: 1, City: DepthCity{Name: "Zurich"}}
+
+	var buf bytes.Buffer
+	err := MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"cities":null,"city_ptr":null,"following":null,"id":1,"name":""}`, buf.String())
+}
+
+func TestMarshalEncoder_MapKeyFilter(t *testing.T) {
+	options := &Options{
+		MapKeyFilter: func(path string, key string) bool {
+			return key != "internal_notes"
+		},
+	}
+	value := MapKeyFilterModel{Attributes: map[string]string{"color": "red", "internal_notes": "secret"}}
+
+	expectedMap, err := Marshal(options, value)
+	assert.NoError(t, err)
+	expected, err := json.Marshal(expectedMap)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = MarshalEncoder(jsontext.NewEncoder(&buf), options, value)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), buf.String())
+}
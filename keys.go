@@ -0,0 +1,210 @@
+package sheriff
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// OpaqueKey is the last segment of the paths listed by Keys for values whose keys are only known once they're
+// marshalled, e.g. `settings.?` for a field implementing Marshaller.
+const OpaqueKey = "?"
+
+// Keys returns the dotted paths of all keys Marshal could output for data of the type of prototype with the given
+// options, sorted, e.g. to document what each audience of an endpoint gets to see. Only the type is looked at,
+// prototype may be a nil pointer.
+//
+// Fields are filtered by their groups (including Options.Authorizer), json tags, Options.TagPredicates,
+// Options.OmitDeprecated and Options.OmitFields and Options.OnlyFields. Fields which may appear are listed too,
+// e.g. omitempty fields and fields with a groups_if tag. The elements of slices, arrays and maps are described by the `*` segment,
+// e.g. `addresses.*.city`, which also stands for the keys of maps (and of inline maps, see Options.InlineMapsWin).
+// Values whose keys are dynamic, i.e. types implementing Marshaller, Unwrapper or ComputedFields and sync.Map,
+// are marked by a path ending in OpaqueKey, and so are recursive types, which are only descended into once per
+// path. Types left to their own marshalling, e.g. time.Time, and interfaces have no keys listed below them.
+//
+// The errors of tags are returned like Marshal does, e.g. the ones of Options.StrictGroups.
+func Keys(options *Options, prototype interface{}) ([]string, error) {
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		return nil, nil
+	}
+	s := acquireMarshalState(options)
+	defer s.release()
+	l := keyLister{s: s, onPath: make(map[reflect.Type]bool)}
+	if err := l.value(t, true, false); err != nil {
+		return nil, err
+	}
+	slices.Sort(l.keys)
+	return slices.Compact(l.keys), nil
+}
+
+// keyLister walks the type passed to Keys. The path of the current key is kept in the marshalState.
+type keyLister struct {
+	s *marshalState
+	// onPath are the struct types on the current path, see Keys.
+	onPath map[reflect.Type]bool
+	keys   []string
+}
+
+// add lists the current path, or the current path with the segment appended if it isn't empty.
+func (l *keyLister) add(segment string) {
+	var b strings.Builder
+	for _, p := range l.s.path {
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		if p.index >= 0 {
+			b.WriteByte('*')
+		} else {
+			b.WriteString(p.name)
+		}
+	}
+	if segment != "" {
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	l.keys = append(l.keys, b.String())
+}
+
+// value lists the keys of values of type t. root reports whether t is the type passed to Keys, which is filtered
+// even if it implements Marshaller, same as Marshal does.
+func (l *keyLister) value(t reflect.Type, root, traverse bool) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	info := typeInfoOf(t)
+	if !root && info.pointer&implMarshaller != 0 || info.pointer&implUnwrapper != 0 || info.sync == syncMap {
+		l.add(OpaqueKey)
+		return nil
+	}
+	if info.sync != notSync || isRaw(t) {
+		return nil
+	}
+	if info.pointer&l.s.marshalerInterfaces != 0 && !((traverse || l.s.options.TraverseMarshalers) && t.Kind() == reflect.Struct && structInfoOf(t).exported) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return l.fields(t, nil)
+	case reflect.Slice, reflect.Array:
+		// byte slices are base64 strings
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		l.s.pushIndex(0)
+		err := l.value(t.Elem(), false, traverse)
+		l.s.pop()
+		return err
+	case reflect.Map:
+		l.s.pushKey("*")
+		l.add("")
+		err := l.value(t.Elem(), false, traverse)
+		l.s.pop()
+		return err
+	}
+	return nil
+}
+
+// fields lists the keys of the fields of the struct type t. inherited are the groups of the anonymous field
+// t is held by, which apply to the fields without groups.
+func (l *keyLister) fields(t reflect.Type, inherited []string) error {
+	// the keys below a recursive type repeat the ones above it
+	if l.onPath[t] {
+		l.add(OpaqueKey)
+		return nil
+	}
+	l.onPath[t] = true
+	defer delete(l.onPath, t)
+	if typeInfoOf(t).pointer&implComputedFields != 0 {
+		l.add(OpaqueKey)
+	}
+
+	s := l.s
+	options := s.options
+	fields := fieldInfosOf(t)
+	for i := range fields {
+		info := &fields[i]
+		field := info.field
+		name, _, embedded := options.fieldKey(info)
+		if name == "" {
+			name = options.UntaggedKeyStyle.convert(field.Name)
+		}
+		if name == "-" || !field.IsExported() || !s.passesTagPredicates(field) || info.deprecated && options.OmitDeprecated {
+			continue
+		}
+		if info.addressKind == reflect.UnsafePointer || info.addressKind == reflect.Uintptr && !options.AllowUintptr {
+			continue
+		}
+
+		if embedded {
+			groups := info.groups
+			if groups == nil {
+				groups = inherited
+			}
+			tt := field.Type
+			if tt.Kind() == reflect.Ptr {
+				tt = tt.Elem()
+			}
+			if err := l.fields(tt, groups); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if options.FieldNamer != nil {
+			if n := options.FieldNamer.Name(t, field, name); n != "" {
+				name = n
+			}
+		}
+		groups := info.groups
+		if groups == nil {
+			groups = inherited
+		}
+		if options.StrictGroups {
+			for _, err := range []error{info.groupsErr, s.unknownGroupErr, info.unknownGroupErr} {
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if info.groupsIfErr != nil {
+			return info.groupsIfErr
+		}
+		// fields with a groups_if tag may be visible
+		if !s.isVisible(t, field, groups) && info.groupsIf == nil {
+			// inline maps contribute nothing instead of a key
+			if options.ExcludedAsNull && !info.inline {
+				l.add(name)
+			}
+			continue
+		}
+		if s.isKeyOmitted(name) {
+			continue
+		}
+		for _, err := range []error{info.maxLenErr, info.piiErr, info.precisionErr, info.inlineErr} {
+			if err != nil {
+				return err
+			}
+		}
+
+		traverse := info.sheriffOpts.Contains("traverse")
+		if info.inline {
+			// the entries are merged into the object of t
+			if err := l.value(field.Type, false, traverse); err != nil {
+				return err
+			}
+			continue
+		}
+		s.pushField(name, t)
+		l.add("")
+		err := l.value(field.Type, false, traverse)
+		s.pop()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
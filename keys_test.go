@@ -0,0 +1,179 @@
+package sheriff
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type KeysAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street,omitempty" groups:"owner"`
+}
+
+type KeysAudit struct {
+	CreatedBy string `json:"created_by"`
+	Reviewed  bool   `json:"reviewed" groups:"user"`
+}
+
+type KeysSettings struct {
+	Theme string `json:"theme"`
+}
+
+func (KeysSettings) Marshal(options *Options) (interface{}, error) {
+	return map[string]interface{}{"theme": "dark"}, nil
+}
+
+type KeysNode struct {
+	Name     string      `json:"name"`
+	Children []*KeysNode `json:"children"`
+}
+
+type KeysUser struct {
+	*KeysAudit `groups:"admin"`
+	ID         int                       `json:"id"`
+	Email      string                    `json:"email,omitempty" groups:"owner"`
+	Address    *KeysAddress              `json:"address"`
+	Addresses  []KeysAddress             `json:"addresses"`
+	ByLabel    map[string][]KeysAddress  `json:"by_label"`
+	Pair       [2]KeysAddress            `json:"pair"`
+	Settings   KeysSettings              `json:"settings"`
+	Extra      map[string]interface{}    `json:"extra" sheriff:"inline"`
+	Tree       KeysNode                  `json:"tree"`
+	Created    time.Time                 `json:"created"`
+	Avatar     []byte                    `json:"avatar"`
+	Any        interface{}               `json:"any"`
+	Body       string                    `json:"body" groups:"moderator" groups_if:"Visibility=public"`
+	Visibility string                    `json:"visibility"`
+	Hidden     string                    `json:"-"`
+	Untagged   map[KeysAddress]int       `groups:"admin"`
+	Nested     map[string]map[string]int `json:"nested"`
+	internal   string
+}
+
+func TestKeys(t *testing.T) {
+	common := []string{
+		"*", "address", "address.city", "addresses", "addresses.*.city", "any", "avatar", "body",
+		"by_label", "by_label.*", "by_label.*.*.city", "created", "id", "nested", "nested.*", "nested.*.*",
+		"pair", "pair.*.city", "settings", "settings.?", "tree", "tree.children", "tree.children.*.?",
+		"tree.name", "visibility",
+	}
+	tests := []struct {
+		name     string
+		options  *Options
+		expected []string
+	}{
+		{
+			name:     "anonymous",
+			options:  &Options{},
+			expected: common,
+		},
+		{
+			name:    "owner",
+			options: &Options{Groups: []string{"owner"}},
+			expected: append(slicesWith(common, "email"),
+				"address.street", "addresses.*.street", "by_label.*.*.street", "pair.*.street"),
+		},
+		{
+			name:     "admin",
+			options:  &Options{Groups: []string{"admin"}},
+			expected: slicesWith(common, "Untagged", "Untagged.*", "created_by"),
+		},
+		{
+			name:     "admin and user",
+			options:  &Options{Groups: []string{"admin", "user"}},
+			expected: slicesWith(common, "Untagged", "Untagged.*", "created_by", "reviewed"),
+		},
+		{
+			name:     "excluded as null",
+			options:  &Options{ExcludedAsNull: true},
+			expected: slicesWith(common, "Untagged", "address.street", "addresses.*.street", "by_label.*.*.street", "created_by", "email", "pair.*.street", "reviewed"),
+		},
+		{
+			name:     "omit fields",
+			options:  &Options{OmitFields: []string{"address", "city"}},
+			expected: []string{"*", "addresses", "any", "avatar", "body", "by_label", "by_label.*", "created", "id", "nested", "nested.*", "nested.*.*", "pair", "settings", "settings.?", "tree", "tree.children", "tree.children.*.?", "tree.name", "visibility"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := Keys(test.options, (*KeysUser)(nil))
+			assert.NoError(t, err)
+			expected := slices.Clone(test.expected)
+			slices.Sort(expected)
+			assert.Equal(t, expected, keys)
+		})
+	}
+}
+
+func TestKeys_MatchesMarshal(t *testing.T) {
+	// every key marshalled for actual data is listed
+	user := KeysUser{
+		KeysAudit: &KeysAudit{CreatedBy: "root"},
+		Email:     "a@example.org",
+		Address:   &KeysAddress{City: "Berlin", Street: "Main St"},
+		Addresses: []KeysAddress{{City: "Paris"}},
+		ByLabel:   map[string][]KeysAddress{"home": {{City: "Rome", Street: "Via"}}},
+		Extra:     map[string]interface{}{"note": 1},
+		Tree:      KeysNode{Name: "root", Children: []*KeysNode{{Name: "leaf"}}},
+		Nested:    map[string]map[string]int{"a": {"b": 1}},
+	}
+	for _, groups := range [][]string{nil, {"owner"}, {"admin", "user"}} {
+		options := &Options{Groups: groups}
+		keys, err := Keys(options, user)
+		assert.NoError(t, err)
+		v, err := Marshal(options, user)
+		assert.NoError(t, err)
+		assertKeysListed(t, keys, "", v)
+	}
+}
+
+// assertKeysListed asserts that the keys of the result of Marshal v are listed in keys, either by their name or
+// as the keys of a map.
+func assertKeysListed(t *testing.T, keys []string, prefix string, v interface{}) {
+	// the keys below are dynamic
+	if slices.Contains(keys, prefix+OpaqueKey) {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			path := prefix + key
+			if !slices.Contains(keys, path) {
+				path = prefix + "*"
+			}
+			assert.Contains(t, keys, path)
+			assertKeysListed(t, keys, path+".", value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			assertKeysListed(t, keys, prefix+"*.", value)
+		}
+	}
+}
+
+type KeysErrors struct {
+	Name string `json:"name" groups:"api,,admin"`
+}
+
+func TestKeys_Errors(t *testing.T) {
+	_, err := Keys(&Options{StrictGroups: true}, KeysErrors{})
+	assert.EqualError(t, err, `marshaller: groups tag "api,,admin" of field Name of sheriff.KeysErrors contains an empty group`)
+
+	_, err = Keys(&Options{}, []GroupsIfInvalidValue{})
+	assert.EqualError(t, err, `marshaller: invalid groups_if value "high" of field Body of sheriff.GroupsIfInvalidValue for int`)
+
+	keys, err := Keys(&Options{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, keys)
+
+	keys, err = Keys(&Options{}, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, keys)
+}
+
+func slicesWith(keys []string, more ...string) []string {
+	return append(slices.Clone(keys), more...)
+}
@@ -0,0 +1,47 @@
+package sheriff
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeyStyle determines how the Go name of a field without json name is converted into its output key.
+type KeyStyle int
+
+const (
+	// AsIsKeyStyle uses the Go field name as is, e.g. `SomeData` or `ID`.
+	AsIsKeyStyle KeyStyle = iota
+	// LowerFirstKeyStyle lower-cases the first letter, or a leading acronym, e.g. `someData`, `id` or `urlPath`.
+	LowerFirstKeyStyle
+	// LowerAllKeyStyle lower-cases the whole name, e.g. `somedata`.
+	LowerAllKeyStyle
+)
+
+func (k KeyStyle) convert(name string) string {
+	switch k {
+	case LowerFirstKeyStyle:
+		return lowerFirst(name)
+	case LowerAllKeyStyle:
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// lowerFirst lower-cases the leading upper-case letters of name, except for the last one if it starts
+// the next word, e.g. `URLPath` becomes `urlPath`.
+func lowerFirst(name string) string {
+	end := 0
+	for end < len(name) {
+		r, size := utf8.DecodeRuneInString(name[end:])
+		if !unicode.IsUpper(r) {
+			break
+		}
+		next, _ := utf8.DecodeRuneInString(name[end+size:])
+		if end > 0 && unicode.IsLower(next) {
+			break
+		}
+		end += size
+	}
+	return strings.ToLower(name[:end]) + name[end:]
+}
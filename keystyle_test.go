@@ -0,0 +1,66 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type KeyStyleEmbedded struct {
+	CreatedAt string
+}
+
+type KeyStyleNested struct {
+	StreetName string
+}
+
+type KeyStyleModel struct {
+	KeyStyleEmbedded
+	SomeData string
+	ID       int
+	URLPath  string
+	Tagged   string `json:"Tagged_Name"`
+	Options  string `json:",omitempty"`
+	Address  KeyStyleNested
+}
+
+func TestMarshal_UntaggedKeyStyle(t *testing.T) {
+	v := KeyStyleModel{
+		KeyStyleEmbedded: KeyStyleEmbedded{CreatedAt: "today"},
+		SomeData:         "data",
+		ID:               1,
+		URLPath:          "/",
+		Tagged:           "tagged",
+		Options:          "options",
+		Address:          KeyStyleNested{StreetName: "street"},
+	}
+
+	tests := map[KeyStyle]string{
+		AsIsKeyStyle:       `{"Address":{"StreetName":"street"},"CreatedAt":"today","ID":1,"Options":"options","SomeData":"data","Tagged_Name":"tagged","URLPath":"/"}`,
+		LowerFirstKeyStyle: `{"Tagged_Name":"tagged","address":{"streetName":"street"},"createdAt":"today","id":1,"options":"options","someData":"data","urlPath":"/"}`,
+		LowerAllKeyStyle:   `{"Tagged_Name":"tagged","address":{"streetname":"street"},"createdat":"today","id":1,"options":"options","somedata":"data","urlpath":"/"}`,
+	}
+	for style, expected := range tests {
+		actualMap, err := Marshal(&Options{UntaggedKeyStyle: style}, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(actual), "%d", style)
+	}
+}
+
+func TestLowerFirst(t *testing.T) {
+	tests := map[string]string{
+		"SomeData": "someData",
+		"ID":       "id",
+		"URLPath":  "urlPath",
+		"A":        "a",
+		"already":  "already",
+		"ÄpfelX":   "äpfelX",
+		"":         "",
+	}
+	for name, expected := range tests {
+		assert.Equal(t, expected, lowerFirst(name), name)
+	}
+}
@@ -0,0 +1,16 @@
+package sheriff
+
+// fieldKey returns the name and the options of the field's tag selected by KeyTag, and whether the field is an
+// anonymous struct field whose fields are brought to the top, which depends on the name.
+func (o *Options) fieldKey(info *fieldInfo) (name string, opts tagOptions, embedded bool) {
+	if o.KeyTag == "" || o.KeyTag == "json" {
+		return info.jsonName, info.jsonOpts, info.embedded
+	}
+	name, opts = parseTag(info.field.Tag.Get(o.KeyTag))
+	return name, opts, name == "" && isEmbeddedStruct(info.field)
+}
+
+// omitsNil reports whether fields and map entries which would be null are omitted, see KeyTag.
+func (o *Options) omitsNil() bool {
+	return o.KeyTag == "toml"
+}
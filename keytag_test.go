@@ -0,0 +1,101 @@
+package sheriff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type KeyTagDatabase struct {
+	Host     string  `toml:"host" json:"db_host"`
+	Port     int     `toml:"port"`
+	Password string  `toml:"password" groups:"admin"`
+	Replica  *string `toml:"replica,omitempty"`
+}
+
+type KeyTagLimits struct {
+	Burst int `toml:"burst"`
+}
+
+type KeyTagConfig struct {
+	KeyTagLimits
+	Name      string                    `toml:"name" json:"title"`
+	Started   time.Time                 `toml:"started"`
+	Stopped   *time.Time                `toml:"stopped"`
+	Database  KeyTagDatabase            `toml:"database"`
+	Replicas  []KeyTagDatabase          `toml:"replicas"`
+	Ports     map[int]string            `toml:"ports"`
+	Labels    map[string]*string        `toml:"labels"`
+	Fallback  *KeyTagDatabase           `toml:"fallback"`
+	Extra     interface{}               `toml:"extra"`
+	Debug     bool                      `toml:"debug,omitempty"`
+	Ignored   string                    `toml:"-" json:"ignored"`
+	Untagged  float64                   `json:"untagged"`
+	Overrides map[string]KeyTagDatabase `toml:"overrides"`
+}
+
+func keyTagConfig() KeyTagConfig {
+	dev := "dev"
+	return KeyTagConfig{
+		KeyTagLimits: KeyTagLimits{Burst: 10},
+		Name:         "api",
+		Started:      time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC),
+		Database:     KeyTagDatabase{Host: "db", Port: 5432, Password: "secret"},
+		Replicas:     []KeyTagDatabase{{Host: "r1", Port: 5433}},
+		Ports:        map[int]string{80: "http"},
+		Labels:       map[string]*string{"env": &dev, "unset": nil},
+		Ignored:      "ignored",
+		Untagged:     1.5,
+		Overrides:    map[string]KeyTagDatabase{"eu": {Host: "eu", Port: 1}},
+	}
+}
+
+func TestMarshal_KeyTagTOML(t *testing.T) {
+	v, err := Marshal(&Options{KeyTag: "toml", ExcludedAsNull: true}, keyTagConfig())
+	assert.NoError(t, err)
+	// the result is what TOML encoders take: time.Time values are kept, nulls are omitted and map keys are strings
+	assert.Equal(t, map[string]interface{}{
+		"Untagged": 1.5,
+		"burst":    10,
+		"name":     "api",
+		"started":  time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC),
+		"database": map[string]interface{}{"host": "db", "port": 5432},
+		"labels":   map[string]interface{}{"env": "dev"},
+		"overrides": map[string]interface{}{
+			"eu": map[string]interface{}{"host": "eu", "port": 1},
+		},
+		"ports":    map[string]interface{}{"80": "http"},
+		"replicas": []interface{}{map[string]interface{}{"host": "r1", "port": 5433}},
+	}, v)
+}
+
+func TestMarshal_KeyTag(t *testing.T) {
+	// without "toml", only the keys change
+	v, err := Marshal(&Options{KeyTag: "toml", Groups: []string{"admin"}}, KeyTagDatabase{Host: "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"host": "db", "port": 0, "password": ""}, v)
+
+	v, err = Marshal(&Options{KeyTag: "yaml", ExcludedAsNull: true}, KeyTagDatabase{Host: "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Host": "db", "Port": 0, "Password": nil, "Replica": nil}, v)
+
+	v, err = Marshal(&Options{KeyTag: "json"}, KeyTagDatabase{Host: "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"db_host": "db", "Port": 0, "Replica": nil}, v)
+
+	keys, err := Keys(&Options{KeyTag: "toml"}, KeyTagDatabase{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host", "port", "replica"}, keys)
+}
+
+func TestMarshalAll_KeyTagTOML(t *testing.T) {
+	optionSets := map[string]*Options{"a": {KeyTag: "toml"}, "admin": {KeyTag: "toml", Groups: []string{"admin"}}}
+	all, err := MarshalAll(keyTagConfig(), optionSets)
+	assert.NoError(t, err)
+	for name, o := range optionSets {
+		v, err := Marshal(o, keyTagConfig())
+		assert.NoError(t, err)
+		assert.Equal(t, v, all[name])
+	}
+}
@@ -0,0 +1,117 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// knownGroups holds the groups registered using MustRegisterGroups.
+var knownGroups = struct {
+	sync.RWMutex
+	groups map[string]struct{}
+}{groups: make(map[string]struct{})}
+
+// MustRegisterGroups declares groups as valid, which makes Options.StrictGroups and Validate report any group
+// which isn't registered, be it in a groups tag or in Options.Groups. This catches typos like `groups:"adminn"`,
+// which would otherwise hide the field from everyone. As long as no groups are registered, no group is reported.
+//
+//	func init() {
+//		sheriff.MustRegisterGroups("public", "internal", "admin")
+//	}
+//
+// MustRegisterGroups may be called several times to add groups. It's safe for concurrent use, but it's meant to
+// be called during initialization. It panics if a group is empty, has surrounding spaces or contains a comma.
+func MustRegisterGroups(groups ...string) {
+	for _, group := range groups {
+		if group == "" || strings.TrimSpace(group) != group || strings.Contains(group, ",") {
+			panic(fmt.Sprintf("sheriff: MustRegisterGroups of invalid group %q", group))
+		}
+	}
+
+	knownGroups.Lock()
+	defer knownGroups.Unlock()
+	for _, group := range groups {
+		knownGroups.groups[group] = struct{}{}
+	}
+	// the unknown groups of the cached fields have to be determined again
+	fieldGroupsRegistry.version.Add(1)
+}
+
+// ResetRegisteredGroups removes all groups registered using MustRegisterGroups, e.g. at the end of a test.
+func ResetRegisteredGroups() {
+	knownGroups.Lock()
+	defer knownGroups.Unlock()
+	clear(knownGroups.groups)
+	fieldGroupsRegistry.version.Add(1)
+}
+
+// isGroupRegistered reports whether group has been registered, or whether no groups have been registered at all.
+func isGroupRegistered(group string) bool {
+	knownGroups.RLock()
+	defer knownGroups.RUnlock()
+	if len(knownGroups.groups) == 0 {
+		return true
+	}
+	_, ok := knownGroups.groups[group]
+	return ok
+}
+
+// unknownRequestedGroup returns an UnknownGroupError for the first of the requested groups which matches none
+// of the registered groups, or nil if there is none.
+func unknownRequestedGroup(requested []string, matcher GroupMatcher) error {
+	knownGroups.RLock()
+	defer knownGroups.RUnlock()
+	if len(knownGroups.groups) == 0 {
+		return nil
+	}
+	for _, r := range requested {
+		if _, ok := knownGroups.groups[r]; ok {
+			continue
+		}
+		known := false
+		if matcher != nil {
+			for group := range knownGroups.groups {
+				if matcher.Match(r, group) {
+					known = true
+					break
+				}
+			}
+		}
+		if !known {
+			return UnknownGroupError{Group: r}
+		}
+	}
+	return nil
+}
+
+// unknownFieldGroup returns an UnknownGroupError for the first group of the field of the struct type t which
+// isn't registered, including groups which may only write it, or nil if there is none.
+func unknownFieldGroup(t reflect.Type, field reflect.StructField) error {
+	entries, _ := fieldGroupEntries(t, field, false)
+	for _, entry := range entries {
+		if group := parseGroupAccess(entry).Group; group != "" && !isGroupRegistered(group) {
+			return UnknownGroupError{Type: t, Field: field.Name, Group: group}
+		}
+	}
+	return nil
+}
+
+// UnknownGroupError is returned if Options.StrictGroups is set and a group hasn't been registered using
+// MustRegisterGroups.
+type UnknownGroupError struct {
+	// Type is the struct type holding the field, nil if the group is one of Options.Groups.
+	Type reflect.Type
+	// Field is the name of the Go field, empty if the group is one of Options.Groups.
+	Field string
+	// Group is the unknown group.
+	Group string
+}
+
+func (e UnknownGroupError) Error() string {
+	if e.Type == nil {
+		return fmt.Sprintf("marshaller: group %q of the options isn't registered", e.Group)
+	}
+	return fmt.Sprintf("marshaller: group %q of field %s of %s isn't registered", e.Group, e.Field, e.Type)
+}
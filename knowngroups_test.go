@@ -0,0 +1,86 @@
+package sheriff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type KnownGroupsModel struct {
+	Name  string `json:"name" groups:"public"`
+	Email string `json:"email" groups:"admin:r,internal:w"`
+}
+
+type KnownGroupsTypo struct {
+	Name  string `json:"name" groups:"public"`
+	Email string `json:"email" groups:"adminn"`
+	Notes string `json:"notes" groups:"admin"`
+}
+
+func TestMustRegisterGroups(t *testing.T) {
+	defer ResetRegisteredGroups()
+	MustRegisterGroups("public", "internal")
+	MustRegisterGroups("admin")
+
+	actual, err := Marshal(&Options{Groups: []string{"admin"}, StrictGroups: true}, KnownGroupsModel{Name: "alice", Email: "alice@example.org"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"email": "alice@example.org"}, actual)
+
+	v := KnownGroupsTypo{Name: "alice", Email: "alice@example.org", Notes: "vip"}
+	_, err = Marshal(&Options{Groups: []string{"admin"}, StrictGroups: true}, v)
+	assert.Equal(t, UnknownGroupError{Type: reflect.TypeOf(v), Field: "Email", Group: "adminn"}, err)
+	assert.EqualError(t, err, `marshaller: group "adminn" of field Email of sheriff.KnownGroupsTypo isn't registered`)
+
+	// the field is skipped if the error is recovered from
+	actual, err = Marshal(&Options{Groups: []string{"admin"}, StrictGroups: true, ErrorPolicy: SkipSilently}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"notes": "vip"}, actual)
+
+	// unknown groups aren't reported unless StrictGroups is set
+	actual, err = Marshal(&Options{Groups: []string{"admin"}}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"notes": "vip"}, actual)
+}
+
+func TestMustRegisterGroups_Options(t *testing.T) {
+	defer ResetRegisteredGroups()
+	MustRegisterGroups("public", "admin", "admin:users")
+
+	v := KnownGroupsModel{Name: "alice"}
+	_, err := Marshal(&Options{Groups: []string{"public", "pubic"}, StrictGroups: true}, v)
+	assert.Equal(t, UnknownGroupError{Group: "pubic"}, err)
+	assert.EqualError(t, err, `marshaller: group "pubic" of the options isn't registered`)
+
+	// the error applies to every field, so it isn't recovered from
+	_, err = Marshal(&Options{Groups: []string{"pubic"}, StrictGroups: true, ErrorPolicy: SkipSilently}, v)
+	assert.Equal(t, UnknownGroupError{Group: "pubic"}, err)
+
+	// requested groups are known if they match a registered group
+	_, err = Marshal(&Options{Groups: []string{"admin:*", "PUBLIC"}, GroupMatcher: GlobGroups, StrictGroups: true}, struct{ A int }{})
+	assert.Equal(t, UnknownGroupError{Group: "PUBLIC"}, err)
+	_, err = Marshal(&Options{Groups: []string{"ADMIN:users", "PUBLIC"}, GroupMatcher: CaseInsensitiveGroups, StrictGroups: true}, struct{ A int }{})
+	assert.NoError(t, err)
+
+	assert.EqualError(t, (&Options{Groups: []string{"public", "pubic"}}).Validate(), `marshaller: invalid options: Groups[1] "pubic" isn't registered`)
+}
+
+func TestMustRegisterGroups_Reset(t *testing.T) {
+	MustRegisterGroups("public")
+	_, err := Marshal(&Options{Groups: []string{"admin"}, StrictGroups: true}, KnownGroupsTypo{})
+	assert.Error(t, err)
+
+	ResetRegisteredGroups()
+	_, err = Marshal(&Options{Groups: []string{"admin"}, StrictGroups: true}, KnownGroupsTypo{})
+	assert.NoError(t, err)
+	assert.NoError(t, (&Options{Groups: []string{"admin"}}).Validate())
+}
+
+func TestMustRegisterGroups_Invalid(t *testing.T) {
+	defer ResetRegisteredGroups()
+	assert.PanicsWithValue(t, `sheriff: MustRegisterGroups of invalid group ""`, func() { MustRegisterGroups("public", "") })
+	assert.PanicsWithValue(t, `sheriff: MustRegisterGroups of invalid group " admin"`, func() { MustRegisterGroups(" admin") })
+	assert.PanicsWithValue(t, `sheriff: MustRegisterGroups of invalid group "a,b"`, func() { MustRegisterGroups("a,b") })
+	// nothing is registered if a group is invalid
+	assert.NoError(t, (&Options{Groups: []string{"public"}}).Validate())
+}
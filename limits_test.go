@@ -0,0 +1,90 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type LimitsItem struct {
+	Name   string `json:"name" groups:"public"`
+	Secret string `json:"secret" groups:"private"`
+}
+
+// LimitsMarshaller returns a large result itself.
+type LimitsMarshaller struct{}
+
+func (LimitsMarshaller) Marshal(options *Options) (interface{}, error) {
+	return map[string]interface{}{
+		"list":  []interface{}{map[string]int{"a": 1, "b": 2, "c": 3}, 2, 3},
+		"typed": []string{"a", "b", "c"},
+	}, nil
+}
+
+type LimitsModel struct {
+	Items      []LimitsItem          `json:"items" groups:"public"`
+	Lookup     map[int]LimitsItem    `json:"lookup" groups:"public"`
+	Nested     map[string][]string   `json:"nested" groups:"public"`
+	Short      []string              `json:"short" groups:"public"`
+	Marshaller LimitsMarshaller      `json:"marshaller" groups:"public"`
+	Empty      map[string]LimitsItem `json:"empty" groups:"public"`
+}
+
+func limitsModel() LimitsModel {
+	return LimitsModel{
+		Items:  []LimitsItem{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+		Lookup: map[int]LimitsItem{3: {Name: "c"}, 1: {Name: "a"}, 2: {Name: "b"}},
+		Nested: map[string][]string{"x": {"1", "2", "3"}},
+		Short:  []string{"a", "b"},
+		Empty:  map[string]LimitsItem{},
+	}
+}
+
+func TestMarshal_MaxLenTruncate(t *testing.T) {
+	options := &Options{Groups: []string{"public"}, MaxSliceLen: 2, MaxMapLen: 2, TruncateOverflow: true, OverflowKey: "…"}
+
+	actualMap, err := Marshal(options, limitsModel())
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"empty":{},`+
+		`"items":[{"name":"a"},{"name":"b"},{"…":1}],`+
+		`"lookup":{"1":{"name":"a"},"2":{"name":"b"},"…":1},`+
+		`"marshaller":{"list":[{"a":1,"b":2},2,{"…":1}],"typed":["a","b"]},`+
+		`"nested":{"x":["1","2",{"…":1}]},`+
+		`"short":["a","b"]}`, string(actual))
+
+	// without OverflowKey, the data is truncated silently
+	options.OverflowKey = ""
+	actualMap, err = Marshal(options, limitsModel())
+	assert.NoError(t, err)
+	actual, err = json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Contains(t, string(actual), `"items":[{"name":"a"},{"name":"b"}],"lookup":{"1":{"name":"a"},"2":{"name":"b"}}`)
+}
+
+func TestMarshal_MaxLenError(t *testing.T) {
+	v := limitsModel()
+
+	_, err := Marshal(&Options{Groups: []string{"public"}, MaxSliceLen: 2}, v)
+	assert.Equal(t, LengthError{Kind: reflect.Slice, Len: 3, Max: 2, Path: "items"}, err)
+	assert.Equal(t, "marshaller: slice of length 3 exceeds the maximum of 2 (at items)", err.Error())
+
+	_, err = Marshal(&Options{Groups: []string{"public"}, MaxMapLen: 2}, v)
+	assert.Equal(t, LengthError{Kind: reflect.Map, Len: 3, Max: 2, Path: "lookup"}, err)
+
+	v.Lookup = nil
+	_, err = Marshal(&Options{Groups: []string{"public"}, MaxMapLen: 2}, v)
+	assert.Equal(t, LengthError{Kind: reflect.Map, Len: 3, Max: 2, Path: "marshaller.list.0"}, err)
+
+	v.Items = nil
+	v.Nested = nil
+	_, err = Marshal(&Options{Groups: []string{"public"}, MaxSliceLen: 2}, v)
+	assert.Equal(t, LengthError{Kind: reflect.Slice, Len: 3, Max: 2, Path: "marshaller.list"}, err)
+
+	_, err = Marshal(&Options{Groups: []string{"public"}, MaxSliceLen: 3, MaxMapLen: 3}, limitsModel())
+	assert.NoError(t, err)
+}
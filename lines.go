@@ -0,0 +1,156 @@
+package sheriff
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// linesPerFlush is the number of lines EncodeLines writes between flushing the writer.
+const linesPerFlush = 100
+
+// LineError is returned by EncodeLines (or passed to Options.OnLineError) if an element failed to marshal.
+type LineError struct {
+	// Index is the position of the element within data.
+	Index int
+	// Err is the error returned by Marshal.
+	Err error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("marshaller: element %d: %s", e.Index, e.Err)
+}
+
+// Unwrap returns the error returned by Marshal.
+func (e LineError) Unwrap() error {
+	return e.Err
+}
+
+// flusher is implemented by writers buffering their output, e.g. http.Flusher.
+type flusher interface {
+	Flush()
+}
+
+// EncodeLines writes the elements of data filtered by the given options to w as JSON Lines (NDJSON), i.e. one
+// JSON document per line, encoded like MarshalAppend does.
+//
+// data may be a slice or an array, a channel, which is read until it's closed, or an iterator function like
+// `func(yield func(interface{}) bool)` (any element type is accepted). Every element is marshalled on its own.
+// If one fails, EncodeLines stops and returns a LineError, unless Options.OnLineError is set, which skips the
+// element instead.
+//
+// If w implements http.Flusher (or any other `Flush()` method), it's flushed every 100 lines, before waiting for
+// the next element of a channel and once done.
+func EncodeLines(w io.Writer, options *Options, data interface{}) error {
+	e := &lineEncoder{w: w, options: options}
+	e.flusher, _ = w.(flusher)
+
+	if err := e.encodeAll(data); err != nil {
+		return err
+	}
+	e.flush()
+	return nil
+}
+
+// lineEncoder holds the state of an EncodeLines call.
+type lineEncoder struct {
+	w       io.Writer
+	flusher flusher
+	options *Options
+	buf     []byte
+	// index is the position of the next element.
+	index int
+}
+
+func (e *lineEncoder) encodeAll(data interface{}) error {
+	if seq, ok := data.(func(yield func(interface{}) bool)); ok {
+		var err error
+		seq(func(elem interface{}) bool {
+			err = e.encode(elem)
+			return err == nil
+		})
+		return err
+	}
+
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Chan:
+		if v.Type().ChanDir()&reflect.RecvDir == 0 {
+			break
+		}
+		for {
+			elem, ok := v.TryRecv()
+			if !elem.IsValid() {
+				// nothing to encode until the next element is sent, so the lines so far are flushed
+				e.flush()
+				elem, ok = v.Recv()
+			}
+			if !ok {
+				return nil
+			}
+			if err := e.encode(elem.Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Func:
+		if !isIteratorType(v.Type()) {
+			break
+		}
+		var err error
+		yield := reflect.MakeFunc(v.Type().In(0), func(args []reflect.Value) []reflect.Value {
+			err = e.encode(args[0].Interface())
+			return []reflect.Value{reflect.ValueOf(err == nil)}
+		})
+		v.Call([]reflect.Value{yield})
+		return err
+	}
+	return fmt.Errorf("marshaller: EncodeLines requires a slice, an array, a channel or an iterator function, got %T", data)
+}
+
+// isIteratorType reports whether t is a function like `func(yield func(T) bool)`.
+func isIteratorType(t reflect.Type) bool {
+	if t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	yield := t.In(0)
+	return yield.Kind() == reflect.Func && yield.NumIn() == 1 && yield.NumOut() == 1 && yield.Out(0).Kind() == reflect.Bool
+}
+
+// encode writes the line of elem.
+func (e *lineEncoder) encode(elem interface{}) error {
+	index := e.index
+	e.index++
+
+	var err error
+	e.buf, err = MarshalAppend(e.buf[:0], e.options, elem)
+	if err != nil {
+		lineErr := LineError{Index: index, Err: err}
+		if e.options.OnLineError == nil {
+			return lineErr
+		}
+		e.options.OnLineError(lineErr)
+		return nil
+	}
+
+	e.buf = append(e.buf, '\n')
+	if _, err := e.w.Write(e.buf); err != nil {
+		return err
+	}
+	if e.index%linesPerFlush == 0 {
+		e.flush()
+	}
+	return nil
+}
+
+func (e *lineEncoder) flush() {
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+}
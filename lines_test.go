@@ -0,0 +1,144 @@
+package sheriff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type LinesModel struct {
+	ID     int    `json:"id" groups:"user,admin"`
+	Name   string `json:"name" groups:"user,admin"`
+	Salary int    `json:"salary" groups:"admin"`
+}
+
+func TestEncodeLines(t *testing.T) {
+	values := []LinesModel{
+		{ID: 1, Name: "alice", Salary: 100},
+		{ID: 2, Name: "bob", Salary: 200},
+	}
+
+	var buf bytes.Buffer
+	err := EncodeLines(&buf, &Options{Groups: []string{"user"}}, values)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"id\":1,\"name\":\"alice\"}\n{\"id\":2,\"name\":\"bob\"}\n", buf.String())
+
+	buf.Reset()
+	err = EncodeLines(&buf, &Options{Groups: []string{"admin"}}, [1]LinesModel{values[0]})
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"id\":1,\"name\":\"alice\",\"salary\":100}\n", buf.String())
+}
+
+func TestEncodeLines_Sources(t *testing.T) {
+	expected := "{\"id\":1,\"name\":\"alice\"}\n{\"id\":2,\"name\":\"bob\"}\n"
+	options := &Options{Groups: []string{"user"}}
+
+	ch := make(chan LinesModel)
+	go func() {
+		ch <- LinesModel{ID: 1, Name: "alice"}
+		ch <- LinesModel{ID: 2, Name: "bob"}
+		close(ch)
+	}()
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeLines(&buf, options, (<-chan LinesModel)(ch)))
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	seq := func(yield func(interface{}) bool) {
+		_ = yield(LinesModel{ID: 1, Name: "alice"}) && yield(&LinesModel{ID: 2, Name: "bob"})
+	}
+	assert.NoError(t, EncodeLines(&buf, options, seq))
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	typedSeq := func(yield func(LinesModel) bool) {
+		_ = yield(LinesModel{ID: 1, Name: "alice"}) && yield(LinesModel{ID: 2, Name: "bob"})
+	}
+	assert.NoError(t, EncodeLines(&buf, options, typedSeq))
+	assert.Equal(t, expected, buf.String())
+
+	err := EncodeLines(&buf, options, LinesModel{})
+	assert.EqualError(t, err, "marshaller: EncodeLines requires a slice, an array, a channel or an iterator function, got sheriff.LinesModel")
+	err = EncodeLines(&buf, options, make(chan<- LinesModel))
+	assert.Error(t, err)
+	err = EncodeLines(&buf, options, func(yield func(LinesModel)) {})
+	assert.Error(t, err)
+}
+
+func TestEncodeLines_Error(t *testing.T) {
+	values := []interface{}{
+		LinesModel{ID: 1, Name: "alice"},
+		DeferFailingModel{},
+		LinesModel{ID: 2, Name: "bob"},
+	}
+
+	// aborts by default
+	var buf bytes.Buffer
+	err := EncodeLines(&buf, &Options{Groups: []string{"user"}}, values)
+	assert.Equal(t, LineError{Index: 1, Err: errDeferFailing}, err)
+	assert.True(t, errors.Is(err, errDeferFailing))
+	assert.Equal(t, "{\"id\":1,\"name\":\"alice\"}\n", buf.String())
+
+	// skips the element with a callback
+	var skipped []LineError
+	buf.Reset()
+	err = EncodeLines(&buf, &Options{
+		Groups:      []string{"user"},
+		OnLineError: func(err LineError) { skipped = append(skipped, err) },
+	}, values)
+	assert.NoError(t, err)
+	assert.Equal(t, []LineError{{Index: 1, Err: errDeferFailing}}, skipped)
+	assert.Equal(t, "{\"id\":1,\"name\":\"alice\"}\n{\"id\":2,\"name\":\"bob\"}\n", buf.String())
+
+	// stops an iterator
+	yielded := 0
+	seq := func(yield func(interface{}) bool) {
+		for _, value := range values {
+			yielded++
+			if !yield(value) {
+				return
+			}
+		}
+	}
+	err = EncodeLines(&bytes.Buffer{}, &Options{}, seq)
+	assert.Equal(t, LineError{Index: 1, Err: errDeferFailing}, err)
+	assert.Equal(t, 2, yielded)
+}
+
+type flushRecorder struct {
+	bytes.Buffer
+	// flushedLines is the number of lines written at every flush.
+	flushedLines []int
+	flushed      chan int
+}
+
+func (r *flushRecorder) Flush() {
+	lines := bytes.Count(r.Bytes(), []byte("\n"))
+	r.flushedLines = append(r.flushedLines, lines)
+	if r.flushed != nil {
+		r.flushed <- lines
+	}
+}
+
+func TestEncodeLines_Flush(t *testing.T) {
+	var w flushRecorder
+	assert.NoError(t, EncodeLines(&w, &Options{}, make([]LinesModel, 250)))
+	assert.Equal(t, []int{100, 200, 250}, w.flushedLines)
+
+	// channels are flushed before waiting for the next element, the line is written before the channel is closed
+	ch := make(chan LinesModel)
+	w = flushRecorder{flushed: make(chan int, 2)}
+	go func() {
+		ch <- LinesModel{ID: 1}
+		for lines := range w.flushed {
+			if lines == 1 {
+				close(ch)
+				return
+			}
+		}
+	}()
+	assert.NoError(t, EncodeLines(&w, &Options{}, ch))
+	assert.Contains(t, w.flushedLines, 1)
+}
@@ -0,0 +1,23 @@
+package sheriff
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ErrPreservedMapKeys is returned by the functions encoding JSON if the data holds a map whose keys are preserved,
+// see Options.PreserveMapKeyTypes.
+var ErrPreservedMapKeys = errors.New("marshaller: maps with keys preserved by Options.PreserveMapKeyTypes can't be encoded as JSON")
+
+// preservesMapKeys reports whether the keys of the map type t currently being marshalled are kept as they are,
+// see Options.PreserveMapKeyTypes.
+func (s *marshalState) preservesMapKeys(t reflect.Type) bool {
+	if !s.options.PreserveMapKeyTypes || t.Key().Kind() == reflect.String {
+		return false
+	}
+	// the entries of inline maps are merged into the object of the struct
+	if n := len(s.frames); n > 0 && s.frames[n-1].kind == structFrame && s.frames[n-1].field.inline {
+		return false
+	}
+	return true
+}
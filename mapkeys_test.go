@@ -0,0 +1,87 @@
+package sheriff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MapKeysReading struct {
+	Value  float64 `json:"value"`
+	Source string  `json:"source" groups:"internal"`
+}
+
+type MapKeysTelemetry struct {
+	Device   string                    `json:"device"`
+	Readings map[int]MapKeysReading    `json:"readings"`
+	Counters map[uint8]int             `json:"counters,omitempty"`
+	Labels   map[string]string         `json:"labels"`
+	Nested   map[int]map[int64]string  `json:"nested"`
+	Extra    map[int]interface{}       `json:"extra" sheriff:"inline"`
+	Empty    map[int]int               `json:"empty"`
+	Pointers map[int16]*MapKeysReading `json:"pointers"`
+}
+
+func mapKeysTelemetry() MapKeysTelemetry {
+	return MapKeysTelemetry{
+		Device:   "sensor",
+		Readings: map[int]MapKeysReading{1: {Value: 1.5, Source: "a"}, -2: {Value: 2}},
+		Labels:   map[string]string{"site": "berlin"},
+		Nested:   map[int]map[int64]string{3: {4: "x"}},
+		Extra:    map[int]interface{}{7: "seven"},
+		Empty:    map[int]int{},
+		Pointers: map[int16]*MapKeysReading{5: nil},
+	}
+}
+
+func TestMarshal_PreserveMapKeyTypes(t *testing.T) {
+	v, err := Marshal(&Options{PreserveMapKeyTypes: true}, mapKeysTelemetry())
+	assert.NoError(t, err)
+	// the keys keep their types, so encoders of formats like CBOR write them as integers (see the cbortest module)
+	assert.Equal(t, map[string]interface{}{
+		"device": "sensor",
+		"readings": map[interface{}]interface{}{
+			1:  map[string]interface{}{"value": 1.5},
+			-2: map[string]interface{}{"value": 2.0},
+		},
+		"labels":   map[string]interface{}{"site": "berlin"},
+		"nested":   map[interface{}]interface{}{3: map[interface{}]interface{}{int64(4): "x"}},
+		"7":        "seven",
+		"empty":    map[interface{}]interface{}{},
+		"pointers": map[interface{}]interface{}{int16(5): nil},
+	}, v)
+}
+
+func TestMarshal_PreserveMapKeyTypesOptions(t *testing.T) {
+	options := &Options{PreserveMapKeyTypes: true, Groups: []string{"internal"}, MaxMapLen: 1, TruncateOverflow: true, OverflowKey: "more"}
+	v, err := Marshal(options, map[int]MapKeysReading{1: {Source: "a"}, 2: {Source: "b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]interface{}{1: map[string]interface{}{"source": "a", "value": 0.0}, "more": 1}, v)
+
+	v, err = Marshal(&Options{PreserveMapKeyTypes: true, OmitEmptyNested: true}, mapKeysTelemetry())
+	assert.NoError(t, err)
+	assert.NotContains(t, v, "empty")
+
+	all, err := MarshalAll(mapKeysTelemetry(), map[string]*Options{"cbor": {PreserveMapKeyTypes: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]interface{}{3: map[interface{}]interface{}{int64(4): "x"}}, all["cbor"].(map[string]interface{})["nested"])
+}
+
+func TestMarshalAppend_PreserveMapKeyTypes(t *testing.T) {
+	options := &Options{PreserveMapKeyTypes: true}
+	_, err := MarshalAppend(nil, options, mapKeysTelemetry())
+	assert.Equal(t, ErrPreservedMapKeys, err)
+
+	_, err = MarshalCanonical(options, mapKeysTelemetry())
+	assert.Equal(t, ErrPreservedMapKeys, err)
+
+	var buf bytes.Buffer
+	assert.True(t, errors.Is(EncodeLines(&buf, options, []MapKeysTelemetry{mapKeysTelemetry()}), ErrPreservedMapKeys))
+
+	// data without such maps is still encoded
+	b, err := MarshalAppend(nil, options, map[string]int{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(b))
+}
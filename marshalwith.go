@@ -0,0 +1,87 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// MarshalWith marshals the struct data like Marshal does and adds the entries of extra to the result, e.g.
+// computed values like `"can_edit": true` which aren't part of the model. The extra values are marshalled with
+// the same options, so structs within them are filtered too.
+//
+// An extra key which is already produced by a field of data results in an ExtraKeyError, unless
+// Options.ExtraOverwrites is set. If data isn't a struct (or a pointer to one) or it's left to a marshaler
+// interface (e.g. time.Time), a MarshalInvalidTypeError is returned, as there is no object to add to.
+func MarshalWith(options *Options, data interface{}, extra map[string]interface{}) (map[string]interface{}, error) {
+	v := reflect.ValueOf(data)
+	if e := reflect.Indirect(v); e.Kind() != reflect.Struct || isMarshalerRoot(options, v) {
+		kind := v.Kind()
+		if e.IsValid() {
+			kind = e.Kind()
+		}
+		return nil, MarshalInvalidTypeError{Kind: kind, Value: data}
+	}
+
+	s := acquireMarshalState(options)
+	defer s.release()
+	if options.Instrumentation == nil {
+		return s.marshalWith(v, extra)
+	}
+
+	var dest map[string]interface{}
+	err := s.instrument(v, func() (err error) {
+		dest, err = s.marshalWith(v, extra)
+		return err
+	})
+	return dest, err
+}
+
+// marshalWith is the implementation of MarshalWith for the struct (or pointer to a struct) v.
+func (s *marshalState) marshalWith(v reflect.Value, extra map[string]interface{}) (map[string]interface{}, error) {
+	result, err := s.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dest, _ := result.(map[string]interface{})
+	if dest == nil {
+		dest = make(map[string]interface{}, len(extra))
+	}
+
+	for key, value := range extra {
+		if _, ok := dest[key]; ok && !s.options.ExtraOverwrites {
+			return nil, ExtraKeyError{Type: reflect.Indirect(v).Type(), Key: key}
+		}
+		s.pushKey(key)
+		marshalled, err := s.marshalValue(reflect.ValueOf(value), false)
+		s.pop()
+		if err != nil {
+			if s.recoverFrom(err) {
+				continue
+			}
+			return nil, err
+		}
+		dest[key] = marshalled
+	}
+	if s.options.DebugMetaKey != "" {
+		withMeta, err := s.withDebugMeta(v, dest)
+		if err != nil {
+			return nil, err
+		}
+		dest = withMeta.(map[string]interface{})
+	}
+	return dest, s.collectedError()
+}
+
+// ExtraKeyError is returned by MarshalWith if a key of the extras is already produced by a field of the struct,
+// and by Envelope if the unwrapped data already has the metadata key, unless Options.ExtraOverwrites is set.
+// It's also returned if the top-level object already has Options.DebugMetaKey.
+type ExtraKeyError struct {
+	// Type is the type of the data.
+	Type reflect.Type
+	// Key is the colliding key.
+	Key string
+}
+
+func (e ExtraKeyError) Error() string {
+	return fmt.Sprintf("marshaller: extra key %q collides with a field of %s", e.Key, e.Type)
+}
@@ -0,0 +1,79 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MarshalWithAuthor struct {
+	Name  string `json:"name" groups:"api"`
+	Email string `json:"email" groups:"admin"`
+}
+
+type MarshalWithPost struct {
+	ID    int    `json:"id" groups:"api"`
+	Title string `json:"title" groups:"api"`
+	Draft bool   `json:"draft" groups:"admin"`
+}
+
+func TestMarshalWith(t *testing.T) {
+	post := MarshalWithPost{ID: 1, Title: "Hello", Draft: true}
+	extra := map[string]interface{}{
+		"can_edit": true,
+		"author":   MarshalWithAuthor{Name: "alice", Email: "alice@example.org"},
+		"draft":    "overwritten",
+	}
+
+	m, err := MarshalWith(&Options{Groups: []string{"api"}}, &post, extra)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"author":{"name":"alice"},"can_edit":true,"draft":"overwritten","id":1,"title":"Hello"}`, string(actual))
+
+	_, err = MarshalWith(&Options{Groups: []string{"admin"}}, post, extra)
+	assert.Equal(t, ExtraKeyError{Type: reflect.TypeOf(post), Key: "draft"}, err)
+	assert.EqualError(t, err, `marshaller: extra key "draft" collides with a field of sheriff.MarshalWithPost`)
+
+	m, err = MarshalWith(&Options{Groups: []string{"admin"}, ExtraOverwrites: true}, post, extra)
+	assert.NoError(t, err)
+	actual, err = json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"author":{"email":"alice@example.org"},"can_edit":true,"draft":"overwritten"}`, string(actual))
+
+	m, err = MarshalWith(&Options{Groups: []string{"api"}}, post, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": 1, "title": "Hello"}, m)
+}
+
+func TestMarshalWith_InvalidType(t *testing.T) {
+	_, err := MarshalWith(&Options{}, []string{"a"}, map[string]interface{}{"b": 1})
+	assert.Equal(t, MarshalInvalidTypeError{Kind: reflect.Slice, Value: []string{"a"}}, err)
+
+	_, err = MarshalWith(&Options{}, time.Time{}, nil)
+	assert.Equal(t, MarshalInvalidTypeError{Kind: reflect.Struct, Value: time.Time{}}, err)
+
+	var post *MarshalWithPost
+	_, err = MarshalWith(&Options{}, post, nil)
+	assert.Equal(t, MarshalInvalidTypeError{Kind: reflect.Ptr, Value: post}, err)
+}
+
+type MarshalWithFailing struct{}
+
+func (MarshalWithFailing) Marshal(options *Options) (interface{}, error) {
+	return nil, errors.New("failing")
+}
+
+func TestMarshalWith_ErrorPolicy(t *testing.T) {
+	extra := map[string]interface{}{"bad": MarshalWithFailing{}, "good": 1}
+	_, err := MarshalWith(&Options{}, MarshalWithPost{ID: 1}, extra)
+	assert.EqualError(t, err, "failing")
+
+	m, err := MarshalWith(&Options{ErrorPolicy: SkipSilently}, MarshalWithPost{ID: 1}, extra)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"good": 1}, m)
+}
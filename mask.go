@@ -0,0 +1,171 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maskRune replaces the masked runes of strings.
+const maskRune = '*'
+
+// maskRegistry holds the masks registered using RegisterMask, including the built-in ones.
+var maskRegistry = struct {
+	sync.RWMutex
+	masks map[string]func(string) string
+}{masks: map[string]func(string) string{
+	"full":  maskFull,
+	"email": maskEmail,
+}}
+
+// RegisterMask registers the masking strategy fn under name, to be used by fields tagged `mask:"<name>"` if
+// Options.EnableMasking is set. fn receives the string value of the field and returns the masked one.
+// Registering a name again replaces its strategy, including the built-in ones:
+//
+//   - `full` replaces every rune by `*`.
+//   - `email` replaces every rune of the local part of an email address by `*`, keeping the domain
+//     (e.g. `*****@example.org`). Values without `@` are masked fully.
+//
+// Besides the registered names, a tag may list the number of runes to keep at the beginning or the end,
+// e.g. `mask:"last4"` or `mask:"first1,last1"`; the runes in between are replaced by `*`. Strings too short
+// to keep anything hidden are masked fully.
+//
+// RegisterMask is safe for concurrent use, but it's meant to be called during initialization.
+// It panics if name is empty or fn is nil.
+func RegisterMask(name string, fn func(string) string) {
+	if name == "" {
+		panic("sheriff: RegisterMask with an empty name")
+	}
+	if fn == nil {
+		panic(fmt.Sprintf("sheriff: RegisterMask of %s with a nil function", name))
+	}
+
+	maskRegistry.Lock()
+	defer maskRegistry.Unlock()
+	maskRegistry.masks[name] = fn
+}
+
+// fieldMask is the parsed mask tag of a struct field.
+type fieldMask struct {
+	// name is the tag if it doesn't list the runes to keep, to be looked up in maskRegistry.
+	name string
+	// first and last are the number of runes kept at the beginning and the end.
+	first, last int
+	// err is returned if the field can't be masked.
+	err error
+}
+
+// parseMaskTag parses the mask tag of the field of the struct type t. It returns nil if there is none.
+func parseMaskTag(t reflect.Type, field reflect.StructField) *fieldMask {
+	tag, ok := field.Tag.Lookup("mask")
+	if !ok {
+		return nil
+	}
+	ft := field.Type
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	if ft.Kind() != reflect.String {
+		return &fieldMask{err: fmt.Errorf("marshaller: mask tag of field %s of %s requires a string, not %s", field.Name, t, field.Type)}
+	}
+
+	m := &fieldMask{}
+	for _, option := range strings.Split(tag, ",") {
+		var n *int
+		var digits string
+		switch {
+		case strings.HasPrefix(option, "first"):
+			n, digits = &m.first, option[len("first"):]
+		case strings.HasPrefix(option, "last"):
+			n, digits = &m.last, option[len("last"):]
+		}
+		count, err := strconv.Atoi(digits)
+		if n == nil || err != nil || count < 0 {
+			// not a list of runes to keep
+			return &fieldMask{name: tag}
+		}
+		*n = count
+	}
+	return m
+}
+
+// apply masks the string value v (possibly behind pointers) of the field field of the struct type t.
+// Nil pointers are kept as null.
+func (m *fieldMask) apply(t reflect.Type, field reflect.StructField, v reflect.Value) (reflect.Value, error) {
+	if m.err != nil {
+		return v, m.err
+	}
+	for v.Kind() == reflect.Ptr || !v.IsValid() {
+		if !v.IsValid() || v.IsNil() {
+			return reflect.Value{}, nil
+		}
+		v = v.Elem()
+	}
+	if m.name == "" {
+		return reflect.ValueOf(maskKeeping(v.String(), m.first, m.last)), nil
+	}
+
+	maskRegistry.RLock()
+	fn, ok := maskRegistry.masks[m.name]
+	maskRegistry.RUnlock()
+	if !ok {
+		return v, unknownMaskError(t, field, m.name)
+	}
+	return reflect.ValueOf(fn(v.String())), nil
+}
+
+// check returns an error if the field field of the struct type t can't be masked, including if the mask
+// isn't registered. Masks may still be registered after the field has been parsed.
+func (m *fieldMask) check(t reflect.Type, field reflect.StructField) error {
+	if m.err != nil || m.name == "" {
+		return m.err
+	}
+	maskRegistry.RLock()
+	_, ok := maskRegistry.masks[m.name]
+	maskRegistry.RUnlock()
+	if !ok {
+		return unknownMaskError(t, field, m.name)
+	}
+	return nil
+}
+
+func unknownMaskError(t reflect.Type, field reflect.StructField, name string) error {
+	return fmt.Errorf("marshaller: unknown mask %q of field %s of %s", name, field.Name, t)
+}
+
+// maskKeeping replaces the runes of s by maskRune, except for the first and the last ones. s is masked fully
+// if it doesn't have more runes than the ones to be kept.
+func maskKeeping(s string, first, last int) string {
+	n := utf8.RuneCountInString(s)
+	if n <= first+last {
+		return maskFull(s)
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	i := 0
+	for _, r := range s {
+		if i >= first && i < n-last {
+			r = maskRune
+		}
+		b.WriteRune(r)
+		i++
+	}
+	return b.String()
+}
+
+// maskFull replaces every rune of s by maskRune.
+func maskFull(s string) string {
+	return strings.Repeat(string(maskRune), utf8.RuneCountInString(s))
+}
+
+// maskEmail masks the local part of the email address s, keeping the domain.
+func maskEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	if at < 0 {
+		return maskFull(s)
+	}
+	return maskFull(s[:at]) + s[at:]
+}
@@ -0,0 +1,154 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MaskCustomer struct {
+	Name    string  `json:"name" mask:"first1,last1"`
+	Card    string  `json:"card" mask:"last4"`
+	Email   *string `json:"email" mask:"email"`
+	Phone   string  `json:"phone" mask:"full"`
+	Country string  `json:"country" mask:"upper"`
+	Note    string  `json:"note"`
+}
+
+func init() {
+	RegisterMask("upper", strings.ToUpper)
+}
+
+func TestMarshal_Mask(t *testing.T) {
+	email := "jürgen@example.org"
+	v := MaskCustomer{Name: "Jürgen", Card: "4111 1111 1111 1234", Email: &email, Phone: "+41 44", Country: "ch", Note: "vip"}
+
+	tests := []struct {
+		name     string
+		data     MaskCustomer
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "disabled",
+			data:     v,
+			options:  &Options{},
+			expected: `{"card":"4111 1111 1111 1234","country":"ch","email":"jürgen@example.org","name":"Jürgen","note":"vip","phone":"+41 44"}`,
+		},
+		{
+			name:     "enabled",
+			data:     v,
+			options:  &Options{EnableMasking: true},
+			expected: `{"card":"***************1234","country":"CH","email":"******@example.org","name":"J****n","note":"vip","phone":"******"}`,
+		},
+		{
+			name:     "unicode",
+			data:     MaskCustomer{Name: "日本語テキスト", Card: "🂡🂢🂣🂤🂥", Phone: "ünï"},
+			options:  &Options{EnableMasking: true},
+			expected: `{"card":"*🂢🂣🂤🂥","country":"","email":null,"name":"日*****ト","note":"","phone":"***"}`,
+		},
+		{
+			name:     "too short",
+			data:     MaskCustomer{Name: "Jo", Card: "123", Phone: "", Email: new(string)},
+			options:  &Options{EnableMasking: true},
+			expected: `{"card":"***","country":"","email":"","name":"**","note":"","phone":""}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Marshal(test.options, test.data)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(test.data, map[string]*Options{"a": test.options, "b": {}})
+			assert.NoError(t, err)
+			assert.Equal(t, m, all["a"])
+		})
+	}
+}
+
+type MaskAccount struct {
+	Owner  string `json:"owner"`
+	Card   string `json:"card" groups:"billing" mask:"last4"`
+	Hidden string `json:"hidden" groups:"billing"`
+}
+
+func TestMarshal_MaskExcludedAsNull(t *testing.T) {
+	v := MaskAccount{Owner: "alice", Card: "4111 1111 1111 1234", Hidden: "secret"}
+
+	tests := []struct {
+		name     string
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "redaction wins",
+			options:  &Options{ExcludedAsNull: true, EnableMasking: true},
+			expected: `{"card":"***************1234","hidden":null,"owner":"alice"}`,
+		},
+		{
+			name:     "masking disabled",
+			options:  &Options{ExcludedAsNull: true},
+			expected: `{"card":null,"hidden":null,"owner":"alice"}`,
+		},
+		{
+			name:     "excluded fields dropped",
+			options:  &Options{EnableMasking: true},
+			expected: `{"owner":"alice"}`,
+		},
+		{
+			name:     "visible",
+			options:  &Options{Groups: []string{"billing"}, ExcludedAsNull: true, EnableMasking: true},
+			expected: `{"card":"***************1234","hidden":"secret","owner":"alice"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var excluded []string
+			test.options.OnExcluded = func(path string, field reflect.StructField, groups []string) { excluded = append(excluded, path) }
+
+			m, err := Marshal(test.options, v)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+			// the redacted field still counts as excluded
+			if test.options.Groups == nil {
+				assert.Equal(t, []string{"card", "hidden"}, excluded)
+			}
+
+			b, err := MarshalAppend(nil, test.options, v)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(b))
+		})
+	}
+}
+
+type MaskInvalidType struct {
+	Number int `json:"number" mask:"last4"`
+}
+
+type MaskUnknown struct {
+	Number string `json:"number" mask:"middle"`
+}
+
+func TestMarshal_MaskInvalid(t *testing.T) {
+	_, err := Marshal(&Options{}, MaskInvalidType{})
+	assert.NoError(t, err)
+
+	_, err = Marshal(&Options{EnableMasking: true}, MaskInvalidType{})
+	assert.EqualError(t, err, "marshaller: mask tag of field Number of sheriff.MaskInvalidType requires a string, not int")
+
+	_, err = Marshal(&Options{EnableMasking: true}, MaskUnknown{})
+	assert.EqualError(t, err, `marshaller: unknown mask "middle" of field Number of sheriff.MaskUnknown`)
+}
+
+func TestRegisterMask(t *testing.T) {
+	assert.Panics(t, func() { RegisterMask("", strings.ToUpper) })
+	assert.Panics(t, func() { RegisterMask("lower", nil) })
+}
@@ -0,0 +1,50 @@
+package sheriff
+
+// MarshalMerged marshals data once per passed option set and deep merges the results using Merge,
+// e.g. to combine a `public` view with an `owner` overlay.
+//
+// Results are merged in the order of optionSets, so later sets win on conflicts. If a result isn't an
+// object (e.g. data is a slice), it replaces the previous result as a whole. Without any option set,
+// data is marshalled with empty Options.
+func MarshalMerged(data interface{}, optionSets ...*Options) (interface{}, error) {
+	if len(optionSets) == 0 {
+		return Marshal(&Options{}, data)
+	}
+
+	var merged interface{}
+	for _, options := range optionSets {
+		v, err := Marshal(options, data)
+		if err != nil {
+			return nil, err
+		}
+		if dst, ok := merged.(map[string]interface{}); ok {
+			if src, ok := v.(map[string]interface{}); ok {
+				Merge(dst, src)
+				continue
+			}
+		}
+		merged = v
+	}
+	return merged, nil
+}
+
+// Merge deep merges src into dst, as returned by Marshal.
+//
+// If a key exists in both maps and both values are maps, they are merged recursively. Otherwise the value
+// of src wins; this includes slices, which are replaced instead of being merged element by element.
+// Maps of src are copied when added to dst, so modifying dst afterwards doesn't affect src.
+func Merge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, ok := value.(map[string]interface{})
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		dstMap, ok := dst[key].(map[string]interface{})
+		if !ok {
+			dstMap = make(map[string]interface{}, len(srcMap))
+			dst[key] = dstMap
+		}
+		Merge(dstMap, srcMap)
+	}
+}
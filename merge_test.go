@@ -0,0 +1,100 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MergeItem struct {
+	Name  string `json:"name" groups:"public"`
+	Price int    `json:"price" groups:"owner"`
+}
+
+type MergeSettings struct {
+	Theme  string `json:"theme" groups:"public"`
+	Notify bool   `json:"notify" groups:"owner"`
+}
+
+type MergeModel struct {
+	Name     string        `json:"name" groups:"public"`
+	Email    string        `json:"email" groups:"owner"`
+	Settings MergeSettings `json:"settings" groups:"public,owner"`
+	Items    []MergeItem   `json:"items" groups:"public,owner"`
+}
+
+func TestMarshalMerged(t *testing.T) {
+	v := MergeModel{
+		Name:     "alice",
+		Email:    "alice@example.org",
+		Settings: MergeSettings{Theme: "dark", Notify: true},
+		Items:    []MergeItem{{Name: "a", Price: 1}, {Name: "b", Price: 2}},
+	}
+
+	actualMap, err := MarshalMerged(v, &Options{Groups: []string{"public"}}, &Options{Groups: []string{"owner"}})
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(map[string]interface{}{
+		"name":     "alice",
+		"email":    "alice@example.org",
+		"settings": map[string]interface{}{"theme": "dark", "notify": true},
+		// slices are replaced by the later view
+		"items": []map[string]interface{}{{"price": 1}, {"price": 2}},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual))
+}
+
+func TestMarshalMerged_NonObject(t *testing.T) {
+	v := []MergeItem{{Name: "a", Price: 1}}
+
+	actualMap, err := MarshalMerged(v, &Options{Groups: []string{"public"}}, &Options{Groups: []string{"owner"}})
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"price":1}]`, string(actual))
+
+	actualMap, err = MarshalMerged(MergeItem{Name: "a", Price: 1})
+	assert.NoError(t, err)
+	actual, err = json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{}`, string(actual))
+}
+
+func TestMerge(t *testing.T) {
+	src := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": "src",
+			"c": map[string]interface{}{"d": 1},
+		},
+		"e": []interface{}{"x"},
+		"f": "scalar",
+	}
+	dst := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": "dst",
+			"g": "kept",
+		},
+		"e": []interface{}{"y", "z"},
+		"f": map[string]interface{}{"replaced": true},
+	}
+
+	Merge(dst, src)
+	assert.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": "src",
+			"c": map[string]interface{}{"d": 1},
+			"g": "kept",
+		},
+		"e": []interface{}{"x"},
+		"f": "scalar",
+	}, dst)
+
+	// src must not be affected by modifications of dst
+	dst["a"].(map[string]interface{})["c"].(map[string]interface{})["d"] = 2
+	assert.Equal(t, 1, src["a"].(map[string]interface{})["c"].(map[string]interface{})["d"])
+}
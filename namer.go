@@ -0,0 +1,36 @@
+package sheriff
+
+import "reflect"
+
+// FieldNamer determines the output key of a struct field.
+//
+// Name is called with the struct type t, the field f and jsonName, the key resolved from the json tag
+// (or the field name if there is none). The returned key is used instead; if it's empty, jsonName is kept.
+// Fields of anonymous structs brought to the top are named like the fields of any other struct, with t
+// being the anonymous struct's type.
+type FieldNamer interface {
+	Name(t reflect.Type, f reflect.StructField, jsonName string) string
+}
+
+// FieldNamerFunc is an adapter to allow the use of ordinary functions as FieldNamer.
+type FieldNamerFunc func(t reflect.Type, f reflect.StructField, jsonName string) string
+
+// Name calls fn(t, f, jsonName).
+func (fn FieldNamerFunc) Name(t reflect.Type, f reflect.StructField, jsonName string) string {
+	return fn(t, f, jsonName)
+}
+
+// ChainNamer applies multiple FieldNamers one after another. Each of them receives the key returned
+// by the previous one as jsonName; a namer returning an empty string leaves the key unchanged.
+type ChainNamer []FieldNamer
+
+// Name implements FieldNamer.
+func (c ChainNamer) Name(t reflect.Type, f reflect.StructField, jsonName string) string {
+	name := jsonName
+	for _, namer := range c {
+		if n := namer.Name(t, f, name); n != "" {
+			name = n
+		}
+	}
+	return name
+}
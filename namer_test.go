@@ -0,0 +1,79 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type NamerVendor struct {
+	Flag bool `json:"flag" vendor:"true"`
+}
+
+type NamerNested struct {
+	LegacyID string `json:"legacy_id"`
+}
+
+type NamerModel struct {
+	NamerVendor
+	LegacyName string            `json:"legacy_name"`
+	Nested     NamerNested       `json:"nested"`
+	Nesteds    []NamerNested     `json:"nesteds"`
+	Labels     map[string]string `json:"labels"`
+	Secret     string            `json:"secret" groups:"private"`
+}
+
+var vendorNamer = FieldNamerFunc(func(t reflect.Type, f reflect.StructField, jsonName string) string {
+	if f.Tag.Get("vendor") == "true" {
+		return "x-" + jsonName
+	}
+	return ""
+})
+
+var legacyNamer = FieldNamerFunc(func(t reflect.Type, f reflect.StructField, jsonName string) string {
+	if strings.HasPrefix(jsonName, "legacy_") {
+		return strings.TrimPrefix(jsonName, "legacy_")
+	}
+	return ""
+})
+
+func TestMarshal_FieldNamer(t *testing.T) {
+	v := NamerModel{
+		NamerVendor: NamerVendor{Flag: true},
+		LegacyName:  "alice",
+		Nested:      NamerNested{LegacyID: "1"},
+		Nesteds:     []NamerNested{{LegacyID: "2"}},
+		Labels:      map[string]string{"legacy_label": "kept"},
+		Secret:      "secret",
+	}
+
+	var excluded []string
+	options := &Options{
+		FieldNamer: ChainNamer{vendorNamer, legacyNamer},
+		OnExcluded: func(path string, field reflect.StructField, groups []string) {
+			excluded = append(excluded, path)
+		},
+	}
+
+	actualMap, err := Marshal(options, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"labels":{"legacy_label":"kept"},"name":"alice","nested":{"id":"1"},"nesteds":[{"id":"2"}],"x-flag":true}`, string(actual))
+	assert.Equal(t, []string{"secret"}, excluded)
+}
+
+func TestChainNamer(t *testing.T) {
+	field := reflect.TypeOf(NamerVendor{}).Field(0)
+	typ := reflect.TypeOf(NamerVendor{})
+
+	assert.Equal(t, "x-flag", ChainNamer{vendorNamer, legacyNamer}.Name(typ, field, "flag"))
+	// every namer receives the key returned by the previous one
+	assert.Equal(t, "x-flag", ChainNamer{legacyNamer, vendorNamer}.Name(typ, field, "legacy_flag"))
+	assert.Equal(t, "x-legacy_flag", ChainNamer{vendorNamer, legacyNamer}.Name(typ, field, "legacy_flag"))
+	assert.Equal(t, "flag", ChainNamer{}.Name(typ, field, "flag"))
+}
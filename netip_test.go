@@ -0,0 +1,115 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type NetipModel struct {
+	Addr            netip.Addr                `json:"addr"`
+	Prefix          netip.Prefix              `json:"prefix"`
+	AddrPort        netip.AddrPort            `json:"addr_port"`
+	AddrPtr         *netip.Addr               `json:"addr_ptr"`
+	PrefixPtr       *netip.Prefix             `json:"prefix_ptr"`
+	AddrPortPtr     *netip.AddrPort           `json:"addr_port_ptr"`
+	Addrs           []netip.Addr              `json:"addrs"`
+	Prefixes        []netip.Prefix            `json:"prefixes"`
+	AddrPorts       []netip.AddrPort          `json:"addr_ports"`
+	PrefixPtrs      []*netip.Prefix           `json:"prefix_ptrs"`
+	AddrMap         map[string]netip.Addr     `json:"addr_map"`
+	PrefixMap       map[string]netip.Prefix   `json:"prefix_map"`
+	AddrPortMap     map[string]netip.AddrPort `json:"addr_port_map"`
+	PrefixPtrMap    map[string]*netip.Prefix  `json:"prefix_ptr_map"`
+	AddrKeyMap      map[netip.Addr]string     `json:"addr_key_map"`
+	Interface       interface{}               `json:"interface"`
+	InterfacePtr    interface{}               `json:"interface_ptr"`
+	InterfaceSlice  []interface{}             `json:"interface_slice"`
+	InterfaceValues map[string]interface{}    `json:"interface_values"`
+}
+
+func TestMarshal_Netip(t *testing.T) {
+	addr := netip.MustParseAddr("192.0.2.1")
+	prefix := netip.MustParsePrefix("2001:db8::/32")
+	addrPort := netip.MustParseAddrPort("[2001:db8::1]:8080")
+
+	v := NetipModel{
+		Addr:            addr,
+		Prefix:          prefix,
+		AddrPort:        addrPort,
+		AddrPtr:         &addr,
+		PrefixPtr:       &prefix,
+		AddrPortPtr:     &addrPort,
+		Addrs:           []netip.Addr{addr},
+		Prefixes:        []netip.Prefix{prefix},
+		AddrPorts:       []netip.AddrPort{addrPort},
+		PrefixPtrs:      []*netip.Prefix{&prefix, nil},
+		AddrMap:         map[string]netip.Addr{"a": addr},
+		PrefixMap:       map[string]netip.Prefix{"a": prefix},
+		AddrPortMap:     map[string]netip.AddrPort{"a": addrPort},
+		PrefixPtrMap:    map[string]*netip.Prefix{"a": &prefix},
+		AddrKeyMap:      map[netip.Addr]string{addr: "a"},
+		Interface:       prefix,
+		InterfacePtr:    &addrPort,
+		InterfaceSlice:  []interface{}{addr, &prefix},
+		InterfaceValues: map[string]interface{}{"a": addrPort},
+	}
+
+	actualMap, err := Marshal(&Options{}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	// sheriff must produce the same output as encoding/json for these types
+	expected, err := json.Marshal(v)
+	assert.NoError(t, err)
+
+	assert.JSONEq(t, string(expected), string(actual))
+	assert.Contains(t, string(actual), `"prefix":"2001:db8::/32"`)
+	assert.Contains(t, string(actual), `"addr_port":"[2001:db8::1]:8080"`)
+}
+
+func TestMarshal_NetipTopLevel(t *testing.T) {
+	prefix := netip.MustParsePrefix("10.0.0.0/8")
+	addrPort := netip.MustParseAddrPort("192.0.2.1:80")
+
+	for _, v := range []interface{}{prefix, &prefix, addrPort, netip.MustParseAddr("::1"), []netip.Prefix{prefix}} {
+		actualMap, err := Marshal(&Options{}, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		expected, err := json.Marshal(v)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual))
+	}
+}
+
+type StringerRootUser struct {
+	Name  string `json:"name" groups:"public"`
+	Email string `json:"email" groups:"private"`
+}
+
+func (u *StringerRootUser) String() string {
+	return u.Name
+}
+
+func TestMarshal_StringerRootIsFiltered(t *testing.T) {
+	user := &StringerRootUser{Name: "alice", Email: "a@x"}
+	options := &Options{Groups: []string{"public"}}
+	expected := map[string]interface{}{"name": "alice"}
+
+	// unlike netip values, structs with exported fields aren't left to their marshalers at the top level
+	v, err := Marshal(options, user)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, v)
+
+	b, err := MarshalAppend(nil, options, user)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"alice"}`, string(b))
+
+	all, err := MarshalAll(user, map[string]*Options{"public": options})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, all["public"])
+}
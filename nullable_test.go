@@ -0,0 +1,107 @@
+package sheriff
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// NullString mimics null.String of github.com/guregu/null, which embeds sql.NullString and
+// implements json.Marshaler with a value receiver.
+type NullString struct {
+	sql.NullString
+}
+
+func (s NullString) MarshalJSON() ([]byte, error) {
+	if !s.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(s.String)
+}
+
+// NullInt mimics null.Int of github.com/volatiletech/null, but implements json.Marshaler with
+// a pointer receiver like some other nullable types do.
+type NullInt struct {
+	sql.NullInt64
+}
+
+func (i *NullInt) MarshalJSON() ([]byte, error) {
+	if !i.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(i.Int64)
+}
+
+type NullableModel struct {
+	String          NullString            `json:"string"`
+	StringPtr       *NullString           `json:"string_ptr"`
+	Strings         []NullString          `json:"strings"`
+	StringMap       map[string]NullString `json:"string_map"`
+	StringInterface interface{}           `json:"string_interface"`
+	Int             NullInt               `json:"int"`
+	IntPtr          *NullInt              `json:"int_ptr"`
+	Ints            []NullInt             `json:"ints"`
+	IntMap          map[string]NullInt    `json:"int_map"`
+	IntInterface    interface{}           `json:"int_interface"`
+}
+
+func TestMarshal_NullableTypes(t *testing.T) {
+	str := NullString{sql.NullString{String: "a", Valid: true}}
+	i := NullInt{sql.NullInt64{Int64: 1, Valid: true}}
+
+	v := NullableModel{
+		String:          str,
+		StringPtr:       &str,
+		Strings:         []NullString{str, {}},
+		StringMap:       map[string]NullString{"a": str, "null": {}},
+		StringInterface: str,
+		Int:             i,
+		IntPtr:          &i,
+		Ints:            []NullInt{i, {}},
+		IntMap:          map[string]NullInt{"a": i, "null": {}},
+		IntInterface:    i,
+	}
+
+	actualMap, err := Marshal(&Options{}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(map[string]interface{}{
+		"string":           "a",
+		"string_ptr":       "a",
+		"strings":          []interface{}{"a", nil},
+		"string_map":       map[string]interface{}{"a": "a", "null": nil},
+		"string_interface": "a",
+		"int":              1,
+		"int_ptr":          1,
+		"ints":             []interface{}{1, nil},
+		"int_map":          map[string]interface{}{"a": 1, "null": nil},
+		"int_interface":    1,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual))
+}
+
+func TestMarshal_NullableTypesTopLevel(t *testing.T) {
+	i := NullInt{sql.NullInt64{Int64: 1, Valid: true}}
+
+	// passed to Marshal directly, they're filtered like any other struct
+	v, err := Marshal(&Options{}, &i)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Int64": int64(1), "Valid": true}, v)
+
+	// inside of a slice they're left to their marshalers
+	for _, v := range []interface{}{[]NullString{{sql.NullString{String: "a", Valid: true}}}, []*NullInt{&i}} {
+		actualMap, err := Marshal(&Options{}, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		expected, err := json.Marshal(v)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual))
+	}
+}
@@ -0,0 +1,159 @@
+package sheriff
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// ValidatePatch reports which parts of the JSON object patch (e.g. the body of a PATCH request) the caller with the
+// groups of options may not write to the struct type of prototype, which may be a pointer. It returns the dotted
+// paths of the keys which map to fields none of the caller's groups may write (see FieldGroups), and of the keys
+// which don't map to any field, sorted. Nothing is returned for patches the caller may apply as a whole:
+//
+//	rejected, err := sheriff.ValidatePatch(options, &User{}, body)
+//	if err != nil {
+//		// the patch isn't a JSON object, respond with 400
+//	}
+//	if len(rejected) > 0 {
+//		// respond with 403, naming the rejected paths
+//	}
+//
+// Keys are resolved like the output keys of Marshal, i.e. using the json tags, Options.UntaggedKeyStyle and the
+// fields of anonymous structs brought to the top. Groups of anonymous fields apply to their inner fields without
+// groups. Nested objects are resolved against the types of the fields, including the elements of slices, arrays
+// and maps, so e.g. `addresses.0.street` is rejected if the caller may write the addresses but not their streets.
+// The contents of rejected keys aren't reported, and neither are the ones of types which decode themselves
+// (i.e. implement json.Unmarshaler or encoding.TextUnmarshaler) or of interfaces.
+func ValidatePatch(options *Options, prototype interface{}, patch []byte) ([]string, error) {
+	t := reflect.TypeOf(prototype)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("marshaller: ValidatePatch of non-struct type %v", t)
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(patch, &object); err != nil {
+		return nil, err
+	}
+
+	s := acquireMarshalState(options)
+	defer s.release()
+	c := patchChecker{s: s}
+	c.object(t, object)
+	slices.Sort(c.rejected)
+	return c.rejected, nil
+}
+
+// patchChecker walks the patch passed to ValidatePatch.
+type patchChecker struct {
+	s        *marshalState
+	rejected []string
+}
+
+// patchField is a field a key of a patch may be resolved to.
+type patchField struct {
+	info *fieldInfo
+	// writeGroups are the groups of the field, or else the ones of the anonymous field holding it.
+	writeGroups []string
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// object checks the keys of the patch object against the fields of the struct type t.
+func (c *patchChecker) object(t reflect.Type, object map[string]interface{}) {
+	fields := make(map[string]patchField)
+	c.fields(t, nil, fields)
+	for key, value := range object {
+		c.s.pushKey(key)
+		f, ok := fields[key]
+		if !ok || f.writeGroups != nil && !c.s.matchesGroups(f.writeGroups, c.s.groups) {
+			c.rejected = append(c.rejected, c.s.currentPath())
+		} else {
+			c.value(f.info.field.Type, value)
+		}
+		c.s.pop()
+	}
+}
+
+// fields adds the fields of the struct type t to fields by their keys, unless the keys are taken already.
+// inherited are the write groups of the anonymous field t is held by.
+func (c *patchChecker) fields(t reflect.Type, inherited []string, fields map[string]patchField) {
+	infos := fieldInfosOf(t)
+	// like encoding/json, the fields of t take precedence over the ones of anonymous structs
+	var embedded []int
+	for i := range infos {
+		info := &infos[i]
+		if info.embedded {
+			embedded = append(embedded, i)
+			continue
+		}
+		if !info.field.IsExported() || info.jsonName == "-" {
+			continue
+		}
+		name := info.jsonName
+		if name == "" {
+			name = c.s.options.UntaggedKeyStyle.convert(info.field.Name)
+		}
+		if _, ok := fields[name]; ok {
+			continue
+		}
+		groups := info.writeGroups
+		if groups == nil {
+			groups = inherited
+		}
+		fields[name] = patchField{info: info, writeGroups: groups}
+	}
+
+	for _, i := range embedded {
+		info := &infos[i]
+		groups := info.writeGroups
+		if groups == nil {
+			groups = inherited
+		}
+		tt := info.field.Type
+		if tt.Kind() == reflect.Ptr {
+			tt = tt.Elem()
+		}
+		c.fields(tt, groups, fields)
+	}
+}
+
+// value checks the value of a patch against the type t of the field or element it's decoded into.
+func (c *patchChecker) value(t reflect.Type, value interface{}) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if pt := reflect.PointerTo(t); pt.Implements(jsonUnmarshalerType) || pt.Implements(textUnmarshalerType) {
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			c.object(t, value)
+		case reflect.Map:
+			for key, elem := range value {
+				c.s.pushKey(key)
+				c.value(t.Elem(), elem)
+				c.s.pop()
+			}
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for i, elem := range value {
+			c.s.pushIndex(i)
+			c.value(t.Elem(), elem)
+			c.s.pop()
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package sheriff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PatchAudit struct {
+	UpdatedBy string `json:"updated_by"`
+	Note      string `json:"note" groups:"user"`
+}
+
+type PatchAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street" groups:"owner"`
+}
+
+type PatchUser struct {
+	*PatchAudit `groups:"admin"`
+	ID          int                     `json:"id" groups:"user:r"`
+	Name        string                  `json:"name"`
+	Role        string                  `json:"role" groups:"user:r,admin"`
+	Email       string                  `json:"email" groups:"owner:w"`
+	Address     *PatchAddress           `json:"address"`
+	Addresses   []PatchAddress          `json:"addresses"`
+	ByLabel     map[string]PatchAddress `json:"by_label"`
+	Birthday    time.Time               `json:"birthday" groups:"owner"`
+	Extra       interface{}             `json:"extra"`
+	Ignored     string                  `json:"-"`
+	UntaggedKey string
+	internal    string
+}
+
+func TestValidatePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []string
+		patch    string
+		expected []string
+	}{
+		{
+			name:  "allowed",
+			patch: `{"name":"alice","address":{"city":"Berlin"},"addresses":[{"city":"Paris"}],"by_label":{"home":{"city":"Rome"}},"UntaggedKey":"x","extra":{"anything":1}}`,
+		},
+		{
+			name:     "read only and write only",
+			groups:   []string{"user"},
+			patch:    `{"id":1,"role":"admin","email":"a@example.org","name":"alice"}`,
+			expected: []string{"email", "id", "role"},
+		},
+		{
+			name:   "owner",
+			groups: []string{"owner"},
+			patch:  `{"email":"a@example.org","address":{"street":"Main St"},"addresses":[{"street":"Rue"}],"birthday":"2000-01-01T00:00:00Z"}`,
+		},
+		{
+			name:     "nested",
+			patch:    `{"address":{"city":"Berlin","street":"Main St","zip":"10115"},"addresses":[{"city":"Paris"},{"street":"Rue"}],"by_label":{"home":{"street":"Via"}},"birthday":{"wall":1}}`,
+			expected: []string{"address.street", "address.zip", "addresses.1.street", "birthday", "by_label.home.street"},
+		},
+		{
+			name:     "unknown",
+			patch:    `{"Ignored":"x","internal":"x","untagged_key":"x","Name":"x"}`,
+			expected: []string{"Ignored", "Name", "internal", "untagged_key"},
+		},
+		{
+			name:     "embedded groups",
+			groups:   []string{"user"},
+			patch:    `{"updated_by":"bob","note":"hi"}`,
+			expected: []string{"updated_by"},
+		},
+		{
+			name:   "embedded admin",
+			groups: []string{"admin"},
+			patch:  `{"updated_by":"bob","role":"admin"}`,
+		},
+		{
+			name:  "null",
+			patch: `null`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rejected, err := ValidatePatch(&Options{Groups: test.groups}, &PatchUser{}, []byte(test.patch))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, rejected)
+		})
+	}
+}
+
+func TestValidatePatch_UntaggedKeyStyle(t *testing.T) {
+	options := &Options{UntaggedKeyStyle: LowerFirstKeyStyle}
+	rejected, err := ValidatePatch(options, PatchUser{}, []byte(`{"untaggedKey":"x","UntaggedKey":"x"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"UntaggedKey"}, rejected)
+}
+
+func TestValidatePatch_Errors(t *testing.T) {
+	_, err := ValidatePatch(&Options{}, &PatchUser{}, []byte(`[{"name":"alice"}]`))
+	assert.Error(t, err)
+
+	_, err = ValidatePatch(&Options{}, &PatchUser{}, []byte(`{"name":`))
+	assert.Error(t, err)
+
+	_, err = ValidatePatch(&Options{}, []PatchUser{}, []byte(`{}`))
+	assert.EqualError(t, err, "marshaller: ValidatePatch of non-struct type []sheriff.PatchUser")
+
+	_, err = ValidatePatch(&Options{}, nil, []byte(`{}`))
+	assert.EqualError(t, err, "marshaller: ValidatePatch of non-struct type <nil>")
+}
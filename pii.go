@@ -0,0 +1,53 @@
+package sheriff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+)
+
+// parsePIITag parses the pii tag of the field of the struct type t. It returns whether the field is to be hashed
+// and an error if the field can't be hashed. Other values of the tag are left alone, as they may be used by
+// Options.TagPredicates.
+func parsePIITag(t reflect.Type, field reflect.StructField) (hash bool, err error) {
+	if field.Tag.Get("pii") != "hash" {
+		return false, nil
+	}
+	ft := field.Type
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	if ft.Kind() != reflect.String && !(ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Uint8) {
+		return false, fmt.Errorf("marshaller: pii tag of field %s of %s requires a string or []byte, not %s", field.Name, t, field.Type)
+	}
+	return true, nil
+}
+
+// hashPII returns the hash of the string or []byte v (possibly behind pointers) using Options.PIIHasher.
+// Nil pointers are kept as null.
+func (s *marshalState) hashPII(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || !v.IsValid() {
+		if !v.IsValid() || v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	var b []byte
+	if v.Kind() == reflect.String {
+		b = []byte(v.String())
+	} else {
+		b = v.Bytes()
+	}
+	hasher := s.options.PIIHasher
+	if hasher == nil {
+		hasher = sha256Hex
+	}
+	return reflect.ValueOf(hasher(b))
+}
+
+// sha256Hex is the default Options.PIIHasher.
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package sheriff
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PIIContact struct {
+	ID      int     `json:"id" groups:"analytics"`
+	Email   string  `json:"email" groups:"analytics" pii:"hash"`
+	Phone   *string `json:"phone,omitempty" groups:"analytics" pii:"hash"`
+	Token   []byte  `json:"token,omitempty" groups:"analytics" pii:"hash"`
+	Address string  `json:"address" groups:"admin" pii:"hash"`
+}
+
+func hmacHasher(key string) func([]byte) string {
+	return func(b []byte) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(b)
+		return hex.EncodeToString(mac.Sum(nil))[:8]
+	}
+}
+
+func TestMarshal_PII(t *testing.T) {
+	phone := "555-0100"
+	contact := PIIContact{ID: 1, Email: "alice@example.org", Phone: &phone, Token: []byte("t"), Address: "Main St"}
+
+	tests := []struct {
+		name     string
+		data     PIIContact
+		options  *Options
+		expected string
+	}{
+		{
+			name:    "sha-256",
+			data:    contact,
+			options: &Options{Groups: []string{"analytics"}},
+			expected: `{"email":"7a64adf28737ea90719cbdf0b1a87a5effff3753b79c91d717f4f4153ead0498","id":1,` +
+				`"phone":"6553afa64d1cd3aa6697b5947ff4e3389d237464e4cdcd1e7f83d2a40a5f348b",` +
+				`"token":"e3b98a4da31a127d4bde6e43033f66ba274cab0eb7eb1c70ec41402bf6273dd8"}`,
+		},
+		{
+			name:     "hasher",
+			data:     contact,
+			options:  &Options{Groups: []string{"analytics", "admin"}, PIIHasher: hmacHasher("k")},
+			expected: `{"address":"4cf30b91","email":"29beb0c8","id":1,"phone":"aa3cad39","token":"e7fcbc16"}`,
+		},
+		{
+			name:     "empty",
+			data:     PIIContact{ID: 2},
+			options:  &Options{Groups: []string{"analytics"}, PIIHasher: hmacHasher("k")},
+			expected: `{"email":"8bb990c4","id":2,"token":"8bb990c4"}`,
+		},
+		{
+			name:     "omit empty",
+			data:     PIIContact{ID: 2},
+			options:  &Options{Groups: []string{"analytics"}, PIIHasher: hmacHasher("k"), OmitEmptyPII: true},
+			expected: `{"email":"8bb990c4","id":2}`,
+		},
+		{
+			name:     "max string length",
+			data:     contact,
+			options:  &Options{Groups: []string{"analytics"}, PIIHasher: hmacHasher("k"), MaxStringLen: 2},
+			expected: `{"email":"29beb0c8","id":1,"phone":"aa3cad39","token":"e7fcbc16"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Marshal(test.options, test.data)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(test.data, map[string]*Options{"a": test.options, "b": {}})
+			assert.NoError(t, err)
+			assert.Equal(t, m, all["a"])
+		})
+	}
+}
+
+type PIIInvalidType struct {
+	Age int `json:"age" pii:"hash"`
+}
+
+func TestMarshal_PIIInvalidType(t *testing.T) {
+	_, err := Marshal(&Options{}, PIIInvalidType{})
+	assert.EqualError(t, err, "marshaller: pii tag of field Age of sheriff.PIIInvalidType requires a string or []byte, not int")
+}
+
+type PIINilPointer struct {
+	Email *string `json:"email" pii:"hash"`
+}
+
+func TestMarshal_PIINilPointer(t *testing.T) {
+	m, err := Marshal(&Options{}, PIINilPointer{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"email": nil}, m)
+}
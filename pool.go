@@ -0,0 +1,44 @@
+package sheriff
+
+import "sync"
+
+// statePool holds marshalStates which can be reused by subsequent calls, see acquireMarshalState.
+var statePool = sync.Pool{
+	New: func() interface{} {
+		return &marshalState{}
+	},
+}
+
+// acquireMarshalState returns a marshalState for options, taken from statePool unless Options.DisablePooling
+// is set. It must be released once the call is done.
+func acquireMarshalState(options *Options) *marshalState {
+	if options.DisablePooling {
+		return newMarshalState(options)
+	}
+	s := statePool.Get().(*marshalState)
+	s.init(options)
+	return s
+}
+
+// release resets s and puts it back into statePool. States which are not from the pool are left alone.
+func (s *marshalState) release() {
+	if s.options.DisablePooling {
+		return
+	}
+	// nothing of a previous call may be visible to the next one
+	clear(s.nestedGroupsMap)
+	// done frames aren't cleared while marshalling, but the pool mustn't keep the marshalled data alive
+	clear(s.frames[:s.maxFrames])
+	*s = marshalState{
+		nestedGroupsMap: s.nestedGroupsMap,
+		path:            s.path[:0],
+		keyBuf:          s.keyBuf[:0],
+		keyPath:         s.keyPath[:0],
+		frames:          s.frames[:0],
+		jsonKeys:        s.jsonKeys[:0],
+		appendFields:    s.appendFields[:0],
+		appendEntries:   s.appendEntries[:0],
+		textBuf:         s.textBuf[:0],
+	}
+	statePool.Put(s)
+}
@@ -0,0 +1,82 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// PoolPlainModel has an untagged field named like a field of UserPrivateInfo, which inherits the groups of
+// its embedding field in UserInfo.
+type PoolPlainModel struct {
+	Age string `json:"age"`
+}
+
+type PoolSmallModel struct {
+	Name  string `json:"name" groups:"public"`
+	Email string `json:"email" groups:"private"`
+}
+
+func TestMarshal_PoolingDoesNotLeakState(t *testing.T) {
+	info := UserInfo{
+		UserPrivateInfo: UserPrivateInfo{Age: "20"},
+		UserPublicInfo:  UserPublicInfo{ID: "F94", Email: "hello@hello.com"},
+	}
+	plain := PoolPlainModel{Age: "30"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_, err := Marshal(&Options{Groups: []string{"public"}}, info)
+				assert.NoError(t, err)
+
+				actual, err := Marshal(&Options{Groups: []string{"public"}}, plain)
+				assert.NoError(t, err)
+				assert.Equal(t, map[string]interface{}{"age": "30"}, actual)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMarshal_DisablePooling(t *testing.T) {
+	data := concurrencyData()
+	for _, groups := range [][]string{nil, {"public"}, {"admin"}} {
+		expectedMap, err := Marshal(&Options{Groups: groups}, data)
+		assert.NoError(t, err)
+		expected, err := json.Marshal(expectedMap)
+		assert.NoError(t, err)
+
+		actualMap, err := Marshal(&Options{Groups: groups, DisablePooling: true}, data)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+
+		assert.Equal(t, string(expected), string(actual), "%v", groups)
+	}
+}
+
+func benchmarkSmallModel(b *testing.B, o *Options) {
+	s := PoolSmallModel{Name: "alice", Email: "alice@example.org"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(o, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshal_SmallModel_Pooled(b *testing.B) {
+	benchmarkSmallModel(b, &Options{Groups: []string{"public"}})
+}
+
+func BenchmarkMarshal_SmallModel_Unpooled(b *testing.B) {
+	benchmarkSmallModel(b, &Options{Groups: []string{"public"}, DisablePooling: true})
+}
@@ -0,0 +1,133 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parsePrecisionTag parses the precision tag of the field of the struct type t, e.g. `precision:"2"`.
+// It returns -1 if there is none, and an error if it's invalid or the field isn't a float.
+func parsePrecisionTag(t reflect.Type, field reflect.StructField) (int, error) {
+	tag, ok := field.Tag.Lookup("precision")
+	if !ok {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(tag)
+	if err != nil || n < 0 {
+		return -1, fmt.Errorf("marshaller: invalid precision %q of field %s of %s", tag, field.Name, t)
+	}
+	if !isFloatType(field.Type) {
+		return -1, fmt.Errorf("marshaller: precision tag of field %s of %s requires a float, not %s", field.Name, t, field.Type)
+	}
+	return n, nil
+}
+
+// isFloatType reports whether t is a float32 or float64 type, or a pointer to one.
+func isFloatType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+// isPlainFloatType reports whether t is a float32 or float64 type without any of the interfaces looked for,
+// or a pointer to one.
+func isPlainFloatType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return isFloatType(t) && typeInfoOf(t).pointer == 0
+}
+
+// roundFloatValue rounds the float v (possibly behind pointers) to the given number of decimals, see roundFloat.
+// ok is false if v is a nil pointer or isn't finite, in which case it's left alone.
+func roundFloatValue(v reflect.Value, decimals int) (n json.Number, ok bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	return roundFloat(v.Float(), v.Type().Bits(), decimals)
+}
+
+// roundFloat formats f with exactly the given number of decimals. It's rounded half away from zero based on
+// the shortest decimal representation of f, so that e.g. 1.005 becomes 1.01 although the closest float64 is
+// slightly below it. ok is false if f is infinite or NaN.
+func roundFloat(f float64, bits int, decimals int) (n json.Number, ok bool) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	s := strconv.FormatFloat(f, 'f', -1, bits)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	integer, fraction, _ := strings.Cut(s, ".")
+
+	var digits []byte
+	if len(fraction) <= decimals {
+		digits = append([]byte(integer), fraction...)
+		for i := len(fraction); i < decimals; i++ {
+			digits = append(digits, '0')
+		}
+	} else {
+		digits = append([]byte(integer), fraction[:decimals]...)
+		if fraction[decimals] >= '5' {
+			digits = incrementDigits(digits)
+		}
+	}
+
+	zero := true
+	for _, d := range digits {
+		if d != '0' {
+			zero = false
+			break
+		}
+	}
+
+	var b strings.Builder
+	// negative zero is written as 0
+	if negative && !zero {
+		b.WriteByte('-')
+	}
+	b.Write(digits[:len(digits)-decimals])
+	if decimals > 0 {
+		b.WriteByte('.')
+		b.Write(digits[len(digits)-decimals:])
+	}
+	return json.Number(b.String()), true
+}
+
+// incrementDigits adds one to the decimal number digits.
+func incrementDigits(digits []byte) []byte {
+	for i := len(digits) - 1; i >= 0; i-- {
+		if digits[i] < '9' {
+			digits[i]++
+			return digits
+		}
+		digits[i] = '0'
+	}
+	return append([]byte{'1'}, digits...)
+}
+
+// isZeroNumber reports whether the formatted number n is zero.
+func isZeroNumber(n json.Number) bool {
+	return strings.Trim(string(n), "-0.") == ""
+}
+
+// fieldPrecision returns the number of decimals the field is rounded to, or -1 if it isn't rounded.
+func (s *marshalState) fieldPrecision(info *fieldInfo) int {
+	if info.precisionErr != nil {
+		return -1
+	}
+	if info.precision >= 0 {
+		return info.precision
+	}
+	if info.float && s.options.FloatPrecision > 0 {
+		return s.options.FloatPrecision
+	}
+	return -1
+}
@@ -0,0 +1,115 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundFloat(t *testing.T) {
+	tests := []struct {
+		f        float64
+		decimals int
+		expected string
+	}{
+		{19.899999999999999, 2, "19.90"},
+		{1.005, 2, "1.01"},
+		{1.015, 2, "1.02"},
+		{2.675, 2, "2.68"},
+		{-1.005, 2, "-1.01"},
+		{-0.004, 2, "0.00"},
+		{0.005, 2, "0.01"},
+		{9.995, 2, "10.00"},
+		{-9.5, 0, "-10"},
+		{0.5, 0, "1"},
+		{0.49, 0, "0"},
+		{42, 3, "42.000"},
+		{1e21, 1, "1000000000000000000000.0"},
+		{1.23456789e-7, 4, "0.0000"},
+	}
+	for _, test := range tests {
+		n, ok := roundFloat(test.f, 64, test.decimals)
+		assert.True(t, ok)
+		assert.Equal(t, json.Number(test.expected), n, "%v", test.f)
+	}
+
+	n, ok := roundFloat(float64(float32(0.1)), 32, 3)
+	assert.True(t, ok)
+	assert.Equal(t, json.Number("0.100"), n)
+
+	_, ok = roundFloat(math.Inf(1), 64, 2)
+	assert.False(t, ok)
+	_, ok = roundFloat(math.NaN(), 64, 2)
+	assert.False(t, ok)
+}
+
+type PrecisionPrice struct {
+	Amount   float64            `json:"amount" precision:"2"`
+	Rate     *float32           `json:"rate" precision:"1"`
+	Discount float64            `json:"discount,omitempty" precision:"2"`
+	Ratio    float64            `json:"ratio"`
+	History  []float64          `json:"history"`
+	Extra    map[string]float64 `json:"extra"`
+}
+
+func TestMarshal_Precision(t *testing.T) {
+	rate := float32(7.25)
+	v := PrecisionPrice{Amount: 19.899999999999999, Rate: &rate, Discount: 0.004, Ratio: 0.123456, History: []float64{1.005}, Extra: map[string]float64{"fee": -2.5}}
+
+	tests := []struct {
+		name     string
+		data     PrecisionPrice
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "tag",
+			data:     v,
+			options:  &Options{},
+			expected: `{"amount":19.90,"extra":{"fee":-2.5},"history":[1.005],"rate":7.3,"ratio":0.123456}`,
+		},
+		{
+			name:     "default",
+			data:     v,
+			options:  &Options{FloatPrecision: 3},
+			expected: `{"amount":19.90,"extra":{"fee":-2.500},"history":[1.005],"rate":7.3,"ratio":0.123}`,
+		},
+		{
+			name:     "omitempty",
+			data:     PrecisionPrice{Amount: -0.001, Discount: 0.005},
+			options:  &Options{},
+			expected: `{"amount":0.00,"discount":0.01,"extra":null,"history":null,"rate":null,"ratio":0}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Marshal(test.options, test.data)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(test.data, map[string]*Options{"a": test.options, "b": {}})
+			assert.NoError(t, err)
+			assert.Equal(t, m, all["a"])
+		})
+	}
+}
+
+type PrecisionInvalidType struct {
+	Count int `json:"count" precision:"2"`
+}
+
+type PrecisionInvalid struct {
+	Amount float64 `json:"amount" precision:"two"`
+}
+
+func TestMarshal_PrecisionInvalid(t *testing.T) {
+	_, err := Marshal(&Options{}, PrecisionInvalidType{})
+	assert.EqualError(t, err, "marshaller: precision tag of field Count of sheriff.PrecisionInvalidType requires a float, not int")
+
+	_, err = Marshal(&Options{}, PrecisionInvalid{})
+	assert.EqualError(t, err, `marshaller: invalid precision "two" of field Amount of sheriff.PrecisionInvalid`)
+}
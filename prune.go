@@ -0,0 +1,194 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Prune returns a deep copy of data with the same type, in which the fields Marshal would exclude by their groups
+// are set to their zero value, e.g. to pass the view of a caller on to typed code like templates or gRPC responses.
+// The group check is the same as Marshal's, including groups propagated from anonymous fields, Options.Authorizer
+// and groups_if tags.
+//
+// Pointers, slices, maps and interfaces are copied while recursing into them, so data is never modified. Arrays
+// are copied as is, as Marshal leaves them to encoding/json.
+// Fields are only zeroed because of their groups; e.g. omitempty or Options.OmitFields don't apply. Types implementing
+// Marshaller or any interface they are left to by Marshal (e.g. json.Marshaler, see Options.InterfacePreference)
+// marshal fields Prune doesn't know about, and are therefore copied shallowly without being pruned. The same applies
+// to unexported fields, apart from the ones of unexported anonymous structs, which encoding/json brings to the top.
+//
+// Errors of the tags are returned like Marshal does with FailFast, e.g. the ones of Options.StrictGroups.
+func Prune(options *Options, data interface{}) (interface{}, error) {
+	v := reflect.ValueOf(data)
+	if !v.IsValid() {
+		return nil, nil
+	}
+	s := acquireMarshalState(options)
+	defer s.release()
+	pruned, err := s.prune(v)
+	if err != nil {
+		return nil, err
+	}
+	return pruned.Interface(), nil
+}
+
+// prune returns a copy of v with the fields excluded by their groups set to their zero value.
+func (s *marshalState) prune(v reflect.Value) (reflect.Value, error) {
+	if err := s.checkDepth(); err != nil {
+		return v, err
+	}
+	if typeInfoOf(v.Type()).pointer&implMarshaller != 0 || isMarshalerRoot(s.options, v) {
+		return v, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := s.prune(v.Elem())
+		if err != nil {
+			return v, err
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(elem)
+		return p, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := s.prune(v.Elem())
+		if err != nil {
+			return v, err
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(elem)
+		return c, nil
+	case reflect.Struct:
+		return s.pruneStruct(v, nil)
+	case reflect.Slice:
+		if v.IsNil() {
+			return v, nil
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		return c, s.pruneElems(c, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return v, nil
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			s.pushKey(fmt.Sprint(iter.Key()))
+			value, err := s.prune(iter.Value())
+			s.pop()
+			if err != nil {
+				return v, err
+			}
+			c.SetMapIndex(iter.Key(), value)
+		}
+		return c, nil
+	}
+	return v, nil
+}
+
+// pruneElems sets the elements of the slice c to the pruned elements of v, which has the same length.
+func (s *marshalState) pruneElems(c, v reflect.Value) error {
+	// primitives have no fields to prune
+	if isPrimitiveKind(v.Type().Elem().Kind()) {
+		reflect.Copy(c, v)
+		return nil
+	}
+	for i := 0; i < v.Len(); i++ {
+		s.pushIndex(i)
+		elem, err := s.prune(v.Index(i))
+		s.pop()
+		if err != nil {
+			return err
+		}
+		c.Index(i).Set(elem)
+	}
+	return nil
+}
+
+// pruneStruct returns a copy of the struct v with the fields excluded by their groups set to their zero value.
+// inherited are the groups of the anonymous field v is held by, which apply to the fields without groups.
+func (s *marshalState) pruneStruct(v reflect.Value, inherited []string) (reflect.Value, error) {
+	t := v.Type()
+	c := reflect.New(t).Elem()
+	// unexported fields are copied as is
+	c.Set(v)
+
+	options := s.options
+	fields := fieldInfosOf(t)
+	for i := range fields {
+		info := &fields[i]
+		field := info.field
+		name, _, embedded := options.fieldKey(info)
+		if !field.IsExported() && !embedded {
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = options.UntaggedKeyStyle.convert(field.Name)
+		}
+		dst := c.Field(i)
+		if !dst.CanSet() {
+			// encoding/json brings the fields of unexported anonymous structs to the top, so they're pruned too
+			dst = reflect.NewAt(field.Type, unsafe.Pointer(dst.UnsafeAddr())).Elem()
+		}
+		if embedded {
+			// the copy is pruned instead of v's field, which may be unexported
+			src := dst
+			if src.Kind() == reflect.Ptr {
+				if src.IsNil() {
+					continue
+				}
+				src = src.Elem()
+			}
+			s.pushField(name, t)
+			pruned, err := s.pruneStruct(src, info.groups)
+			s.pop()
+			if err != nil {
+				return v, err
+			}
+			if dst.Kind() == reflect.Ptr {
+				dst.Set(reflect.New(src.Type()))
+				dst = dst.Elem()
+			}
+			dst.Set(pruned)
+			continue
+		}
+
+		groups := info.groups
+		if groups == nil {
+			groups = inherited
+		}
+		if options.StrictGroups {
+			for _, err := range []error{info.groupsErr, s.unknownGroupErr, info.unknownGroupErr} {
+				if err != nil {
+					return v, err
+				}
+			}
+		}
+		if info.groupsIfErr != nil {
+			return v, info.groupsIfErr
+		}
+		if !s.isVisible(t, field, groups) && !(info.groupsIf != nil && info.groupsIf.matches(v)) {
+			dst.SetZero()
+			continue
+		}
+
+		s.pushField(name, t)
+		pruned, err := s.prune(v.Field(i))
+		s.pop()
+		if err != nil {
+			return v, err
+		}
+		dst.Set(pruned)
+	}
+	return c, nil
+}
@@ -0,0 +1,174 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PruneAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street,omitempty" groups:"owner"`
+}
+
+type PruneAudit struct {
+	CreatedBy string `json:"created_by,omitempty"`
+}
+
+type pruneVersion struct {
+	Revision int `json:"revision,omitempty" groups:"admin"`
+}
+
+type PruneUser struct {
+	*PruneAudit `groups:"admin"`
+	Name        string                   `json:"name"`
+	Email       string                   `json:"email,omitempty" groups:"owner"`
+	Address     *PruneAddress            `json:"address,omitempty"`
+	Addresses   []PruneAddress           `json:"addresses"`
+	ByLabel     map[string]*PruneAddress `json:"by_label"`
+	Any         interface{}              `json:"any"`
+	Pair        [2]PruneAddress          `json:"pair"`
+	Tags        []string                 `json:"tags,omitempty" groups:"admin"`
+	Visibility  string                   `json:"visibility"`
+	Body        string                   `json:"body,omitempty" groups:"moderator" groups_if:"Visibility=public"`
+	internal    string
+}
+
+func newPruneUser() PruneUser {
+	return PruneUser{
+		PruneAudit: &PruneAudit{CreatedBy: "root"},
+		Name:       "alice",
+		Email:      "alice@example.org",
+		Address:    &PruneAddress{City: "Berlin", Street: "Main St"},
+		Addresses:  []PruneAddress{{City: "Paris", Street: "Rue"}},
+		ByLabel:    map[string]*PruneAddress{"home": {City: "Rome", Street: "Via"}, "none": nil},
+		Any:        PruneAddress{City: "Oslo", Street: "Gate"},
+		Pair:       [2]PruneAddress{{City: "Lima", Street: "Calle"}},
+		Tags:       []string{"vip"},
+		Visibility: "private",
+		Body:       "hello",
+		internal:   "kept",
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *Options
+	}{
+		{"anonymous", &Options{}},
+		{"owner", &Options{Groups: []string{"owner"}}},
+		{"admin", &Options{Groups: []string{"admin"}}},
+		{"moderator", &Options{Groups: []string{"moderator", "owner"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := newPruneUser()
+			pruned, err := Prune(test.options, &user)
+			assert.NoError(t, err)
+			assert.IsType(t, &PruneUser{}, pruned)
+
+			// the excluded fields are zero and omitted, so the output is the same as Marshal's
+			actual, err := json.Marshal(pruned)
+			assert.NoError(t, err)
+			v, err := Marshal(test.options, &user)
+			assert.NoError(t, err)
+			expected, err := json.Marshal(v)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(actual))
+
+			assert.Equal(t, "kept", pruned.(*PruneUser).internal)
+			assert.Equal(t, newPruneUser(), user)
+		})
+	}
+}
+
+func TestPrune_Copies(t *testing.T) {
+	user := newPruneUser()
+	pruned, err := Prune(&Options{Groups: []string{"owner", "admin", "moderator"}}, user)
+	assert.NoError(t, err)
+	p := pruned.(PruneUser)
+
+	// everything is visible, but nothing is shared with the input
+	assert.Equal(t, user, p)
+	assert.True(t, user.PruneAudit != p.PruneAudit)
+	assert.True(t, user.Address != p.Address)
+	assert.True(t, &user.Addresses[0] != &p.Addresses[0])
+	assert.True(t, user.ByLabel["home"] != p.ByLabel["home"])
+	assert.True(t, &user.Tags[0] != &p.Tags[0])
+
+	pruned, err = Prune(&Options{}, user)
+	assert.NoError(t, err)
+	p = pruned.(PruneUser)
+	assert.Equal(t, PruneAudit{}, *p.PruneAudit)
+	assert.Equal(t, PruneAddress{City: "Oslo"}, p.Any)
+	// arrays are left to encoding/json by Marshal
+	assert.Equal(t, PruneAddress{City: "Lima", Street: "Calle"}, p.Pair[0])
+	assert.Nil(t, p.ByLabel["none"])
+	assert.Nil(t, p.Tags)
+}
+
+type PruneVersioned struct {
+	pruneVersion
+	*prunePointerVersion
+}
+
+type prunePointerVersion struct {
+	Revision string `json:"pointer_revision,omitempty" groups:"admin"`
+}
+
+func TestPrune_UnexportedAnonymousFields(t *testing.T) {
+	data := PruneVersioned{pruneVersion{Revision: 3}, &prunePointerVersion{Revision: "r"}}
+	pruned, err := Prune(&Options{}, data)
+	assert.NoError(t, err)
+
+	// encoding/json outputs their fields, unlike Marshal
+	p := pruned.(PruneVersioned)
+	assert.Equal(t, PruneVersioned{pruneVersion{}, &prunePointerVersion{}}, p)
+	assert.Equal(t, "r", data.prunePointerVersion.Revision)
+
+	pruned, err = Prune(&Options{Groups: []string{"admin"}}, data)
+	assert.NoError(t, err)
+	assert.Equal(t, data, pruned)
+}
+
+type PruneMarshaller struct {
+	Secret string `json:"secret" groups:"admin"`
+}
+
+func (m PruneMarshaller) Marshal(options *Options) (interface{}, error) {
+	return map[string]interface{}{"custom": m.Secret}, nil
+}
+
+type PruneWithMarshaller struct {
+	Custom  *PruneMarshaller `json:"custom"`
+	Visible PruneAddress     `json:"visible"`
+}
+
+func TestPrune_Marshaller(t *testing.T) {
+	data := PruneWithMarshaller{Custom: &PruneMarshaller{Secret: "s"}, Visible: PruneAddress{City: "Kyiv", Street: "Vul"}}
+	pruned, err := Prune(&Options{}, data)
+	assert.NoError(t, err)
+
+	// Marshaller types are left intact, as the fields they marshal are unknown
+	p := pruned.(PruneWithMarshaller)
+	assert.True(t, data.Custom == p.Custom)
+	assert.Equal(t, PruneAddress{City: "Kyiv"}, p.Visible)
+}
+
+func TestPrune_Errors(t *testing.T) {
+	_, err := Prune(&Options{}, GroupsIfInvalidValue{})
+	assert.EqualError(t, err, `marshaller: invalid groups_if value "high" of field Body of sheriff.GroupsIfInvalidValue for int`)
+
+	_, err = Prune(&Options{StrictGroups: true}, []CheckMistakes{{}})
+	assert.EqualError(t, err, `marshaller: groups tag "api,,admin" of field Name of sheriff.CheckMistakes contains an empty group`)
+
+	pruned, err := Prune(&Options{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, pruned)
+
+	pruned, err = Prune(&Options{}, []int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, pruned)
+}
@@ -0,0 +1,36 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Raw wraps a value which is passed through as is, e.g. a sub-document which has already been filtered and
+// shaped. Its Value is neither traversed nor filtered by groups, nor are any options applied to it (e.g.
+// Options.MaxStringLen or Options.TraverseMarshalers); it's left to the final encoder, the same as if it was
+// marshalled by encoding/json directly.
+//
+// Raw can be used as a field value, a map value, a slice element and as the result of a Marshaller.
+type Raw struct {
+	Value interface{}
+}
+
+// MarshalJSON encodes r.Value using encoding/json, for Raw values which end up in an encoder as they are.
+func (r Raw) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Value)
+}
+
+var rawType = reflect.TypeOf(Raw{})
+
+// isRaw reports whether t is Raw or a pointer to it.
+func isRaw(t reflect.Type) bool {
+	return t == rawType || t.Kind() == reflect.Ptr && t.Elem() == rawType
+}
+
+// rawValue returns the value held by v if it's a Raw or a non-nil pointer to one.
+func rawValue(v reflect.Value) (value interface{}, ok bool) {
+	if !isRaw(v.Type()) {
+		return nil, false
+	}
+	return reflect.Indirect(v).Interface().(Raw).Value, true
+}
@@ -0,0 +1,77 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type RawStringer string
+
+func (RawStringer) String() string {
+	return "stringer"
+}
+
+type RawInner struct {
+	Public string `json:"public" groups:"api"`
+	Secret string `json:"secret" groups:"admin"`
+}
+
+type RawMarshaller struct{}
+
+func (RawMarshaller) Marshal(options *Options) (interface{}, error) {
+	return Raw{Value: map[string]interface{}{"computed": RawInner{Public: "p", Secret: "s"}}}, nil
+}
+
+type RawModel struct {
+	Field   Raw                    `json:"field" groups:"api"`
+	Pointer *Raw                   `json:"pointer" groups:"api"`
+	Map     map[string]interface{} `json:"map" groups:"api"`
+	Slice   []interface{}          `json:"slice" groups:"api"`
+	Custom  RawMarshaller          `json:"custom" groups:"api"`
+	Hidden  Raw                    `json:"hidden" groups:"admin"`
+}
+
+func TestMarshal_Raw(t *testing.T) {
+	inner := RawInner{Public: "p", Secret: "s"}
+	v := RawModel{
+		Field:   Raw{Value: inner},
+		Pointer: &Raw{Value: []string{"a", "b"}},
+		Map:     map[string]interface{}{"raw": Raw{Value: RawStringer("x")}, "filtered": inner},
+		Slice:   []interface{}{Raw{Value: inner}, &inner},
+		Hidden:  Raw{Value: "hidden"},
+	}
+	expected := `{"custom":{"computed":{"public":"p","secret":"s"}},"field":{"public":"p","secret":"s"},` +
+		`"map":{"filtered":{"public":"p"},"raw":"x"},"pointer":["a","b"],` +
+		`"slice":[{"public":"p","secret":"s"},{"public":"p"}]}`
+
+	optionSets := []*Options{
+		{Groups: []string{"api"}},
+		{Groups: []string{"api"}, TraverseMarshalers: true},
+		{Groups: []string{"api"}, InterfacePreference: []InterfaceKind{InterfaceStringer}},
+		{Groups: []string{"api"}, MaxSliceLen: 5, MaxStringLen: 100},
+	}
+	for _, options := range optionSets {
+		m, err := Marshal(options, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(m)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(actual))
+
+		all, err := MarshalAll(v, map[string]*Options{"a": options, "b": {}})
+		assert.NoError(t, err)
+		assert.Equal(t, m, all["a"])
+	}
+}
+
+func TestMarshal_RawRoot(t *testing.T) {
+	value := map[string]interface{}{"a": 1}
+	m, err := Marshal(&Options{TraverseMarshalers: true}, Raw{Value: value})
+	assert.NoError(t, err)
+	assert.Equal(t, value, m)
+
+	b, err := json.Marshal(Raw{Value: value})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(b))
+}
@@ -0,0 +1,107 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// fieldGroupsRegistry holds the groups registered using RegisterFieldGroups.
+var fieldGroupsRegistry = struct {
+	sync.RWMutex
+	types map[reflect.Type]map[string][]string
+	// version is incremented by every registration (including the ones of MustRegisterGroups), so that the fields
+	// cached by fieldInfosOf are parsed again.
+	version atomic.Uint64
+}{types: make(map[reflect.Type]map[string][]string)}
+
+// RegisterFieldGroups attaches groups to fields of the struct type t, which is useful for types one can't add
+// groups tags to, e.g. `gorm.Model`:
+//
+//	sheriff.RegisterFieldGroups(reflect.TypeOf(gorm.Model{}), map[string][]string{"DeletedAt": {"admin"}})
+//
+// The keys of groups are Go field names. The registered groups are used wherever t is marshalled (including
+// when it's embedded) for fields which don't have a groups tag of their own. Registering groups for an
+// anonymous struct field propagates them to the inner fields, the same as a groups tag does.
+// Registering a field again replaces its groups.
+//
+// RegisterFieldGroups is safe for concurrent use, but it's meant to be called during initialization.
+// It panics if t isn't a struct (or a pointer to one) or one of the field names doesn't exist in t.
+func RegisterFieldGroups(t reflect.Type, groups map[string][]string) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("sheriff: RegisterFieldGroups of non-struct type %s", t))
+	}
+	for name := range groups {
+		if _, ok := t.FieldByName(name); !ok {
+			panic(fmt.Sprintf("sheriff: RegisterFieldGroups of unknown field %s of %s", name, t))
+		}
+	}
+
+	fieldGroupsRegistry.Lock()
+	defer fieldGroupsRegistry.Unlock()
+	fields := fieldGroupsRegistry.types[t]
+	if fields == nil {
+		fields = make(map[string][]string, len(groups))
+		fieldGroupsRegistry.types[t] = fields
+	}
+	for name, g := range groups {
+		fields[name] = append([]string(nil), normalizeGroups(g)...)
+	}
+	fieldGroupsRegistry.version.Add(1)
+}
+
+// fieldGroups returns the groups which may read the field of the struct type t, taken from its groups tag
+// or else from the registry. It returns nil if the field has no groups, and an empty slice if none of its
+// groups may read it. The returned slice may be modified. If strict is set, an InvalidGroupsTagError
+// is returned for tags containing empty groups.
+func fieldGroups(t reflect.Type, field reflect.StructField, strict bool) ([]string, error) {
+	return fieldGroupsWith(t, field, AccessRead, strict)
+}
+
+// fieldGroupsWith returns the groups with the given access to the field of the struct type t, like fieldGroups
+// does for reading.
+func fieldGroupsWith(t reflect.Type, field reflect.StructField, access Access, strict bool) ([]string, error) {
+	entries, err := fieldGroupEntries(t, field, strict)
+	if entries == nil || err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entryAccess := parseGroupAccess(entry); entryAccess.Access&access != 0 {
+			groups = append(groups, entryAccess.Group)
+		}
+	}
+	return groups, nil
+}
+
+// fieldGroupEntries returns the normalized, but otherwise unparsed entries of the groups of the field
+// of the struct type t, nil if it has none.
+func fieldGroupEntries(t reflect.Type, field reflect.StructField, strict bool) ([]string, error) {
+	if tag := field.Tag.Get(tagName); tag != "" {
+		groups := strings.Split(tag, ",")
+		if strict {
+			for _, group := range groups {
+				if strings.TrimSpace(group) == "" {
+					return nil, InvalidGroupsTagError{Type: t, Field: field.Name, Tag: tag}
+				}
+			}
+		}
+		if groups = normalizeGroups(groups); len(groups) == 0 {
+			return nil, nil
+		}
+		return groups, nil
+	}
+
+	fieldGroupsRegistry.RLock()
+	defer fieldGroupsRegistry.RUnlock()
+	groups, ok := fieldGroupsRegistry.types[t][field.Name]
+	if !ok || len(groups) == 0 {
+		return nil, nil
+	}
+	return groups, nil
+}
@@ -0,0 +1,137 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RegistryBaseModel mimics gorm.Model, a type which can't be tagged with groups.
+type RegistryBaseModel struct {
+	ID        uint
+	CreatedAt time.Time
+	DeletedAt *time.Time
+}
+
+type RegistryUser struct {
+	RegistryBaseModel
+	Name string `json:"name"`
+}
+
+type RegistryAccount struct {
+	Base  RegistryBaseModel `json:"base"`
+	Owner RegistryUser      `json:"owner"`
+}
+
+func init() {
+	RegisterFieldGroups(reflect.TypeOf(RegistryBaseModel{}), map[string][]string{
+		"DeletedAt": {"admin"},
+	})
+	RegisterFieldGroups(reflect.TypeOf(&RegistryAccount{}), map[string][]string{
+		"Base": {"admin", "owner"},
+	})
+}
+
+func TestRegisterFieldGroups(t *testing.T) {
+	createdAt, err := time.Parse(time.RFC3339, "2017-01-20T18:11:00Z")
+	assert.NoError(t, err)
+	base := RegistryBaseModel{ID: 1, CreatedAt: createdAt, DeletedAt: &createdAt}
+	v := RegistryAccount{
+		Base:  base,
+		Owner: RegistryUser{RegistryBaseModel: base, Name: "alice"},
+	}
+
+	actualMap, err := Marshal(&Options{}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"owner":{"CreatedAt":"2017-01-20T18:11:00Z","ID":1,"name":"alice"}}`, string(actual))
+
+	actualMap, err = Marshal(&Options{Groups: []string{"admin"}}, v)
+	assert.NoError(t, err)
+	actual, err = json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"base":{"CreatedAt":"2017-01-20T18:11:00Z","DeletedAt":"2017-01-20T18:11:00Z","ID":1},"owner":{"CreatedAt":"2017-01-20T18:11:00Z","DeletedAt":"2017-01-20T18:11:00Z","ID":1,"name":"alice"}}`, string(actual))
+}
+
+type RegistryTagged struct {
+	Name string `json:"name" groups:"public"`
+}
+
+type RegistryEmbedding struct {
+	RegistryTagged
+	RegistryBaseModel
+}
+
+func TestRegisterFieldGroups_TagWins(t *testing.T) {
+	RegisterFieldGroups(reflect.TypeOf(RegistryTagged{}), map[string][]string{"Name": {"admin"}})
+	RegisterFieldGroups(reflect.TypeOf(RegistryEmbedding{}), map[string][]string{"RegistryBaseModel": {"admin"}})
+
+	v := RegistryEmbedding{RegistryTagged{Name: "alice"}, RegistryBaseModel{ID: 1}}
+
+	actualMap, err := Marshal(&Options{Groups: []string{"public"}}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	// the groups registered for the embedded field propagate to the inner fields
+	assert.Equal(t, `{"name":"alice"}`, string(actual))
+}
+
+type RegistryReregistered struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func TestRegisterFieldGroups_AfterMarshal(t *testing.T) {
+	v := RegistryReregistered{Name: "alice", Email: "alice@example.org"}
+	options := &Options{Groups: []string{"public"}}
+
+	actual, err := Marshal(options, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "alice", "email": "alice@example.org"}, actual)
+
+	// the fields parsed by the first call aren't used anymore
+	RegisterFieldGroups(reflect.TypeOf(v), map[string][]string{"Email": {"admin"}})
+	actual, err = Marshal(options, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "alice"}, actual)
+}
+
+func TestRegisterFieldGroups_Panics(t *testing.T) {
+	assert.Panics(t, func() {
+		RegisterFieldGroups(reflect.TypeOf(""), map[string][]string{"Name": {"admin"}})
+	})
+	assert.Panics(t, func() {
+		RegisterFieldGroups(reflect.TypeOf(RegistryTagged{}), map[string][]string{"Unknown": {"admin"}})
+	})
+}
+
+type RegistryConcurrent struct {
+	A string
+	B string
+}
+
+func TestRegisterFieldGroups_Concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterFieldGroups(reflect.TypeOf(RegistryConcurrent{}), map[string][]string{"A": {"admin"}})
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := Marshal(&Options{}, RegistryConcurrent{A: "a", B: "b"})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	actual, err := Marshal(&Options{}, RegistryConcurrent{A: "a", B: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"B": "b"}, actual)
+}
@@ -0,0 +1,79 @@
+package sheriff
+
+import (
+	"strings"
+	"sync"
+)
+
+// ScopeMapper maps OAuth 2.0 scopes, e.g. the scope claim of a JWT, to groups:
+//
+//	var scopes sheriff.ScopeMapper
+//	scopes.Register("users:read", "user")
+//	scopes.Register("users:admin", "user", "admin")
+//	...
+//	data, err := sheriff.Marshal(scopes.OptionsForScope(claims.Scope), user)
+//
+// It doesn't parse or verify tokens; callers hand it the scopes of tokens they've already verified.
+// The zero value is ready to use. A ScopeMapper is safe for concurrent use, but mustn't be copied after first use.
+type ScopeMapper struct {
+	// OnUnknown is called for every scope passed to GroupsFor which isn't registered. Unknown scopes are ignored
+	// if it's nil.
+	OnUnknown func(scope string)
+
+	mu     sync.RWMutex
+	groups map[string][]string
+}
+
+// Register maps scope to groups. Registering a scope again adds the groups to the ones it already maps to.
+// A scope registered without groups is known, but grants none.
+func (m *ScopeMapper) Register(scope string, groups ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groups == nil {
+		m.groups = make(map[string][]string)
+	}
+	m.groups[scope] = append(m.groups[scope], normalizeGroups(groups)...)
+}
+
+// GroupsFor returns the groups the given scopes map to, in the order of the scopes and without duplicates,
+// e.g. if several scopes map to the same group. It returns nil if they map to no groups.
+func (m *ScopeMapper) GroupsFor(scopes []string) []string {
+	var groups []string
+	seen := make(map[string]struct{})
+	for _, scope := range scopes {
+		// the lock isn't held while calling OnUnknown, which may register the scope
+		m.mu.RLock()
+		mapped, ok := m.groups[scope]
+		m.mu.RUnlock()
+		if !ok {
+			if m.OnUnknown != nil {
+				m.OnUnknown(scope)
+			}
+			continue
+		}
+		for _, group := range mapped {
+			if _, ok := seen[group]; !ok {
+				seen[group] = struct{}{}
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups
+}
+
+// OptionsFor returns new Options whose groups are the ones the given scopes map to, see GroupsFor.
+func (m *ScopeMapper) OptionsFor(scopes []string) *Options {
+	return &Options{Groups: m.GroupsFor(scopes)}
+}
+
+// OptionsForScope returns new Options whose groups are the ones the space-delimited scope string maps to,
+// see ParseScope.
+func (m *ScopeMapper) OptionsForScope(scope string) *Options {
+	return m.OptionsFor(ParseScope(scope))
+}
+
+// ParseScope splits the value of an OAuth 2.0 scope parameter or claim into its scopes, which are delimited
+// by spaces as defined by RFC 6749, section 3.3. Repeated spaces don't result in empty scopes.
+func ParseScope(scope string) []string {
+	return strings.FieldsFunc(scope, func(r rune) bool { return r == ' ' })
+}
@@ -0,0 +1,49 @@
+package sheriff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ScopedUser struct {
+	Name  string `json:"name" groups:"user"`
+	Email string `json:"email" groups:"admin"`
+	Notes string `json:"notes" groups:"support"`
+}
+
+func TestScopeMapper(t *testing.T) {
+	var scopes ScopeMapper
+	scopes.Register("users:read", "user")
+	scopes.Register("users:admin", "user", " admin ")
+	scopes.Register("tickets", "support", "user")
+	scopes.Register("openid")
+
+	assert.Equal(t, []string{"user", "admin", "support"}, scopes.GroupsFor([]string{"users:read", "users:admin", "tickets"}))
+	assert.Equal(t, []string{"user"}, scopes.GroupsFor([]string{"users:read", "openid", "unknown"}))
+	assert.Nil(t, scopes.GroupsFor([]string{"openid"}))
+	assert.Nil(t, scopes.GroupsFor(nil))
+
+	scopes.Register("users:read", "admin")
+	assert.Equal(t, []string{"user", "admin"}, scopes.GroupsFor([]string{"users:read"}))
+
+	data, err := Marshal(scopes.OptionsForScope("tickets  openid"), ScopedUser{Name: "alice", Email: "alice@example.org", Notes: "vip"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "alice", "notes": "vip"}, data)
+}
+
+func TestScopeMapper_OnUnknown(t *testing.T) {
+	var unknown []string
+	scopes := ScopeMapper{OnUnknown: func(scope string) { unknown = append(unknown, scope) }}
+	scopes.Register("openid")
+	scopes.Register("users:read", "user")
+
+	assert.Equal(t, &Options{Groups: []string{"user"}}, scopes.OptionsFor([]string{"email", "openid", "users:read", "profile"}))
+	assert.Equal(t, []string{"email", "profile"}, unknown)
+}
+
+func TestParseScope(t *testing.T) {
+	assert.Equal(t, []string{"openid", "users:read", "tickets"}, ParseScope(" openid users:read  tickets "))
+	assert.Empty(t, ParseScope(""))
+	assert.Empty(t, ParseScope("   "))
+}
@@ -1,19 +1,32 @@
 package sheriff
 
 import (
+	"context"
+	"database/sql/driver"
 	"encoding"
-	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-var tagName = "groups"
+const tagName = "groups"
 
-// JSON marshals the object based on groups and wrap with root if specified
+// DefaultMaxDepth is the maximum nesting depth used if Options.MaxDepth is not set.
+const DefaultMaxDepth = 10000
+
+// JSON marshals the object based on groups and wrap with root if specified.
+// If groups is empty, the options set by SetDefault are used.
 func JSON(data interface{}, root string, groups string) interface{} {
-	intermediate, err := Marshal(&Options{Groups: strings.Split(groups, ",")}, data)
+	options := getDefault()
+	if groups != "" {
+		options = &Options{Groups: splitGroups(groups)}
+	}
+	intermediate, err := Marshal(options, data)
 	if err != nil {
 		panic(err)
 	}
@@ -32,23 +45,431 @@ type Options struct {
 	// Groups determine which fields are getting marshalled based on the groups tag.
 	// A field with multiple groups (comma-separated) will result in marshalling of that
 	// field if one of their groups is specified.
+	// Spaces around group names are ignored and empty groups dropped, both here and in tags.
 	Groups []string
+	// GroupMatcher determines whether a requested group matches a group of a tag, e.g. CaseInsensitiveGroups
+	// or GlobGroups. It applies to the groups propagated from anonymous fields and to OmitEmptyGroups alike.
+	// If it's nil, ExactGroups is used.
+	GroupMatcher GroupMatcher
 
-	// This is used internally so that we can propagate anonymous fields groups tag to all child field.
-	nestedGroupsMap map[string][]string
+	// Authorizer decides which fields with groups are visible to Subject, the identity of the caller, e.g. by
+	// asking a policy engine. AuthorizerMode determines whether it replaces the check of Groups (the default),
+	// grants access beyond it or restricts it. Fields without groups aren't affected.
+	Authorizer     Authorizer
+	Subject        interface{}
+	AuthorizerMode AuthorizerMode
+
+	// OmitEmptyGroups restricts the omitempty json option to the given groups: if set, omitempty is only honored
+	// if at least one of these groups is among Groups, otherwise empty fields are marshalled too. If the requested
+	// Groups contain both listed and unlisted groups, omitempty is honored.
+	OmitEmptyGroups []string
+
+	// TagPredicates filter fields by arbitrary tags in addition to groups: a field carrying one of the tag keys
+	// is only marshalled if the predicate returns true for the tag's value, e.g. to drop fields tagged `pii:"true"`
+	// from exports. Fields without the tag are not affected. A predicate on an anonymous struct field applies to
+	// all of its fields.
+	TagPredicates map[string]func(tagValue string) bool
+
+	// MaxRenderDepth limits how many levels of structs are rendered, e.g. for shallow list responses. The marshalled
+	// struct is the first level; every nested struct, slice and map adds a level (anonymous structs brought to the
+	// top don't). Structs beyond the limit are replaced by null, or omitted if OmitDepthOverflow is set, or
+	// replaced by an object containing only the field named DepthOverflowField if it's set. Structs which are
+	// elements of slices or maps are never omitted, but replaced by null instead. If zero, all levels are rendered.
+	MaxRenderDepth int
+	// DepthOverflowField is the output key of the field (e.g. "id") structs beyond MaxRenderDepth are reduced to.
+	// If the struct doesn't have such a field (or it's excluded by groups), it's treated as if no field was set.
+	DepthOverflowField string
+	// OmitDepthOverflow omits struct fields beyond MaxRenderDepth instead of setting them to null.
+	OmitDepthOverflow bool
+
+	// MaxSliceLen and MaxMapLen limit the number of elements of slices and maps (including the ones returned by
+	// a Marshaller) which are marshalled, to protect against pathologically large data. If a slice or map
+	// is longer, a LengthError is returned, unless TruncateOverflow is set. If zero, the length is unlimited.
+	MaxSliceLen int
+	MaxMapLen   int
+	// TruncateOverflow truncates slices and maps longer than MaxSliceLen or MaxMapLen instead of returning an error.
+	// Slices keep their first elements, maps the entries with the lowest keys.
+	TruncateOverflow bool
+	// OverflowKey marks truncated slices and maps if set: a map gets an entry with this key and the number of dropped
+	// entries as value, a slice gets an additional element being such a map, e.g. `{"…": 42}`. Slices and maps
+	// returned by a Marshaller are only marked if they are []interface{} or map[string]interface{}.
+	OverflowKey string
+
+	// OmitFields drops the keys of struct fields and map entries listed, after the group filtering. An entry is
+	// either a key (e.g. `password_hash`) or a dotted path of keys (e.g. `user.password_hash`, leaving out slice
+	// indexes), which matches wherever the path of a key ends with it, at any depth. Entries starting with `$.`
+	// (e.g. `$.user.password_hash`) only match the path from the top level.
+	OmitFields []string
+	// OnlyFields keeps only the keys of struct fields and map entries listed, after the group filtering, using the
+	// same entries as OmitFields. A matched key is kept with everything within it, as are the keys leading to a
+	// dotted path. A key only matching deeper down isn't reached if its parent's key isn't kept. OmitFields wins
+	// over OnlyFields.
+	OnlyFields []string
+
+	// Expand lists the dotted paths of fields tagged with `sheriff:"ref=<key>"` which are rendered fully. Such
+	// fields are rendered as references by default: a struct is replaced by the value of its field whose json
+	// name is the given key (e.g. `sheriff:"ref=id"`), a slice or map of structs by a slice or map of them.
+	// The paths consist of the keys of the fields, without slice indexes or map keys, e.g. `invoice.customer`
+	// or `lines.product` for the product of every line. Expanding a path expands the fields leading to it too.
+	Expand []string
+	// ReferenceObjects renders references as objects holding only the referencing field, e.g. `{"id": 42}`,
+	// instead of its bare value.
+	ReferenceObjects bool
+
+	// TypeField is the key of a type discriminator added to structs held by interfaces (e.g. the elements of
+	// a []Animal or the values of a map[string]interface{}), so that consumers can tell their concrete types
+	// apart. Its value is the short name of the type (e.g. `Dog`) or the one registered using RegisterTypeName.
+	// Structs within fields, slices and maps of concrete types don't get it. A TypeFieldError is returned if
+	// the struct already has the key.
+	TypeField string
+
+	// MaxStringLen truncates strings to the given number of runes and appends a marker like `…(truncated 10243 bytes)`,
+	// e.g. to keep log payloads small. Fields can override it with the `sheriff:"maxlen=N"` tag, which applies to
+	// the strings within the field's value too (e.g. slice elements or map values); `maxlen=0` disables truncation.
+	// If zero, strings are only truncated within fields having the tag.
+	MaxStringLen int
+
+	// PIIHasher replaces the values of string and []byte fields tagged `pii:"hash"`, e.g. with a keyed hash using
+	// HMAC, so that exported records stay joinable without being readable. The fields are hashed once they passed
+	// the group check; nil pointers are kept as null. Tagging fields of other types results in an error.
+	// If it's nil, the hex-encoded SHA-256 digest is used.
+	PIIHasher func([]byte) string
+	// OmitEmptyPII makes omitempty drop empty fields tagged `pii:"hash"`. By default, the hash of an empty value
+	// counts as non-empty, so only nil pointers are omitted.
+	OmitEmptyPII bool
+	// EnableMasking masks the values of string fields tagged `mask:"<strategy>"` (e.g. `mask:"last4"`), see
+	// RegisterMask. It's disabled by default, so that internal tooling can see the raw values using the same
+	// structs. Fields tagged `pii:"hash"` are hashed instead.
+	EnableMasking bool
+
+	// TimeLocation converts every time.Time (and pointer to one) to the given location before it's marshalled,
+	// which changes the offset of its RFC 3339 representation, e.g. to `-04:00` for `America/New_York`.
+	// Zero times are left alone, so that omitempty and IsZero still see them as zero.
+	TimeLocation *time.Location
+
+	// FloatPrecision rounds every float to the given number of decimals (half away from zero) and outputs it as
+	// json.Number with exactly that many decimals, so that trailing zeros are kept (e.g. `19.90`). Fields can
+	// override it with the `precision:"N"` tag; `precision:"0"` rounds to integers. If zero, floats are only
+	// rounded within fields having the tag. With omitempty, fields which round to zero are omitted.
+	FloatPrecision int
+
+	// Int64AsString outputs integers of 64 bits, i.e. int64, uint64 and on 64-bit platforms int and uint, as decimal
+	// strings (e.g. `"9223372036854775807"`), as JavaScript clients lose precision beyond 2^53. Types implementing
+	// one of the interfaces looked for are left alone. omitempty decides on the integer, so fields which are 0 are
+	// still omitted, while their string "0" is output without omitempty.
+	Int64AsString bool
+
+	// MapKeyFilter decides which entries of maps are marshalled, as map entries can't be tagged with groups. It's
+	// called with the dotted path of the map (e.g. `user.attributes`) and the key converted to a string; entries
+	// for which it returns false are dropped. A map without any entries left is still marshalled as an empty object.
+	MapKeyFilter func(path string, key string) bool
+
+	// PreserveMapKeyTypes keeps the keys of maps whose keys aren't strings (e.g. map[int]T) as they are instead of
+	// converting them to strings, for encoders supporting such keys, e.g. CBOR or MessagePack. Such maps result in
+	// a map[interface{}]interface{}, which can't be encoded as JSON: MarshalAppend and the functions encoding JSON
+	// return ErrPreservedMapKeys instead. Map keys still have to be supported by Marshal, and inline maps are
+	// still converted, as their entries are merged into an object.
+	PreserveMapKeyTypes bool
+
+	// UntaggedKeyStyle converts the output keys of fields without a json name, which are the Go field names by default.
+	UntaggedKeyStyle KeyStyle
+
+	// KeyTag is the struct tag the output keys and the omitempty option are taken from instead of the json tag, e.g.
+	// "toml" to write filtered configuration with the toml tags of the structs. Fields without the tag are keyed by
+	// their Go name like untagged fields are. As TOML has no null, "toml" also makes Marshal omit the fields and map
+	// entries which would be null, including the ones of ExcludedAsNull; elements of slices are kept. If empty,
+	// "json" is used.
+	KeyTag string
+
+	// DisablePooling makes every call allocate its own internal state instead of reusing it from a pool.
+	// It only exists for debugging, output doesn't depend on it.
+	DisablePooling bool
+
+	// StrictGroups makes Marshal return an InvalidGroupsTagError for groups tags containing empty groups
+	// (e.g. `groups:"a,,b"`) instead of ignoring them. If groups have been registered using MustRegisterGroups,
+	// it also returns an UnknownGroupError for groups of tags or of Groups which aren't registered.
+	StrictGroups bool
+
+	// TraverseMarshalers makes sheriff recurse into structs implementing json.Marshaler, encoding.TextMarshaler,
+	// encoding.TextAppender or fmt.Stringer and apply the group filtering to their fields instead of leaving them to their own
+	// marshalling. The custom formatting of such types is lost for the whole subtree. Structs without exported
+	// fields (e.g. time.Time) are still left to their marshalling, as traversing them would result in an empty
+	// object. Use the `sheriff:"traverse"` field tag to enable this for single fields only.
+	TraverseMarshalers bool
+
+	// OmitEmptyNested drops the key of a nested struct or map field if nothing is left in it after filtering,
+	// instead of emitting an empty object. As nested fields are marshalled first, a chain of empty structs
+	// collapses completely.
+	OmitEmptyNested bool
+
+	// InlineMapsWin makes the entries of map fields with the `sheriff:"inline"` tag replace the keys of the declared
+	// fields of the struct they're merged into. By default, the declared fields win.
+	InlineMapsWin bool
+
+	// ExtraOverwrites makes the extras passed to MarshalWith replace the keys of the struct's fields, instead of
+	// resulting in an ExtraKeyError.
+	ExtraOverwrites bool
+
+	// DebugMetaKey adds the filtering which was applied to the top-level object under this key (e.g. `_sheriff`),
+	// to tell from logged payloads why they look the way they do. It holds the requested groups and, if set,
+	// OmitFields and OnlyFields. If the top level isn't an object, nothing is added; if it already has the key,
+	// an ExtraKeyError is returned. Disabled if empty.
+	DebugMetaKey string
+
+	// CacheKeyer enables caching the results of Marshal and MarshalAppend for data which doesn't change, e.g. reference
+	// data loaded at startup. It's called with the data passed in; if it returns ok, the result is cached under the key,
+	// the type of the data and the options, and returned from the cache by later calls for the same key, type and
+	// options. The order and duplicates of Groups don't matter, and options not affecting the output (e.g.
+	// Instrumentation and OnExcluded) are ignored. Nothing is cached with options which can't be compared, i.e. a
+	// non-nil Authorizer, PIIHasher, MapKeyFilter, TagPredicates, GroupMatcherFunc or FieldNamerFunc. The results of
+	// Marshal are copied when they're returned, so modifying them doesn't affect the cache. Results are only cached if
+	// no error occurred.
+	CacheKeyer func(v interface{}) (key string, ok bool)
+	// OutputCache holds the results cached because of CacheKeyer, e.g. to invalidate them. If nil,
+	// DefaultOutputCache is used.
+	OutputCache *OutputCache
+
+	// MaxDepth is the maximum nesting depth of structs, slices and maps which will be marshalled.
+	// Deeper data results in a MaxDepthError instead of exhausting the stack.
+	// If zero, DefaultMaxDepth is used.
+	MaxDepth int
+
+	// ErrOnDuplicateKeys makes Marshal return a DuplicateKeyError if two fields of a struct end up with the same
+	// output key, e.g. through json tags or embedded structs, instead of silently overwriting the first one.
+	// As only marshalled fields are considered, collisions which only occur for particular groups are detected too.
+	ErrOnDuplicateKeys bool
+
+	// ErrorPolicy determines whether marshalling stops at the first value which fails to marshal (the default),
+	// or goes on without it, e.g. for exports which shouldn't fail because of a single bad element. Errors of the
+	// marshalled value itself (e.g. if it implements Marshaller) are always returned as is.
+	ErrorPolicy ErrorPolicy
+
+	// TreatZeroStructsAsEmpty makes omitempty omit struct values which are zero, the same way nil struct pointers
+	// are omitted. If the struct type has an `IsZero() bool` method (e.g. time.Time), it decides instead.
+	TreatZeroStructsAsEmpty bool
+
+	// FlatSeparator separates the segments of the keys produced by MarshalFlat. If empty, "." is used.
+	FlatSeparator string
+
+	// ValuesNotation determines how MarshalValues builds the keys of nested objects.
+	ValuesNotation ValuesNotation
+
+	// EnvSliceSeparator joins the elements of slices exported by MarshalEnv, e.g. ",". If empty, slices result in
+	// an error.
+	EnvSliceSeparator string
+
+	// OnLineError makes EncodeLines skip elements which fail to marshal instead of aborting. It's called with
+	// the error of every skipped element.
+	OnLineError func(err LineError)
+
+	// ExcludedAsNull makes fields which are excluded by the group check show up with a null value instead of
+	// being dropped, so that every key is always present. Fields skipped for other reasons (`json:"-"`,
+	// omitempty or unexported fields) are still dropped. Redaction wins over the null: with EnableMasking, excluded
+	// fields with a mask tag show up with their masked value instead.
+	ExcludedAsNull bool
+
+	// OnExcluded is called for every field which is excluded by the group check, e.g. to keep an audit trail of
+	// withheld fields. It receives the dotted path of the field (same as in errors, i.e. including the names of
+	// embedded structs and slice indexes), the struct field and the groups it requires. Fields of slice elements
+	// are reported once per element. It's not called for fields skipped for other reasons (`json:"-"`, omitempty
+	// or unexported fields), nor for fields within excluded fields.
+	OnExcluded func(path string, field reflect.StructField, groups []string)
+
+	// OnDeprecated is called for every field tagged as deprecated (e.g. `deprecated:"use full_name"`) which is
+	// emitted, i.e. which passed the json tag, omitempty and group checks, e.g. to find out which clients still
+	// receive such fields. It receives the dotted path of the field like OnExcluded does and the note of the tag.
+	// Fields of slice elements are reported once per element. Results returned from the cache of CacheKeyer don't
+	// report their fields again.
+	OnDeprecated func(path string, note string)
+	// OmitDeprecated drops the fields tagged as deprecated, for clients which opted in to the new shape.
+	OmitDeprecated bool
+
+	// Instrumentation is notified at the beginning and the end of every Marshal call, e.g. to export metrics.
+	Instrumentation Instrumentation
+
+	// FieldNamer determines the output keys of struct fields, after the json tag has been resolved.
+	// It's not called for keys of maps.
+	FieldNamer FieldNamer
+
+	// UseBinaryMarshaler makes sheriff call MarshalBinary on types implementing encoding.BinaryMarshaler
+	// (with a value or pointer receiver), but none of json.Marshaler, encoding.TextMarshaler and fmt.Stringer.
+	// The resulting bytes are left as []byte, so it's up to the final encoder how to represent them
+	// (encoding/json uses base64). As encoding/json ignores the interface, this is disabled by default.
+	UseBinaryMarshaler bool
+
+	// AllowUintptr makes sheriff output uintptr values as numbers. By default they are dropped, as they usually
+	// hold addresses or handles (e.g. of syscalls) which must not leak into responses: struct fields of such
+	// types are omitted and other uintptr values (e.g. slice elements, map values or the contents of interface
+	// fields) are null. unsafe.Pointer values, which encoding/json can't marshal, are always dropped that way.
+	// Types implementing one of the interfaces sheriff looks for (e.g. encoding.TextMarshaler) are marshalled as usual.
+	AllowUintptr bool
+
+	// InterfacePreference determines which of json.Marshaler, encoding.TextMarshaler and fmt.Stringer make sheriff
+	// leave a type to its own marshalling, and which of them is used if a type implements several, e.g. for
+	// outputs other than JSON. The first interface of the list which a type implements is used, see InterfaceKind
+	// for how; interfaces which aren't listed are ignored, so that such types are marshalled like any other.
+	// If nil, types implementing any of the three are kept as they are, leaving the choice to the encoder
+	// (encoding/json prefers json.Marshaler over encoding.TextMarshaler and ignores fmt.Stringer).
+	InterfacePreference []InterfaceKind
+
+	// UseValuer makes sheriff call Value on types implementing database/sql/driver.Valuer (with a value or
+	// pointer receiver), but none of json.Marshaler, encoding.TextMarshaler and fmt.Stringer, and marshal the
+	// returned value instead of the type's fields. A nil driver.Value is marshalled as null. If Value fails,
+	// a ValuerError is returned.
+	UseValuer bool
 }
 
 // MarshalInvalidTypeError is an error returned to indicate the wrong type has been
 // passed to Marshal.
 type MarshalInvalidTypeError struct {
-	// t reflects the type of the data
-	t reflect.Kind
-	// data contains the passed data itself
-	data interface{}
+	// Kind reflects the kind of the data
+	Kind reflect.Kind
+	// Value contains the passed data itself
+	Value interface{}
 }
 
 func (e MarshalInvalidTypeError) Error() string {
-	return fmt.Sprintf("marshaller: Unable to marshal type %s. Struct required.", e.t)
+	return fmt.Sprintf("marshaller: Unable to marshal type %s. Struct required.", e.Kind)
+}
+
+// MaxDepthError is returned if the marshalled data is nested deeper than Options.MaxDepth.
+type MaxDepthError struct {
+	// MaxDepth is the maximum depth which was exceeded.
+	MaxDepth int
+	// Path is the dotted path of the value exceeding the maximum depth.
+	Path string
+}
+
+func (e MaxDepthError) Error() string {
+	path := e.Path
+	// deep paths are long, but the start and the end are the interesting parts
+	if len(path) > 256 {
+		path = path[:128] + "..." + path[len(path)-128:]
+	}
+	return fmt.Sprintf("marshaller: maximum depth of %d exceeded at %s", e.MaxDepth, path)
+}
+
+// DuplicateKeyError is returned if Options.ErrOnDuplicateKeys is set and two fields
+// of a struct are marshalled to the same key.
+type DuplicateKeyError struct {
+	// Type is the struct type holding the fields.
+	Type reflect.Type
+	// Key is the output key both fields are marshalled to.
+	Key string
+	// Field is the name of the Go field which was marshalled first. For keys of
+	// embedded structs it's the name of the embedded field.
+	Field string
+	// OtherField is the name of the Go field which was marshalled second.
+	OtherField string
+	// Path is the dotted path of the struct, empty if it's the top level.
+	Path string
+}
+
+func (e DuplicateKeyError) Error() string {
+	msg := fmt.Sprintf("marshaller: fields %s and %s of %s are both marshalled to key %q", e.Field, e.OtherField, e.Type, e.Key)
+	if e.Path != "" {
+		msg += fmt.Sprintf(" (at %s)", e.Path)
+	}
+	return msg
+}
+
+// InvalidGroupsTagError is returned if Options.StrictGroups is set and a groups tag contains empty groups.
+type InvalidGroupsTagError struct {
+	// Type is the struct type holding the field.
+	Type reflect.Type
+	// Field is the name of the Go field.
+	Field string
+	// Tag is the value of the groups tag.
+	Tag string
+}
+
+func (e InvalidGroupsTagError) Error() string {
+	return fmt.Sprintf("marshaller: groups tag %q of field %s of %s contains an empty group", e.Tag, e.Field, e.Type)
+}
+
+// LengthError is returned if a slice or map is longer than Options.MaxSliceLen or Options.MaxMapLen.
+type LengthError struct {
+	// Kind is either reflect.Slice or reflect.Map.
+	Kind reflect.Kind
+	// Len is the actual length.
+	Len int
+	// Max is the maximum length which was exceeded.
+	Max int
+	// Path is the dotted path of the slice or map, empty if it's the top level.
+	Path string
+}
+
+func (e LengthError) Error() string {
+	msg := fmt.Sprintf("marshaller: %s of length %d exceeds the maximum of %d", e.Kind, e.Len, e.Max)
+	if e.Path != "" {
+		msg += fmt.Sprintf(" (at %s)", e.Path)
+	}
+	return msg
+}
+
+// UnsupportedMapKeyError is returned for maps whose keys are neither strings, integers nor implement
+// encoding.TextMarshaler or encoding.TextAppender, the same keys encoding/json rejects.
+type UnsupportedMapKeyError struct {
+	// Kind is the kind of the map key.
+	Kind reflect.Kind
+	// Path is the dotted path of the map, empty if it's the top level.
+	Path string
+	// MapType is the type of the map.
+	MapType reflect.Type
+}
+
+func (e UnsupportedMapKeyError) Error() string {
+	msg := fmt.Sprintf("marshaller: unsupported map key kind %s of %s", e.Kind, e.MapType)
+	if e.Path != "" {
+		msg += fmt.Sprintf(" (at %s)", e.Path)
+	}
+	return msg
+}
+
+// MapKeyError is returned if the MarshalText method of a map key failed.
+type MapKeyError struct {
+	// Type is the type of the map key.
+	Type reflect.Type
+	// Path is the dotted path of the map, empty if it's the top level.
+	Path string
+	// Err is the error returned by MarshalText.
+	Err error
+}
+
+func (e MapKeyError) Error() string {
+	msg := fmt.Sprintf("marshaller: MarshalText of map key %s failed: %s", e.Type, e.Err)
+	if e.Path != "" {
+		msg += fmt.Sprintf(" (at %s)", e.Path)
+	}
+	return msg
+}
+
+// Unwrap returns the error returned by MarshalText.
+func (e MapKeyError) Unwrap() error {
+	return e.Err
+}
+
+// ValuerError is returned if the Value method of a driver.Valuer failed while Options.UseValuer is set.
+type ValuerError struct {
+	// Type is the type implementing driver.Valuer.
+	Type reflect.Type
+	// Path is the dotted path of the value, empty if it's the top level.
+	Path string
+	// Err is the error returned by Value.
+	Err error
+}
+
+func (e ValuerError) Error() string {
+	msg := fmt.Sprintf("marshaller: Value of %s failed: %s", e.Type, e.Err)
+	if e.Path != "" {
+		msg += fmt.Sprintf(" (at %s)", e.Path)
+	}
+	return msg
+}
+
+// Unwrap returns the error returned by Value.
+func (e ValuerError) Unwrap() error {
+	return e.Err
 }
 
 // Marshaller is the interface models have to implement in order to conform to marshalling.
@@ -56,12 +477,232 @@ type Marshaller interface {
 	Marshal(options *Options) (interface{}, error)
 }
 
+// Unwrapper is the interface wrapper types (e.g. a generic Optional[T]) can implement in order to be
+// replaced by the value they hold.
+//
+// UnwrapSheriff returns the wrapped value and whether it is present. A present value is marshalled instead
+// of the wrapper, including the group filtering if it's a struct. An absent value is marshalled as null
+// and is considered empty by omitempty; a present zero value isn't.
+type Unwrapper interface {
+	UnwrapSheriff() (interface{}, bool)
+}
+
 // Marshal encodes the passed data into a map which can be used to pass to json.Marshal().
 //
 // If the passed argument `data` is a struct, the return value will be of type `map[string]interface{}`.
+// The same applies to a map (or a pointer to a map): its values are filtered and its keys are converted to
+// strings like encoding/json does, i.e. string, integer and encoding.TextMarshaler keys are supported. A nil map
+// results in nil.
 // In all other cases we can't derive the type in a meaningful way and is therefore an `interface{}`.
 func Marshal(options *Options, data interface{}) (interface{}, error) {
-	v := reflect.ValueOf(data)
+	return MarshalContext(context.Background(), options, data)
+}
+
+// marshalRoot marshals the data passed to Marshal. Unlike nested structs, a struct passed to Marshal directly
+// is filtered even if it implements the Marshaller interface or one of the marshaler interfaces, but the same as
+// for nested values, types implementing one of the latter without exported fields (e.g. netip.Prefix) are left to
+// their own marshalling.
+func (s *marshalState) marshalRoot(v reflect.Value) (interface{}, error) {
+	k, ok := s.outputCacheKey(v, cachedValue)
+	if !ok {
+		return s.marshalRootUncached(v)
+	}
+	cache := s.options.outputCache()
+	if result, ok := cache.get(k); ok {
+		return copyResult(result), nil
+	}
+	result, err := s.marshalRootUncached(v)
+	if err == nil {
+		cache.add(k, copyResult(result))
+	}
+	return result, err
+}
+
+// marshalRootUncached is marshalRoot without Options.CacheKeyer.
+func (s *marshalState) marshalRootUncached(v reflect.Value) (interface{}, error) {
+	var result interface{}
+	var err error
+	if isMarshalerRoot(s.options, v) {
+		result, err = s.marshalValue(v, false)
+	} else {
+		result, err = s.marshal(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.options.DebugMetaKey != "" {
+		if result, err = s.withDebugMeta(v, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, s.collectedError()
+}
+
+// isMarshalerRoot reports whether v implements one of the marshaler interfaces and is to be left to them,
+// or implements Unwrapper, is replaced by its contents like sync.Map or is a Raw value. Structs with exported
+// fields are always filtered, only the ones without any (e.g. netip.Prefix) are left to their marshalers.
+func isMarshalerRoot(options *Options, v reflect.Value) bool {
+	if !v.IsValid() {
+		return false
+	}
+	info := typeInfoOf(v.Type())
+	if info.pointer&implUnwrapper != 0 || info.sync != notSync || isRaw(v.Type()) {
+		return true
+	}
+	if isTraversable(v) {
+		return false
+	}
+	return info.pointer&options.marshalerInterfaces() != 0
+}
+
+// marshalState holds the state of a single Marshal call.
+//
+// Options are shared between concurrent calls and must never be modified while marshalling,
+// all mutable bookkeeping lives here instead.
+type marshalState struct {
+	options *Options
+	// This is used internally so that we can propagate anonymous fields groups tag to all child field.
+	// It's only allocated once an anonymous field with groups is encountered.
+	nestedGroupsMap map[string][]string
+	// path holds the segments leading from the marshalled data to the value currently being marshalled.
+	path []pathSegment
+	// stats is only set if Options.Instrumentation is.
+	stats *Stats
+	// groups are the normalized Options.Groups.
+	groups []string
+	// unknownGroupErr is the UnknownGroupError of groups if Options.StrictGroups is set.
+	unknownGroupErr error
+	// omitEmpty reports whether the omitempty json option is honored.
+	omitEmpty bool
+	// renderDepth is the number of levels of the value currently being marshalled, see Options.MaxRenderDepth.
+	renderDepth int
+	// maxStringLen is the maximum length of strings within the field currently being marshalled, see Options.MaxStringLen.
+	maxStringLen int
+	// keyBuf is the scratch buffer integer map keys are formatted in.
+	keyBuf []byte
+	// omitPatterns and onlyPatterns are the parsed Options.OmitFields and Options.OnlyFields, nil if there are none.
+	omitPatterns []keyPattern
+	onlyPatterns []keyPattern
+	// keyPath is the scratch buffer of isKeyOmitted.
+	keyPath []string
+	// jsonKeys is the scratch buffer the keys of objects are sorted in by MarshalAppend.
+	jsonKeys []string
+	// appendFields and appendEntries are the scratch buffers the fields of structs and the entries of maps are
+	// sorted in by MarshalAppend, see appendStruct.
+	appendFields  []structField
+	appendEntries []mapEntry
+	// textBuf is the scratch buffer MarshalAppend appends the text of encoding.TextAppender implementations to.
+	textBuf []byte
+	// canonical makes MarshalAppend follow the rules of MarshalCanonical.
+	canonical bool
+	// sink receives the output of MarshalAppend in chunks instead of it being appended to a single buffer, see flush.
+	sink io.Writer
+	// frames are the structs, slices and maps being marshalled, see frame.
+	frames []frame
+	// maxFrames is the largest number of frames pushed at once, which are cleared by release.
+	maxFrames int
+	// errs are the errors collected with Options.ErrorPolicy CollectAll.
+	errs []FieldError
+	// ctx is the context passed to MarshalContext. done is its Done channel, nil if it's never done (e.g. for Marshal).
+	ctx  context.Context
+	done <-chan struct{}
+	// contextTicks counts the elements marshalled since ctx was checked last, see tickContext.
+	contextTicks int
+	// marshalerInterfaces are the interfaces whose implementations are left to their own marshalling,
+	// see Options.InterfacePreference.
+	marshalerInterfaces typeInterfaces
+	// shared holds what MarshalAll shares between the option sets for the element currently being marshalled,
+	// see sharedBox. It's nil for all other calls.
+	shared *sharedBox
+}
+
+// pathSegment is one step of the path to the value currently being marshalled.
+type pathSegment struct {
+	// name is the output key of a struct field or a map key.
+	name string
+	// index is the position of a slice element, -1 for fields and map entries.
+	index int
+	// parent is the type of the struct holding the field, nil for slice elements and map entries.
+	parent reflect.Type
+	// embedded reports whether the field is an anonymous struct field whose children are brought to the top.
+	embedded bool
+}
+
+func newMarshalState(options *Options) *marshalState {
+	s := &marshalState{}
+	s.init(options)
+	return s
+}
+
+// init prepares the empty state s for a call with options.
+func (s *marshalState) init(options *Options) {
+	groups := normalizeGroups(options.Groups)
+	s.options = options
+	s.groups = groups
+	s.omitEmpty = len(options.OmitEmptyGroups) == 0 || s.matchesGroups(normalizeGroups(options.OmitEmptyGroups), groups)
+	s.maxStringLen = options.MaxStringLen
+	s.marshalerInterfaces = options.marshalerInterfaces()
+	s.omitPatterns = parseKeyPatterns(options.OmitFields)
+	s.onlyPatterns = parseKeyPatterns(options.OnlyFields)
+	if options.StrictGroups {
+		s.unknownGroupErr = unknownRequestedGroup(groups, options.GroupMatcher)
+	}
+}
+
+func (s *marshalState) pushField(name string, parent reflect.Type) {
+	s.path = append(s.path, pathSegment{name: name, index: -1, parent: parent})
+}
+
+// pushStructField pushes the struct field f of the struct type parent.
+func (s *marshalState) pushStructField(f *structField, parent reflect.Type) {
+	s.path = append(s.path, pathSegment{name: f.name, index: -1, parent: parent, embedded: f.embedded})
+}
+
+func (s *marshalState) pushKey(key string) {
+	s.path = append(s.path, pathSegment{name: key, index: -1})
+}
+
+func (s *marshalState) pushIndex(i int) {
+	s.path = append(s.path, pathSegment{index: i})
+}
+
+func (s *marshalState) pop() {
+	s.path = s.path[:len(s.path)-1]
+}
+
+// currentPath returns the dotted path of the value currently being marshalled, e.g. `users.0.address`.
+func (s *marshalState) currentPath() string {
+	var b strings.Builder
+	for i, segment := range s.path {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		if segment.index >= 0 {
+			b.WriteString(strconv.Itoa(segment.index))
+		} else {
+			b.WriteString(segment.name)
+		}
+	}
+	return b.String()
+}
+
+// checkDepth returns a MaxDepthError if the current path is deeper than allowed.
+func (s *marshalState) checkDepth() error {
+	maxDepth := s.options.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if len(s.path) > maxDepth {
+		return MaxDepthError{MaxDepth: maxDepth, Path: s.currentPath()}
+	}
+	if s.stats != nil && len(s.path) > s.stats.MaxDepth {
+		s.stats.MaxDepth = len(s.path)
+	}
+	return nil
+}
+
+// marshal is the implementation of Marshal.
+func (s *marshalState) marshal(v reflect.Value) (interface{}, error) {
 	// If data was nil, bail here to avoid panicking. We didn't want to marshal that anyway.
 	if !v.IsValid() {
 		return nil, nil
@@ -69,198 +710,865 @@ func Marshal(options *Options, data interface{}) (interface{}, error) {
 
 	t := v.Type()
 
-	// Initialise nestedGroupsMap,
-	// TODO: this may impact the performance, find a better place for this.
-	if options.nestedGroupsMap == nil {
-		options.nestedGroupsMap = make(map[string][]string)
-	}
-
 	if t.Kind() == reflect.Ptr {
 		// follow pointer
 		t = t.Elem()
 	}
 	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
 		// follow pointer
 		v = v.Elem()
 	}
 
+	base := len(s.frames)
+	result, pending, err := s.beginMarshal(v, t)
+	if err != nil || !pending {
+		return result, err
+	}
+	return s.run(base)
+}
+
+// beginMarshal is the part of marshal before the work list is run: the non-nil v, whose type without
+// pointers is t, is marshalled like by visit, except that structs are always filtered.
+func (s *marshalState) beginMarshal(v reflect.Value, t reflect.Type) (result interface{}, pending bool, err error) {
 	if t.Kind() != reflect.Struct {
-		return marshalValue(options, v)
+		return s.visit(v, false)
+	}
+	if s.done != nil {
+		if err := s.checkContext(); err != nil {
+			return nil, false, err
+		}
 	}
+	s.pushStruct(v, typeInfoOf(t))
+	return nil, true, nil
+}
+
+// claimKey records that the struct field named fieldName of t writes the output key.
+// A DuplicateKeyError is returned if another field wrote that key before. owners is nil
+// if duplicate keys are not to be detected.
+func (s *marshalState) claimKey(owners map[string]string, t reflect.Type, key, fieldName string) error {
+	if owners == nil {
+		return nil
+	}
+	if other, ok := owners[key]; ok {
+		return DuplicateKeyError{
+			Type:       t,
+			Key:        key,
+			Field:      other,
+			OtherField: fieldName,
+			Path:       s.currentPath(),
+		}
+	}
+	owners[key] = fieldName
+	return nil
+}
 
-	dest := make(map[string]interface{})
+// structField is a struct field which passed the json tag, omitempty and group checks.
+// With Options.ExcludedAsNull, it may also be a field which failed the group check.
+type structField struct {
+	field reflect.StructField
+	// name is the key of the field in the output.
+	name string
+	// value is the value of the field with pointers dereferenced.
+	value reflect.Value
+	// embedded reports whether the field is an anonymous struct field without json name,
+	// whose children should be brought to the top.
+	embedded    bool
+	jsonOpts    tagOptions
+	sheriffOpts tagOptions
+	// excluded reports whether the field failed the group check and is to be marshalled as null.
+	excluded bool
+	// maxStringLen is the maximum length of strings within the field, see Options.MaxStringLen.
+	maxStringLen int
+	// inline reports whether the entries of the map held by the field are merged into the struct's result.
+	inline bool
+}
+
+// eachField calls fn for every field of the struct value v which passes the json tag, omitempty and group checks.
+func (s *marshalState) eachField(t reflect.Type, v reflect.Value, fn func(f structField) error) error {
+	var f structField
+	for i := 0; ; {
+		ok, err := s.nextField(t, v, &i, &f)
+		if err != nil || !ok {
+			return err
+		}
+		maxStringLen := s.maxStringLen
+		s.maxStringLen = f.maxStringLen
+		err = fn(f)
+		s.maxStringLen = maxStringLen
+		if err != nil {
+			return err
+		}
+	}
+}
 
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		val := v.Field(i)
+// nextField sets f to the first field of the struct value v starting at the index *i which passes the json tag,
+// omitempty and group checks, and advances *i past it. ok is false if there is no such field left.
+func (s *marshalState) nextField(t reflect.Type, v reflect.Value, i *int, f *structField) (ok bool, err error) {
+	options := s.options
 
-		jsonTag, jsonOpts := parseTag(field.Tag.Get("json"))
+	var fields []fieldInfo
+	if s.shared != nil {
+		fields = s.shared.fieldInfosOf(t)
+	} else {
+		fields = fieldInfosOf(t)
+	}
+	for ; *i < len(fields); *i++ {
+		info := &fields[*i]
+		field := info.field
+		val := v.Field(*i)
 
 		// If no json tag is provided, use the field Name
+		jsonTag, jsonOpts, embedded := options.fieldKey(info)
 		if jsonTag == "" {
-			jsonTag = field.Name
+			jsonTag = options.UntaggedKeyStyle.convert(field.Name)
 		}
 
 		if jsonTag == "-" {
 			continue
 		}
-		if jsonOpts.Contains("omitempty") && isEmptyValue(val) {
+		hashedEmpty := info.pii && !options.OmitEmptyPII && val.Kind() != reflect.Ptr
+		roundedZero := false
+		if decimals := s.fieldPrecision(info); decimals >= 0 && val.CanInterface() {
+			if n, ok := roundFloatValue(val, decimals); ok {
+				val = reflect.ValueOf(n)
+				roundedZero = isZeroNumber(n)
+			}
+		}
+		if s.omitEmpty && jsonOpts.Contains("omitempty") && !hashedEmpty && (roundedZero || isEmptyValue(val) || isAbsent(val) || (options.TreatZeroStructsAsEmpty && isZeroStruct(val))) {
 			continue
 		}
 		// skip unexported fields
 		if !val.IsValid() || !val.CanInterface() {
 			continue
 		}
+		if info.addressKind == reflect.UnsafePointer || info.addressKind == reflect.Uintptr && !options.AllowUintptr {
+			continue
+		}
 
 		// if there is an anonymous field which is a struct
 		// we want the childs exposed at the toplevel to be
 		// consistent with the embedded json marshaller
 		if val.Kind() == reflect.Ptr {
+			// a nil embedded struct pointer has no fields to contribute
+			if embedded && val.IsNil() {
+				continue
+			}
 			val = val.Elem()
 		}
 
-		// we can skip the group check if if the field is a composition field
-		isEmbeddedField := field.Anonymous && val.Kind() == reflect.Struct
+		if !s.passesTagPredicates(field) {
+			continue
+		}
+		if info.deprecated && options.OmitDeprecated {
+			continue
+		}
+
+		// we can skip the group check if if the field is a composition field.
+		// Other embedded types (e.g. `type ID string`, named maps or slices) are
+		// marshalled like a regular field named after their type.
+		isEmbeddedField := embedded
+		if options.FieldNamer != nil && !isEmbeddedField {
+			if name := options.FieldNamer.Name(t, field, jsonTag); name != "" {
+				jsonTag = name
+			}
+		}
+		if options.StrictGroups {
+			// the field is skipped if the error is recovered from
+			if err := info.groupsErr; err != nil {
+				*i++
+				return false, err
+			}
+			if err := s.unknownGroupErr; err != nil {
+				*i++
+				return false, err
+			}
+			if err := info.unknownGroupErr; err != nil {
+				*i++
+				return false, err
+			}
+		}
 
-		if isEmbeddedField && field.Type.Kind() == reflect.Struct {
+		if isEmbeddedField {
 			tt := field.Type
-			groups := field.Tag.Get(tagName)
-			if groups != "" {
-				parentGroups := strings.Split(groups, ",")
-				for i := 0; i < tt.NumField(); i++ {
-					nestedField := tt.Field(i)
-					options.nestedGroupsMap[nestedField.Name] = parentGroups
+			if tt.Kind() == reflect.Ptr {
+				tt = tt.Elem()
+			}
+			if parentGroups := info.groups; parentGroups != nil {
+				if s.nestedGroupsMap == nil {
+					s.nestedGroupsMap = make(map[string][]string, tt.NumField())
+				}
+				for _, nested := range fieldInfosOf(tt) {
+					s.nestedGroupsMap[nested.field.Name] = parentGroups
 				}
 			}
 		}
 
 		if !isEmbeddedField {
-			var groups []string
-			if field.Tag.Get(tagName) != "" {
-				groups = strings.Split(field.Tag.Get(tagName), ",")
+			groups := info.groups
+			if groups == nil && len(s.nestedGroupsMap) > 0 && s.nestedGroupsMap[field.Name] != nil {
+				groups = s.nestedGroupsMap[field.Name]
 			}
-
-			if len(groups) == 0 && options.nestedGroupsMap[field.Name] != nil {
-				groups = append(groups, options.nestedGroupsMap[field.Name]...)
+			if info.groupsIfErr != nil {
+				*i++
+				return false, info.groupsIfErr
 			}
-			shouldShow := len(groups) == 0 || listContains(groups, options.Groups)
+			// a field whose groups may only write it (e.g. `groups:"admin:w"`) isn't shown to anyone,
+			// unless its groups_if condition holds for this struct value
+			shouldShow := s.isVisible(t, field, groups) || info.groupsIf != nil && info.groupsIf.matches(v)
 			if !shouldShow {
-				continue
+				if s.stats != nil {
+					s.stats.ExcludedFields++
+				}
+				if options.OnExcluded != nil {
+					s.pushField(jsonTag, t)
+					path := s.currentPath()
+					s.pop()
+					// the groups are shared with other calls
+					options.OnExcluded(path, field, slices.Clone(groups))
+				}
+				// inline maps contribute nothing instead of a key
+				if !options.ExcludedAsNull || info.inline || options.omitsNil() {
+					continue
+				}
+				// redaction wins over the null, the field is masked below
+				if info.mask == nil || !options.EnableMasking {
+					*i++
+					*f = structField{field: field, name: jsonTag, value: val, excluded: true, maxStringLen: s.maxStringLen}
+					return true, nil
+				}
 			}
 		}
 
-		v, err := marshalValue(options, val)
+		if !isEmbeddedField && s.isKeyOmitted(jsonTag) {
+			continue
+		}
+		if info.deprecated && options.OnDeprecated != nil {
+			s.pushField(jsonTag, t)
+			path := s.currentPath()
+			s.pop()
+			options.OnDeprecated(path, info.deprecation)
+		}
+		if s.stats != nil && !isEmbeddedField {
+			s.stats.EmittedFields++
+		}
+		maxStringLen := s.maxStringLen
+		if info.maxLenErr != nil {
+			*i++
+			return false, info.maxLenErr
+		}
+		if info.maxLen >= 0 {
+			maxStringLen = info.maxLen
+		}
+		if info.piiErr != nil {
+			*i++
+			return false, info.piiErr
+		}
+		if info.precisionErr != nil {
+			*i++
+			return false, info.precisionErr
+		}
+		if info.inlineErr != nil {
+			*i++
+			return false, info.inlineErr
+		}
+		if info.pii {
+			val = s.hashPII(val)
+			// digests aren't truncated
+			maxStringLen = 0
+		} else if info.mask != nil && options.EnableMasking {
+			var err error
+			if val, err = info.mask.apply(t, field, val); err != nil {
+				*i++
+				return false, err
+			}
+		}
+		*i++
+		if info.ref != "" && !isEmbeddedField && !s.isExpanded(jsonTag) {
+			s.pushField(jsonTag, t)
+			ref, err := s.reference(val, info.ref)
+			s.pop()
+			if err != nil {
+				return false, err
+			}
+			val = reflect.ValueOf(ref)
+		}
+		*f = structField{
+			field:        field,
+			name:         jsonTag,
+			value:        val,
+			embedded:     isEmbeddedField,
+			jsonOpts:     jsonOpts,
+			sheriffOpts:  info.sheriffOpts,
+			maxStringLen: maxStringLen,
+			inline:       info.inline,
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// lowestMapKeys returns the n keys which are the lowest once converted to strings.
+func (s *marshalState) lowestMapKeys(keys []reflect.Value, n int) ([]reflect.Value, error) {
+	keyStrings := make([]string, len(keys))
+	for i, key := range keys {
+		keyString, err := s.mapKeyString(key)
 		if err != nil {
 			return nil, err
 		}
+		keyStrings[i] = keyString
+	}
+	sort.Sort(mapKeysByString{keys, keyStrings})
+	return keys[:n], nil
+}
+
+// mapKeysByString sorts map keys by their string representation.
+type mapKeysByString struct {
+	keys    []reflect.Value
+	strings []string
+}
+
+func (m mapKeysByString) Len() int           { return len(m.keys) }
+func (m mapKeysByString) Less(i, j int) bool { return m.strings[i] < m.strings[j] }
+func (m mapKeysByString) Swap(i, j int) {
+	m.keys[i], m.keys[j] = m.keys[j], m.keys[i]
+	m.strings[i], m.strings[j] = m.strings[j], m.strings[i]
+}
+
+// limitResult applies Options.MaxSliceLen and Options.MaxMapLen to the result of a Marshaller.
+// Slices and maps within []interface{} and map[string]interface{} are limited recursively.
+func (s *marshalState) limitResult(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	options := s.options
 
-		// when a composition field we want to bring the child
-		// nodes to the top
-		nestedVal, ok := v.(map[string]interface{})
-		if isEmbeddedField && ok {
-			for key, value := range nestedVal {
-				dest[key] = value
+	switch v.Kind() {
+	case reflect.Slice:
+		l := v.Len()
+		if max := options.MaxSliceLen; max > 0 && l > max {
+			if !options.TruncateOverflow {
+				return nil, LengthError{Kind: reflect.Slice, Len: l, Max: max, Path: s.currentPath()}
 			}
-		} else {
-			dest[jsonTag] = v
+			v = v.Slice(0, max)
+		}
+		values, ok := v.Interface().([]interface{})
+		if !ok {
+			return v.Interface(), nil
+		}
+		dest := make([]interface{}, len(values), len(values)+1)
+		for i, value := range values {
+			s.pushIndex(i)
+			d, err := s.limitResult(reflect.ValueOf(value))
+			s.pop()
+			if err != nil {
+				return nil, err
+			}
+			dest[i] = d
+		}
+		if l > len(values) && options.OverflowKey != "" {
+			dest = append(dest, map[string]interface{}{options.OverflowKey: l - len(values)})
+		}
+		return dest, nil
+	case reflect.Map:
+		keys := v.MapKeys()
+		overflow := 0
+		if max := options.MaxMapLen; max > 0 && len(keys) > max {
+			if !options.TruncateOverflow {
+				return nil, LengthError{Kind: reflect.Map, Len: len(keys), Max: max, Path: s.currentPath()}
+			}
+			overflow = len(keys) - max
+			if err := s.checkMapKey(v.Type()); err != nil {
+				return nil, err
+			}
+			var err error
+			if keys, err = s.lowestMapKeys(keys, max); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := v.Interface().(map[string]interface{}); !ok {
+			if overflow == 0 {
+				return v.Interface(), nil
+			}
+			dest := reflect.MakeMapWithSize(v.Type(), len(keys))
+			for _, key := range keys {
+				dest.SetMapIndex(key, v.MapIndex(key))
+			}
+			return dest.Interface(), nil
+		}
+		// the keys are visited in order so that the path of a LengthError doesn't depend on the map iteration order
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		dest := make(map[string]interface{}, len(keys)+1)
+		if overflow > 0 && options.OverflowKey != "" {
+			dest[options.OverflowKey] = overflow
+		}
+		for _, key := range keys {
+			s.pushKey(key.String())
+			d, err := s.limitResult(v.MapIndex(key).Elem())
+			s.pop()
+			if err != nil {
+				return nil, err
+			}
+			dest[key.String()] = d
+		}
+		return dest, nil
+	}
+	return v.Interface(), nil
+}
+
+// depthOverflowOmitted is returned by depthOverflow for struct fields which are to be omitted.
+type depthOverflowOmitted struct{}
+
+// depthOverflow returns the replacement of the struct v which is beyond Options.MaxRenderDepth.
+func (s *marshalState) depthOverflow(v reflect.Value) (interface{}, error) {
+	if key := s.options.DepthOverflowField; key != "" {
+		// the struct is marshalled without rendering any further structs and without notifying about
+		// the excluded or deprecated fields, as it's not part of the output
+		options := *s.options
+		options.OnExcluded = nil
+		options.OnDeprecated = nil
+		options.Instrumentation = nil
+		options.DepthOverflowField = ""
+		options.OmitDepthOverflow = false
+		sub := newMarshalState(&options)
+		sub.path = s.path
+		// only the struct itself (and its anonymous structs) is rendered
+		sub.renderDepth = options.MaxRenderDepth - 1
+
+		intermediate, err := sub.marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		s.errs = append(s.errs, sub.errs...)
+		if value, ok := intermediate.(map[string]interface{})[key]; ok {
+			return map[string]interface{}{key: value}, nil
 		}
 	}
+	// only struct fields can be omitted, slice elements keep their position
+	if s.options.OmitDepthOverflow && len(s.path) > 0 && s.path[len(s.path)-1].parent != nil {
+		return depthOverflowOmitted{}, nil
+	}
+	return nil, nil
+}
+
+// passesTagPredicates reports whether field passes all of Options.TagPredicates.
+func (s *marshalState) passesTagPredicates(field reflect.StructField) bool {
+	for key, predicate := range s.options.TagPredicates {
+		if value, ok := field.Tag.Lookup(key); ok && !predicate(value) {
+			return false
+		}
+	}
+	return true
+}
 
-	return dest, nil
+// isEmbeddedStruct reports whether field is an anonymous field of a struct or struct pointer type.
+func isEmbeddedStruct(field reflect.StructField) bool {
+	if !field.Anonymous {
+		return false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
 }
 
 // marshalValue is being used for getting the actual value of a field.
 //
 // There is support for types implementing the Marshaller interface, arbitrary structs, slices, maps and base types.
-func marshalValue(options *Options, v reflect.Value) (interface{}, error) {
-	// return nil on nil pointer struct fields
-	if !v.IsValid() || !v.CanInterface() {
-		return nil, nil
+// If traverse is set, structs implementing one of the marshaler interfaces are marshalled like any other struct.
+func (s *marshalState) marshalValue(v reflect.Value, traverse bool) (interface{}, error) {
+	base := len(s.frames)
+	result, pending, err := s.visit(v, traverse)
+	if err != nil || !pending {
+		return result, err
 	}
-	val := v.Interface()
+	return s.run(base)
+}
 
-	if marshaller, ok := val.(Marshaller); ok {
-		return marshaller.Marshal(options)
+// visit returns the marshalled value of v. For structs, slices and maps, a frame is pushed instead and pending
+// is set; the value is the result of the frame once run is done with it.
+func (s *marshalState) visit(v reflect.Value, traverse bool) (result interface{}, pending bool, err error) {
+	options := s.options
+	// viaInterface reports whether v was held by an interface, see Options.TypeField
+	viaInterface := false
+
+	for {
+		// return nil on nil pointer struct fields
+		if !v.IsValid() || !v.CanInterface() {
+			return nil, false, nil
+		}
+		// interfaces (e.g. elements of []interface{}) are dispatched on the value they hold, so that typed nil
+		// pointers are caught below before calling any of their methods
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+			viaInterface = true
+			continue
+		}
+		// nil pointers (e.g. slice elements or map values) are null, like encoding/json
+		// doesn't call any marshaler on them either
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, false, nil
+		}
+		if err := s.checkDepth(); err != nil {
+			return nil, false, err
+		}
+		if options.TimeLocation != nil {
+			v = s.inTimeLocation(v)
+		}
+		// the interfaces are only asserted on types implementing them, which saves boxing e.g. every struct
+		var info typeInfo
+		if s.shared != nil {
+			info = s.shared.typeInfoOf(v.Type())
+		} else {
+			info = typeInfoOf(v.Type())
+		}
+		if info.pointer == 0 && isPrimitiveKind(v.Kind()) {
+			if v.Kind() == reflect.String && s.maxStringLen > 0 {
+				return truncateString(v.String(), s.maxStringLen), false, nil
+			}
+			if v.Kind() == reflect.Uintptr && !options.AllowUintptr {
+				return nil, false, nil
+			}
+			if options.FloatPrecision > 0 && (v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64) {
+				if n, ok := roundFloat(v.Float(), v.Type().Bits(), options.FloatPrecision); ok {
+					return n, false, nil
+				}
+			}
+			if options.Int64AsString && isInt64(v.Type()) {
+				return int64String(v), false, nil
+			}
+			if s.shared != nil {
+				return s.shared.box(v), false, nil
+			}
+			return primitiveInterface(v), false, nil
+		}
+
+		if info.value&implJSONMarshaler != 0 {
+			if value, ok := rawValue(v); ok {
+				return value, false, nil
+			}
+		}
+		if info.value&implMarshaller != 0 {
+			result, err := v.Interface().(Marshaller).Marshal(options)
+			if raw, ok := result.(Raw); ok {
+				return raw.Value, false, err
+			}
+			if err != nil || (options.MaxSliceLen == 0 && options.MaxMapLen == 0) {
+				return result, false, err
+			}
+			result, err = s.limitResult(reflect.ValueOf(result))
+			return result, false, err
+		}
+		if unwrapper, ok := receiver(v, info, implUnwrapper); ok {
+			value, present := unwrapper.(Unwrapper).UnwrapSheriff()
+			if !present {
+				return nil, false, nil
+			}
+			v = reflect.ValueOf(value)
+			continue
+		}
+		// types which are e.g. structs, slices or maps and implement one of the following interfaces should not be
+		// marshalled by sheriff because they'll be correctly marshalled by json.Marshal instead.
+		// Otherwise (e.g. net.IP) a byte slice may be output as a list of uints instead of as an IP string.
+		if !(traverse || options.TraverseMarshalers) || !isTraversable(v) {
+			// with pointer receivers, the pointer has to be passed on as encoding/json wouldn't call the
+			// marshaler on a value which isn't addressable (e.g. map values or dereferenced struct fields)
+			if options.InterfacePreference == nil {
+				if marshaler, ok := receiver(v, info, implMarshalerMethod); ok {
+					return marshaler, false, nil
+				}
+			} else if info.pointer&s.marshalerInterfaces != 0 {
+				result, err := s.preferredMarshaler(v, info)
+				return result, false, err
+			}
+		}
+		if options.UseValuer {
+			if valuer, ok := receiver(v, info, implValuer); ok {
+				value, err := valuer.(driver.Valuer).Value()
+				if err != nil {
+					return nil, false, ValuerError{Type: v.Type(), Path: s.currentPath(), Err: err}
+				}
+				v = reflect.ValueOf(value)
+				continue
+			}
+		}
+		if options.UseBinaryMarshaler {
+			if m, ok := receiver(v, info, implBinaryMarshaler); ok {
+				result, err := m.(encoding.BinaryMarshaler).MarshalBinary()
+				return result, false, err
+			}
+		}
+		// sync.Map and the atomic types are replaced by their contents, as their fields are unexported
+		if info.sync != notSync {
+			if v.Kind() == reflect.Ptr {
+				v = v.Elem()
+			}
+			if v, err = s.loadSync(v, info.sync); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		k := v.Kind()
+
+		if k == reflect.Ptr {
+			v = v.Elem()
+			k = v.Kind()
+		}
+
+		switch k {
+		case reflect.Interface:
+			// re-dispatch on the contained value so that every kind (including typed nil pointers) is handled
+			v = v.Elem()
+			viaInterface = true
+			continue
+		case reflect.Struct:
+			if options.MaxRenderDepth > 0 && s.renderDepth >= options.MaxRenderDepth {
+				result, err := s.depthOverflow(v)
+				return result, false, err
+			}
+			if s.done != nil {
+				if err := s.checkContext(); err != nil {
+					return nil, false, err
+				}
+			}
+			s.pushStruct(v, info)
+			if viaInterface && options.TypeField != "" {
+				s.frames[len(s.frames)-1].typed = true
+			}
+			return nil, true, nil
+		case reflect.Slice:
+			if v.IsNil() {
+				return nil, false, nil
+			}
+			return nil, true, s.pushSlice(v, traverse)
+		case reflect.Map:
+			if v.IsNil() {
+				return nil, false, nil
+			}
+			if v.Len() == 0 {
+				if s.preservesMapKeys(v.Type()) {
+					return make(map[interface{}]interface{}), false, nil
+				}
+				return make(map[string]interface{}), false, nil
+			}
+			return nil, true, s.pushMap(v, traverse)
+		case reflect.String:
+			if s.maxStringLen > 0 {
+				return truncateString(v.String(), s.maxStringLen), false, nil
+			}
+		case reflect.Uintptr:
+			if !options.AllowUintptr {
+				return nil, false, nil
+			}
+		case reflect.UnsafePointer:
+			return nil, false, nil
+		}
+		return v.Interface(), false, nil
 	}
-	// types which are e.g. structs, slices or maps and implement one of the following interfaces should not be
-	// marshalled by sheriff because they'll be correctly marshalled by json.Marshal instead.
-	// Otherwise (e.g. net.IP) a byte slice may be output as a list of uints instead of as an IP string.
-	switch val.(type) {
-	case json.Marshaler, encoding.TextMarshaler, fmt.Stringer:
-		return val, nil
+}
+
+// isPrimitiveKind reports whether k is the kind of a bool, number or string.
+func isPrimitiveKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
 	}
-	k := v.Kind()
+	return false
+}
 
-	if k == reflect.Ptr {
-		v = v.Elem()
-		val = v.Interface()
-		k = v.Kind()
+// primitiveInterface returns the value of the primitive v like v.Interface() does. v.Interface() copies
+// addressable values (e.g. the fields of a struct passed by pointer) to the heap, so these are converted
+// using the typed accessors if they are of a predeclared type, which avoids allocating for e.g. small
+// integers, booleans and empty strings.
+func primitiveInterface(v reflect.Value) interface{} {
+	if !v.CanAddr() || v.Type().PkgPath() != "" {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Int:
+		return int(v.Int())
+	case reflect.Int64:
+		return v.Int()
+	case reflect.Uint:
+		return uint(v.Uint())
+	case reflect.Uint64:
+		return v.Uint()
+	case reflect.Float64:
+		return v.Float()
 	}
+	return v.Interface()
+}
 
-	if k == reflect.Interface || k == reflect.Struct {
-		return Marshal(options, val)
+// truncateString truncates str to n runes and appends a marker stating how many bytes were dropped.
+func truncateString(str string, n int) string {
+	i := 0
+	for pos := range str {
+		if i == n {
+			return fmt.Sprintf("%s…(truncated %d bytes)", str[:pos], len(str)-pos)
+		}
+		i++
 	}
-	if k == reflect.Slice {
-		if v.IsNil() {
-			return nil, nil
+	return str
+}
+
+// zeroer is implemented by types which know whether they are zero, e.g. time.Time.
+type zeroer interface {
+	IsZero() bool
+}
+
+// isZeroStruct reports whether v is a struct which is zero, using its IsZero method if it has one.
+func isZeroStruct(v reflect.Value) bool {
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	if v.CanInterface() {
+		if z, ok := v.Interface().(zeroer); ok {
+			return z.IsZero()
 		}
-		l := v.Len()
-		dest := make([]interface{}, l)
-		for i := 0; i < l; i++ {
-			d, err := marshalValue(options, v.Index(i))
-			if err != nil {
-				return nil, err
+		if v.CanAddr() {
+			if z, ok := v.Addr().Interface().(zeroer); ok {
+				return z.IsZero()
 			}
-			dest[i] = d
 		}
-		return dest, nil
 	}
-	if k == reflect.Map {
+	return v.IsZero()
+}
+
+// isAbsent reports whether v implements Unwrapper and holds no value.
+func isAbsent(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return false
+	}
+	unwrapper, ok := receiver(v, typeInfoOf(v.Type()), implUnwrapper)
+	if !ok {
+		return false
+	}
+	_, present := unwrapper.(Unwrapper).UnwrapSheriff()
+	return !present
+}
+
+// isTraversable reports whether v is a struct or a non-nil pointer to a struct which sheriff can traverse instead
+// of leaving it to its marshaler. Structs without exported fields (e.g. time.Time) aren't, as traversing them
+// would only result in an empty object.
+func isTraversable(v reflect.Value) bool {
+	if v.Kind() == reflect.Ptr {
 		if v.IsNil() {
-			return nil, nil
+			return false
 		}
-		mapKeys := v.MapKeys()
-		if len(mapKeys) == 0 {
-			dest := make(map[string]interface{})
-			return dest, nil
-		}
-		dest := make(map[string]interface{})
-		for _, key := range mapKeys {
-			d, err := marshalValue(options, v.MapIndex(key))
-			if err != nil {
-				return nil, err
-			}
-			keyString, err := coerceMapKeyToString(key)
-			if err != nil {
-				return nil, err
-			}
-			dest[keyString] = d
-		}
-		return dest, nil
+		v = v.Elem()
 	}
-	return val, nil
+	return v.Kind() == reflect.Struct && structInfoOf(v.Type()).exported
 }
 
-func coerceMapKeyToString(v reflect.Value) (string, error) {
+// mapKeyString converts the map key v into a string like encoding/json does, i.e. string, integer,
+// encoding.TextMarshaler and encoding.TextAppender keys are supported.
+func (s *marshalState) mapKeyString(v reflect.Value) (string, error) {
 	// Copied from encode.go in the official json package
 
 	if v.Kind() == reflect.String {
 		return v.String(), nil
 	}
 
-	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
-		buf, err := tm.MarshalText()
-		return string(buf), err
+	if typeInfoOf(v.Type()).value&(implTextMarshaler|implTextAppender) != 0 {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return "", nil
+		}
+		buf, err := marshalText(v.Interface())
+		if err != nil {
+			return "", MapKeyError{Type: v.Type(), Path: s.currentPath(), Err: err}
+		}
+		return string(buf), nil
 	}
 
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return strconv.FormatInt(v.Int(), 10), nil
+		s.keyBuf = strconv.AppendInt(s.keyBuf[:0], v.Int(), 10)
+		return string(s.keyBuf), nil
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		return strconv.FormatUint(v.Uint(), 10), nil
+		s.keyBuf = strconv.AppendUint(s.keyBuf[:0], v.Uint(), 10)
+		return string(s.keyBuf), nil
+	}
+
+	// the key types of maps are checked upfront by checkMapKey, this is only reached for keys of a sync.Map
+	return "", UnsupportedMapKeyError{Kind: v.Kind(), Path: s.currentPath()}
+}
+
+// checkMapKey returns an UnsupportedMapKeyError if the keys of the map type t can't be converted to strings by
+// mapKeyString. As this only depends on the key type, the error is the same no matter in which order the keys
+// are iterated.
+func (s *marshalState) checkMapKey(t reflect.Type) error {
+	if isSupportedMapKey(t.Key()) {
+		return nil
+	}
+	return UnsupportedMapKeyError{Kind: t.Key().Kind(), Path: s.currentPath(), MapType: t}
+}
+
+// isSupportedMapKey reports whether mapKeyString supports keys of type t.
+func isSupportedMapKey(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
 	}
+	return typeInfoOf(t).value&(implTextMarshaler|implTextAppender) != 0
+}
 
-	return "", MarshalInvalidTypeError{t: v.Kind(), data: v.Interface()}
+// parseSheriffTag returns the comma-separated options of a struct field's "sheriff" tag,
+// e.g. `sheriff:"traverse"`.
+func parseSheriffTag(field reflect.StructField) tagOptions {
+	return tagOptions(field.Tag.Get("sheriff"))
+}
+
+// splitGroups splits a comma-separated list of groups and normalizes it using normalizeGroups.
+func splitGroups(groups string) []string {
+	return normalizeGroups(strings.Split(groups, ","))
+}
+
+// normalizeGroups trims spaces around the groups and drops empty ones.
+// groups is returned as is if it's already normalized.
+func normalizeGroups(groups []string) []string {
+	normalized := true
+	for _, group := range groups {
+		if group == "" || strings.TrimSpace(group) != group {
+			normalized = false
+			break
+		}
+	}
+	if normalized {
+		return groups
+	}
+
+	dest := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if group = strings.TrimSpace(group); group != "" {
+			dest = append(dest, group)
+		}
+	}
+	return dest
+}
+
+// Value returns the value of an option of the form `name=value`.
+func (o tagOptions) Value(name string) (string, bool) {
+	for _, option := range strings.Split(string(o), ",") {
+		if strings.HasPrefix(option, name+"=") {
+			return option[len(name)+1:], true
+		}
+	}
+	return "", false
 }
 
 // contains check if a given key is contained in a slice of strings.
@@ -0,0 +1,65 @@
+// Package sheriff_fiber integrates sheriff with Fiber.
+//
+// Fiber's JSONEncoder has no access to the request, so the groups are passed along with the data: the Groups
+// middleware stores the groups of a request in its locals, JSON reads them and hands the data tagged with them
+// to the encoder, and JSONMarshal, configured as the app's JSONEncoder, filters tagged data using sheriff.
+//
+//	app := fiber.New(fiber.Config{JSONEncoder: sheriff_fiber.JSONMarshal})
+//	app.Get("/user", sheriff_fiber.Groups("public"), func(c *fiber.Ctx) error {
+//		return sheriff_fiber.JSON(c, user)
+//	})
+package sheriff_fiber
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/peoplecentrix/sheriff"
+)
+
+// groupsLocalsKey is the key of the groups in the locals of a fiber.Ctx.
+type groupsLocalsKey struct{}
+
+// Groups returns a middleware which sets the groups used by JSON for the request.
+func Groups(groups ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(groupsLocalsKey{}, groups)
+		return c.Next()
+	}
+}
+
+// GroupsFromCtx returns the groups set by the Groups middleware and whether there are any.
+func GroupsFromCtx(c *fiber.Ctx) ([]string, bool) {
+	groups, ok := c.Locals(groupsLocalsKey{}).([]string)
+	return groups, ok
+}
+
+// JSON sends data as JSON response like c.JSON does, filtered by the groups set by the Groups middleware.
+// Without groups, data is passed to c.JSON as is.
+func JSON(c *fiber.Ctx, data interface{}, ctype ...string) error {
+	groups, ok := GroupsFromCtx(c)
+	if !ok {
+		return c.JSON(data, ctype...)
+	}
+	return c.JSON(grouped{groups: groups, data: data}, ctype...)
+}
+
+// grouped is data passed to the JSONEncoder by JSON, to be filtered by groups.
+type grouped struct {
+	groups []string
+	data   interface{}
+}
+
+// JSONMarshal implements utils.JSONMarshal. Data sent by JSON is filtered by its groups using sheriff,
+// anything else is encoded using encoding/json.
+func JSONMarshal(v interface{}) ([]byte, error) {
+	g, ok := v.(grouped)
+	if !ok {
+		return json.Marshal(v)
+	}
+	filtered, err := sheriff.Marshal(&sheriff.Options{Groups: g.groups}, g.data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(filtered)
+}
@@ -0,0 +1,54 @@
+package sheriff_fiber
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type User struct {
+	Username string `json:"username" groups:"public"`
+	Email    string `json:"email" groups:"personal"`
+}
+
+func newApp() *fiber.App {
+	user := User{Username: "alice", Email: "alice@example.org"}
+	handler := func(c *fiber.Ctx) error {
+		return JSON(c, user)
+	}
+
+	app := fiber.New(fiber.Config{JSONEncoder: JSONMarshal})
+	app.Get("/public", Groups("public"), handler)
+	app.Get("/personal", Groups("public", "personal"), handler)
+	app.Get("/plain", handler)
+	return app
+}
+
+func TestGroups(t *testing.T) {
+	tests := map[string]string{
+		"/public":   `{"username":"alice"}`,
+		"/personal": `{"email":"alice@example.org","username":"alice"}`,
+		"/plain":    `{"username":"alice","email":"alice@example.org"}`,
+	}
+
+	app := newApp()
+	for path, expected := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+		assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get(fiber.HeaderContentType))
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(body), path)
+	}
+}
+
+func TestJSONMarshal_Plain(t *testing.T) {
+	actual, err := JSONMarshal(User{Username: "alice", Email: "alice@example.org"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"username":"alice","email":"alice@example.org"}`, string(actual))
+}
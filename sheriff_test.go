@@ -1,8 +1,14 @@
 package sheriff
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
+	"reflect"
+	"runtime/debug"
+	"strings"
 	"testing"
 	"time"
 
@@ -303,6 +309,37 @@ func TestMarshal_ParentInherit(t *testing.T) {
 
 }
 
+type UserInfoPointers struct {
+	*UserPrivateInfo `groups:"private"`
+	*UserPublicInfo  `groups:"public"`
+}
+
+func TestMarshal_ParentInheritPointer(t *testing.T) {
+	publicInfo := UserPublicInfo{ID: "F94", Email: "hello@hello.com"}
+	privateInfo := UserPrivateInfo{Age: "20"}
+	testModel := UserInfoPointers{
+		UserPrivateInfo: &privateInfo,
+		UserPublicInfo:  &publicInfo,
+	}
+
+	o := &Options{
+		Groups: []string{"public"},
+	}
+
+	actualMap, err := Marshal(o, testModel)
+	assert.NoError(t, err)
+
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(map[string]interface{}{
+		"ID": "F94",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual))
+}
+
 type TimeHackTest struct {
 	ATime time.Time `json:"a_time" groups:"test"`
 }
@@ -696,3 +733,1140 @@ func TestNilArrayAlias(t *testing.T) {
 
 	assert.Equal(t, string(expected), string(actual))
 }
+
+type TraverseProfile struct {
+	Name   string `json:"name" groups:"public"`
+	Secret string `json:"secret" groups:"private"`
+}
+
+func (p TraverseProfile) MarshalJSON() ([]byte, error) {
+	type alias TraverseProfile
+	return json.Marshal(alias(p))
+}
+
+type TraverseModel struct {
+	Profile   TraverseProfile    `json:"profile" groups:"public"`
+	Traversed TraverseProfile    `json:"traversed" groups:"public" sheriff:"traverse"`
+	Pointers  []*TraverseProfile `json:"pointers" groups:"public" sheriff:"traverse"`
+}
+
+func TestMarshal_TraverseMarshalersTag(t *testing.T) {
+	profile := TraverseProfile{Name: "alice", Secret: "s3cr3t"}
+	v := TraverseModel{
+		Profile:   profile,
+		Traversed: profile,
+		Pointers:  []*TraverseProfile{&profile},
+	}
+	o := &Options{Groups: []string{"public"}}
+
+	actualMap, err := Marshal(o, v)
+	assert.NoError(t, err)
+
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(map[string]interface{}{
+		"profile":   map[string]interface{}{"name": "alice", "secret": "s3cr3t"},
+		"traversed": map[string]interface{}{"name": "alice"},
+		"pointers":  []interface{}{map[string]interface{}{"name": "alice"}},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual))
+}
+
+func TestMarshal_TraverseMarshalersOption(t *testing.T) {
+	profile := TraverseProfile{Name: "alice", Secret: "s3cr3t"}
+	v := TraverseModel{
+		Profile:   profile,
+		Traversed: profile,
+	}
+	o := &Options{Groups: []string{"public"}, TraverseMarshalers: true}
+
+	actualMap, err := Marshal(o, v)
+	assert.NoError(t, err)
+
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	assert.NotContains(t, string(actual), "s3cr3t")
+
+	expected, err := json.Marshal(map[string]interface{}{
+		"profile":   map[string]interface{}{"name": "alice"},
+		"traversed": map[string]interface{}{"name": "alice"},
+		"pointers":  nil,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual))
+}
+
+type EmbeddedOmitEmptyChild struct {
+	Foo string `json:"foo" groups:"test"`
+}
+
+type EmbeddedOmitEmptyNilPointer struct {
+	*EmbeddedOmitEmptyChild `json:",omitempty"`
+	Bar                     string `json:"bar"`
+}
+
+type EmbeddedNilPointer struct {
+	*EmbeddedOmitEmptyChild
+	Bar string `json:"bar"`
+}
+
+type EmbeddedOmitEmptyNamed struct {
+	EmbeddedOmitEmptyChild `json:"child,omitempty"`
+	Bar                    string `json:"bar"`
+}
+
+func TestMarshal_EmbeddedOmitEmpty(t *testing.T) {
+	tests := map[string]struct {
+		options  *Options
+		data     interface{}
+		expected map[string]interface{}
+	}{
+		"nil pointer omitempty": {
+			options:  &Options{Groups: []string{"test"}},
+			data:     EmbeddedOmitEmptyNilPointer{Bar: "bar"},
+			expected: map[string]interface{}{"bar": "bar"},
+		},
+		"nil pointer": {
+			options:  &Options{Groups: []string{"test"}},
+			data:     EmbeddedNilPointer{Bar: "bar"},
+			expected: map[string]interface{}{"bar": "bar"},
+		},
+		"named empty after filtering": {
+			options:  &Options{},
+			data:     EmbeddedOmitEmptyNamed{EmbeddedOmitEmptyChild{Foo: "foo"}, "bar"},
+			expected: map[string]interface{}{"bar": "bar"},
+		},
+		"named populated": {
+			options: &Options{Groups: []string{"test"}},
+			data:    EmbeddedOmitEmptyNamed{EmbeddedOmitEmptyChild{Foo: "foo"}, "bar"},
+			expected: map[string]interface{}{
+				"bar":   "bar",
+				"child": map[string]interface{}{"foo": "foo"},
+			},
+		},
+		"pointer populated": {
+			options: &Options{Groups: []string{"test"}},
+			data:    EmbeddedOmitEmptyNilPointer{&EmbeddedOmitEmptyChild{Foo: "foo"}, "bar"},
+			expected: map[string]interface{}{
+				"bar": "bar",
+				"foo": "foo",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actualMap, err := Marshal(test.options, test.data)
+			assert.NoError(t, err)
+
+			actual, err := json.Marshal(actualMap)
+			assert.NoError(t, err)
+
+			expected, err := json.Marshal(test.expected)
+			assert.NoError(t, err)
+
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+type EmbeddedID string
+type EmbeddedCount int
+type EmbeddedTags []string
+type EmbeddedAttributes map[string]string
+
+type EmbeddedNonStructModel struct {
+	EmbeddedID
+	EmbeddedCount      `groups:"admin"`
+	EmbeddedTags       `groups:"test"`
+	EmbeddedAttributes `json:"attributes" groups:"test"`
+	Name               string `json:"name"`
+}
+
+func TestMarshal_EmbeddedNonStruct(t *testing.T) {
+	v := EmbeddedNonStructModel{
+		EmbeddedID:         "42",
+		EmbeddedCount:      3,
+		EmbeddedTags:       EmbeddedTags{"a", "b"},
+		EmbeddedAttributes: EmbeddedAttributes{"foo": "bar"},
+		Name:               "name",
+	}
+
+	tests := map[string]map[string]interface{}{
+		"test": {
+			"EmbeddedID":   "42",
+			"EmbeddedTags": []string{"a", "b"},
+			"attributes":   map[string]string{"foo": "bar"},
+			"name":         "name",
+		},
+		"admin": {
+			"EmbeddedID":    "42",
+			"EmbeddedCount": 3,
+			"name":          "name",
+		},
+	}
+
+	for group, expectedMap := range tests {
+		o := &Options{Groups: []string{group}}
+
+		actualMap, err := Marshal(o, v)
+		assert.NoError(t, err)
+
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+
+		expected, err := json.Marshal(expectedMap)
+		assert.NoError(t, err)
+
+		assert.Equal(t, string(expected), string(actual))
+	}
+
+	// without any group filtering the keys are the same as the ones of encoding/json
+	actualMap, err := Marshal(&Options{Groups: []string{"test", "admin"}}, v)
+	assert.NoError(t, err)
+
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(v)
+	assert.NoError(t, err)
+
+	assert.JSONEq(t, string(expected), string(actual))
+}
+
+type OmitEmptyNestedLeaf struct {
+	Secret string `json:"secret" groups:"admin"`
+}
+
+type OmitEmptyNestedMiddle struct {
+	Leaf OmitEmptyNestedLeaf `json:"leaf"`
+}
+
+type OmitEmptyNestedModel struct {
+	Name          string                `json:"name"`
+	Middle        OmitEmptyNestedMiddle `json:"middle"`
+	Leaf          *OmitEmptyNestedLeaf  `json:"leaf,omitempty"`
+	Attributes    map[string]string     `json:"attributes"`
+	OmitEmptyAttr map[string]string     `json:"omit_empty_attr,omitempty"`
+}
+
+func TestMarshal_OmitEmptyNested(t *testing.T) {
+	v := OmitEmptyNestedModel{
+		Name:          "name",
+		Middle:        OmitEmptyNestedMiddle{OmitEmptyNestedLeaf{"secret"}},
+		Leaf:          &OmitEmptyNestedLeaf{"secret"},
+		Attributes:    map[string]string{},
+		OmitEmptyAttr: map[string]string{},
+	}
+
+	tests := map[string]struct {
+		options  *Options
+		expected map[string]interface{}
+	}{
+		"default": {
+			options: &Options{},
+			expected: map[string]interface{}{
+				"name":       "name",
+				"middle":     map[string]interface{}{"leaf": map[string]interface{}{}},
+				"leaf":       map[string]interface{}{},
+				"attributes": map[string]interface{}{},
+			},
+		},
+		"omit empty nested": {
+			options: &Options{OmitEmptyNested: true},
+			expected: map[string]interface{}{
+				"name": "name",
+			},
+		},
+		"omit empty nested with visible fields": {
+			options: &Options{OmitEmptyNested: true, Groups: []string{"admin"}},
+			expected: map[string]interface{}{
+				"name":   "name",
+				"middle": map[string]interface{}{"leaf": map[string]interface{}{"secret": "secret"}},
+				"leaf":   map[string]interface{}{"secret": "secret"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actualMap, err := Marshal(test.options, v)
+			assert.NoError(t, err)
+
+			actual, err := json.Marshal(actualMap)
+			assert.NoError(t, err)
+
+			expected, err := json.Marshal(test.expected)
+			assert.NoError(t, err)
+
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+type InvalidKeyNested struct {
+	Lookup map[AModel]string `json:"lookup" groups:"test"`
+}
+
+type InvalidKeyModel struct {
+	Items []InvalidKeyNested `json:"items" groups:"test"`
+}
+
+func TestMarshal_InvalidTypeErrorDetails(t *testing.T) {
+	v := InvalidKeyModel{
+		Items: []InvalidKeyNested{
+			{Lookup: map[AModel]string{{AllGroups: true}: "foo"}},
+		},
+	}
+	o := &Options{Groups: []string{"test"}}
+
+	_, err := Marshal(o, v)
+	assert.Error(t, err)
+
+	assert.Equal(t, UnsupportedMapKeyError{Kind: reflect.Struct, Path: "items.0.lookup", MapType: reflect.TypeOf(map[AModel]string{})}, err)
+	assert.Equal(t, "marshaller: unsupported map key kind struct of map[sheriff.AModel]string (at items.0.lookup)", err.Error())
+}
+
+func TestMarshal_InvalidTypeErrorTopLevel(t *testing.T) {
+	m := map[AModel]string{{}: "foo", {AllGroups: true}: "bar", {TestGroup: true}: "baz"}
+	for i := 0; i < 10; i++ {
+		_, err := Marshal(&Options{}, m)
+		assert.Equal(t, UnsupportedMapKeyError{Kind: reflect.Struct, MapType: reflect.TypeOf(m)}, err)
+		assert.Equal(t, "marshaller: unsupported map key kind struct of map[sheriff.AModel]string", err.Error())
+	}
+
+	// the key type is checked before truncating the map
+	_, err := Marshal(&Options{MaxMapLen: 1, TruncateOverflow: true}, m)
+	assert.Equal(t, UnsupportedMapKeyError{Kind: reflect.Struct, MapType: reflect.TypeOf(m)}, err)
+
+	_, err = MarshalAll(map[AModel]string{{}: "foo"}, map[string]*Options{"a": {}})
+	assert.Equal(t, UnsupportedMapKeyError{Kind: reflect.Struct, MapType: reflect.TypeOf(map[AModel]string{})}, err)
+}
+
+type DeepNode struct {
+	Value int       `json:"value"`
+	Next  *DeepNode `json:"next"`
+}
+
+func deepChain(n int) *DeepNode {
+	var head *DeepNode
+	for i := 0; i < n; i++ {
+		head = &DeepNode{Value: i, Next: head}
+	}
+	return head
+}
+
+func TestMarshal_MaxDepth(t *testing.T) {
+	_, err := Marshal(&Options{}, deepChain(100000))
+
+	var maxDepthErr MaxDepthError
+	assert.True(t, errors.As(err, &maxDepthErr))
+	assert.Equal(t, DefaultMaxDepth, maxDepthErr.MaxDepth)
+	assert.True(t, strings.HasPrefix(maxDepthErr.Path, "next.next."))
+
+	_, err = Marshal(&Options{MaxDepth: 3}, deepChain(5))
+	assert.Equal(t, MaxDepthError{MaxDepth: 3, Path: "next.next.next.value"}, err)
+	assert.Equal(t, "marshaller: maximum depth of 3 exceeded at next.next.next.value", err.Error())
+}
+
+func TestMarshal_MaxDepthWithinLimit(t *testing.T) {
+	actualMap, err := Marshal(&Options{MaxDepth: 3}, deepChain(3))
+	assert.NoError(t, err)
+
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"next":{"next":{"next":null,"value":0},"value":1},"value":2}`, string(actual))
+}
+
+func TestMarshal_DeepDataDoesNotGrowStack(t *testing.T) {
+	// marshalling doesn't recurse, so a stack far smaller than the data's depth suffices
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	n := 200000
+	actualMap, err := Marshal(&Options{MaxDepth: 2 * n}, deepChain(n))
+	assert.NoError(t, err)
+
+	depth := 0
+	for node, ok := actualMap.(map[string]interface{}); ok; node, ok = node["next"].(map[string]interface{}) {
+		assert.Equal(t, n-1-depth, node["value"])
+		depth++
+	}
+	assert.Equal(t, n, depth)
+}
+
+type NilElementItem struct {
+	Name   string `json:"name" groups:"test"`
+	Secret string `json:"secret" groups:"admin"`
+}
+
+type NilElementModel struct {
+	Items  []*NilElementItem          `json:"items" groups:"test"`
+	Lookup map[string]*NilElementItem `json:"lookup" groups:"test"`
+}
+
+func TestMarshal_NilPointerElements(t *testing.T) {
+	v := NilElementModel{
+		Items: []*NilElementItem{nil, {Name: "foo", Secret: "secret"}, nil},
+		Lookup: map[string]*NilElementItem{
+			"a": nil,
+			"b": {Name: "bar", Secret: "secret"},
+		},
+	}
+	o := &Options{Groups: []string{"test"}}
+
+	actualMap, err := Marshal(o, v)
+	assert.NoError(t, err)
+
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(map[string]interface{}{
+		"items": []interface{}{nil, map[string]interface{}{"name": "foo"}, nil},
+		"lookup": map[string]interface{}{
+			"a": nil,
+			"b": map[string]interface{}{"name": "bar"},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual))
+}
+
+type TextMarshalerKey struct {
+	Prefix string
+	ID     int
+}
+
+func (k TextMarshalerKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%s-%d", k.Prefix, k.ID)), nil
+}
+
+func TestMarshal_TopLevelMap(t *testing.T) {
+	users := map[int]AModel{
+		1: {AllGroups: true, TestGroup: true},
+		2: {AllGroups: false, TestGroup: true},
+	}
+	textKeyed := map[TextMarshalerKey]AModel{
+		{"user", 1}: {AllGroups: true, TestGroup: true},
+	}
+	var nilMap map[int]AModel
+
+	tests := map[string]struct {
+		data     interface{}
+		expected interface{}
+	}{
+		"int keys": {
+			data: users,
+			expected: map[string]interface{}{
+				"1": map[string]interface{}{"something": true},
+				"2": map[string]interface{}{"something": false},
+			},
+		},
+		"pointer to map": {
+			data: &users,
+			expected: map[string]interface{}{
+				"1": map[string]interface{}{"something": true},
+				"2": map[string]interface{}{"something": false},
+			},
+		},
+		"text marshaler keys": {
+			data: textKeyed,
+			expected: map[string]interface{}{
+				"user-1": map[string]interface{}{"something": true},
+			},
+		},
+		"nil map": {
+			data:     nilMap,
+			expected: nil,
+		},
+		"nil pointer to map": {
+			data:     (*map[int]AModel)(nil),
+			expected: nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := Marshal(&Options{Groups: []string{"test"}}, test.data)
+			assert.NoError(t, err)
+			if test.expected == nil {
+				assert.Nil(t, actual)
+				return
+			}
+			assert.IsType(t, map[string]interface{}{}, actual)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+type InterfaceFieldModel struct {
+	Data interface{} `json:"data" groups:"test"`
+}
+
+func TestMarshal_InterfaceFieldContents(t *testing.T) {
+	tests := map[string]struct {
+		data     interface{}
+		expected interface{}
+	}{
+		"nil pointer": {
+			data:     (*NilElementItem)(nil),
+			expected: nil,
+		},
+		"pointer": {
+			data:     &NilElementItem{Name: "foo", Secret: "secret"},
+			expected: map[string]interface{}{"name": "foo"},
+		},
+		"slice of pointers": {
+			data: []*NilElementItem{{Name: "foo", Secret: "secret"}, nil},
+			expected: []interface{}{
+				map[string]interface{}{"name": "foo"},
+				nil,
+			},
+		},
+		"map of structs": {
+			data: map[string]NilElementItem{"a": {Name: "foo", Secret: "secret"}},
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{"name": "foo"},
+			},
+		},
+		"nil": {
+			data:     nil,
+			expected: nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actualMap, err := Marshal(&Options{Groups: []string{"test"}}, InterfaceFieldModel{Data: test.data})
+			assert.NoError(t, err)
+
+			actual, err := json.Marshal(actualMap)
+			assert.NoError(t, err)
+
+			expected, err := json.Marshal(map[string]interface{}{"data": test.expected})
+			assert.NoError(t, err)
+
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestMarshal_TopLevelNilPointer(t *testing.T) {
+	actual, err := Marshal(&Options{}, (*NilElementItem)(nil))
+	assert.NoError(t, err)
+	assert.Nil(t, actual)
+}
+
+type DuplicateKeyEmbedded struct {
+	Name string `json:"name" groups:"admin"`
+}
+
+type DuplicateKeyModel struct {
+	DuplicateKeyEmbedded
+	Title string `json:"title"`
+	Label string `json:"name" groups:"public"`
+}
+
+func TestMarshal_ErrOnDuplicateKeys(t *testing.T) {
+	v := DuplicateKeyModel{
+		DuplicateKeyEmbedded: DuplicateKeyEmbedded{Name: "embedded"},
+		Title:                "title",
+		Label:                "label",
+	}
+
+	// without the option the later field silently wins
+	actual, err := Marshal(&Options{Groups: []string{"public", "admin"}}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "label", "title": "title"}, actual)
+
+	// the collision only exists if both groups are requested
+	actual, err = Marshal(&Options{Groups: []string{"public"}, ErrOnDuplicateKeys: true}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "label", "title": "title"}, actual)
+
+	_, err = Marshal(&Options{Groups: []string{"public", "admin"}, ErrOnDuplicateKeys: true}, v)
+	assert.Equal(t, DuplicateKeyError{
+		Type:       reflect.TypeOf(v),
+		Key:        "name",
+		Field:      "DuplicateKeyEmbedded",
+		OtherField: "Label",
+	}, err)
+	assert.Equal(t, `marshaller: fields DuplicateKeyEmbedded and Label of sheriff.DuplicateKeyModel are both marshalled to key "name"`, err.Error())
+}
+
+type DuplicateKeyNested struct {
+	Items []DuplicateKeyModel `json:"items"`
+}
+
+func TestMarshal_ErrOnDuplicateKeysNested(t *testing.T) {
+	v := DuplicateKeyNested{Items: []DuplicateKeyModel{{Label: "label"}}}
+
+	_, err := Marshal(&Options{Groups: []string{"public", "admin"}, ErrOnDuplicateKeys: true}, v)
+	var duplicateKeyErr DuplicateKeyError
+	assert.True(t, errors.As(err, &duplicateKeyErr))
+	assert.Equal(t, "items.0", duplicateKeyErr.Path)
+}
+
+type ZeroStructRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// ZeroStructCustom considers itself zero if Value is "zero", regardless of the other fields.
+type ZeroStructCustom struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+func (z *ZeroStructCustom) IsZero() bool {
+	return z.Value == "zero"
+}
+
+type ZeroStructModel struct {
+	Window      ZeroStructRange  `json:"window,omitempty"`
+	OtherWindow ZeroStructRange  `json:"other_window,omitempty"`
+	NoOmit      ZeroStructRange  `json:"no_omit"`
+	Custom      ZeroStructCustom `json:"custom,omitempty"`
+	Time        time.Time        `json:"time,omitempty"`
+}
+
+func TestMarshal_TreatZeroStructsAsEmpty(t *testing.T) {
+	v := &ZeroStructModel{
+		OtherWindow: ZeroStructRange{To: 1},
+		Custom:      ZeroStructCustom{Value: "zero", Count: 3},
+	}
+
+	actualMap, err := Marshal(&Options{}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"custom":{"count":3,"value":"zero"},"no_omit":{"from":0,"to":0},"other_window":{"from":0,"to":1},"time":"0001-01-01T00:00:00Z","window":{"from":0,"to":0}}`, string(actual))
+
+	actualMap, err = Marshal(&Options{TreatZeroStructsAsEmpty: true}, v)
+	assert.NoError(t, err)
+	actual, err = json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"no_omit":{"from":0,"to":0},"other_window":{"from":0,"to":1}}`, string(actual))
+}
+
+type ExcludedAsNullModel struct {
+	Name    string `json:"name" groups:"public"`
+	Salary  int    `json:"salary" groups:"private"`
+	Notes   string `json:"notes,omitempty" groups:"private"`
+	Hidden  string `json:"-" groups:"private"`
+	Nested  UserInfo
+	Private *TestGroupsModel `json:"private" groups:"private"`
+}
+
+func TestMarshal_ExcludedAsNull(t *testing.T) {
+	v := ExcludedAsNullModel{
+		Name:   "alice",
+		Salary: 100,
+		Hidden: "hidden",
+		Nested: UserInfo{
+			UserPrivateInfo: UserPrivateInfo{Age: "20"},
+			UserPublicInfo:  UserPublicInfo{ID: "F94", Email: "hello@hello.com"},
+		},
+		Private: &TestGroupsModel{},
+	}
+
+	actualMap, err := Marshal(&Options{Groups: []string{"public"}, ExcludedAsNull: true}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Nested":{"Age":null,"Email":null,"ID":"F94"},"name":"alice","private":null,"salary":null}`, string(actual))
+
+	actualMap, err = Marshal(&Options{Groups: []string{"public"}}, v)
+	assert.NoError(t, err)
+	actual, err = json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Nested":{"ID":"F94"},"name":"alice"}`, string(actual))
+}
+
+type OnExcludedItem struct {
+	Name  string `json:"name" groups:"public"`
+	Price int    `json:"price" groups:"private"`
+}
+
+type OnExcludedModel struct {
+	UserInfo
+	Name   string           `json:"name" groups:"public"`
+	Salary int              `json:"salary" groups:"private,admin"`
+	Notes  string           `json:"notes,omitempty" groups:"private"`
+	Hidden string           `json:"-" groups:"private"`
+	Items  []OnExcludedItem `json:"items" groups:"public"`
+	Item   OnExcludedItem   `json:"item" groups:"private"`
+}
+
+func TestMarshal_OnExcluded(t *testing.T) {
+	v := OnExcludedModel{
+		UserInfo: UserInfo{UserPublicInfo: UserPublicInfo{ID: "F94"}},
+		Name:     "alice",
+		Items:    []OnExcludedItem{{Name: "a"}, {Name: "b"}},
+	}
+
+	type excluded struct {
+		path   string
+		field  string
+		groups []string
+	}
+	var calls []excluded
+	options := &Options{
+		Groups: []string{"public"},
+		OnExcluded: func(path string, field reflect.StructField, groups []string) {
+			calls = append(calls, excluded{path, field.Name, groups})
+		},
+	}
+
+	actualMap, err := Marshal(options, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"ID":"F94","items":[{"name":"a"},{"name":"b"}],"name":"alice"}`, string(actual))
+
+	assert.Equal(t, []excluded{
+		{"UserInfo.UserPrivateInfo.Age", "Age", []string{"private"}},
+		{"UserInfo.UserPublicInfo.Email", "Email", []string{"private"}},
+		{"salary", "Salary", []string{"private", "admin"}},
+		{"items.0.price", "Price", []string{"private"}},
+		{"items.1.price", "Price", []string{"private"}},
+		{"item", "Item", []string{"private"}},
+	}, calls)
+}
+
+// BinaryValue implements encoding.BinaryMarshaler with a value receiver.
+type BinaryValue struct {
+	A, B byte
+}
+
+func (b BinaryValue) MarshalBinary() ([]byte, error) {
+	return []byte{b.A, b.B}, nil
+}
+
+// BinaryPointer implements encoding.BinaryMarshaler with a pointer receiver.
+type BinaryPointer struct {
+	A byte
+}
+
+func (b *BinaryPointer) MarshalBinary() ([]byte, error) {
+	return []byte{b.A}, nil
+}
+
+type BinaryModel struct {
+	Value      BinaryValue              `json:"value"`
+	Pointer    BinaryPointer            `json:"pointer"`
+	PointerPtr *BinaryPointer           `json:"pointer_ptr"`
+	Map        map[string]BinaryPointer `json:"map"`
+	Slice      []BinaryPointer          `json:"slice"`
+	Interface  interface{}              `json:"interface"`
+}
+
+func TestMarshal_UseBinaryMarshaler(t *testing.T) {
+	v := BinaryModel{
+		Value:      BinaryValue{1, 2},
+		Pointer:    BinaryPointer{3},
+		PointerPtr: &BinaryPointer{4},
+		Map:        map[string]BinaryPointer{"a": {5}},
+		Slice:      []BinaryPointer{{6}},
+		Interface:  BinaryPointer{7},
+	}
+
+	actual, err := Marshal(&Options{UseBinaryMarshaler: true}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"value":       []byte{1, 2},
+		"pointer":     []byte{3},
+		"pointer_ptr": []byte{4},
+		"map":         map[string]interface{}{"a": []byte{5}},
+		"slice":       []interface{}{[]byte{6}},
+		"interface":   []byte{7},
+	}, actual)
+
+	actual, err = Marshal(&Options{}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"A": byte(1), "B": byte(2)}, actual.(map[string]interface{})["value"])
+}
+
+// ValuerColumn implements driver.Valuer with a value receiver.
+type ValuerColumn struct {
+	value   string
+	invalid bool
+}
+
+func (c ValuerColumn) Value() (driver.Value, error) {
+	if c.invalid {
+		return nil, errValuerInvalid
+	}
+	if c.value == "" {
+		return nil, nil
+	}
+	return c.value, nil
+}
+
+// ValuerCounter implements driver.Valuer with a pointer receiver.
+type ValuerCounter struct {
+	Count int64
+}
+
+func (c *ValuerCounter) Value() (driver.Value, error) {
+	return c.Count, nil
+}
+
+var errValuerInvalid = errors.New("invalid column")
+
+type ValuerModel struct {
+	Column    ValuerColumn             `json:"column"`
+	Null      ValuerColumn             `json:"null"`
+	ColumnPtr *ValuerColumn            `json:"column_ptr"`
+	Counter   ValuerCounter            `json:"counter"`
+	Counters  map[string]ValuerCounter `json:"counters"`
+	Interface interface{}              `json:"interface"`
+	Invalid   []ValuerColumn           `json:"invalid,omitempty"`
+}
+
+func TestMarshal_UseValuer(t *testing.T) {
+	v := ValuerModel{
+		Column:    ValuerColumn{value: "a"},
+		ColumnPtr: &ValuerColumn{value: "b"},
+		Counter:   ValuerCounter{Count: 1},
+		Counters:  map[string]ValuerCounter{"x": {Count: 2}},
+		Interface: ValuerColumn{value: "c"},
+	}
+
+	actualMap, err := Marshal(&Options{UseValuer: true}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"column":"a","column_ptr":"b","counter":1,"counters":{"x":2},"interface":"c","null":null}`, string(actual))
+
+	// without the option, the internals are marshalled
+	actualMap, err = Marshal(&Options{}, v)
+	assert.NoError(t, err)
+	actual, err = json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"column":{},"column_ptr":{},"counter":{"Count":1},"counters":{"x":{"Count":2}},"interface":{},"null":{}}`, string(actual))
+}
+
+func TestMarshal_UseValuerError(t *testing.T) {
+	v := ValuerModel{Invalid: []ValuerColumn{{value: "a"}, {invalid: true}}}
+
+	_, err := Marshal(&Options{UseValuer: true}, v)
+	assert.Equal(t, ValuerError{Type: reflect.TypeOf(ValuerColumn{}), Path: "invalid.1", Err: errValuerInvalid}, err)
+	assert.True(t, errors.Is(err, errValuerInvalid))
+	assert.Equal(t, "marshaller: Value of sheriff.ValuerColumn failed: invalid column (at invalid.1)", err.Error())
+}
+
+type GroupsSpacingModel struct {
+	Unspaced string `json:"unspaced" groups:"admin,billing"`
+	Spaced   string `json:"spaced" groups:" admin, billing "`
+	Empty    string `json:"empty" groups:"admin,,billing,"`
+	Other    string `json:"other" groups:"other"`
+}
+
+func TestMarshal_GroupsSpacing(t *testing.T) {
+	v := GroupsSpacingModel{Unspaced: "unspaced", Spaced: "spaced", Empty: "empty", Other: "other"}
+
+	for _, groups := range [][]string{{"billing"}, {" billing"}, {"billing", ""}, {"", " admin "}} {
+		actualMap, err := Marshal(&Options{Groups: groups}, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"empty":"empty","spaced":"spaced","unspaced":"unspaced"}`, string(actual), "%q", groups)
+	}
+
+	// an empty group doesn't match the empty entries of the tags
+	actualMap, err := Marshal(&Options{Groups: []string{""}}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, actualMap)
+
+	actual, err := json.Marshal(JSON(v, "", "billing, other,"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"empty":"empty","other":"other","spaced":"spaced","unspaced":"unspaced"}`, string(actual))
+}
+
+func TestMarshal_StrictGroups(t *testing.T) {
+	v := GroupsSpacingModel{}
+
+	_, err := Marshal(&Options{Groups: []string{"admin"}, StrictGroups: true}, v)
+	assert.Equal(t, InvalidGroupsTagError{Type: reflect.TypeOf(v), Field: "Empty", Tag: "admin,,billing,"}, err)
+	assert.Equal(t, `marshaller: groups tag "admin,,billing," of field Empty of sheriff.GroupsSpacingModel contains an empty group`, err.Error())
+
+	// spaces are fine
+	actual, err := Marshal(&Options{Groups: []string{"admin"}, StrictGroups: true}, struct {
+		Spaced string `json:"spaced" groups:" admin, billing "`
+	}{"spaced"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"spaced": "spaced"}, actual)
+}
+
+type OmitEmptyGroupsModel struct {
+	Name     string   `json:"name,omitempty" groups:"public,admin"`
+	Nickname string   `json:"nickname,omitempty" groups:"public,admin"`
+	Tags     []string `json:"tags,omitempty" groups:"public,admin"`
+	Notes    string   `json:"notes,omitempty" groups:"admin"`
+}
+
+func TestMarshal_OmitEmptyGroups(t *testing.T) {
+	v := OmitEmptyGroupsModel{Name: "alice"}
+
+	tests := []struct {
+		groups   []string
+		expected string
+	}{
+		{[]string{"public"}, `{"name":"alice"}`},
+		{[]string{"admin"}, `{"name":"alice","nickname":"","notes":"","tags":null}`},
+		// a group honoring omitempty wins
+		{[]string{"admin", "public"}, `{"name":"alice"}`},
+		{nil, `{}`},
+	}
+	for _, test := range tests {
+		actualMap, err := Marshal(&Options{Groups: test.groups, OmitEmptyGroups: []string{"public"}}, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, string(actual), "%v", test.groups)
+	}
+
+	// without OmitEmptyGroups, omitempty is always honored
+	actualMap, err := Marshal(&Options{Groups: []string{"admin"}}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"alice"}`, string(actual))
+}
+
+type TagPredicateContact struct {
+	Phone string `json:"phone" pii:"true" groups:"admin"`
+	City  string `json:"city" groups:"public,admin"`
+}
+
+type TagPredicateModel struct {
+	TagPredicateContact
+	Name    string              `json:"name" groups:"public,admin"`
+	Email   string              `json:"email" pii:"true" groups:"public,admin"`
+	Salary  int                 `json:"salary" pii:"false" groups:"admin"`
+	Nested  TagPredicateContact `json:"nested" groups:"public,admin"`
+	Private TagPredicateContact `json:"private" pii:"true" groups:"public,admin"`
+}
+
+func TestMarshal_TagPredicates(t *testing.T) {
+	contact := TagPredicateContact{Phone: "123", City: "Zurich"}
+	v := TagPredicateModel{
+		TagPredicateContact: contact,
+		Name:                "alice",
+		Email:               "alice@example.org",
+		Salary:              100,
+		Nested:              contact,
+		Private:             contact,
+	}
+	noPII := map[string]func(string) bool{
+		"pii": func(value string) bool { return value != "true" },
+	}
+
+	tests := []struct {
+		groups   []string
+		expected string
+	}{
+		{[]string{"public"}, `{"city":"Zurich","name":"alice","nested":{"city":"Zurich"}}`},
+		{[]string{"admin"}, `{"city":"Zurich","name":"alice","nested":{"city":"Zurich"},"salary":100}`},
+	}
+	for _, test := range tests {
+		actualMap, err := Marshal(&Options{Groups: test.groups, TagPredicates: noPII}, v)
+		assert.NoError(t, err)
+		actual, err := json.Marshal(actualMap)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, string(actual), "%v", test.groups)
+	}
+
+	// without predicates, only groups apply
+	actualMap, err := Marshal(&Options{Groups: []string{"admin"}}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"city":"Zurich","email":"alice@example.org","name":"alice","nested":{"city":"Zurich","phone":"123"},"phone":"123","private":{"city":"Zurich","phone":"123"},"salary":100}`, string(actual))
+}
+
+type TruncateNested struct {
+	Text string `json:"text"`
+}
+
+type TruncateModel struct {
+	Title  string            `json:"title" sheriff:"maxlen=5"`
+	Body   string            `json:"body"`
+	Emoji  string            `json:"emoji" sheriff:"maxlen=2"`
+	Tags   []string          `json:"tags" sheriff:"maxlen=3"`
+	Attrs  map[string]string `json:"attrs" sheriff:"maxlen=3"`
+	Nested TruncateNested    `json:"nested" sheriff:"maxlen=4"`
+	Full   string            `json:"full" sheriff:"maxlen=0"`
+	Short  string            `json:"short" sheriff:"maxlen=10"`
+}
+
+func TestMarshal_MaxStringLen(t *testing.T) {
+	v := TruncateModel{
+		Title:  "Hello World",
+		Body:   "a very long body",
+		Emoji:  "🙂🙃😀",
+		Tags:   []string{"golang", "go"},
+		Attrs:  map[string]string{"description": "hello"},
+		Nested: TruncateNested{Text: "nested text"},
+		Full:   "never truncated",
+		Short:  "short",
+	}
+
+	actual, err := Marshal(&Options{}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"title":  "Hello…(truncated 6 bytes)",
+		"body":   "a very long body",
+		"emoji":  "🙂🙃…(truncated 4 bytes)",
+		"tags":   []interface{}{"gol…(truncated 3 bytes)", "go"},
+		"attrs":  map[string]interface{}{"description": "hel…(truncated 2 bytes)"},
+		"nested": map[string]interface{}{"text": "nest…(truncated 7 bytes)"},
+		"full":   "never truncated",
+		"short":  "short",
+	}, actual)
+
+	actual, err = Marshal(&Options{MaxStringLen: 6}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, "a very…(truncated 10 bytes)", actual.(map[string]interface{})["body"])
+	assert.Equal(t, "Hello…(truncated 6 bytes)", actual.(map[string]interface{})["title"])
+	assert.Equal(t, "never truncated", actual.(map[string]interface{})["full"])
+
+	_, err = Marshal(&Options{}, struct {
+		Invalid string `sheriff:"maxlen=x"`
+	}{})
+	assert.EqualError(t, err, `marshaller: invalid maxlen "x" of field Invalid of struct { Invalid string "sheriff:\"maxlen=x\"" }`)
+}
+
+type MapKeyFilterModel struct {
+	Attributes map[string]string         `json:"attributes"`
+	Settings   map[string]string         `json:"settings"`
+	Nested     map[string]map[int]string `json:"nested"`
+	Hidden     map[string]string         `json:"hidden,omitempty"`
+}
+
+func TestMarshal_MapKeyFilter(t *testing.T) {
+	v := MapKeyFilterModel{
+		Attributes: map[string]string{"color": "red", "internal_notes": "secret"},
+		Settings:   map[string]string{"internal_notes": "kept"},
+		Nested:     map[string]map[int]string{"a": {1: "one", 2: "two"}},
+		Hidden:     map[string]string{"internal_notes": "secret"},
+	}
+
+	var paths []string
+	options := &Options{
+		MapKeyFilter: func(path string, key string) bool {
+			paths = append(paths, path+":"+key)
+			switch path {
+			case "attributes", "hidden":
+				return key != "internal_notes"
+			case "nested.a":
+				return key != "2"
+			}
+			return true
+		},
+	}
+
+	actualMap, err := Marshal(options, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"attributes":{"color":"red"},"hidden":{},"nested":{"a":{"1":"one"}},"settings":{"internal_notes":"kept"}}`, string(actual))
+	assert.Contains(t, paths, "nested:a")
+	assert.Contains(t, paths, "nested.a:2")
+}
+
+func TestMarshal_NestedGroupsMapIsLazy(t *testing.T) {
+	s := newMarshalState(&Options{Groups: []string{"test"}})
+	_, err := s.marshal(reflect.ValueOf(TestGroupsModel{DefaultMarshal: "DefaultMarshal"}))
+	assert.NoError(t, err)
+	assert.Nil(t, s.nestedGroupsMap)
+
+	s = newMarshalState(&Options{Groups: []string{"public"}})
+	_, err = s.marshal(reflect.ValueOf(UserInfo{UserPublicInfo: UserPublicInfo{ID: "F94"}}))
+	assert.NoError(t, err)
+	assert.NotNil(t, s.nestedGroupsMap)
+}
+
+type PrimitiveLevel int
+
+type PrimitivesModel struct {
+	Bool    bool           `json:"bool"`
+	Int     int            `json:"int"`
+	Int8    int8           `json:"int8"`
+	Int64   int64          `json:"int64"`
+	Uint    uint           `json:"uint"`
+	Uint16  uint16         `json:"uint16"`
+	Uint64  uint64         `json:"uint64"`
+	Float32 float32        `json:"float32"`
+	Float64 float64        `json:"float64"`
+	String  string         `json:"string"`
+	Level   PrimitiveLevel `json:"level"`
+}
+
+func TestMarshal_PrimitiveTypes(t *testing.T) {
+	v := PrimitivesModel{true, -1, -8, -64, 1, 16, 64, 0.5, 1.5, "str", 3}
+	expected := map[string]interface{}{
+		"bool":    true,
+		"int":     -1,
+		"int8":    int8(-8),
+		"int64":   int64(-64),
+		"uint":    uint(1),
+		"uint16":  uint16(16),
+		"uint64":  uint64(64),
+		"float32": float32(0.5),
+		"float64": 1.5,
+		"string":  "str",
+		"level":   PrimitiveLevel(3),
+	}
+
+	// fields of structs passed by pointer are addressable, the ones of structs passed by value aren't
+	for _, data := range []interface{}{v, &v} {
+		actual, err := Marshal(&Options{}, data)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+type FailingKey struct {
+	Name string
+}
+
+func (k FailingKey) MarshalText() ([]byte, error) {
+	if k.Name == "bad" {
+		return nil, errors.New("bad key")
+	}
+	return []byte(k.Name), nil
+}
+
+type MapKeyModel struct {
+	Lookup map[FailingKey]int `json:"lookup"`
+	Ints   map[int64]int      `json:"ints"`
+}
+
+func TestMarshal_MapKeys(t *testing.T) {
+	actual, err := Marshal(&Options{}, MapKeyModel{
+		Lookup: map[FailingKey]int{{"good"}: 1},
+		Ints:   map[int64]int{-5: 1, 1234567890123: 2},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"lookup": map[string]interface{}{"good": 1},
+		"ints":   map[string]interface{}{"-5": 1, "1234567890123": 2},
+	}, actual)
+}
+
+func TestMarshal_MapKeyError(t *testing.T) {
+	_, err := Marshal(&Options{}, MapKeyModel{Lookup: map[FailingKey]int{{"bad"}: 1}})
+	assert.Equal(t, "marshaller: MarshalText of map key sheriff.FailingKey failed: bad key (at lookup)", err.Error())
+	var keyErr MapKeyError
+	assert.True(t, errors.As(err, &keyErr))
+	assert.Equal(t, reflect.TypeOf(FailingKey{}), keyErr.Type)
+	assert.EqualError(t, errors.Unwrap(err), "bad key")
+}
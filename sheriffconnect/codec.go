@@ -0,0 +1,47 @@
+package sheriffconnect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// codec is a connect.Codec like the default JSON codec, except that it writes the results of the Interceptor
+// in place of the messages they belong to.
+type codec struct {
+	name        string
+	interceptor *Interceptor
+}
+
+// Name implements connect.Codec.
+func (c *codec) Name() string {
+	return c.name
+}
+
+// Marshal implements connect.Codec.
+func (c *codec) Marshal(message any) ([]byte, error) {
+	if filtered, ok := c.interceptor.filtered.LoadAndDelete(message); ok {
+		return json.Marshal(filtered)
+	}
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("sheriff: %T is neither filtered nor a proto.Message", message)
+	}
+	return protojson.Marshal(protoMessage)
+}
+
+// Unmarshal implements connect.Codec.
+func (c *codec) Unmarshal(data []byte, message any) error {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return fmt.Errorf("sheriff: %T is not a proto.Message", message)
+	}
+	if len(data) == 0 {
+		return errors.New("zero-length payload is not a valid JSON object")
+	}
+	// unknown fields are discarded like the default codec does
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, protoMessage)
+}
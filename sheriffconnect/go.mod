@@ -0,0 +1,16 @@
+module github.com/peoplecentrix/sheriff/sheriffconnect
+
+go 1.24.0
+
+require (
+	connectrpc.com/connect v1.19.1
+	github.com/peoplecentrix/sheriff v0.0.0-20261016174454-b08b1bfa4df7
+	github.com/stretchr/testify v1.4.0
+	google.golang.org/protobuf v1.36.9
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
@@ -0,0 +1,126 @@
+// Package sheriffconnect filters the responses of Connect handlers using sheriff.
+//
+// The interceptor can't replace the response message of a handler, as its type is fixed by the generated code.
+// It marshals the message using sheriff instead and hands the result to the JSON codec installed along with it,
+// which writes it in place of the message. Responses sent using a binary codec (e.g. the gRPC protocol with
+// protobuf) are passed through untouched.
+//
+//	interceptor := sheriffconnect.NewInterceptor(sheriffconnect.GroupsFromHeader("X-Scopes"))
+//	path, handler := userv1connect.NewUserServiceHandler(svc, interceptor.HandlerOption())
+package sheriffconnect
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"connectrpc.com/connect"
+	"github.com/peoplecentrix/sheriff"
+)
+
+// OptionsFunc returns the options to filter the response of procedure with, given the headers of the request.
+// If it returns nil, the response is passed through untouched.
+type OptionsFunc func(procedure string, header http.Header) *sheriff.Options
+
+// ByProcedure returns an OptionsFunc which looks up the options by procedure, e.g. `/user.v1.UserService/GetUser`.
+func ByProcedure(options map[string]*sheriff.Options) OptionsFunc {
+	return func(procedure string, header http.Header) *sheriff.Options {
+		return options[procedure]
+	}
+}
+
+// GroupsFromHeader returns an OptionsFunc which takes the comma-separated groups from the header name.
+// Responses of requests without that header are passed through untouched.
+func GroupsFromHeader(name string) OptionsFunc {
+	return func(procedure string, header http.Header) *sheriff.Options {
+		values := header.Values(name)
+		if len(values) == 0 {
+			return nil
+		}
+		var groups []string
+		for _, value := range values {
+			groups = append(groups, strings.Split(value, ",")...)
+		}
+		return &sheriff.Options{Groups: groups}
+	}
+}
+
+// Interceptor is a connect.Interceptor filtering the responses of unary handlers.
+// Streaming procedures and clients are passed through untouched.
+//
+// Handlers must not return the same message from concurrent calls, as the filtered result is associated with
+// the message until it is encoded. Such calls fail with an internal error.
+type Interceptor struct {
+	options OptionsFunc
+	// filtered maps the response messages to the results of sheriff.Marshal which the codec writes instead.
+	filtered sync.Map
+}
+
+// NewInterceptor returns an Interceptor filtering responses with the options returned by options.
+func NewInterceptor(options OptionsFunc) *Interceptor {
+	return &Interceptor{options: options}
+}
+
+// HandlerOption returns the option installing the interceptor along with the JSON codecs writing its results.
+func (i *Interceptor) HandlerOption() connect.HandlerOption {
+	return connect.WithHandlerOptions(
+		connect.WithInterceptors(i),
+		connect.WithCodec(&codec{name: "json", interceptor: i}),
+		connect.WithCodec(&codec{name: "json; charset=utf-8", interceptor: i}),
+	)
+}
+
+// WrapUnary implements connect.Interceptor.
+func (i *Interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		res, err := next(ctx, req)
+		if err != nil || req.Spec().IsClient || !isJSON(req) {
+			return res, err
+		}
+		o := i.options(req.Spec().Procedure, req.Header())
+		if o == nil {
+			return res, nil
+		}
+		options := *o
+		// generated messages implement fmt.Stringer, which would leave them to encoding/json unfiltered
+		options.TraverseMarshalers = true
+
+		msg := res.Any()
+		filtered, err := sheriff.Marshal(&options, msg)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("sheriff: filtering response of %s: %w", req.Spec().Procedure, err))
+		}
+		if _, loaded := i.filtered.LoadOrStore(msg, filtered); loaded {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("sheriff: response message of %s is shared with a concurrent call", req.Spec().Procedure))
+		}
+		return res, nil
+	}
+}
+
+// WrapStreamingClient implements connect.Interceptor.
+func (i *Interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements connect.Interceptor.
+func (i *Interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// isJSON reports whether the response to req is encoded using a JSON codec, e.g. for the content types
+// `application/json` or `application/grpc+json`.
+func isJSON(req connect.AnyRequest) bool {
+	contentType := req.Header().Get("Content-Type")
+	if contentType == "" {
+		// unary Connect GET requests pass the codec as query parameter
+		return strings.HasPrefix(req.Peer().Query.Get("encoding"), "json")
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
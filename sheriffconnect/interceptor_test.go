@@ -0,0 +1,122 @@
+package sheriffconnect
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/peoplecentrix/sheriff"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// User stands in for a generated message.
+type User struct {
+	Name    string   `json:"name,omitempty" groups:"public"`
+	Email   string   `json:"email,omitempty" groups:"personal"`
+	Friends []string `json:"friends,omitempty" groups:"public"`
+}
+
+// String implements fmt.Stringer like generated messages do.
+func (x *User) String() string { return "name:" + x.Name }
+
+const procedure = "/user.v1.UserService/GetUser"
+
+func newServer(t *testing.T, options OptionsFunc) *httptest.Server {
+	interceptor := NewInterceptor(options)
+	handler := connect.NewUnaryHandler(procedure, func(ctx context.Context, req *connect.Request[emptypb.Empty]) (*connect.Response[User], error) {
+		return connect.NewResponse(&User{Name: "alice", Email: "alice@example.org", Friends: []string{"bob", "carol"}}), nil
+	}, interceptor.HandlerOption())
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func post(t *testing.T, server *httptest.Server, header http.Header) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, server.URL+procedure, strings.NewReader("{}"))
+	assert.NoError(t, err)
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := server.Client().Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestInterceptor(t *testing.T) {
+	server := newServer(t, GroupsFromHeader("X-Scopes"))
+
+	status, body := post(t, server, http.Header{"X-Scopes": {"public"}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"friends":["bob","carol"],"name":"alice"}`, body)
+
+	status, body = post(t, server, http.Header{"X-Scopes": {"public,personal"}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"email":"alice@example.org","friends":["bob","carol"],"name":"alice"}`, body)
+}
+
+func TestInterceptor_ByProcedure(t *testing.T) {
+	server := newServer(t, ByProcedure(map[string]*sheriff.Options{
+		procedure: {Groups: []string{"personal"}},
+	}))
+
+	status, body := post(t, server, http.Header{})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"email":"alice@example.org"}`, body)
+}
+
+func TestInterceptor_Error(t *testing.T) {
+	server := newServer(t, func(procedure string, header http.Header) *sheriff.Options {
+		return &sheriff.Options{Groups: []string{"public"}, MaxSliceLen: 1}
+	})
+
+	status, body := post(t, server, http.Header{})
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Contains(t, body, `"code":"internal"`)
+	assert.Contains(t, body, "(at friends)")
+}
+
+func TestInterceptor_Binary(t *testing.T) {
+	interceptor := NewInterceptor(GroupsFromHeader("X-Scopes"))
+	msg := &User{Name: "alice", Email: "alice@example.org"}
+	unary := interceptor.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		return connect.NewResponse(msg), nil
+	})
+
+	for _, contentType := range []string{"application/proto", "application/grpc", "application/grpc-web+proto"} {
+		req := connect.NewRequest(&emptypb.Empty{})
+		req.Header().Set("Content-Type", contentType)
+		req.Header().Set("X-Scopes", "public")
+
+		res, err := unary(context.Background(), req)
+		assert.NoError(t, err)
+		assert.Same(t, msg, res.Any())
+		_, ok := interceptor.filtered.Load(msg)
+		assert.False(t, ok, contentType)
+	}
+}
+
+func TestInterceptor_SharedMessage(t *testing.T) {
+	interceptor := NewInterceptor(GroupsFromHeader("X-Scopes"))
+	msg := &User{Name: "alice"}
+	unary := interceptor.WrapUnary(func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		return connect.NewResponse(msg), nil
+	})
+
+	req := connect.NewRequest(&emptypb.Empty{})
+	req.Header().Set("Content-Type", "application/grpc+json")
+	req.Header().Set("X-Scopes", "public")
+
+	_, err := unary(context.Background(), req)
+	assert.NoError(t, err)
+	_, err = unary(context.Background(), req)
+	assert.Equal(t, connect.CodeInternal, connect.CodeOf(err))
+}
@@ -0,0 +1,207 @@
+// Package sherifftest provides assertions for testing the output of sheriff.Marshal, e.g. the groups of a model.
+//
+// Values are compared after encoding them using encoding/json, so the order of keys doesn't matter. Paths are
+// dotted like the paths reported by sheriff, e.g. `users.0.address.city` for the city of the first user.
+package sherifftest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/peoplecentrix/sheriff"
+)
+
+// TestingT is the subset of testing.TB used by the assertions.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertMarshalEqual asserts that input marshalled using options equals expectedJSON. On failure, every differing
+// field is reported with its path.
+func AssertMarshalEqual(t TestingT, options *sheriff.Options, input interface{}, expectedJSON string) bool {
+	t.Helper()
+	actual, err := marshal(options, input)
+	if err != nil {
+		t.Errorf("sherifftest: marshalling %T failed: %v", input, err)
+		return false
+	}
+	expected, err := decode([]byte(expectedJSON))
+	if err != nil {
+		t.Errorf("sherifftest: invalid expected JSON: %v", err)
+		return false
+	}
+
+	if diffs := diff("", expected, actual); len(diffs) > 0 {
+		t.Errorf("sherifftest: %T marshalled with groups %v differs from the expected JSON:\n\t%s", input, options.Groups, strings.Join(diffs, "\n\t"))
+		return false
+	}
+	return true
+}
+
+// AssertFieldHidden asserts that there is no value at path in the output of input marshalled using options.
+// Fields excluded with sheriff.Options.ExcludedAsNull set are visible with a null value.
+func AssertFieldHidden(t TestingT, options *sheriff.Options, input interface{}, path string) bool {
+	t.Helper()
+	actual, err := marshal(options, input)
+	if err != nil {
+		t.Errorf("sherifftest: marshalling %T failed: %v", input, err)
+		return false
+	}
+	if value, ok := lookup(actual, path); ok {
+		t.Errorf("sherifftest: %s of %T marshalled with groups %v is visible: %s", path, input, options.Groups, encode(value))
+		return false
+	}
+	return true
+}
+
+// AssertFieldVisible asserts that there is a value at path in the output of input marshalled using options.
+func AssertFieldVisible(t TestingT, options *sheriff.Options, input interface{}, path string) bool {
+	t.Helper()
+	actual, err := marshal(options, input)
+	if err != nil {
+		t.Errorf("sherifftest: marshalling %T failed: %v", input, err)
+		return false
+	}
+	if _, ok := lookup(actual, path); !ok {
+		t.Errorf("sherifftest: %s of %T marshalled with groups %v is hidden", path, input, options.Groups)
+		return false
+	}
+	return true
+}
+
+// marshal marshals input like json.Marshal(sheriff.Marshal(options, input)) and decodes the result.
+func marshal(options *sheriff.Options, input interface{}) (interface{}, error) {
+	intermediate, err := sheriff.Marshal(options, input)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(intermediate)
+	if err != nil {
+		return nil, err
+	}
+	return decode(b)
+}
+
+// decode decodes b keeping numbers as json.Number, so that large integers are compared exactly.
+func decode(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func encode(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// lookup returns the value at the dotted path within v.
+func lookup(v interface{}, path string) (interface{}, bool) {
+	for _, segment := range strings.Split(path, ".") {
+		switch container := v.(type) {
+		case map[string]interface{}:
+			value, ok := container[segment]
+			if !ok {
+				return nil, false
+			}
+			v = value
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(container) {
+				return nil, false
+			}
+			v = container[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// diff returns a description of every difference between the decoded values expected and actual.
+func diff(path string, expected, actual interface{}) []string {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(e)+len(a))
+		for key := range e {
+			keys = append(keys, key)
+		}
+		for key := range a {
+			if _, ok := e[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, key := range keys {
+			expectedValue, inExpected := e[key]
+			actualValue, inActual := a[key]
+			switch {
+			case !inActual:
+				diffs = append(diffs, fmt.Sprintf("%s: missing, expected %s", joinPath(path, key), encode(expectedValue)))
+			case !inExpected:
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", joinPath(path, key), encode(actualValue)))
+			default:
+				diffs = append(diffs, diff(joinPath(path, key), expectedValue, actualValue)...)
+			}
+		}
+		return diffs
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		var diffs []string
+		if len(e) != len(a) {
+			diffs = append(diffs, fmt.Sprintf("%s: expected %d elements, got %d", displayPath(path), len(e), len(a)))
+		}
+		for i := 0; i < len(e) && i < len(a); i++ {
+			diffs = append(diffs, diff(joinPath(path, strconv.Itoa(i)), e[i], a[i])...)
+		}
+		return diffs
+	case json.Number:
+		// e.g. 1.0 and 1 are the same number
+		if a, ok := actual.(json.Number); ok {
+			ef, errE := e.Float64()
+			af, errA := a.Float64()
+			if e == a || (errE == nil && errA == nil && ef == af) {
+				return nil
+			}
+		}
+	default:
+		if expected == actual {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("%s: expected %s, got %s", displayPath(path), encode(expected), encode(actual))}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
@@ -0,0 +1,93 @@
+package sherifftest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/peoplecentrix/sheriff"
+	"github.com/stretchr/testify/assert"
+)
+
+type Address struct {
+	City   string `json:"city" groups:"public"`
+	Street string `json:"street" groups:"private"`
+}
+
+type User struct {
+	Name      string    `json:"name" groups:"public"`
+	Email     string    `json:"email" groups:"private"`
+	Age       int       `json:"age" groups:"public"`
+	Addresses []Address `json:"addresses" groups:"public"`
+}
+
+func user() User {
+	return User{
+		Name:      "alice",
+		Email:     "alice@example.org",
+		Age:       30,
+		Addresses: []Address{{City: "Zurich", Street: "Bahnhofstrasse"}},
+	}
+}
+
+// recorder is a TestingT recording the reported errors.
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertMarshalEqual(t *testing.T) {
+	options := &sheriff.Options{Groups: []string{"public"}}
+	assert.True(t, AssertMarshalEqual(t, options, user(), `{"addresses":[{"city":"Zurich"}],"age":30.0,"name":"alice"}`))
+	assert.True(t, AssertMarshalEqual(t, options, user(), `{"name":"alice","age":30,"addresses":[{"city":"Zurich"}]}`))
+}
+
+func TestAssertMarshalEqual_Diff(t *testing.T) {
+	r := &recorder{}
+	ok := AssertMarshalEqual(r, &sheriff.Options{Groups: []string{"public", "private"}}, user(), `{"addresses":[{"city":"Bern"},{"city":"Zurich"}],"age":30,"name":"alice","nickname":"ally"}`)
+	assert.False(t, ok)
+	assert.Equal(t, []string{
+		"sherifftest: sherifftest.User marshalled with groups [public private] differs from the expected JSON:\n" +
+			"\taddresses: expected 2 elements, got 1\n" +
+			"\taddresses.0.city: expected \"Bern\", got \"Zurich\"\n" +
+			"\taddresses.0.street: unexpected \"Bahnhofstrasse\"\n" +
+			"\temail: unexpected \"alice@example.org\"\n" +
+			"\tnickname: missing, expected \"ally\"",
+	}, r.errors)
+}
+
+func TestAssertMarshalEqual_Errors(t *testing.T) {
+	r := &recorder{}
+	assert.False(t, AssertMarshalEqual(r, &sheriff.Options{}, user(), `{`))
+	assert.False(t, AssertMarshalEqual(r, &sheriff.Options{Groups: []string{"public"}, MaxDepth: 1}, user(), `{}`))
+	assert.Equal(t, []string{
+		"sherifftest: invalid expected JSON: unexpected EOF",
+		"sherifftest: marshalling sherifftest.User failed: marshaller: maximum depth of 1 exceeded at addresses.0",
+	}, r.errors)
+}
+
+func TestAssertFieldHidden(t *testing.T) {
+	options := &sheriff.Options{Groups: []string{"public"}}
+	assert.True(t, AssertFieldHidden(t, options, user(), "email"))
+	assert.True(t, AssertFieldHidden(t, options, user(), "addresses.0.street"))
+	assert.True(t, AssertFieldHidden(t, options, user(), "addresses.1.city"))
+	assert.True(t, AssertFieldVisible(t, options, user(), "addresses.0.city"))
+
+	r := &recorder{}
+	assert.False(t, AssertFieldHidden(r, options, user(), "addresses.0.city"))
+	assert.False(t, AssertFieldVisible(r, options, user(), "email"))
+	assert.Equal(t, []string{
+		`sherifftest: addresses.0.city of sherifftest.User marshalled with groups [public] is visible: "Zurich"`,
+		`sherifftest: email of sherifftest.User marshalled with groups [public] is hidden`,
+	}, r.errors)
+}
+
+func TestAssertFieldHidden_ExcludedAsNull(t *testing.T) {
+	r := &recorder{}
+	assert.False(t, AssertFieldHidden(r, &sheriff.Options{Groups: []string{"public"}, ExcludedAsNull: true}, user(), "email"))
+	assert.Equal(t, []string{`sherifftest: email of sherifftest.User marshalled with groups [public] is visible: null`}, r.errors)
+}
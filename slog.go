@@ -0,0 +1,57 @@
+package sheriff
+
+import (
+	"log/slog"
+	"sort"
+)
+
+// LogValue marshals data like Marshal does and converts the result into a slog.Value.
+//
+// Objects are converted into nested group values with their keys sorted, so that handlers render them as proper
+// structures and attribute-level middlewares can inspect them. Slices and other values are converted using slog.AnyValue.
+// If data is nil or marshalling fails, a string value describing the problem is returned instead.
+func LogValue(options *Options, data interface{}) slog.Value {
+	intermediate, err := Marshal(options, data)
+	if err != nil {
+		return slog.StringValue("!ERROR: " + err.Error())
+	}
+	if intermediate == nil {
+		return slog.StringValue("<nil>")
+	}
+	return logValue(intermediate)
+}
+
+// LogValuer returns a slog.LogValuer which marshals data using LogValue only once it is actually logged.
+func LogValuer(options *Options, data interface{}) slog.LogValuer {
+	return logValuer{options: options, data: data}
+}
+
+// logValuer is the slog.LogValuer returned by LogValuer.
+type logValuer struct {
+	options *Options
+	data    interface{}
+}
+
+// LogValue implements slog.LogValuer.
+func (l logValuer) LogValue() slog.Value {
+	return LogValue(l.options, l.data)
+}
+
+func logValue(v interface{}) slog.Value {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return slog.AnyValue(v)
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, len(keys))
+	for i, key := range keys {
+		attrs[i] = slog.Attr{Key: key, Value: logValue(m[key])}
+	}
+	return slog.GroupValue(attrs...)
+}
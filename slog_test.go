@@ -0,0 +1,75 @@
+package sheriff
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SlogModel struct {
+	Name     string      `json:"name" groups:"public"`
+	Internal string      `json:"internal" groups:"internal"`
+	Address  FlatAddress `json:"address" groups:"public"`
+	Tags     []string    `json:"tags" groups:"public"`
+}
+
+func slogTestData() SlogModel {
+	return SlogModel{
+		Name:     "alice",
+		Internal: "internal",
+		Address:  FlatAddress{City: "Zurich", Street: "Main"},
+		Tags:     []string{"a", "b"},
+	}
+}
+
+func TestLogValue(t *testing.T) {
+	v := LogValue(&Options{Groups: []string{"public"}}, slogTestData())
+
+	assert.Equal(t, slog.KindGroup, v.Kind())
+	attrs := v.Group()
+	assert.Len(t, attrs, 3)
+	assert.Equal(t, "address", attrs[0].Key)
+	assert.Equal(t, slog.KindGroup, attrs[0].Value.Kind())
+	assert.Equal(t, "city", attrs[0].Value.Group()[0].Key)
+	assert.Equal(t, "name", attrs[1].Key)
+	assert.Equal(t, "alice", attrs[1].Value.String())
+	assert.Equal(t, "tags", attrs[2].Key)
+}
+
+func TestLogValuer_Handlers(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	logger.Info("user", "user", LogValuer(&Options{Groups: []string{"public"}}, slogTestData()))
+	assert.Equal(t, `{"level":"INFO","msg":"user","user":{"address":{"city":"Zurich"},"name":"alice","tags":["a","b"]}}`+"\n", buf.String())
+
+	buf.Reset()
+	logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	logger.Info("user", "user", LogValuer(&Options{Groups: []string{"public"}}, slogTestData()))
+	assert.Equal(t, "level=INFO msg=user user.address.city=Zurich user.name=alice user.tags=\"[a b]\"\n", buf.String())
+}
+
+func TestLogValue_Degraded(t *testing.T) {
+	v := LogValue(&Options{}, nil)
+	assert.Equal(t, slog.KindString, v.Kind())
+	assert.Equal(t, "<nil>", v.String())
+
+	v = LogValue(&Options{}, map[AModel]string{{}: "foo"})
+	assert.Equal(t, slog.KindString, v.Kind())
+	assert.Equal(t, "!ERROR: marshaller: unsupported map key kind struct of map[sheriff.AModel]string", v.String())
+}
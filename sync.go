@@ -0,0 +1,50 @@
+package sheriff
+
+import (
+	"reflect"
+	"sync"
+)
+
+// loadSync returns the contents of v, which is a sync.Map or one of the types of sync/atomic with a Load method
+// (e.g. atomic.Int64, atomic.Value or atomic.Pointer), to be marshalled instead of its internal fields.
+//
+// The entries of a sync.Map are collected into a map keyed by strings, converting the keys like the ones of
+// regular maps are. Values which are modified concurrently are loaded as they are at the time, but the map as a
+// whole isn't a consistent snapshot, the same as sync.Map.Range doesn't guarantee one.
+func (s *marshalState) loadSync(v reflect.Value, kind syncKind) (reflect.Value, error) {
+	p := pointerInterface(v)
+	if kind == atomicValue {
+		return reflect.ValueOf(p).MethodByName("Load").Call(nil)[0], nil
+	}
+
+	entries := make(map[string]interface{})
+	var err error
+	// the keys of a sync.Map may be of any type, so the unsupported key of the lowest kind is reported
+	// to not depend on the order of the keys
+	unsupported := reflect.UnsafePointer + 1
+	p.(*sync.Map).Range(func(key, value interface{}) bool {
+		k := reflect.ValueOf(key)
+		if !k.IsValid() || !isSupportedMapKey(k.Type()) {
+			if k.Kind() < unsupported {
+				unsupported = k.Kind()
+			}
+			return true
+		}
+		keyString, keyErr := s.mapKeyString(k)
+		if keyErr != nil {
+			if err == nil {
+				err = keyErr
+			}
+			return true
+		}
+		entries[keyString] = value
+		return true
+	})
+	if unsupported <= reflect.UnsafePointer {
+		return reflect.Value{}, UnsupportedMapKeyError{Kind: unsupported, Path: s.currentPath(), MapType: v.Type()}
+	}
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(entries), nil
+}
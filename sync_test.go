@@ -0,0 +1,130 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SyncItem struct {
+	Name   string `json:"name" groups:"api"`
+	Secret string `json:"secret" groups:"admin"`
+}
+
+type SyncModel struct {
+	Cache   sync.Map                  `json:"cache" groups:"api"`
+	Counter atomic.Int64              `json:"counter" groups:"api"`
+	Small   atomic.Int32              `json:"small" groups:"api"`
+	Ready   atomic.Bool               `json:"ready" groups:"api"`
+	Value   atomic.Value              `json:"value" groups:"api"`
+	Item    atomic.Pointer[SyncItem]  `json:"item" groups:"api"`
+	Hidden  atomic.Uint64             `json:"hidden" groups:"admin"`
+	Nested  map[string]*atomic.Uint32 `json:"nested" groups:"api"`
+}
+
+func newSyncModel() *SyncModel {
+	m := &SyncModel{Nested: map[string]*atomic.Uint32{"a": new(atomic.Uint32)}}
+	m.Cache.Store("alice", SyncItem{Name: "alice", Secret: "a"})
+	m.Cache.Store(42, SyncItem{Name: "bob", Secret: "b"})
+	m.Counter.Store(7)
+	m.Small.Store(-3)
+	m.Ready.Store(true)
+	m.Value.Store(SyncItem{Name: "value", Secret: "v"})
+	m.Item.Store(&SyncItem{Name: "item", Secret: "i"})
+	m.Hidden.Store(9)
+	m.Nested["a"].Store(5)
+	return m
+}
+
+func TestMarshal_Sync(t *testing.T) {
+	m := newSyncModel()
+	expected := `{"cache":{"42":{"name":"bob"},"alice":{"name":"alice"}},"counter":7,"item":{"name":"item"},` +
+		`"nested":{"a":5},"ready":true,"small":-3,"value":{"name":"value"}}`
+	o := &Options{Groups: []string{"api"}}
+
+	v, err := Marshal(o, m)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(actual))
+
+	appended, err := MarshalAppend(nil, o, m)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(appended))
+
+	all, err := MarshalAll(m, map[string]*Options{"api": o, "admin": {Groups: []string{"admin"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, v, all["api"])
+}
+
+func TestMarshal_SyncEmpty(t *testing.T) {
+	v, err := Marshal(&Options{Groups: []string{"api"}}, &SyncModel{})
+	assert.NoError(t, err)
+	actual, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"cache":{},"counter":0,"item":null,"nested":null,"ready":false,"small":0,"value":null}`, string(actual))
+}
+
+func TestMarshal_SyncRoot(t *testing.T) {
+	var counter atomic.Int64
+	counter.Store(3)
+	v, err := Marshal(&Options{}, &counter)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+
+	var m sync.Map
+	m.Store("a", 1)
+	v, err = Marshal(&Options{}, &m)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": 1}, v)
+}
+
+func TestMarshal_SyncMapInvalidKey(t *testing.T) {
+	m := &SyncModel{}
+	m.Cache.Store(1.5, "float")
+	m.Cache.Store(true, "bool")
+	m.Cache.Store("a", "string")
+	// the unsupported key of the lowest kind is reported, no matter the order of the keys
+	for i := 0; i < 10; i++ {
+		_, err := Marshal(&Options{Groups: []string{"api"}}, m)
+		assert.Equal(t, UnsupportedMapKeyError{Kind: reflect.Bool, Path: "cache", MapType: reflect.TypeOf(sync.Map{})}, err)
+		assert.EqualError(t, err, "marshaller: unsupported map key kind bool of sync.Map (at cache)")
+	}
+}
+
+func TestMarshal_SyncConcurrentMutation(t *testing.T) {
+	m := newSyncModel()
+	o := &Options{Groups: []string{"api"}}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			m.Cache.Store(fmt.Sprint(i%50), SyncItem{Name: fmt.Sprint(i)})
+			m.Cache.Delete(fmt.Sprint((i + 25) % 50))
+			m.Counter.Add(1)
+			m.Value.Store(SyncItem{Name: fmt.Sprint(i)})
+			m.Item.Store(&SyncItem{Name: fmt.Sprint(i)})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		v, err := Marshal(o, m)
+		assert.NoError(t, err)
+		_, err = json.Marshal(v)
+		assert.NoError(t, err)
+	}
+	close(done)
+	wg.Wait()
+}
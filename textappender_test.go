@@ -0,0 +1,111 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// AppenderVersion only implements encoding.TextAppender. Without it, its fields would be marshalled.
+type AppenderVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+}
+
+func (v AppenderVersion) AppendText(b []byte) ([]byte, error) {
+	b = strconv.AppendInt(b, int64(v.Major), 10)
+	b = append(b, '.')
+	return strconv.AppendInt(b, int64(v.Minor), 10), nil
+}
+
+// AppenderBoth implements both encoding.TextMarshaler and encoding.TextAppender and counts their calls.
+type AppenderBoth struct {
+	marshalled *int
+	appended   *int
+}
+
+func (a AppenderBoth) MarshalText() ([]byte, error) {
+	*a.marshalled++
+	return []byte("both"), nil
+}
+
+func (a AppenderBoth) AppendText(b []byte) ([]byte, error) {
+	*a.appended++
+	return append(b, "both"...), nil
+}
+
+type AppenderFailing struct{}
+
+func (AppenderFailing) AppendText(b []byte) ([]byte, error) {
+	return b, errors.New("failing appender")
+}
+
+type AppenderModel struct {
+	Version   AppenderVersion         `json:"version" groups:"api"`
+	Previous  *AppenderVersion        `json:"previous" groups:"api"`
+	ByVersion map[AppenderVersion]int `json:"by_version" groups:"api"`
+	Secret    string                  `json:"secret" groups:"admin"`
+}
+
+func TestMarshal_TextAppender(t *testing.T) {
+	v := AppenderModel{
+		Version:   AppenderVersion{Major: 1, Minor: 2},
+		ByVersion: map[AppenderVersion]int{{Major: 0, Minor: 9}: 3},
+		Secret:    "secret",
+	}
+	options := &Options{Groups: []string{"api"}}
+
+	m, err := Marshal(options, v)
+	assert.NoError(t, err)
+	// the value is left to encoding/json, the map key is converted like encoding/json does
+	assert.Equal(t, map[string]interface{}{"version": v.Version, "previous": nil, "by_version": map[string]interface{}{"0.9": 3}}, m)
+	expected, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"by_version":{"0.9":3},"previous":null,"version":"1.2"}`, string(expected))
+
+	actual, err := MarshalAppend(nil, options, v)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+
+	all, err := MarshalAll(v, map[string]*Options{"a": options, "b": {}})
+	assert.NoError(t, err)
+	assert.Equal(t, m, all["a"])
+
+	m, err = Marshal(&Options{Groups: []string{"api"}, InterfacePreference: []InterfaceKind{InterfaceTextMarshaler}}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2", m.(map[string]interface{})["version"])
+
+	fields, err := Fields(options, v)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2", fields["version"])
+
+	values, err := MarshalValues(options, v)
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"version": {"1.2"}, "by_version.0.9": {"3"}}, values)
+}
+
+func TestMarshalAppend_TextAppenderPreferred(t *testing.T) {
+	var marshalled, appended int
+	v := map[string]interface{}{"a": AppenderBoth{&marshalled, &appended}, "b": AppenderBoth{&marshalled, &appended}}
+
+	actual, err := MarshalAppend(nil, &Options{}, v)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"both","b":"both"}`, string(actual))
+	assert.Equal(t, 0, marshalled)
+	assert.Equal(t, 2, appended)
+
+	actual, err = MarshalCanonical(&Options{}, []interface{}{AppenderVersion{Major: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, `["1.0"]`, string(actual))
+
+	_, err = MarshalAppend(nil, &Options{}, []interface{}{AppenderFailing{}})
+	assert.EqualError(t, err, "failing appender")
+
+	_, err = Marshal(&Options{}, map[AppenderFailing]int{{}: 1})
+	assert.Equal(t, MapKeyError{Type: reflect.TypeOf(AppenderFailing{}), Err: errors.New("failing appender")}, err)
+}
@@ -0,0 +1,120 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TimeEmbedded struct {
+	time.Time
+}
+
+type TimePointerEmbedded struct {
+	*time.Time
+}
+
+type TimePositionsModel struct {
+	Direct          time.Time               `json:"direct" groups:"api"`
+	Pointer         *time.Time              `json:"pointer" groups:"api"`
+	Map             map[string]time.Time    `json:"map" groups:"api"`
+	PointerMap      map[string]*time.Time   `json:"pointer_map" groups:"api"`
+	Slice           []time.Time             `json:"slice" groups:"api"`
+	PointerSlice    []*time.Time            `json:"pointer_slice" groups:"api"`
+	Array           [1]time.Time            `json:"array" groups:"api"`
+	Interface       interface{}             `json:"interface" groups:"api"`
+	PointerIface    interface{}             `json:"pointer_interface" groups:"api"`
+	InterfaceMap    map[string]interface{}  `json:"interface_map" groups:"api"`
+	InterfaceSlice  []interface{}           `json:"interface_slice" groups:"api"`
+	Embedded        TimeEmbedded            `json:"embedded" groups:"api"`
+	PointerEmbedded TimePointerEmbedded     `json:"pointer_embedded" groups:"api"`
+	EmbeddedMap     map[string]TimeEmbedded `json:"embedded_map" groups:"api"`
+	Traversed       map[string]time.Time    `json:"traversed" groups:"api" sheriff:"traverse"`
+	TraversedIface  interface{}             `json:"traversed_interface" groups:"api" sheriff:"traverse"`
+}
+
+func timePositionsModel(t time.Time) TimePositionsModel {
+	return TimePositionsModel{
+		Direct:          t,
+		Pointer:         &t,
+		Map:             map[string]time.Time{"a": t},
+		PointerMap:      map[string]*time.Time{"a": &t},
+		Slice:           []time.Time{t},
+		PointerSlice:    []*time.Time{&t},
+		Array:           [1]time.Time{t},
+		Interface:       t,
+		PointerIface:    &t,
+		InterfaceMap:    map[string]interface{}{"a": t, "b": &t},
+		InterfaceSlice:  []interface{}{t, &t},
+		Embedded:        TimeEmbedded{t},
+		PointerEmbedded: TimePointerEmbedded{&t},
+		EmbeddedMap:     map[string]TimeEmbedded{"a": {t}},
+		Traversed:       map[string]time.Time{"a": t},
+		TraversedIface:  t,
+	}
+}
+
+func TestMarshal_TimePositions(t *testing.T) {
+	tm := time.Date(2017, 1, 20, 18, 11, 0, 0, time.FixedZone("CET", 3600))
+	const ts = `"2017-01-20T18:11:00+01:00"`
+	expected := `{"array":[` + ts + `],"direct":` + ts + `,"embedded":` + ts + `,"embedded_map":{"a":` + ts + `},` +
+		`"interface":` + ts + `,"interface_map":{"a":` + ts + `,"b":` + ts + `},"interface_slice":[` + ts + `,` + ts + `],` +
+		`"map":{"a":` + ts + `},"pointer":` + ts + `,"pointer_embedded":` + ts + `,"pointer_interface":` + ts + `,` +
+		`"pointer_map":{"a":` + ts + `},"pointer_slice":[` + ts + `],"slice":[` + ts + `],` +
+		`"traversed":{"a":` + ts + `},"traversed_interface":` + ts + `}`
+
+	// traversing the structs embedding time.Time brings their only field, which is left to its marshaler,
+	// out as a named field like encoding/json does
+	traversed := strings.NewReplacer(
+		`"embedded":`+ts, `"embedded":{"Time":`+ts+`}`,
+		`"embedded_map":{"a":`+ts+`}`, `"embedded_map":{"a":{"Time":`+ts+`}}`,
+		`"pointer_embedded":`+ts, `"pointer_embedded":{"Time":`+ts+`}`,
+	).Replace(expected)
+
+	for name, test := range map[string]struct {
+		options  *Options
+		expected string
+	}{
+		"groups":     {&Options{Groups: []string{"api"}}, expected},
+		"traverse":   {&Options{Groups: []string{"api"}, TraverseMarshalers: true}, traversed},
+		"truncate":   {&Options{Groups: []string{"api"}, MaxMapLen: 2, TruncateOverflow: true}, expected},
+		"collectAll": {&Options{Groups: []string{"api"}, ErrorPolicy: CollectAll}, expected},
+	} {
+		o, expected := test.options, test.expected
+		t.Run(name, func(t *testing.T) {
+			v, err := Marshal(o, timePositionsModel(tm))
+			assert.NoError(t, err)
+			actual, err := json.Marshal(v)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, string(actual))
+
+			appended, err := MarshalAppend(nil, o, timePositionsModel(tm))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, string(appended))
+
+			all, err := MarshalAll(timePositionsModel(tm), map[string]*Options{"a": o, "b": {Groups: []string{"api", "other"}}})
+			assert.NoError(t, err)
+			actual, err = json.Marshal(all["a"])
+			assert.NoError(t, err)
+			assert.Equal(t, expected, string(actual))
+		})
+	}
+}
+
+func TestMarshal_TimeRoot(t *testing.T) {
+	tm := time.Date(2017, 1, 20, 18, 11, 0, 0, time.UTC)
+	for _, o := range []*Options{{}, {TraverseMarshalers: true}} {
+		for _, data := range []interface{}{tm, &tm, []time.Time{tm}, map[string]*time.Time{"a": &tm}} {
+			v, err := Marshal(o, data)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(v)
+			assert.NoError(t, err)
+			expected, err := json.Marshal(data)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual))
+		}
+	}
+}
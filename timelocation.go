@@ -0,0 +1,23 @@
+package sheriff
+
+import (
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// inTimeLocation converts v to Options.TimeLocation if it's a non-zero time.Time or a pointer to one.
+// Any other value is returned as is.
+func (s *marshalState) inTimeLocation(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Ptr && v.Type().Elem() == timeType {
+		v = v.Elem()
+	} else if v.Type() != timeType {
+		return v
+	}
+	t := v.Interface().(time.Time)
+	if t.IsZero() {
+		return v
+	}
+	return reflect.ValueOf(t.In(s.options.TimeLocation))
+}
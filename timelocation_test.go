@@ -0,0 +1,82 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TimeLocationModel struct {
+	Created  time.Time            `json:"created"`
+	Updated  *time.Time           `json:"updated"`
+	History  []time.Time          `json:"history"`
+	Events   map[string]time.Time `json:"events"`
+	Any      interface{}          `json:"any"`
+	Deleted  time.Time            `json:"deleted,omitempty"`
+	Archived *time.Time           `json:"archived"`
+	Zero     time.Time            `json:"zero"`
+}
+
+func TestMarshal_TimeLocation(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	summer := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	winter := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := TimeLocationModel{
+		Created: summer,
+		Updated: &winter,
+		History: []time.Time{winter, summer},
+		Events:  map[string]time.Time{"signup": summer},
+		Any:     &winter,
+	}
+
+	tests := []struct {
+		name     string
+		options  *Options
+		expected string
+	}{
+		{
+			name:    "utc",
+			options: &Options{},
+			expected: `{"any":"2024-01-01T12:00:00Z","archived":null,"created":"2024-07-01T12:00:00Z","deleted":"0001-01-01T00:00:00Z",` +
+				`"events":{"signup":"2024-07-01T12:00:00Z"},"history":["2024-01-01T12:00:00Z","2024-07-01T12:00:00Z"],` +
+				`"updated":"2024-01-01T12:00:00Z","zero":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:    "new york",
+			options: &Options{TimeLocation: newYork, TreatZeroStructsAsEmpty: true},
+			expected: `{"any":"2024-01-01T07:00:00-05:00","archived":null,"created":"2024-07-01T08:00:00-04:00",` +
+				`"events":{"signup":"2024-07-01T08:00:00-04:00"},"history":["2024-01-01T07:00:00-05:00","2024-07-01T08:00:00-04:00"],` +
+				`"updated":"2024-01-01T07:00:00-05:00","zero":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:    "traversed",
+			options: &Options{TimeLocation: newYork, TraverseMarshalers: true},
+			expected: `{"any":"2024-01-01T07:00:00-05:00","archived":null,"created":"2024-07-01T08:00:00-04:00","deleted":"0001-01-01T00:00:00Z",` +
+				`"events":{"signup":"2024-07-01T08:00:00-04:00"},"history":["2024-01-01T07:00:00-05:00","2024-07-01T08:00:00-04:00"],` +
+				`"updated":"2024-01-01T07:00:00-05:00","zero":"0001-01-01T00:00:00Z"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := Marshal(test.options, v)
+			assert.NoError(t, err)
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			all, err := MarshalAll(v, map[string]*Options{"a": test.options, "b": {}})
+			assert.NoError(t, err)
+			assert.Equal(t, m, all["a"])
+		})
+	}
+
+	// the same instant is kept
+	m, err := Marshal(&Options{TimeLocation: newYork}, v)
+	assert.NoError(t, err)
+	assert.True(t, m.(map[string]interface{})["created"].(time.Time).Equal(summer))
+}
@@ -0,0 +1,3 @@
+// Package tomltest checks that the results of sheriff.Marshal with Options.KeyTag "toml" can be written by a TOML
+// encoder. It only holds tests and lives in its own module, so that sheriff itself doesn't depend on a TOML package.
+package tomltest
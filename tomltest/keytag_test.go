@@ -0,0 +1,67 @@
+package tomltest
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/peoplecentrix/sheriff"
+	"github.com/stretchr/testify/assert"
+)
+
+type Database struct {
+	Host     string  `toml:"host" json:"db_host"`
+	Port     int     `toml:"port"`
+	Password string  `toml:"password" groups:"admin"`
+	Replica  *string `toml:"replica,omitempty"`
+}
+
+type Limits struct {
+	Burst int `toml:"burst"`
+}
+
+type Config struct {
+	Limits
+	Name      string              `toml:"name" json:"title"`
+	Started   time.Time           `toml:"started"`
+	Stopped   *time.Time          `toml:"stopped"`
+	Database  Database            `toml:"database"`
+	Replicas  []Database          `toml:"replicas"`
+	Ports     map[int]string      `toml:"ports"`
+	Labels    map[string]*string  `toml:"labels"`
+	Fallback  *Database           `toml:"fallback"`
+	Extra     interface{}         `toml:"extra"`
+	Debug     bool                `toml:"debug,omitempty"`
+	Ignored   string              `toml:"-" json:"ignored"`
+	Untagged  float64             `json:"untagged"`
+	Overrides map[string]Database `toml:"overrides"`
+}
+
+func config() Config {
+	dev := "dev"
+	return Config{
+		Limits:    Limits{Burst: 10},
+		Name:      "api",
+		Started:   time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC),
+		Database:  Database{Host: "db", Port: 5432, Password: "secret"},
+		Replicas:  []Database{{Host: "r1", Port: 5433}},
+		Ports:     map[int]string{80: "http"},
+		Labels:    map[string]*string{"env": &dev, "unset": nil},
+		Ignored:   "ignored",
+		Untagged:  1.5,
+		Overrides: map[string]Database{"eu": {Host: "eu", Port: 1}},
+	}
+}
+
+func TestMarshal_KeyTagTOML(t *testing.T) {
+	v, err := sheriff.Marshal(&sheriff.Options{KeyTag: "toml", ExcludedAsNull: true}, config())
+	assert.NoError(t, err)
+
+	var b bytes.Buffer
+	assert.NoError(t, toml.NewEncoder(&b).Encode(v))
+	golden, err := os.ReadFile("testdata/keytag.toml")
+	assert.NoError(t, err)
+	assert.Equal(t, string(golden), b.String())
+}
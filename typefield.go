@@ -0,0 +1,77 @@
+package sheriff
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// typeNameRegistry holds the names registered using RegisterTypeName.
+var typeNameRegistry = struct {
+	sync.RWMutex
+	names map[reflect.Type]string
+}{names: make(map[reflect.Type]string)}
+
+// RegisterTypeName sets the name written to Options.TypeField for values of the struct type t, instead of its
+// short name (e.g. `Dog` for `animals.Dog`). Registering a type again replaces its name.
+//
+// RegisterTypeName is safe for concurrent use, but it's meant to be called during initialization.
+// It panics if t isn't a struct (or a pointer to one) or name is empty.
+func RegisterTypeName(t reflect.Type, name string) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("sheriff: RegisterTypeName of non-struct type %s", t))
+	}
+	if name == "" {
+		panic(fmt.Sprintf("sheriff: RegisterTypeName of %s with an empty name", t))
+	}
+
+	typeNameRegistry.Lock()
+	defer typeNameRegistry.Unlock()
+	typeNameRegistry.names[t] = name
+}
+
+// typeName returns the name written to Options.TypeField for values of the struct type t.
+func typeName(t reflect.Type) string {
+	typeNameRegistry.RLock()
+	name, ok := typeNameRegistry.names[t]
+	typeNameRegistry.RUnlock()
+	if ok {
+		return name
+	}
+	if t.Name() == "" {
+		// anonymous structs have no short name
+		return t.String()
+	}
+	return t.Name()
+}
+
+// TypeFieldError is returned if a struct which is to get Options.TypeField already has a key with that name.
+type TypeFieldError struct {
+	// Type is the struct type.
+	Type reflect.Type
+	// Key is Options.TypeField.
+	Key string
+	// Path is the dotted path of the struct, empty if it's the top level.
+	Path string
+}
+
+func (e TypeFieldError) Error() string {
+	msg := fmt.Sprintf("marshaller: key %q of %s collides with the type field", e.Key, e.Type)
+	if e.Path != "" {
+		msg += fmt.Sprintf(" (at %s)", e.Path)
+	}
+	return msg
+}
+
+// addTypeField adds Options.TypeField to the result of the struct frame f.
+func (s *marshalState) addTypeField(f *frame) error {
+	key := s.options.TypeField
+	if _, ok := f.dest[key]; ok {
+		return TypeFieldError{Type: f.t, Key: key, Path: s.currentPath()}
+	}
+	f.dest[key] = typeName(f.t)
+	return nil
+}
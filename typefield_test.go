@@ -0,0 +1,75 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TypeFieldRenamed struct {
+	Integer int `json:"integer" groups:"safe"`
+}
+
+type TypeFieldColliding struct {
+	Type string `json:"_type" groups:"safe"`
+}
+
+type TypeFieldModel struct {
+	Single interface{}            `json:"single" groups:"safe"`
+	Nested InterfaceableBeta      `json:"nested" groups:"safe"`
+	List   ArrayOfInterfaceable   `json:"list" groups:"safe"`
+	Map    map[string]interface{} `json:"map" groups:"safe"`
+	Ptrs   []interface{}          `json:"ptrs" groups:"safe"`
+}
+
+func TestMarshal_TypeField(t *testing.T) {
+	RegisterTypeName(reflect.TypeOf(&TypeFieldRenamed{}), "renamed")
+
+	model := TypeFieldModel{
+		Single: InterfaceableBeta{1, "secret"},
+		Nested: InterfaceableBeta{2, "secret"},
+		List: ArrayOfInterfaceable{
+			InterfaceableBeta{3, "secret"},
+			InterfaceableCharlie{4, "secret"},
+			"plain",
+		},
+		Map:  map[string]interface{}{"a": InterfaceableCharlie{5, "secret"}, "b": map[string]interface{}{"c": 6}},
+		Ptrs: []interface{}{&TypeFieldRenamed{7}, (*TypeFieldRenamed)(nil)},
+	}
+	expected := `{"list":[{"_type":"InterfaceableBeta","integer":3},{"_type":"InterfaceableCharlie","integer":4},"plain"],` +
+		`"map":{"a":{"_type":"InterfaceableCharlie","integer":5},"b":{"c":6}},` +
+		`"nested":{"integer":2},"ptrs":[{"_type":"renamed","integer":7},null],` +
+		`"single":{"_type":"InterfaceableBeta","integer":1}}`
+	o := &Options{Groups: []string{"safe"}, TypeField: "_type"}
+
+	v, err := Marshal(o, model)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(actual))
+
+	all, err := MarshalAll(model, map[string]*Options{"typed": o, "untyped": {Groups: []string{"safe"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, v, all["typed"])
+	untyped, err := Marshal(&Options{Groups: []string{"safe"}}, model)
+	assert.NoError(t, err)
+	assert.Equal(t, untyped, all["untyped"])
+
+	// the data passed to Marshal isn't held by an interface of the model
+	v, err = Marshal(o, InterfaceableBeta{1, "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"integer": 1}, v)
+}
+
+func TestMarshal_TypeFieldCollision(t *testing.T) {
+	model := TypeFieldModel{List: ArrayOfInterfaceable{TypeFieldColliding{Type: "mine"}}}
+	_, err := Marshal(&Options{Groups: []string{"safe"}, TypeField: "_type"}, model)
+	assert.EqualError(t, err, `marshaller: key "_type" of sheriff.TypeFieldColliding collides with the type field (at list.0)`)
+}
+
+func TestRegisterTypeName_Invalid(t *testing.T) {
+	assert.Panics(t, func() { RegisterTypeName(reflect.TypeOf(1), "int") })
+	assert.Panics(t, func() { RegisterTypeName(reflect.TypeOf(TypeFieldRenamed{}), "") })
+}
@@ -0,0 +1,281 @@
+package sheriff
+
+import (
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// typeInterfaces is a bitmask of the interfaces marshalValue looks for.
+type typeInterfaces uint16
+
+const (
+	implMarshaller typeInterfaces = 1 << iota
+	implUnwrapper
+	implJSONMarshaler
+	implTextMarshaler
+	implStringer
+	implValuer
+	implBinaryMarshaler
+	implComputedFields
+	implTextAppender
+)
+
+// implMarshalerMethod are the interfaces of types which are left to their own marshalling by default,
+// see Options.InterfacePreference.
+const implMarshalerMethod = implJSONMarshaler | implTextMarshaler | implTextAppender | implStringer
+
+// textAppender is encoding.TextAppender, which is only part of the standard library since Go 1.24.
+type textAppender interface {
+	AppendText(b []byte) ([]byte, error)
+}
+
+var interfaceTypes = [...]struct {
+	flag typeInterfaces
+	typ  reflect.Type
+}{
+	{implMarshaller, reflect.TypeOf((*Marshaller)(nil)).Elem()},
+	{implUnwrapper, reflect.TypeOf((*Unwrapper)(nil)).Elem()},
+	{implJSONMarshaler, reflect.TypeOf((*json.Marshaler)(nil)).Elem()},
+	{implTextMarshaler, reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()},
+	{implStringer, reflect.TypeOf((*fmt.Stringer)(nil)).Elem()},
+	{implValuer, reflect.TypeOf((*driver.Valuer)(nil)).Elem()},
+	{implBinaryMarshaler, reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()},
+	{implComputedFields, reflect.TypeOf((*ComputedFields)(nil)).Elem()},
+	{implTextAppender, reflect.TypeOf((*textAppender)(nil)).Elem()},
+}
+
+// syncKind identifies the types of sync and sync/atomic which are marshalled by their contents, see loadSync.
+type syncKind uint8
+
+const (
+	notSync syncKind = iota
+	// syncMap is sync.Map.
+	syncMap
+	// atomicValue are the types of sync/atomic with a Load method, e.g. atomic.Int64 or atomic.Value.
+	atomicValue
+)
+
+// typeInfo describes which interfaces a type implements. value holds the interfaces implemented by the type
+// itself, pointer the ones implemented by a pointer to it, i.e. including methods with pointer receivers.
+// For pointer types, both are the same.
+type typeInfo struct {
+	value   typeInterfaces
+	pointer typeInterfaces
+	// sync is the syncKind of the type, or of the type pointed to for pointer types.
+	sync syncKind
+}
+
+// typeInfos caches the typeInfo of every type seen by typeInfoOf.
+var typeInfos sync.Map
+
+// typeInfoOf returns the typeInfo of the non-interface type t.
+func typeInfoOf(t reflect.Type) typeInfo {
+	if info, ok := typeInfos.Load(t); ok {
+		return info.(typeInfo)
+	}
+	info := typeInfo{value: implementedInterfaces(t)}
+	if t.Kind() == reflect.Ptr {
+		info.pointer = info.value
+		info.sync = syncKindOf(t.Elem())
+	} else {
+		info.pointer = implementedInterfaces(reflect.PointerTo(t))
+		info.sync = syncKindOf(t)
+	}
+	typeInfos.Store(t, info)
+	return info
+}
+
+// syncKindOf returns the syncKind of t.
+func syncKindOf(t reflect.Type) syncKind {
+	if t.Kind() != reflect.Struct {
+		return notSync
+	}
+	switch t.PkgPath() {
+	case "sync":
+		if t.Name() == "Map" {
+			return syncMap
+		}
+	case "sync/atomic":
+		if m, ok := reflect.PointerTo(t).MethodByName("Load"); ok && m.Type.NumIn() == 1 && m.Type.NumOut() == 1 {
+			return atomicValue
+		}
+	}
+	return notSync
+}
+
+func implementedInterfaces(t reflect.Type) typeInterfaces {
+	var implemented typeInterfaces
+	if t.NumMethod() == 0 {
+		return implemented
+	}
+	for _, it := range interfaceTypes {
+		if t.Implements(it.typ) {
+			implemented |= it.flag
+		}
+	}
+	return implemented
+}
+
+// receiver returns the value to call the methods of one of the interfaces in mask on. Methods with value
+// receivers are called on v itself, methods with pointer receivers on a pointer to v. ok is false if v
+// implements none of the interfaces.
+func receiver(v reflect.Value, info typeInfo, mask typeInterfaces) (val interface{}, ok bool) {
+	if info.value&mask != 0 {
+		return v.Interface(), true
+	}
+	if info.pointer&mask != 0 {
+		return pointerInterface(v), true
+	}
+	return nil, false
+}
+
+// pointerInterface returns a pointer to the value of v as interface{}, so that methods with pointer receivers
+// can be called. If v isn't addressable, the pointer refers to a copy.
+func pointerInterface(v reflect.Value) interface{} {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
+
+// fieldInfo holds the parsed tags of a struct field, which don't depend on the options.
+type fieldInfo struct {
+	field reflect.StructField
+	// jsonName is the name given by the json tag, empty if there is none.
+	jsonName    string
+	jsonOpts    tagOptions
+	sheriffOpts tagOptions
+	// embedded reports whether the field is an anonymous struct field without json name,
+	// whose children are brought to the top.
+	embedded bool
+	// groups are the groups returned by fieldGroups. They're shared and must not be modified.
+	groups []string
+	// writeGroups are the groups which may write the field, see ValidatePatch.
+	writeGroups []string
+	// groupsErr is the error returned by fieldGroups if strict.
+	groupsErr error
+	// unknownGroupErr is the UnknownGroupError of groups which aren't registered, see MustRegisterGroups.
+	unknownGroupErr error
+	// groupsIf is the parsed groups_if tag, nil if there is none.
+	groupsIf    *groupsCondition
+	groupsIfErr error
+	// maxLen is the maxlen option of the sheriff tag, -1 if it's not set.
+	maxLen    int
+	maxLenErr error
+	// addressKind is reflect.Uintptr or reflect.UnsafePointer if the field holds one of them (possibly through
+	// pointers) and implements none of the interfaces looked for, see Options.AllowUintptr.
+	addressKind reflect.Kind
+	// ref is the ref option of the sheriff tag, see Options.Expand.
+	ref string
+	// pii reports whether the field is tagged `pii:"hash"`, see Options.PIIHasher.
+	pii    bool
+	piiErr error
+	// mask is the parsed mask tag, nil if there is none, see RegisterMask.
+	mask *fieldMask
+	// precision is the precision tag, -1 if it's not set.
+	precision    int
+	precisionErr error
+	// inline reports whether the field has the inline option of the sheriff tag, see Options.InlineMapsWin.
+	inline    bool
+	inlineErr error
+	// float reports whether the field holds a float (possibly through pointers) without any of the interfaces
+	// looked for, see Options.FloatPrecision.
+	float bool
+	// deprecated reports whether the field has a deprecated tag, whose value is deprecation, see
+	// Options.OnDeprecated.
+	deprecated  bool
+	deprecation string
+}
+
+// addressKindOf returns the kind of t if it's an uintptr or unsafe.Pointer (or a pointer to one) without any of
+// the interfaces looked for, or reflect.Invalid otherwise.
+func addressKindOf(t reflect.Type) reflect.Kind {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if k := t.Kind(); (k == reflect.Uintptr || k == reflect.UnsafePointer) && typeInfoOf(t).pointer == 0 {
+		return k
+	}
+	return reflect.Invalid
+}
+
+// structInfo holds the fields of a struct type.
+type structInfo struct {
+	// version is the version of fieldGroupsRegistry the fields were parsed at, which also changes with the
+	// groups registered using MustRegisterGroups.
+	version uint64
+	fields  []fieldInfo
+	// exported reports whether the struct has any exported fields.
+	exported bool
+	// inline reports whether the struct has any fields with the inline option of the sheriff tag.
+	inline bool
+}
+
+// structInfos caches the structInfo of every type seen by fieldInfosOf.
+var structInfos sync.Map
+
+// fieldInfosOf returns the fieldInfo of every field of the struct type t, in the order of the fields.
+func fieldInfosOf(t reflect.Type) []fieldInfo {
+	return structInfoOf(t).fields
+}
+
+// structInfoOf returns the structInfo of the struct type t.
+func structInfoOf(t reflect.Type) *structInfo {
+	version := fieldGroupsRegistry.version.Load()
+	if info, ok := structInfos.Load(t); ok && info.(*structInfo).version == version {
+		return info.(*structInfo)
+	}
+
+	fields := make([]fieldInfo, t.NumField())
+	exported, inline := false, false
+	for i := range fields {
+		field := t.Field(i)
+		jsonName, jsonOpts := parseTag(field.Tag.Get("json"))
+		f := fieldInfo{
+			field:       field,
+			jsonName:    jsonName,
+			jsonOpts:    jsonOpts,
+			sheriffOpts: parseSheriffTag(field),
+			// an anonymous field with a json name is treated like a named field, same as encoding/json does
+			embedded: jsonName == "" && isEmbeddedStruct(field),
+			maxLen:   -1,
+		}
+		f.groups, _ = fieldGroups(t, field, false)
+		_, f.groupsErr = fieldGroups(t, field, true)
+		f.writeGroups, _ = fieldGroupsWith(t, field, AccessWrite, false)
+		f.unknownGroupErr = unknownFieldGroup(t, field)
+		f.groupsIf, f.groupsIfErr = parseGroupsIfTag(t, field)
+		if value, ok := f.sheriffOpts.Value("maxlen"); ok {
+			if n, err := strconv.Atoi(value); err != nil || n < 0 {
+				f.maxLenErr = fmt.Errorf("marshaller: invalid maxlen %q of field %s of %s", value, field.Name, t)
+			} else {
+				f.maxLen = n
+			}
+		}
+		f.addressKind = addressKindOf(field.Type)
+		f.ref, _ = f.sheriffOpts.Value("ref")
+		f.pii, f.piiErr = parsePIITag(t, field)
+		f.mask = parseMaskTag(t, field)
+		f.precision, f.precisionErr = parsePrecisionTag(t, field)
+		f.float = isPlainFloatType(field.Type)
+		f.deprecation, f.deprecated = field.Tag.Lookup("deprecated")
+		f.inline, f.inlineErr = parseInlineTag(t, field, f.sheriffOpts)
+		if f.inline {
+			inline = true
+		}
+		fields[i] = f
+		if field.IsExported() {
+			exported = true
+		}
+	}
+	info := &structInfo{version: version, fields: fields, exported: exported, inline: inline}
+	structInfos.Store(t, info)
+	return info
+}
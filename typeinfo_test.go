@@ -0,0 +1,52 @@
+package sheriff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ValueStringer struct{}
+
+func (ValueStringer) String() string { return "value" }
+
+type PointerTextMarshaler struct{}
+
+func (*PointerTextMarshaler) MarshalText() ([]byte, error) { return []byte("pointer"), nil }
+
+func TestTypeInfoOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      reflect.Type
+		expected typeInfo
+	}{
+		{"plain struct", reflect.TypeOf(AModel{}), typeInfo{}},
+		{"value receiver", reflect.TypeOf(ValueStringer{}), typeInfo{value: implStringer, pointer: implStringer}},
+		{"pointer receiver", reflect.TypeOf(PointerTextMarshaler{}), typeInfo{pointer: implTextMarshaler}},
+		{"pointer type", reflect.TypeOf(&PointerTextMarshaler{}), typeInfo{value: implTextMarshaler, pointer: implTextMarshaler}},
+		{"marshaller", reflect.TypeOf(IsMarshaller{}), typeInfo{value: implMarshaller, pointer: implMarshaller}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, typeInfoOf(test.typ))
+			// cached
+			assert.Equal(t, test.expected, typeInfoOf(test.typ))
+		})
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	v := reflect.ValueOf(PointerTextMarshaler{})
+	val, ok := receiver(v, typeInfoOf(v.Type()), implMarshalerMethod)
+	assert.True(t, ok)
+	assert.IsType(t, &PointerTextMarshaler{}, val)
+
+	v = reflect.ValueOf(ValueStringer{})
+	val, ok = receiver(v, typeInfoOf(v.Type()), implMarshalerMethod)
+	assert.True(t, ok)
+	assert.IsType(t, ValueStringer{}, val)
+
+	_, ok = receiver(v, typeInfoOf(v.Type()), implUnwrapper)
+	assert.False(t, ok)
+}
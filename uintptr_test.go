@@ -0,0 +1,108 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type UintptrHandle uintptr
+
+func (h UintptrHandle) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("handle-%d", uintptr(h))), nil
+}
+
+type UintptrInner struct {
+	Name   string         `json:"name" groups:"api"`
+	Handle uintptr        `json:"handle" groups:"api"`
+	Ptr    unsafe.Pointer `json:"ptr" groups:"api"`
+}
+
+type UintptrModel struct {
+	Name      string                    `json:"name" groups:"api"`
+	Handle    uintptr                   `json:"handle" groups:"api"`
+	HandlePtr *uintptr                  `json:"handle_ptr" groups:"api"`
+	Ptr       unsafe.Pointer            `json:"ptr" groups:"api"`
+	Named     UintptrHandle             `json:"named" groups:"api"`
+	Inner     UintptrInner              `json:"inner" groups:"api"`
+	Handles   []uintptr                 `json:"handles" groups:"api"`
+	Ptrs      map[string]unsafe.Pointer `json:"ptrs" groups:"api"`
+	Any       interface{}               `json:"any" groups:"api"`
+	Anys      []interface{}             `json:"anys" groups:"api"`
+}
+
+func uintptrModel() UintptrModel {
+	handle := uintptr(42)
+	x := 1
+	return UintptrModel{
+		Name:      "file",
+		Handle:    handle,
+		HandlePtr: &handle,
+		Ptr:       unsafe.Pointer(&x),
+		Named:     7,
+		Inner:     UintptrInner{Name: "inner", Handle: 3, Ptr: unsafe.Pointer(&x)},
+		Handles:   []uintptr{1, 2},
+		Ptrs:      map[string]unsafe.Pointer{"x": unsafe.Pointer(&x)},
+		Any:       handle,
+		Anys:      []interface{}{handle, unsafe.Pointer(&x), "s"},
+	}
+}
+
+func TestMarshal_Uintptr(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  *Options
+		expected string
+	}{
+		{
+			name:     "default",
+			options:  &Options{Groups: []string{"api"}},
+			expected: `{"any":null,"anys":[null,null,"s"],"handles":[null,null],"inner":{"name":"inner"},"name":"file","named":"handle-7","ptrs":{"x":null}}`,
+		},
+		{
+			name:     "allowed",
+			options:  &Options{Groups: []string{"api"}, AllowUintptr: true},
+			expected: `{"any":42,"anys":[42,null,"s"],"handle":42,"handle_ptr":42,"handles":[1,2],"inner":{"handle":3,"name":"inner"},"name":"file","named":"handle-7","ptrs":{"x":null}}`,
+		},
+		{
+			name:     "excluded as null",
+			options:  &Options{Groups: []string{"other"}, ExcludedAsNull: true},
+			expected: `{"any":null,"anys":null,"handles":null,"inner":null,"name":null,"named":null,"ptrs":null}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := Marshal(test.options, uintptrModel())
+			assert.NoError(t, err)
+			actual, err := json.Marshal(v)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			appended, err := MarshalAppend(nil, test.options, uintptrModel())
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(appended))
+
+			all, err := MarshalAll(uintptrModel(), map[string]*Options{"a": test.options, "b": {Groups: []string{"api"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, v, all["a"])
+		})
+	}
+}
+
+func TestMarshal_UintptrRoot(t *testing.T) {
+	x := 1
+	v, err := Marshal(&Options{}, uintptr(1))
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	v, err = Marshal(&Options{AllowUintptr: true}, uintptr(1))
+	assert.NoError(t, err)
+	assert.Equal(t, uintptr(1), v)
+
+	v, err = Marshal(&Options{AllowUintptr: true}, unsafe.Pointer(&x))
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
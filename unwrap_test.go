@@ -0,0 +1,88 @@
+package sheriff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Optional is a generic wrapper like the ones commonly used for optional fields.
+type Optional[T any] struct {
+	value   T
+	present bool
+}
+
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{value: value, present: true}
+}
+
+func (o Optional[T]) UnwrapSheriff() (interface{}, bool) {
+	return o.value, o.present
+}
+
+// MarshalJSON makes sure the wrapper isn't left to encoding/json.
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.present {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+type OptionalProfile struct {
+	Name   string `json:"name" groups:"public"`
+	Secret string `json:"secret" groups:"private"`
+}
+
+type OptionalModel struct {
+	Count      Optional[int]               `json:"count"`
+	CountOmit  Optional[int]               `json:"count_omit,omitempty"`
+	ZeroOmit   Optional[int]               `json:"zero_omit,omitempty"`
+	Absent     Optional[string]            `json:"absent"`
+	AbsentOmit Optional[string]            `json:"absent_omit,omitempty"`
+	Profile    Optional[OptionalProfile]   `json:"profile"`
+	ProfilePtr *Optional[OptionalProfile]  `json:"profile_ptr"`
+	NilPtr     *Optional[OptionalProfile]  `json:"nil_ptr"`
+	Profiles   []Optional[OptionalProfile] `json:"profiles"`
+}
+
+func TestMarshal_Unwrapper(t *testing.T) {
+	profile := Some(OptionalProfile{Name: "alice", Secret: "s3cr3t"})
+	v := OptionalModel{
+		Count:      Some(3),
+		CountOmit:  Some(4),
+		ZeroOmit:   Some(0),
+		Profile:    profile,
+		ProfilePtr: &profile,
+		Profiles:   []Optional[OptionalProfile]{profile, {}},
+	}
+
+	actualMap, err := Marshal(&Options{Groups: []string{"public"}}, v)
+	assert.NoError(t, err)
+	actual, err := json.Marshal(actualMap)
+	assert.NoError(t, err)
+
+	expected, err := json.Marshal(map[string]interface{}{
+		"count":       3,
+		"count_omit":  4,
+		"zero_omit":   0,
+		"absent":      nil,
+		"profile":     map[string]interface{}{"name": "alice"},
+		"profile_ptr": map[string]interface{}{"name": "alice"},
+		"nil_ptr":     nil,
+		"profiles":    []interface{}{map[string]interface{}{"name": "alice"}, nil},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, string(expected), string(actual))
+}
+
+func TestMarshal_UnwrapperTopLevel(t *testing.T) {
+	actualMap, err := Marshal(&Options{Groups: []string{"public"}}, Some(OptionalProfile{Name: "alice", Secret: "s3cr3t"}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "alice"}, actualMap)
+
+	actualMap, err = Marshal(&Options{}, Optional[int]{})
+	assert.NoError(t, err)
+	assert.Nil(t, actualMap)
+}
@@ -0,0 +1,82 @@
+package sheriff
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Validate checks the options for invalid values and returns an error describing all problems found,
+// or nil if the options are valid. Options which have no effect in combination with others are reported too:
+// ExcludedAsNull with a KeyTag omitting null values, DepthOverflowField and OmitDepthOverflow without
+// MaxRenderDepth, and a MaxRenderDepth which isn't below MaxDepth, as the latter fails before it's reached.
+//
+// Marshal doesn't call Validate, as it tolerates most of these problems (e.g. empty groups are dropped).
+// It's meant to be called once where options are built from configuration or user input.
+func (o *Options) Validate() error {
+	var errs []error
+	_, glob := o.GroupMatcher.(globGroups)
+	for i, group := range o.Groups {
+		if strings.TrimSpace(group) == "" {
+			errs = append(errs, fmt.Errorf("marshaller: invalid options: Groups[%d] is empty", i))
+		} else if strings.TrimSpace(group) != group {
+			errs = append(errs, fmt.Errorf("marshaller: invalid options: Groups[%d] %q has surrounding spaces", i, group))
+		} else if strings.Contains(group, ",") {
+			errs = append(errs, fmt.Errorf("marshaller: invalid options: Groups[%d] %q contains a comma", i, group))
+		} else if _, err := path.Match(group, ""); glob && err != nil {
+			errs = append(errs, fmt.Errorf("marshaller: invalid options: Groups[%d] %q is a malformed pattern", i, group))
+		} else if unknownRequestedGroup([]string{group}, o.GroupMatcher) != nil {
+			errs = append(errs, fmt.Errorf("marshaller: invalid options: Groups[%d] %q isn't registered", i, group))
+		}
+	}
+	errs = append(errs, validateKeyPatterns("OmitFields", o.OmitFields)...)
+	errs = append(errs, validateKeyPatterns("OnlyFields", o.OnlyFields)...)
+	if o.MaxDepth < 0 {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: MaxDepth %d is negative", o.MaxDepth))
+	}
+	if strings.Contains(o.FlatSeparator, `\`) {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: FlatSeparator %q contains the escape character \\", o.FlatSeparator))
+	}
+	if o.ValuesNotation != DottedNotation && o.ValuesNotation != BracketNotation {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: ValuesNotation %d is unknown", o.ValuesNotation))
+	}
+	if o.UntaggedKeyStyle < AsIsKeyStyle || o.UntaggedKeyStyle > LowerAllKeyStyle {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: UntaggedKeyStyle %d is unknown", o.UntaggedKeyStyle))
+	}
+	// reflect.StructTag.Get can't find keys containing these
+	if strings.ContainsAny(o.KeyTag, " \":") {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: KeyTag %q isn't a valid tag key", o.KeyTag))
+	}
+	if o.ExcludedAsNull && o.omitsNil() {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: ExcludedAsNull has no effect with KeyTag %q, which omits null values", o.KeyTag))
+	}
+	if o.MaxRenderDepth == 0 && o.DepthOverflowField != "" {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: DepthOverflowField %q has no effect without MaxRenderDepth", o.DepthOverflowField))
+	}
+	if o.MaxRenderDepth == 0 && o.OmitDepthOverflow {
+		errs = append(errs, errors.New("marshaller: invalid options: OmitDepthOverflow has no effect without MaxRenderDepth"))
+	}
+	if o.MaxDepth > 0 && o.MaxRenderDepth >= o.MaxDepth {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: MaxRenderDepth %d isn't below MaxDepth %d, which fails first", o.MaxRenderDepth, o.MaxDepth))
+	}
+	if o.AuthorizerMode > AuthorizerRestricts {
+		errs = append(errs, fmt.Errorf("marshaller: invalid options: AuthorizerMode %d is unknown", o.AuthorizerMode))
+	}
+	return errors.Join(errs...)
+}
+
+// validateKeyPatterns checks the entries of OmitFields or OnlyFields, which silently match nothing if a key is empty.
+func validateKeyPatterns(name string, entries []string) []error {
+	var errs []error
+	for i, entry := range entries {
+		keys := strings.TrimPrefix(entry, rootPrefix)
+		if keys == "" {
+			errs = append(errs, fmt.Errorf("marshaller: invalid options: %s[%d] %q is empty", name, i, entry))
+		} else if slices.Contains(strings.Split(keys, "."), "") {
+			errs = append(errs, fmt.Errorf("marshaller: invalid options: %s[%d] %q has an empty key", name, i, entry))
+		}
+	}
+	return errs
+}
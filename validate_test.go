@@ -0,0 +1,119 @@
+package sheriff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	assert.NoError(t, (&Options{}).Validate())
+	assert.NoError(t, (&Options{
+		Groups:         []string{"api", "personal"},
+		MaxDepth:       10,
+		FlatSeparator:  "/",
+		ValuesNotation: BracketNotation,
+		OmitFields:     []string{"password", "$.user.token"},
+		OnlyFields:     []string{"id", "items.name"},
+	}).Validate())
+	assert.NoError(t, (&Options{MaxDepth: 4, MaxRenderDepth: 3, DepthOverflowField: "id", OmitDepthOverflow: true}).Validate())
+	assert.NoError(t, (&Options{KeyTag: "yaml", ExcludedAsNull: true}).Validate())
+
+	tests := map[string]struct {
+		options  *Options
+		expected string
+	}{
+		"empty group": {
+			options:  &Options{Groups: []string{"api", ""}},
+			expected: "marshaller: invalid options: Groups[1] is empty",
+		},
+		"blank group": {
+			options:  &Options{Groups: []string{" "}},
+			expected: "marshaller: invalid options: Groups[0] is empty",
+		},
+		"spaced group": {
+			options:  &Options{Groups: []string{" api"}},
+			expected: `marshaller: invalid options: Groups[0] " api" has surrounding spaces`,
+		},
+		"comma in group": {
+			options:  &Options{Groups: []string{"api,personal"}},
+			expected: `marshaller: invalid options: Groups[0] "api,personal" contains a comma`,
+		},
+		"malformed group pattern": {
+			options:  &Options{Groups: []string{"admin:[users"}, GroupMatcher: GlobGroups},
+			expected: `marshaller: invalid options: Groups[0] "admin:[users" is a malformed pattern`,
+		},
+		"negative max depth": {
+			options:  &Options{MaxDepth: -1},
+			expected: "marshaller: invalid options: MaxDepth -1 is negative",
+		},
+		"escape in flat separator": {
+			options:  &Options{FlatSeparator: `\`},
+			expected: `marshaller: invalid options: FlatSeparator "\\" contains the escape character \`,
+		},
+		"unknown values notation": {
+			options:  &Options{ValuesNotation: 3},
+			expected: "marshaller: invalid options: ValuesNotation 3 is unknown",
+		},
+		"unknown authorizer mode": {
+			options:  &Options{AuthorizerMode: 3},
+			expected: "marshaller: invalid options: AuthorizerMode 3 is unknown",
+		},
+		"unknown key style": {
+			options:  &Options{UntaggedKeyStyle: 5},
+			expected: "marshaller: invalid options: UntaggedKeyStyle 5 is unknown",
+		},
+		"empty omitted field": {
+			options:  &Options{OmitFields: []string{"password", ""}},
+			expected: `marshaller: invalid options: OmitFields[1] "" is empty`,
+		},
+		"empty rooted omitted field": {
+			options:  &Options{OmitFields: []string{"$."}},
+			expected: `marshaller: invalid options: OmitFields[0] "$." is empty`,
+		},
+		"empty key in omitted field": {
+			options:  &Options{OmitFields: []string{"user..password"}},
+			expected: `marshaller: invalid options: OmitFields[0] "user..password" has an empty key`,
+		},
+		"empty only field": {
+			options:  &Options{OnlyFields: []string{""}},
+			expected: `marshaller: invalid options: OnlyFields[0] "" is empty`,
+		},
+		"empty key in only field": {
+			options:  &Options{OnlyFields: []string{"id", "a."}},
+			expected: `marshaller: invalid options: OnlyFields[1] "a." has an empty key`,
+		},
+		"invalid key tag": {
+			options:  &Options{KeyTag: "toml:"},
+			expected: `marshaller: invalid options: KeyTag "toml:" isn't a valid tag key`,
+		},
+		"excluded as null with toml": {
+			options:  &Options{KeyTag: "toml", ExcludedAsNull: true},
+			expected: `marshaller: invalid options: ExcludedAsNull has no effect with KeyTag "toml", which omits null values`,
+		},
+		"depth overflow field without render depth": {
+			options:  &Options{DepthOverflowField: "id"},
+			expected: `marshaller: invalid options: DepthOverflowField "id" has no effect without MaxRenderDepth`,
+		},
+		"omitted depth overflow without render depth": {
+			options:  &Options{OmitDepthOverflow: true},
+			expected: "marshaller: invalid options: OmitDepthOverflow has no effect without MaxRenderDepth",
+		},
+		"render depth beyond max depth": {
+			options:  &Options{MaxDepth: 3, MaxRenderDepth: 3, DepthOverflowField: "id"},
+			expected: "marshaller: invalid options: MaxRenderDepth 3 isn't below MaxDepth 3, which fails first",
+		},
+	}
+
+	for name, test := range tests {
+		err := test.options.Validate()
+		if assert.Error(t, err, name) {
+			assert.Equal(t, test.expected, err.Error(), name)
+		}
+	}
+}
+
+func TestOptions_ValidateMultiple(t *testing.T) {
+	err := (&Options{Groups: []string{""}, MaxDepth: -1}).Validate()
+	assert.EqualError(t, err, "marshaller: invalid options: Groups[0] is empty\nmarshaller: invalid options: MaxDepth -1 is negative")
+}
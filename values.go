@@ -0,0 +1,125 @@
+package sheriff
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// ValuesNotation determines how MarshalValues builds the keys of nested objects.
+type ValuesNotation int
+
+const (
+	// DottedNotation joins the keys of nested objects with a dot, e.g. `address.city`.
+	DottedNotation ValuesNotation = iota
+	// BracketNotation wraps the keys of nested objects in brackets, e.g. `address[city]`.
+	BracketNotation
+)
+
+// MarshalValues marshals data like Marshal does and converts the result into url.Values,
+// e.g. to send it as `application/x-www-form-urlencoded`.
+//
+// Keys are the same as the ones Marshal produces. Nested objects use the notation configured in
+// Options.ValuesNotation, slices repeat their key for every element. Primitives are rendered with
+// strconv, except floats, which are formatted like in the JSON output (e.g. `1500000` rather than `1.5e+06`).
+// Types implementing encoding.TextMarshaler or encoding.TextAppender (e.g. time.Time) are rendered with
+// MarshalText or AppendText. Nil values are omitted.
+func MarshalValues(options *Options, data interface{}) (url.Values, error) {
+	intermediate, err := Marshal(options, data)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(url.Values)
+	if err := addValues(values, options.ValuesNotation, "", intermediate); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func addValues(values url.Values, notation ValuesNotation, prefix string, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		for key, value := range v {
+			if err := addValues(values, notation, valuesKey(notation, prefix, key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		for _, value := range v {
+			if err := addValues(values, notation, prefix, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case encoding.TextMarshaler, textAppender:
+		b, err := marshalText(v)
+		if err != nil {
+			return err
+		}
+		values.Add(prefix, string(b))
+		return nil
+	case json.Number:
+		values.Add(prefix, v.String())
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		values.Add(prefix, rv.String())
+		return nil
+	case reflect.Bool:
+		values.Add(prefix, strconv.FormatBool(rv.Bool()))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		values.Add(prefix, strconv.FormatInt(rv.Int(), 10))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		values.Add(prefix, strconv.FormatUint(rv.Uint(), 10))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		values.Add(prefix, string(appendFloat(nil, rv.Float(), rv.Type().Bits())))
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+
+	// anything else (e.g. types implementing json.Marshaler or fmt.Stringer) is converted using its JSON representation
+	if _, ok := v.(json.Marshaler); !ok {
+		if s, ok := v.(fmt.Stringer); ok {
+			values.Add(prefix, s.String())
+			return nil
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return err
+	}
+	return addValues(values, notation, prefix, decoded)
+}
+
+func valuesKey(notation ValuesNotation, prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	if notation == BracketNotation {
+		return prefix + "[" + key + "]"
+	}
+	return prefix + "." + key
+}
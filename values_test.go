@@ -0,0 +1,79 @@
+package sheriff
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ValuesItem struct {
+	Name string `json:"name" groups:"public"`
+}
+
+type ValuesModel struct {
+	Name      string       `json:"name" groups:"public"`
+	Secret    string       `json:"secret" groups:"private"`
+	Age       int          `json:"age" groups:"public"`
+	Score     float64      `json:"score" groups:"public"`
+	Active    bool         `json:"active" groups:"public"`
+	Tags      []string     `json:"tags" groups:"public"`
+	Address   FlatAddress  `json:"address" groups:"public"`
+	Items     []ValuesItem `json:"items" groups:"public"`
+	CreatedAt time.Time    `json:"created_at" groups:"public"`
+	Nil       *ValuesItem  `json:"nil" groups:"public"`
+}
+
+func valuesTestData(t *testing.T) ValuesModel {
+	createdAt, err := time.Parse(time.RFC3339, "2017-01-20T18:11:00Z")
+	assert.NoError(t, err)
+
+	return ValuesModel{
+		Name:      "alice",
+		Secret:    "secret",
+		Age:       42,
+		Score:     1.5,
+		Active:    true,
+		Tags:      []string{"a", "b"},
+		Address:   FlatAddress{City: "Zurich", Street: "Main"},
+		Items:     []ValuesItem{{"foo"}, {"bar"}},
+		CreatedAt: createdAt,
+	}
+}
+
+func TestMarshalValues(t *testing.T) {
+	actual, err := MarshalValues(&Options{Groups: []string{"public"}}, valuesTestData(t))
+	assert.NoError(t, err)
+
+	assert.Equal(t, url.Values{
+		"name":         {"alice"},
+		"age":          {"42"},
+		"score":        {"1.5"},
+		"active":       {"true"},
+		"tags":         {"a", "b"},
+		"address.city": {"Zurich"},
+		"items.name":   {"foo", "bar"},
+		"created_at":   {"2017-01-20T18:11:00Z"},
+	}, actual)
+}
+
+func TestMarshalValues_BracketNotation(t *testing.T) {
+	actual, err := MarshalValues(&Options{Groups: []string{"public", "private"}, ValuesNotation: BracketNotation}, valuesTestData(t))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"Zurich"}, actual["address[city]"])
+	assert.Equal(t, []string{"Main"}, actual["address[street]"])
+	assert.Equal(t, []string{"foo", "bar"}, actual["items[name]"])
+	assert.Equal(t, []string{"secret"}, actual["secret"])
+	assert.Equal(t, "address%5Bcity%5D=Zurich", url.Values{"address[city]": actual["address[city]"]}.Encode())
+}
+
+func TestMarshalValues_Floats(t *testing.T) {
+	actual, err := MarshalValues(&Options{}, map[string]interface{}{"price": 1500000.0, "rate": 0.0000001, "small": float32(0.25)})
+	assert.NoError(t, err)
+
+	// floats are formatted like in the JSON output
+	assert.Equal(t, url.Values{"price": {"1500000"}, "rate": {"1e-7"}, "small": {"0.25"}}, actual)
+	assert.Equal(t, "price=1500000&rate=1e-7&small=0.25", actual.Encode())
+}
@@ -0,0 +1,434 @@
+package sheriff
+
+import "reflect"
+
+// frameKind is the kind of value a frame marshals the elements of.
+type frameKind uint8
+
+const (
+	structFrame frameKind = iota
+	sliceFrame
+	mapFrame
+)
+
+// frame is a struct, slice or map whose elements are being marshalled.
+//
+// Instead of recursing into nested values, marshalValue pushes a frame onto marshalState.frames for every
+// struct, slice and map and run visits the elements of the topmost frame one after the other, in the same
+// order a recursive traversal would. This keeps deep data from growing the goroutine stack.
+type frame struct {
+	kind     frameKind
+	v        reflect.Value
+	t        reflect.Type
+	traverse bool
+
+	// pathLen, renderDepth and maxStringLen are the state of the marshalState before the frame was pushed,
+	// which is restored once it's done.
+	pathLen      int
+	renderDepth  int
+	maxStringLen int
+
+	// dest is the result of struct and map frames.
+	dest map[string]interface{}
+	// owners records the field which produced each key of a struct, see claimKey.
+	owners map[string]string
+	// computed reports whether the struct implements ComputedFields.
+	computed bool
+	// typed reports whether Options.TypeField is to be added to the struct, as it was reached through an interface.
+	typed bool
+	// inline are the results of the struct's inline map fields, which are merged once its fields are done.
+	inline []map[string]interface{}
+	// field is the struct field whose value is currently being marshalled.
+	field structField
+
+	// elems is the result of slice frames.
+	elems []interface{}
+	// overflow is the number of dropped slice elements, see Options.TruncateOverflow.
+	overflow int
+
+	// iter and key iterate over the entries of maps, unless keys holds the entries which are left after
+	// truncating it or the entries shared by MarshalAll, in which case values holds their values.
+	iter   *reflect.MapIter
+	key    reflect.Value
+	keys   []reflect.Value
+	values []reflect.Value
+	// keyString is the key of the map entry whose value is currently being marshalled.
+	keyString string
+	// keyed is the result of map frames whose keys aren't converted to strings, see Options.PreserveMapKeyTypes.
+	// keyValue is then the key of the map entry whose value is currently being marshalled.
+	keyed    map[interface{}]interface{}
+	keyValue interface{}
+
+	// index is the next field of a struct, the current element of a slice or the next key within keys.
+	index int
+}
+
+// push pushes a frame for the value v currently being marshalled and returns it. The frame is set up in
+// place, as frames are too large to be copied around cheaply.
+func (s *marshalState) push(kind frameKind, v reflect.Value, traverse bool) *frame {
+	s.frames = append(s.frames, frame{
+		kind:         kind,
+		v:            v,
+		traverse:     traverse,
+		pathLen:      len(s.path),
+		renderDepth:  s.renderDepth,
+		maxStringLen: s.maxStringLen,
+	})
+	s.renderDepth++
+	if len(s.frames) > s.maxFrames {
+		s.maxFrames = len(s.frames)
+	}
+	return &s.frames[len(s.frames)-1]
+}
+
+// pushStruct pushes a frame for the struct v, whose typeInfo (or the one of a pointer to it) is info.
+func (s *marshalState) pushStruct(v reflect.Value, info typeInfo) {
+	f := s.push(structFrame, v, false)
+	f.t = v.Type()
+	f.computed = info.pointer&implComputedFields != 0
+	f.typed = false
+	// the number of fields is an upper bound of the number of keys, except for anonymous structs brought to the top
+	f.dest = make(map[string]interface{}, f.t.NumField())
+	if s.options.ErrOnDuplicateKeys {
+		f.owners = make(map[string]string)
+	}
+}
+
+// pushSlice pushes a frame for the non-nil slice v.
+func (s *marshalState) pushSlice(v reflect.Value, traverse bool) error {
+	l := v.Len()
+	overflow := 0
+	if max := s.options.MaxSliceLen; max > 0 && l > max {
+		if !s.options.TruncateOverflow {
+			return LengthError{Kind: reflect.Slice, Len: l, Max: max, Path: s.currentPath()}
+		}
+		overflow = l - max
+		l = max
+	}
+	f := s.push(sliceFrame, v, traverse)
+	f.elems = make([]interface{}, l)
+	f.overflow = overflow
+	return nil
+}
+
+// pushMap pushes a frame for the non-empty map v.
+func (s *marshalState) pushMap(v reflect.Value, traverse bool) error {
+	if err := s.checkMapKey(v.Type()); err != nil {
+		return err
+	}
+	l := v.Len()
+	if max := s.options.MaxMapLen; max > 0 && l > max {
+		if !s.options.TruncateOverflow {
+			return LengthError{Kind: reflect.Map, Len: l, Max: max, Path: s.currentPath()}
+		}
+		keys, err := s.lowestMapKeys(v.MapKeys(), max)
+		if err != nil {
+			return err
+		}
+		preserve := s.preservesMapKeys(v.Type())
+		f := s.push(mapFrame, v, traverse)
+		f.keys = keys
+		if preserve {
+			f.keyed = make(map[interface{}]interface{}, max+1)
+		} else {
+			f.dest = make(map[string]interface{}, max+1)
+		}
+		if s.options.OverflowKey != "" {
+			f.setEntry(s.options.OverflowKey, s.options.OverflowKey, l-max)
+		}
+		return nil
+	}
+
+	preserve := s.preservesMapKeys(v.Type())
+	f := s.push(mapFrame, v, traverse)
+	if preserve {
+		f.keyed = make(map[interface{}]interface{}, l)
+	} else {
+		f.dest = make(map[string]interface{}, l)
+	}
+	if s.shared != nil {
+		// MarshalAll looks up the entries once for all the frames of the map, see next
+		return nil
+	}
+	// unlike v.MapKeys(), iterating using a single key value doesn't copy every key
+	f.iter = v.MapRange()
+	f.key = reflect.New(v.Type().Key()).Elem()
+	return nil
+}
+
+// run marshals the elements of the frames above base until the frame at base is done, and returns its result.
+//
+// Elements which fail to marshal stop it, unless Options.ErrorPolicy allows to recover from the error, in which
+// case the element is skipped.
+func (s *marshalState) run(base int) (interface{}, error) {
+	for {
+		f := &s.frames[len(s.frames)-1]
+		child, traverse, ok, err := s.next(f)
+		if err != nil {
+			// next has already moved past the element
+			if s.recoverFrom(err) {
+				continue
+			}
+			return nil, s.unwind(base, err)
+		}
+
+		var result interface{}
+		if ok {
+			if s.done != nil {
+				if err := s.tickContext(); err != nil {
+					return nil, s.unwind(base, err)
+				}
+			}
+			var pending bool
+			result, pending, err = s.visit(child, traverse)
+			if err != nil {
+				if s.recoverFrom(err) {
+					s.skip(f)
+					continue
+				}
+				return nil, s.unwind(base, err)
+			}
+			if pending {
+				continue
+			}
+		} else {
+			if result, err = s.finish(f); err != nil {
+				return nil, s.unwind(base, err)
+			}
+			if len(s.frames) == base {
+				return result, nil
+			}
+			f = &s.frames[len(s.frames)-1]
+		}
+
+		if err := s.assign(f, result); err != nil {
+			if s.recoverFrom(err) {
+				continue
+			}
+			return nil, s.unwind(base, err)
+		}
+	}
+}
+
+// finish completes the frame f, whose elements are all done, removes it and returns its result.
+func (s *marshalState) finish(f *frame) (interface{}, error) {
+	if len(f.inline) > 0 {
+		s.mergeInline(f)
+	}
+	if f.computed {
+		if err := s.mergeComputedFields(f); err != nil && !s.recoverFrom(err) {
+			return nil, err
+		}
+	}
+	if f.typed {
+		if err := s.addTypeField(f); err != nil && !s.recoverFrom(err) {
+			return nil, err
+		}
+	}
+	return s.popFrame(), nil
+}
+
+// next returns the next element of f to be marshalled, with the path and the state set up for it.
+// ok is false if all elements are done.
+func (s *marshalState) next(f *frame) (child reflect.Value, traverse bool, ok bool, err error) {
+	switch f.kind {
+	case structFrame:
+		for {
+			field := &f.field
+			ok, err := s.nextField(f.t, f.v, &f.index, field)
+			if err != nil || !ok {
+				return reflect.Value{}, false, false, err
+			}
+			if field.excluded {
+				if err := s.claimKey(f.owners, f.t, field.name, field.field.Name); err != nil {
+					return reflect.Value{}, false, false, err
+				}
+				f.dest[field.name] = nil
+				continue
+			}
+
+			s.maxStringLen = field.maxStringLen
+			// anonymous structs brought to the top are rendered at the current level
+			if field.embedded {
+				s.renderDepth--
+			}
+			s.pushStructField(field, f.t)
+			return field.value, field.sheriffOpts.Contains("traverse"), true, nil
+		}
+	case sliceFrame:
+		if f.index == len(f.elems) {
+			return reflect.Value{}, false, false, nil
+		}
+		s.pushIndex(f.index)
+		return f.v.Index(f.index), f.traverse, true, nil
+	default:
+		for {
+			var key, value reflect.Value
+			if f.keys != nil {
+				if f.index == len(f.keys) {
+					return reflect.Value{}, false, false, nil
+				}
+				key = f.keys[f.index]
+				if f.values != nil {
+					value = f.values[f.index]
+				} else {
+					value = f.v.MapIndex(key)
+				}
+				f.index++
+			} else {
+				if f.iter == nil {
+					// MarshalAll only sets up the iterators of the maps which aren't run together with others
+					f.iter = f.v.MapRange()
+					f.key = reflect.New(f.v.Type().Key()).Elem()
+				}
+				if !f.iter.Next() {
+					return reflect.Value{}, false, false, nil
+				}
+				f.key.SetIterKey(f.iter)
+				key = f.key
+				value = f.iter.Value()
+			}
+
+			keyString, err := s.mapKeyString(key)
+			if err != nil {
+				return reflect.Value{}, false, false, err
+			}
+			if s.options.MapKeyFilter != nil && !s.options.MapKeyFilter(s.currentPath(), keyString) {
+				continue
+			}
+			if s.isKeyOmitted(keyString) {
+				continue
+			}
+			f.keyString = keyString
+			if f.keyed != nil {
+				f.keyValue = key.Interface()
+			}
+			s.pushKey(keyString)
+			return value, f.traverse, true, nil
+		}
+	}
+}
+
+// assign stores the result of the element of f returned by next, and restores the state.
+func (s *marshalState) assign(f *frame, result interface{}) error {
+	s.pop()
+	switch f.kind {
+	case structFrame:
+		if f.field.embedded {
+			s.renderDepth++
+		}
+		s.maxStringLen = f.maxStringLen
+		return s.assignField(f, result)
+	case sliceFrame:
+		f.elems[f.index] = result
+		f.index++
+	default:
+		if result != nil || !s.options.omitsNil() {
+			f.setEntry(f.keyValue, f.keyString, result)
+		}
+	}
+	return nil
+}
+
+// skip restores the state after the element of f returned by next failed to marshal, like assign does.
+// Slice elements are set to null, struct fields and map entries are omitted.
+func (s *marshalState) skip(f *frame) {
+	s.pop()
+	switch f.kind {
+	case structFrame:
+		if f.field.embedded {
+			s.renderDepth++
+		}
+		s.maxStringLen = f.maxStringLen
+	case sliceFrame:
+		f.elems[f.index] = nil
+		f.index++
+	}
+}
+
+// assignField stores the result of the struct field f.field.
+func (s *marshalState) assignField(f *frame, result interface{}) error {
+	if _, ok := result.(depthOverflowOmitted); ok {
+		return nil
+	}
+	if result == nil && s.options.omitsNil() {
+		return nil
+	}
+
+	// when a composition field we want to bring the child
+	// nodes to the top
+	nestedVal, ok := result.(map[string]interface{})
+	if f.field.inline {
+		// nil maps contribute nothing
+		if ok {
+			f.inline = append(f.inline, nestedVal)
+		}
+		return nil
+	}
+	if f.field.embedded && ok {
+		for key, value := range nestedVal {
+			if err := s.claimKey(f.owners, f.t, key, f.field.field.Name); err != nil {
+				return err
+			}
+			f.dest[key] = value
+		}
+		return nil
+	}
+	// a named anonymous struct field is nested like any other field, but omitted
+	// if it's omitempty and none of its fields are left after filtering
+	if f.field.field.Anonymous && ok && len(nestedVal) == 0 && s.omitEmpty && f.field.jsonOpts.Contains("omitempty") {
+		return nil
+	}
+	if s.options.OmitEmptyNested && ok && len(nestedVal) == 0 {
+		return nil
+	}
+	if keyed, isKeyed := result.(map[interface{}]interface{}); s.options.OmitEmptyNested && isKeyed && len(keyed) == 0 {
+		return nil
+	}
+	if err := s.claimKey(f.owners, f.t, f.field.name, f.field.field.Name); err != nil {
+		return err
+	}
+	f.dest[f.field.name] = result
+	return nil
+}
+
+// popFrame removes the topmost frame, which is done, and returns its result.
+func (s *marshalState) popFrame() interface{} {
+	f := &s.frames[len(s.frames)-1]
+	s.renderDepth = f.renderDepth
+
+	var result interface{}
+	if f.kind == sliceFrame {
+		if f.overflow > 0 && s.options.OverflowKey != "" {
+			f.elems = append(f.elems, map[string]interface{}{s.options.OverflowKey: f.overflow})
+		}
+		result = f.elems
+	} else if f.keyed != nil {
+		result = f.keyed
+	} else {
+		result = f.dest
+	}
+	s.frames = s.frames[:len(s.frames)-1]
+	return result
+}
+
+// unwind removes the frames above base after err occurred and restores the state to the one before
+// the frame at base was pushed.
+func (s *marshalState) unwind(base int, err error) error {
+	f := &s.frames[base]
+	s.path = s.path[:f.pathLen]
+	s.renderDepth = f.renderDepth
+	s.maxStringLen = f.maxStringLen
+	s.frames = s.frames[:base]
+	return err
+}
+
+// setEntry stores the value of a map entry of the map frame f under its key, which is key if f's keys are
+// preserved, or else keyString.
+func (f *frame) setEntry(key interface{}, keyString string, value interface{}) {
+	if f.keyed != nil {
+		f.keyed[key] = value
+		return
+	}
+	f.dest[keyString] = value
+}